@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/service"
+	"github.com/spf13/cobra"
+)
+
+func Catalog(version application.VersionConfig) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "catalog",
+		Short: "Manage the catalog of the backups",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	command.AddCommand(catalogRebuild(version))
+	return command
+}
+
+func catalogRebuild(version application.VersionConfig) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "rebuild",
+		Short: "Recreate the backups recorded by the catalog entries of a drive",
+		Long:  "This command will read the catalog entries stored with each upload on the given drive and record again their backups and drive files, keeping their ids and creation dates. It is used after the database was lost, the drive files already recorded being skipped.",
+		Run: func(cmd *cobra.Command, args []string) {
+			configFile, err := cmd.Flags().GetString("config")
+			if err != nil {
+				log.Fatal(err)
+			}
+			label, err := cmd.Flags().GetString("drive")
+			if err != nil {
+				log.Fatal(err)
+			}
+			if label == "" {
+				log.Fatal("--drive is required")
+			}
+
+			app, err := CreateAppFromYml(configFile)
+			if err != nil {
+				log.Fatalf("Error creating app from config => %v", err)
+			}
+			app.Mode = application.APP_MODE_CLI
+			app.Version = version
+			ctx, stop := InterruptContext()
+			defer stop()
+
+			output, err := service.RebuildCatalog(ctx, app, label)
+			counts := make(map[string]int)
+			for _, result := range output.Results {
+				counts[result.Status]++
+				if result.Status == service.CATALOG_REBUILD_STATUS_FAILED {
+					log.Printf("Catalog entry %s: %s", result.Path, result.Error)
+					continue
+				}
+				log.Printf("Catalog entry %s: drive file %s of backup %s %s", result.Path, result.DriveFileId, result.BackupId, result.Status)
+			}
+			log.Printf("%d drive files created, %d skipped, %d failed", counts[service.CATALOG_REBUILD_STATUS_CREATED], counts[service.CATALOG_REBUILD_STATUS_SKIPPED], counts[service.CATALOG_REBUILD_STATUS_FAILED])
+			if err != nil {
+				log.Fatal(err)
+			}
+			if counts[service.CATALOG_REBUILD_STATUS_FAILED] > 0 {
+				log.Fatalf("%d catalog entries could not be rebuilt", counts[service.CATALOG_REBUILD_STATUS_FAILED])
+			}
+		},
+	}
+	command.Flags().String("drive", "", "Label of the drive whose catalog entries are read")
+	return command
+}
@@ -1,6 +1,11 @@
 package cmd
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/herytz/backupman/cmd/config"
 	"github.com/herytz/backupman/core/application"
 	"github.com/herytz/backupman/migration"
@@ -18,3 +23,9 @@ func CreateAppFromYml(configFile string) (*application.App, error) {
 	app := application.NewApp(config)
 	return app, nil
 }
+
+// InterruptContext returns a context done when the command is interrupted, so
+// the running backups are cancelled
+func InterruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
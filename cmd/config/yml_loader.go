@@ -3,10 +3,14 @@ package config
 import (
 	"fmt"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/goccy/go-yaml"
 	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/dumper"
 )
 
 type config struct {
@@ -17,6 +21,12 @@ type config struct {
 			Enabled string `yaml:"enabled"`
 			Cron    string `yaml:"cron"`
 		} `yaml:"backup_job"`
+		RetryJob struct {
+			Enabled     string `yaml:"enabled"`
+			Cron        string `yaml:"cron"`
+			MaxAge      string `yaml:"max_age"`
+			MaxAttempts int    `yaml:"max_attempts"`
+		} `yaml:"retry_job"`
 	}
 	Database struct {
 		Provider string
@@ -31,7 +41,20 @@ type config struct {
 	DataSources []struct {
 		Provider string
 		Label    string
-		// mysql, postgres
+		Drives   []string
+		// Commands run around the backups
+		Hooks struct {
+			PreDump    []string `yaml:"pre_dump"`
+			PostDump   []string `yaml:"post_dump"`
+			PostUpload []string `yaml:"post_upload"`
+			OnFailure  []string `yaml:"on_failure"`
+			Timeout    string   `yaml:"timeout"`
+		} `yaml:"hooks"`
+		// Maximum duration of each dump
+		DumpTimeout string `yaml:"dump_timeout"`
+		// Upload the dumps while they are written, exec, filesystem, mysql, postgres and sqlite only
+		Streaming string `yaml:"streaming"`
+		// mysql, postgres, redis
 		Host      string
 		Port      int
 		User      string
@@ -39,8 +62,56 @@ type config struct {
 		DdName    string `yaml:"db_name"`
 		TmpFolder string `yaml:"tmp_folder"`
 		Tls       string
+		// redis: TLS certificates and verification
+		TlsCaFile     string `yaml:"tls_ca_file"`
+		TlsCertFile   string `yaml:"tls_cert_file"`
+		TlsKeyFile    string `yaml:"tls_key_file"`
+		TlsSkipVerify string `yaml:"tls_skip_verify"`
+		// mysql, postgres: table filters
+		IncludeTables    []string          `yaml:"include_tables"`
+		ExcludeTables    []string          `yaml:"exclude_tables"`
+		SchemaOnlyTables []string          `yaml:"schema_only_tables"`
+		Where            map[string]string `yaml:"where"`
+		// mysql, postgres: anonymization
+		Masking []struct {
+			Column   string
+			Strategy string
+			Value    string
+		}
+		// mysql, postgres: number of tables dumped concurrently
+		Parallelism int `yaml:"parallelism"`
+		// mysql, postgres, sqlite: sql, or csv, jsonl, parquet to export each table to a file
+		Format string `yaml:"format"`
+		// mysql, postgres: "all" or database patterns, instead of db_name
+		Databases databaseList `yaml:"databases"`
+		// mysql: incremental backups read from the binary log
+		Incremental struct {
+			Enabled  string
+			Cron     string
+			ServerId uint32 `yaml:"server_id"`
+		} `yaml:"incremental"`
+		// postgres: base backups and WAL archiving for point in time recovery
+		Pitr struct {
+			Enabled      string
+			PgBasebackup string `yaml:"pg_basebackup"`
+		} `yaml:"pitr"`
 		// sqlite
 		DbPath string `yaml:"db_path"`
+		// exec
+		Command       []string          `yaml:"command"`
+		HealthCommand []string          `yaml:"health_command"`
+		Env           map[string]string `yaml:"env"`
+		Timeout       string            `yaml:"timeout"`
+		FileExtension string            `yaml:"file_extension"`
+		// mongodb
+		Uri                string   `yaml:"uri"`
+		IncludeCollections []string `yaml:"include_collections"`
+		ExcludeCollections []string `yaml:"exclude_collections"`
+		// filesystem
+		Paths       []string `yaml:"paths"`
+		Include     []string `yaml:"include"`
+		Exclude     []string `yaml:"exclude"`
+		Compression string   `yaml:"compression"`
 	} `yaml:"data_sources"`
 	Drives []struct {
 		Provider string
@@ -58,6 +129,21 @@ type config struct {
 		Endpoint       string `yaml:"endpoint"`
 		Prefix         string `yaml:"prefix"`
 		ForcePathStyle bool   `yaml:"force_path_style"`
+		// Retries of the failed uploads
+		Retry struct {
+			Attempts     int     `yaml:"attempts"`
+			InitialDelay string  `yaml:"initial_delay"`
+			MaxDelay     string  `yaml:"max_delay"`
+			Jitter       float64 `yaml:"jitter"`
+		} `yaml:"retry"`
+		// Uploads to the drive at the same time
+		Concurrency int `yaml:"concurrency"`
+		// Maximum duration of each upload attempt
+		UploadTimeout string `yaml:"upload_timeout"`
+		// Store the dumps as deduplicated chunks, local and s3 only
+		Dedup string `yaml:"dedup"`
+		// Split the uploaded dumps into volumes of at most this size, like 2GB
+		MaxFileSize string `yaml:"max_file_size"`
 	}
 	Notifiers struct {
 		Mail struct {
@@ -86,6 +172,32 @@ type config struct {
 		By      string
 		Value   int
 	}
+	Concurrency struct {
+		Dumps   int `yaml:"dumps"`
+		Uploads int `yaml:"uploads"`
+	}
+}
+
+// databaseList accepts either "all" or a list of database patterns
+type databaseList []string
+
+func (d *databaseList) UnmarshalYAML(unmarshal func(any) error) error {
+	var all string
+	err := unmarshal(&all)
+	if err == nil {
+		if all != "all" {
+			return fmt.Errorf("databases must be \"all\" or a list of patterns, got %s", all)
+		}
+		*d = []string{"*"}
+		return nil
+	}
+	var patterns []string
+	err = unmarshal(&patterns)
+	if err != nil {
+		return err
+	}
+	*d = patterns
+	return nil
 }
 
 func LoadYml(file string) (application.AppConfig, error) {
@@ -107,6 +219,24 @@ func LoadYml(file string) (application.AppConfig, error) {
 	httpConfig.ApiKeys = ymlConfig.Http.ApiKeys
 	httpConfig.BackupJob.Enabled = ymlConfig.Http.BackupJob.Enabled == "true"
 	httpConfig.BackupJob.Cron = ymlConfig.Http.BackupJob.Cron
+	httpConfig.RetryJob = application.RetryJobConfig{
+		Enabled:     ymlConfig.Http.RetryJob.Enabled == "true",
+		Cron:        ymlConfig.Http.RetryJob.Cron,
+		MaxAge:      24 * time.Hour,
+		MaxAttempts: ymlConfig.Http.RetryJob.MaxAttempts,
+	}
+	if ymlConfig.Http.RetryJob.MaxAge != "" {
+		httpConfig.RetryJob.MaxAge, err = time.ParseDuration(ymlConfig.Http.RetryJob.MaxAge)
+		if err != nil {
+			return c, fmt.Errorf("invalid retry_job max_age (%s): %s", ymlConfig.Http.RetryJob.MaxAge, err)
+		}
+	}
+	if httpConfig.RetryJob.MaxAttempts == 0 {
+		httpConfig.RetryJob.MaxAttempts = 10
+	}
+	if httpConfig.RetryJob.Enabled && httpConfig.RetryJob.Cron == "" {
+		return c, fmt.Errorf("retry_job cron is required")
+	}
 	c.Http = httpConfig
 
 	switch ymlConfig.Database.Provider {
@@ -142,35 +272,247 @@ func LoadYml(file string) (application.AppConfig, error) {
 		return c, fmt.Errorf("no data sources configured")
 	}
 
+	dataSourceLabels := make(map[string]bool)
 	for _, ds := range ymlConfig.DataSources {
+		if dataSourceLabels[ds.Label] {
+			return c, fmt.Errorf("duplicate data source label: %s", ds.Label)
+		}
+		dataSourceLabels[ds.Label] = true
+
+		options := application.DataSourceOptions{
+			Drives:    ds.Drives,
+			Streaming: ds.Streaming == "true",
+			Incremental: application.IncrementalConfig{
+				Enabled: ds.Incremental.Enabled == "true",
+				Cron:    ds.Incremental.Cron,
+			},
+			Hooks: application.HooksConfig{
+				PreDump:    ds.Hooks.PreDump,
+				PostDump:   ds.Hooks.PostDump,
+				PostUpload: ds.Hooks.PostUpload,
+				OnFailure:  ds.Hooks.OnFailure,
+			},
+		}
+		if ds.Hooks.Timeout != "" {
+			options.Hooks.Timeout, err = time.ParseDuration(ds.Hooks.Timeout)
+			if err != nil {
+				return c, fmt.Errorf("data source (%s): invalid hooks timeout (%s): %s", ds.Label, ds.Hooks.Timeout, err)
+			}
+		}
+		if ds.DumpTimeout != "" {
+			options.DumpTimeout, err = time.ParseDuration(ds.DumpTimeout)
+			if err != nil {
+				return c, fmt.Errorf("data source (%s): invalid dump_timeout (%s): %s", ds.Label, ds.DumpTimeout, err)
+			}
+			if options.DumpTimeout < 0 {
+				return c, fmt.Errorf("data source (%s): dump_timeout cannot be negative", ds.Label)
+			}
+		}
+		if options.Streaming && !slices.Contains([]string{"exec", "filesystem", "mysql", "postgres", "sqlite"}, ds.Provider) {
+			return c, fmt.Errorf("data source (%s): streaming is not supported by %s provider", ds.Label, ds.Provider)
+		}
+		// A base backup is written by pg_basebackup
+		if options.Streaming && ds.Pitr.Enabled == "true" {
+			return c, fmt.Errorf("data source (%s): streaming cannot be used with pitr", ds.Label)
+		}
+		if options.Incremental.Enabled {
+			if ds.Provider != "mysql" {
+				return c, fmt.Errorf("data source (%s): incremental backups are not supported by %s provider", ds.Label, ds.Provider)
+			}
+			if len(ds.Databases) > 0 {
+				return c, fmt.Errorf("data source (%s): incremental backups require db_name instead of databases", ds.Label)
+			}
+			if ds.Incremental.Cron == "" {
+				return c, fmt.Errorf("data source (%s): incremental cron is required", ds.Label)
+			}
+			if ds.Incremental.ServerId == 0 {
+				return c, fmt.Errorf("data source (%s): incremental server_id is required", ds.Label)
+			}
+		}
+
+		tableFilter := application.TableFilterConfig{
+			IncludeTables:    ds.IncludeTables,
+			ExcludeTables:    ds.ExcludeTables,
+			SchemaOnlyTables: ds.SchemaOnlyTables,
+			Where:            ds.Where,
+		}
+		masking := []application.MaskingRuleConfig{}
+		for _, rule := range ds.Masking {
+			table, column, _ := strings.Cut(rule.Column, ".")
+			masking = append(masking, application.MaskingRuleConfig{
+				Table:    table,
+				Column:   column,
+				Strategy: rule.Strategy,
+				Value:    rule.Value,
+			})
+		}
+		err = application.NewSqlDumpOptions(tableFilter, masking, ds.Parallelism, ds.Format).Validate()
+		if err != nil {
+			return c, fmt.Errorf("data source (%s): %s", ds.Label, err)
+		}
+		if dumper.IsTableExport(ds.Format) {
+			if ds.Provider != "mysql" && ds.Provider != "postgres" && ds.Provider != "sqlite" {
+				return c, fmt.Errorf("data source (%s): format is not supported by %s provider", ds.Label, ds.Provider)
+			}
+			// The changes are replayed on a SQL dump
+			if options.Incremental.Enabled || ds.Pitr.Enabled == "true" {
+				return c, fmt.Errorf("data source (%s): format %s cannot be used with incremental backups or pitr", ds.Label, ds.Format)
+			}
+		}
+		if len(ds.Databases) > 0 && ds.DdName != "" {
+			return c, fmt.Errorf("data source (%s): db_name and databases cannot be used together", ds.Label)
+		}
+		pitr := application.PitrConfig{
+			Enabled:      ds.Pitr.Enabled == "true",
+			PgBasebackup: ds.Pitr.PgBasebackup,
+		}
+		if pitr.Enabled {
+			if ds.Provider != "postgres" {
+				return c, fmt.Errorf("data source (%s): pitr is not supported by %s provider", ds.Label, ds.Provider)
+			}
+			// A base backup holds the whole cluster
+			if len(ds.Databases) > 0 || len(ds.IncludeTables) > 0 || len(ds.ExcludeTables) > 0 || len(ds.SchemaOnlyTables) > 0 || len(ds.Where) > 0 || len(ds.Masking) > 0 {
+				return c, fmt.Errorf("data source (%s): pitr cannot be used with databases, table filters or masking", ds.Label)
+			}
+		}
+		err = dumper.TableFilter{IncludeTables: ds.Databases}.Validate()
+		if err != nil {
+			return c, fmt.Errorf("data source (%s): %s", ds.Label, err)
+		}
+
 		switch ds.Provider {
 		case "mysql":
 			c.DataSources = append(c.DataSources, application.MysqlDataSourceConfig{
-				Host:      ds.Host,
-				Port:      ds.Port,
-				User:      ds.User,
-				Password:  ds.Password,
-				Database:  ds.DdName,
-				TmpFolder: ds.TmpFolder,
-				Label:     ds.Label,
-				Tls:       ds.Tls,
+				Host:        ds.Host,
+				Port:        ds.Port,
+				User:        ds.User,
+				Password:    ds.Password,
+				Database:    ds.DdName,
+				Databases:   ds.Databases,
+				TmpFolder:   ds.TmpFolder,
+				Label:       ds.Label,
+				Tls:         ds.Tls,
+				TableFilter: tableFilter,
+				Masking:     masking,
+				Parallelism: ds.Parallelism,
+				Format:      ds.Format,
+				ServerId:    ds.Incremental.ServerId,
+				Options:     options,
 			})
 		case "postgres":
 			c.DataSources = append(c.DataSources, application.PostgresDataSourceConfig{
-				Host:      ds.Host,
-				Port:      ds.Port,
-				User:      ds.User,
-				Password:  ds.Password,
-				Database:  ds.DdName,
-				TmpFolder: ds.TmpFolder,
-				Label:     ds.Label,
-				Tls:       ds.Tls == "true",
+				Host:        ds.Host,
+				Port:        ds.Port,
+				User:        ds.User,
+				Password:    ds.Password,
+				Database:    ds.DdName,
+				Databases:   ds.Databases,
+				TmpFolder:   ds.TmpFolder,
+				Label:       ds.Label,
+				Tls:         ds.Tls == "true",
+				TableFilter: tableFilter,
+				Masking:     masking,
+				Parallelism: ds.Parallelism,
+				Format:      ds.Format,
+				Pitr:        pitr,
+				Options:     options,
 			})
 		case "sqlite":
 			c.DataSources = append(c.DataSources, application.SqliteDataSourceConfig{
 				Label:     ds.Label,
 				TmpFolder: ds.TmpFolder,
 				DbPath:    ds.DbPath,
+				Format:    ds.Format,
+				Options:   options,
+			})
+		case "exec":
+			if len(ds.Command) == 0 {
+				return c, fmt.Errorf("data source (%s): command is required for exec provider", ds.Label)
+			}
+			var timeout time.Duration
+			if ds.Timeout != "" {
+				timeout, err = time.ParseDuration(ds.Timeout)
+				if err != nil {
+					return c, fmt.Errorf("data source (%s): invalid timeout (%s): %s", ds.Label, ds.Timeout, err)
+				}
+			}
+			c.DataSources = append(c.DataSources, application.ExecDataSourceConfig{
+				Label:         ds.Label,
+				TmpFolder:     ds.TmpFolder,
+				Host:          ds.Host,
+				Port:          ds.Port,
+				User:          ds.User,
+				Password:      ds.Password,
+				Database:      ds.DdName,
+				Command:       ds.Command,
+				HealthCommand: ds.HealthCommand,
+				Env:           ds.Env,
+				Timeout:       timeout,
+				FileExtension: ds.FileExtension,
+				Options:       options,
+			})
+		case "mongodb":
+			if ds.Uri == "" {
+				return c, fmt.Errorf("data source (%s): uri is required for mongodb provider", ds.Label)
+			}
+			err = dumper.TableFilter{IncludeTables: ds.IncludeCollections, ExcludeTables: ds.ExcludeCollections}.Validate()
+			if err != nil {
+				return c, fmt.Errorf("data source (%s): %s", ds.Label, err)
+			}
+			c.DataSources = append(c.DataSources, application.MongodbDataSourceConfig{
+				Label:              ds.Label,
+				TmpFolder:          ds.TmpFolder,
+				Uri:                ds.Uri,
+				Database:           ds.DdName,
+				IncludeCollections: ds.IncludeCollections,
+				ExcludeCollections: ds.ExcludeCollections,
+				Options:            options,
+			})
+		case "redis":
+			port := ds.Port
+			if port == 0 {
+				port = 6379
+			}
+			tlsOptions := ds.TlsCaFile != "" || ds.TlsCertFile != "" || ds.TlsKeyFile != "" || ds.TlsSkipVerify == "true"
+			if tlsOptions && ds.Tls != "true" {
+				return c, fmt.Errorf("data source (%s): tls options require tls", ds.Label)
+			}
+			if (ds.TlsCertFile == "") != (ds.TlsKeyFile == "") {
+				return c, fmt.Errorf("data source (%s): tls_cert_file and tls_key_file must be set together", ds.Label)
+			}
+			c.DataSources = append(c.DataSources, application.RedisDataSourceConfig{
+				Label:         ds.Label,
+				TmpFolder:     ds.TmpFolder,
+				Host:          ds.Host,
+				Port:          port,
+				User:          ds.User,
+				Password:      ds.Password,
+				Tls:           ds.Tls == "true",
+				TlsCaFile:     ds.TlsCaFile,
+				TlsCertFile:   ds.TlsCertFile,
+				TlsKeyFile:    ds.TlsKeyFile,
+				TlsSkipVerify: ds.TlsSkipVerify == "true",
+				Options:       options,
+			})
+		case "filesystem":
+			if len(ds.Paths) == 0 {
+				return c, fmt.Errorf("data source (%s): paths is required for filesystem provider", ds.Label)
+			}
+			if ds.Compression != dumper.FILESYSTEM_COMPRESSION_NONE && ds.Compression != dumper.FILESYSTEM_COMPRESSION_GZIP {
+				return c, fmt.Errorf("data source (%s): unsupported compression: %s", ds.Label, ds.Compression)
+			}
+			err = dumper.TableFilter{IncludeTables: ds.Include, ExcludeTables: ds.Exclude}.Validate()
+			if err != nil {
+				return c, fmt.Errorf("data source (%s): %s", ds.Label, err)
+			}
+			c.DataSources = append(c.DataSources, application.FilesystemDataSourceConfig{
+				Label:       ds.Label,
+				TmpFolder:   ds.TmpFolder,
+				Paths:       ds.Paths,
+				Include:     ds.Include,
+				Exclude:     ds.Exclude,
+				Compression: ds.Compression,
+				Options:     options,
 			})
 		default:
 			return c, fmt.Errorf("unsupported data source provider: %s", ds.Provider)
@@ -181,12 +523,71 @@ func LoadYml(file string) (application.AppConfig, error) {
 		return c, fmt.Errorf("no drives configured")
 	}
 
+	driveLabels := make(map[string]bool)
 	for _, drive := range ymlConfig.Drives {
+		if driveLabels[drive.Label] {
+			return c, fmt.Errorf("duplicate drive label: %s", drive.Label)
+		}
+		driveLabels[drive.Label] = true
+
+		retry := application.RetryConfig{
+			Attempts: drive.Retry.Attempts,
+			Jitter:   drive.Retry.Jitter,
+		}
+		if drive.Retry.InitialDelay != "" {
+			retry.InitialDelay, err = time.ParseDuration(drive.Retry.InitialDelay)
+			if err != nil {
+				return c, fmt.Errorf("drive (%s): invalid retry initial_delay (%s): %s", drive.Label, drive.Retry.InitialDelay, err)
+			}
+		}
+		if drive.Retry.MaxDelay != "" {
+			retry.MaxDelay, err = time.ParseDuration(drive.Retry.MaxDelay)
+			if err != nil {
+				return c, fmt.Errorf("drive (%s): invalid retry max_delay (%s): %s", drive.Label, drive.Retry.MaxDelay, err)
+			}
+		}
+		if retry.Attempts < 0 || retry.InitialDelay < 0 || retry.MaxDelay < 0 {
+			return c, fmt.Errorf("drive (%s): retry attempts and delays cannot be negative", drive.Label)
+		}
+		if retry.Jitter < 0 || retry.Jitter > 1 {
+			return c, fmt.Errorf("drive (%s): retry jitter must be between 0 and 1", drive.Label)
+		}
+		if drive.Concurrency < 0 {
+			return c, fmt.Errorf("drive (%s): concurrency cannot be negative", drive.Label)
+		}
+		options := application.DriveOptions{
+			Retry:       retry,
+			Concurrency: drive.Concurrency,
+			Dedup:       drive.Dedup == "true",
+		}
+		if options.Dedup && drive.Provider != "local" && drive.Provider != "s3" {
+			return c, fmt.Errorf("drive (%s): dedup is not supported by %s provider", drive.Label, drive.Provider)
+		}
+		if drive.MaxFileSize != "" {
+			options.MaxFileSize, err = parseFileSize(drive.MaxFileSize)
+			if err != nil {
+				return c, fmt.Errorf("drive (%s): invalid max_file_size (%s): %s", drive.Label, drive.MaxFileSize, err)
+			}
+			if options.Dedup {
+				return c, fmt.Errorf("drive (%s): max_file_size cannot be used with dedup", drive.Label)
+			}
+		}
+		if drive.UploadTimeout != "" {
+			options.UploadTimeout, err = time.ParseDuration(drive.UploadTimeout)
+			if err != nil {
+				return c, fmt.Errorf("drive (%s): invalid upload_timeout (%s): %s", drive.Label, drive.UploadTimeout, err)
+			}
+			if options.UploadTimeout < 0 {
+				return c, fmt.Errorf("drive (%s): upload_timeout cannot be negative", drive.Label)
+			}
+		}
+
 		switch drive.Provider {
 		case "local":
 			c.Drives = append(c.Drives, application.LocalDriveConfig{
-				Label:  drive.Label,
-				Folder: drive.Folder,
+				Label:   drive.Label,
+				Folder:  drive.Folder,
+				Options: options,
 			})
 		case "google_drive":
 			c.Drives = append(c.Drives, application.GoogleDriveConfig{
@@ -194,6 +595,7 @@ func LoadYml(file string) (application.AppConfig, error) {
 				Folder:           drive.Folder,
 				ClientSecretFile: drive.ClientSecretFile,
 				TokenFile:        drive.TokenFile,
+				Options:          options,
 			})
 		case "s3":
 			c.Drives = append(c.Drives, application.S3DriveConfig{
@@ -205,12 +607,21 @@ func LoadYml(file string) (application.AppConfig, error) {
 				Endpoint:       drive.Endpoint,
 				Prefix:         drive.Prefix,
 				ForcePathStyle: drive.ForcePathStyle,
+				Options:        options,
 			})
 		default:
 			return c, fmt.Errorf("unsupported drive provider: %s", drive.Provider)
 		}
 	}
 
+	for _, ds := range ymlConfig.DataSources {
+		for _, label := range ds.Drives {
+			if !driveLabels[label] {
+				return c, fmt.Errorf("data source (%s): unknown drive label: %s", ds.Label, label)
+			}
+		}
+	}
+
 	destinations := []application.MailNotifierDestinationConfig{}
 	for _, dest := range ymlConfig.Notifiers.Mail.Destinations {
 		destinations = append(destinations, application.MailNotifierDestinationConfig{
@@ -243,6 +654,14 @@ func LoadYml(file string) (application.AppConfig, error) {
 		},
 	}
 
+	if ymlConfig.Concurrency.Dumps < 0 || ymlConfig.Concurrency.Uploads < 0 {
+		return c, fmt.Errorf("concurrency dumps and uploads cannot be negative")
+	}
+	c.Concurrency = application.ConcurrencyConfig{
+		Dumps:   ymlConfig.Concurrency.Dumps,
+		Uploads: ymlConfig.Concurrency.Uploads,
+	}
+
 	if ymlConfig.Retention.Enabled == "true" {
 		switch ymlConfig.Retention.By {
 		case "age":
@@ -257,3 +676,40 @@ func LoadYml(file string) (application.AppConfig, error) {
 
 	return c, nil
 }
+
+// fileSizeUnits are the units of the file sizes, longest suffixes first
+var fileSizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"TiB", 1 << 40},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"TB", 1000 * 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// parseFileSize parses a positive size like 500MB or 2GiB, in bytes without unit
+func parseFileSize(value string) (int64, error) {
+	number := strings.TrimSpace(value)
+	unit := int64(1)
+	for _, u := range fileSizeUnits {
+		if strings.HasSuffix(number, u.suffix) {
+			number = strings.TrimSpace(strings.TrimSuffix(number, u.suffix))
+			unit = u.bytes
+			break
+		}
+	}
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("expected a number of bytes with an optional unit like MB or GiB")
+	}
+	if size <= 0 {
+		return 0, fmt.Errorf("size must be positive")
+	}
+	return size * unit, nil
+}
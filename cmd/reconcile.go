@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/service"
+	"github.com/spf13/cobra"
+)
+
+func Reconcile(version application.VersionConfig) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Compare the drives to the recorded backups",
+		Long:  "This command will list the files of each drive and report the finished drive files whose file is missing and the files no drive file references. With --mark-missing, the missing drive files are recorded as missing. With --delete-orphans-older-than, the unreferenced files older than the given duration are deleted.",
+		Run: func(cmd *cobra.Command, args []string) {
+			configFile, err := cmd.Flags().GetString("config")
+			if err != nil {
+				log.Fatal(err)
+			}
+			drives, err := cmd.Flags().GetStringArray("drive")
+			if err != nil {
+				log.Fatal(err)
+			}
+			markMissing, err := cmd.Flags().GetBool("mark-missing")
+			if err != nil {
+				log.Fatal(err)
+			}
+			orphanAge, err := cmd.Flags().GetDuration("delete-orphans-older-than")
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			app, err := CreateAppFromYml(configFile)
+			if err != nil {
+				log.Fatalf("Error creating app from config => %v", err)
+			}
+			app.Mode = application.APP_MODE_CLI
+			app.Version = version
+			ctx, stop := InterruptContext()
+			defer stop()
+
+			output, err := service.Reconcile(ctx, app, service.ReconcileInput{
+				Drives:                 drives,
+				MarkMissing:            markMissing,
+				DeleteOrphansOlderThan: orphanAge,
+			})
+			failed := 0
+			for _, report := range output.Reports {
+				if report.Error != "" {
+					failed++
+					log.Printf("Drive (%s): %s", report.Label, report.Error)
+					continue
+				}
+				for _, missing := range report.Missing {
+					action := ""
+					if missing.Marked {
+						action = " (marked missing)"
+					}
+					log.Printf("Drive (%s): file %s of drive file %s of backup %s is missing%s", report.Label, missing.Path, missing.DriveFileId, missing.BackupId, action)
+				}
+				deleted := 0
+				for _, orphan := range report.Orphans {
+					action := ""
+					if orphan.Deleted {
+						action = " (deleted)"
+						deleted++
+					}
+					log.Printf("Drive (%s): file %s of %d bytes modified at %s is not referenced%s", report.Label, orphan.Path, orphan.Size, orphan.ModTime.Format("2006-01-02 15:04:05"), action)
+				}
+				log.Printf("Drive (%s): %d missing files, %d orphan files, %d deleted", report.Label, len(report.Missing), len(report.Orphans), deleted)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			if failed > 0 {
+				log.Fatalf("%d of %d drives could not be reconciled", failed, len(output.Reports))
+			}
+		},
+	}
+	command.Flags().StringArray("drive", nil, "Label of a drive to reconcile, every drive when not set (repeatable)")
+	command.Flags().Bool("mark-missing", false, "Record the finished drive files whose file is missing as missing")
+	command.Flags().Duration("delete-orphans-older-than", 0, "Delete the files referenced by no drive file older than this duration (e.g. 168h)")
+	return command
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/service"
+	"github.com/spf13/cobra"
+)
+
+func Replicate(version application.VersionConfig) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "replicate",
+		Short: "Copy the backups of a drive to another drive",
+		Long:  "This command will copy the finished backups uploaded to a drive to another configured drive, for example to migrate the existing backups to a new drive. Each copy is downloaded back and compared to its source, then recorded as a new drive file of its backup. The backups already copied are skipped, so an interrupted replication is resumed by running the command again.",
+		Run: func(cmd *cobra.Command, args []string) {
+			configFile, err := cmd.Flags().GetString("config")
+			if err != nil {
+				log.Fatal(err)
+			}
+			from, err := cmd.Flags().GetString("from")
+			if err != nil {
+				log.Fatal(err)
+			}
+			to, err := cmd.Flags().GetString("to")
+			if err != nil {
+				log.Fatal(err)
+			}
+			since, err := cmd.Flags().GetDuration("since")
+			if err != nil {
+				log.Fatal(err)
+			}
+			if from == "" || to == "" {
+				log.Fatal("--from and --to are required")
+			}
+
+			app, err := CreateAppFromYml(configFile)
+			if err != nil {
+				log.Fatalf("Error creating app from config => %v", err)
+			}
+			app.Mode = application.APP_MODE_CLI
+			app.Version = version
+			ctx, stop := InterruptContext()
+			defer stop()
+
+			output, err := service.Replicate(ctx, app, service.ReplicateInput{
+				From:  from,
+				To:    to,
+				Since: since,
+			})
+			counts := make(map[string]int)
+			for _, result := range output.Results {
+				counts[result.Status]++
+				log.Printf("Backup %s (%s): %s %s", result.BackupId, result.Label, result.Status, result.Error)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			if counts[service.REPLICATE_STATUS_FAILED] > 0 {
+				log.Fatalf("%d of %d backups failed to replicate", counts[service.REPLICATE_STATUS_FAILED], len(output.Results))
+			}
+			log.Printf("Replication completed: %d backups replicated, %d already replicated", counts[service.REPLICATE_STATUS_REPLICATED], counts[service.REPLICATE_STATUS_SKIPPED])
+		},
+	}
+	command.Flags().String("from", "", "Label of the drive the backups are copied from")
+	command.Flags().String("to", "", "Label of the drive the backups are copied to")
+	command.Flags().Duration("since", 0, "Only copy the backups created within this duration (e.g. 720h)")
+	return command
+}
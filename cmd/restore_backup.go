@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"log"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/service"
+	"github.com/spf13/cobra"
+)
+
+func RestoreBackup(version application.VersionConfig) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "restore [id]",
+		Short: "Restore a backup",
+		Long:  "This command will load a backup back into its data source. An incremental backup is restored with its full backup and the incremental backups taken before it. With --until, the changes are replayed up to the given time. A PostgreSQL base backup is restored in the new data directory given by --target-dir, with the archived WAL segments to replay when the server starts on it.",
+		Run: func(cmd *cobra.Command, args []string) {
+			configFile, err := cmd.Flags().GetString("config")
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if len(args) < 1 {
+				log.Fatal("Backup ID is required for restore")
+			}
+			untilFlag, err := cmd.Flags().GetString("until")
+			if err != nil {
+				log.Fatal(err)
+			}
+			var until time.Time
+			if untilFlag != "" {
+				until, err = time.Parse(time.RFC3339, untilFlag)
+				if err != nil {
+					log.Fatalf("Invalid restore time (%s), expected RFC 3339 format like 2006-01-02T15:04:05Z07:00 => %v", untilFlag, err)
+				}
+			}
+
+			targetDir, err := cmd.Flags().GetString("target-dir")
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			app, err := CreateAppFromYml(configFile)
+			if err != nil {
+				log.Fatalf("Error creating app from config => %v", err)
+			}
+			app.Mode = application.APP_MODE_CLI
+			app.Version = version
+			backupId := args[0]
+			err = service.Restore(app, backupId, service.RestoreOptions{Until: until, TargetDir: targetDir})
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("Backup restore completed for ID: %s", backupId)
+		},
+	}
+	command.Flags().String("until", "", "Restore the state of the data source at this time (RFC 3339)")
+	command.Flags().String("target-dir", "", "Data directory receiving a restored base backup, must be empty")
+	return command
+}
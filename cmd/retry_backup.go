@@ -4,36 +4,97 @@ import (
 	"log"
 
 	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/model"
 	"github.com/herytz/backupman/core/service"
 	"github.com/spf13/cobra"
 )
 
 func RetryBackup(version application.VersionConfig) *cobra.Command {
-	return &cobra.Command{
+	command := &cobra.Command{
 		Use:   "retry [id]",
 		Short: "Retry a failed backup",
-		Long:  "This command will retry a failed backup.",
+		Long:  "This command will retry a failed backup. A backup whose dump step failed is dumped again as a new backup linked to the failed one. With --all-failed, every failed backup whose dump is still present or whose dump step failed is retried, optionally only the recent ones or the ones of a data source.",
 		Run: func(cmd *cobra.Command, args []string) {
 			configFile, err := cmd.Flags().GetString("config")
 			if err != nil {
 				log.Fatal(err)
 			}
+			allFailed, err := cmd.Flags().GetBool("all-failed")
+			if err != nil {
+				log.Fatal(err)
+			}
+			since, err := cmd.Flags().GetDuration("since")
+			if err != nil {
+				log.Fatal(err)
+			}
+			dataSource, err := cmd.Flags().GetString("data-source")
+			if err != nil {
+				log.Fatal(err)
+			}
+			concurrency, err := cmd.Flags().GetInt("concurrency")
+			if err != nil {
+				log.Fatal(err)
+			}
 
-			if len(args) < 1 {
+			if allFailed && len(args) > 0 {
+				log.Fatal("Backup ID cannot be used with --all-failed")
+			}
+			if !allFailed && len(args) < 1 {
 				log.Fatal("Backup ID is required for retry")
 			}
+			if !allFailed && (since != 0 || dataSource != "") {
+				log.Fatal("--since and --data-source require --all-failed")
+			}
 			app, err := CreateAppFromYml(configFile)
 			if err != nil {
 				log.Fatalf("Error creating app from config => %v", err)
 			}
 			app.Mode = application.APP_MODE_CLI
 			app.Version = version
+			ctx, stop := InterruptContext()
+			defer stop()
+
+			if allFailed {
+				output, err := service.BackupRetryAllFailed(ctx, app, service.BackupRetryAllInput{
+					Since:       since,
+					DataSource:  dataSource,
+					Concurrency: concurrency,
+				})
+				if err != nil {
+					log.Fatal(err)
+				}
+				failed := 0
+				for _, result := range output.Results {
+					if result.Status != model.BACKUP_STATUS_FINISHED {
+						failed++
+					}
+					if result.NewBackupId != "" {
+						log.Printf("Backup %s (%s) dumped again by backup %s: %s %s", result.BackupId, result.Label, result.NewBackupId, result.Status, result.Error)
+						continue
+					}
+					log.Printf("Backup %s (%s): %s %s", result.BackupId, result.Label, result.Status, result.Error)
+				}
+				if failed > 0 {
+					log.Fatalf("%d of %d backups are still failed", failed, len(output.Results))
+				}
+				log.Printf("Backup retry completed for %d backups", len(output.Results))
+				return
+			}
+
 			backupId := args[0]
-			err = service.BackupRetry(app, backupId)
+			retryId, err := service.BackupRetry(ctx, app, backupId)
 			if err != nil {
 				log.Fatal(err)
 			}
-			log.Printf("Backup retry completed for ID: %s", backupId)
+			if retryId != backupId {
+				log.Printf("Backup %s dumped again by backup %s", backupId, retryId)
+			}
+			log.Printf("Backup retry completed for ID: %s", retryId)
 		},
 	}
+	command.Flags().Bool("all-failed", false, "Retry every failed backup whose dump is still present or whose dump step failed")
+	command.Flags().Duration("since", 0, "With --all-failed, only retry the backups created within this duration (e.g. 24h)")
+	command.Flags().String("data-source", "", "With --all-failed, only retry the backups of this data source")
+	command.Flags().Int("concurrency", service.DEFAULT_RETRY_CONCURRENCY, "With --all-failed, number of backups retried at the same time")
+	return command
 }
@@ -4,15 +4,16 @@ import (
 	"log"
 
 	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/model"
 	"github.com/herytz/backupman/core/service"
 	"github.com/spf13/cobra"
 )
 
 func RunBackup(version application.VersionConfig) *cobra.Command {
-	return &cobra.Command{
+	command := &cobra.Command{
 		Use:   "run",
 		Short: "Run the backup",
-		Long:  "This command will launch the backup.",
+		Long:  "This command will launch the backup. With --incremental, only the changes made since the last backup of the data sources having incremental backups enabled are captured.",
 		Run: func(cmd *cobra.Command, args []string) {
 			configFile, err := cmd.Flags().GetString("config")
 			if err != nil {
@@ -24,11 +25,39 @@ func RunBackup(version application.VersionConfig) *cobra.Command {
 			}
 			app.Mode = application.APP_MODE_CLI
 			app.Version = version
-			backupIds, err := service.Backup(app)
+			incremental, err := cmd.Flags().GetBool("incremental")
+			if err != nil {
+				log.Fatal(err)
+			}
+			dataSources, err := cmd.Flags().GetStringArray("data-source")
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = service.CheckDataSources(app, dataSources)
+			if err != nil {
+				log.Fatal(err)
+			}
+			ctx, stop := InterruptContext()
+			defer stop()
+			var backupIds []string
+			if incremental {
+				backupIds, err = service.BackupIncremental(ctx, app, dataSources...)
+			} else {
+				var runId string
+				runId, err = service.StartBackupRun(app, model.RUN_TRIGGER_CLI, "")
+				if err != nil {
+					log.Fatal(err)
+				}
+				log.Printf("Backup run %s started", runId)
+				backupIds, err = service.Backup(ctx, app, runId, dataSources...)
+			}
 			if err != nil {
 				log.Fatal(err)
 			}
 			log.Printf("Backups created: %v", backupIds)
 		},
 	}
+	command.Flags().Bool("incremental", false, "Capture the changes made since the last backup")
+	command.Flags().StringArray("data-source", nil, "Only back up this data source, can be repeated")
+	return command
 }
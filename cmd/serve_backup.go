@@ -29,7 +29,9 @@ func ServeBackup(version application.VersionConfig) *cobra.Command {
 			}
 			app.Mode = application.APP_MODE_WEB
 			app.Version = version
-			err = http.Serve(app, port)
+			ctx, stop := InterruptContext()
+			defer stop()
+			err = http.Serve(ctx, app, port)
 			if err != nil {
 				log.Fatal(err)
 			}
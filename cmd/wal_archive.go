@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/service"
+	"github.com/spf13/cobra"
+)
+
+func WalArchive(version application.VersionConfig) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "wal-archive [path] [name]",
+		Short: "Archive a PostgreSQL WAL segment",
+		Long:  "This command uploads a WAL segment to the drives of a PostgreSQL data source with pitr enabled. It is meant to be the archive_command of the server: archive_command = 'backupman wal-archive %p %f --data-source <label> -c <config>'.",
+		Run: func(cmd *cobra.Command, args []string) {
+			configFile, err := cmd.Flags().GetString("config")
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if len(args) < 2 {
+				log.Fatal("WAL segment path and name are required for archive")
+			}
+			label, err := cmd.Flags().GetString("data-source")
+			if err != nil {
+				log.Fatal(err)
+			}
+			if label == "" {
+				log.Fatal("Data source label is required for archive")
+			}
+
+			app, err := CreateAppFromYml(configFile)
+			if err != nil {
+				log.Fatalf("Error creating app from config => %v", err)
+			}
+			app.Mode = application.APP_MODE_CLI
+			app.Version = version
+			ctx, stop := InterruptContext()
+			defer stop()
+			err = service.ArchiveWal(ctx, app, label, args[0], args[1])
+			if err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	command.Flags().String("data-source", "", "Label of the data source the WAL segment belongs to")
+	return command
+}
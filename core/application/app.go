@@ -38,6 +38,7 @@ type App struct {
 			Enabled bool
 			Cron    string
 		}
+		RetryJob RetryJobConfig
 	}
 	Drives    []drive.Drive
 	Dumpers   []dumper.Dumper
@@ -47,6 +48,14 @@ type App struct {
 		Enabled bool
 		Days    int
 	}
+	// Options of each data source, by dumper label
+	DataSourceOptions map[string]DataSourceOptions
+	// Options of each drive, by drive label
+	DriveOptions map[string]DriveOptions
+	// Limits of the dumps and uploads running at the same time
+	Limiter *Limiter
+	// Backups running in the application, which can be cancelled
+	Running *RunningBackups
 }
 
 func NewApp(config AppConfig) *App {
@@ -57,50 +66,167 @@ func NewApp(config AppConfig) *App {
 	app.Version.BuildDate = config.Version.BuildDate
 
 	drives := make([]drive.Drive, len(config.Drives))
+	driveOptions := make(map[string]DriveOptions)
 	for i, driveConfig := range config.Drives {
 		switch config := driveConfig.(type) {
 		case LocalDriveConfig:
 			drives[i] = drive.NewLocalDrive(config.Label, config.Folder)
+			driveOptions[config.Label] = config.Options
 		case GoogleDriveConfig:
 			drives[i] = drive.NewGoogleDrive(config.Label, config.Folder, config.ClientSecretFile, config.TokenFile)
+			driveOptions[config.Label] = config.Options
 		case S3DriveConfig:
 			drives[i] = drive.NewS3Drive(config.Label, config.Bucket, config.Region, config.AccessKey, config.SecretKey, config.Endpoint, config.Prefix, config.ForcePathStyle)
+			driveOptions[config.Label] = config.Options
 		default:
 			log.Fatal("Unsupported drive type")
 		}
+		if driveOptions[drives[i].GetLabel()].Dedup {
+			drives[i] = drive.NewDedupDrive(drives[i])
+		}
+		if driveOptions[drives[i].GetLabel()].MaxFileSize > 0 {
+			drives[i] = drive.NewVolumeDrive(drives[i], driveOptions[drives[i].GetLabel()].MaxFileSize)
+		}
 	}
 
 	dumpers := make([]dumper.Dumper, len(config.DataSources))
+	dataSourceOptions := make(map[string]DataSourceOptions)
 	for i, dataSourceConfig := range config.DataSources {
 		switch config := dataSourceConfig.(type) {
 		case MysqlDataSourceConfig:
-			dumpers[i] = dumper.NewMysqlDumper(
+			options := NewSqlDumpOptions(config.TableFilter, config.Masking, config.Parallelism, config.Format)
+			if len(config.Databases) > 0 {
+				dumpers[i] = dumper.NewMysqlServerDumper(
+					config.Label,
+					config.TmpFolder,
+					config.Host,
+					config.Port,
+					config.User,
+					config.Password,
+					config.Tls,
+					config.Databases,
+					options,
+				)
+			} else {
+				dumpers[i] = dumper.NewMysqlDumper(
+					config.Label,
+					config.TmpFolder,
+					config.Host,
+					config.Port,
+					config.User,
+					config.Password,
+					config.Database,
+					config.Tls,
+					options,
+					dumper.BinlogOptions{
+						Enabled:  config.Options.Incremental.Enabled,
+						ServerId: config.ServerId,
+					},
+				)
+			}
+			dataSourceOptions[config.Label] = config.Options
+		case PostgresDataSourceConfig:
+			options := NewSqlDumpOptions(config.TableFilter, config.Masking, config.Parallelism, config.Format)
+			if config.Pitr.Enabled {
+				dumpers[i] = dumper.NewPostgresBaseBackupDumper(
+					config.Label,
+					config.TmpFolder,
+					config.Host,
+					config.Port,
+					config.User,
+					config.Password,
+					config.Tls,
+					config.Pitr.PgBasebackup,
+				)
+			} else if len(config.Databases) > 0 {
+				dumpers[i] = dumper.NewPostgresServerDumper(
+					config.Label,
+					config.TmpFolder,
+					config.Host,
+					config.Port,
+					config.User,
+					config.Password,
+					config.Tls,
+					config.Databases,
+					options,
+				)
+			} else {
+				dumpers[i] = dumper.NewPostgresDumper(
+					config.Label,
+					config.TmpFolder,
+					config.Host,
+					config.Port,
+					config.User,
+					config.Password,
+					config.Database,
+					config.Tls,
+					options,
+				)
+			}
+			dataSourceOptions[config.Label] = config.Options
+		case SqliteDataSourceConfig:
+			dumpers[i] = dumper.NewSqliteDumper(
 				config.Label,
 				config.TmpFolder,
-				config.Host,
-				config.Port,
-				config.User,
-				config.Password,
+				config.DbPath,
+				config.Format,
+			)
+			dataSourceOptions[config.Label] = config.Options
+		case ExecDataSourceConfig:
+			dumpers[i] = dumper.NewExecDumper(
+				config.Label,
+				config.TmpFolder,
+				dumper.ExecConnection{
+					Host:     config.Host,
+					Port:     config.Port,
+					User:     config.User,
+					Password: config.Password,
+					Database: config.Database,
+				},
+				config.Command,
+				config.HealthCommand,
+				config.Env,
+				config.Timeout,
+				config.FileExtension,
+			)
+			dataSourceOptions[config.Label] = config.Options
+		case MongodbDataSourceConfig:
+			dumpers[i] = dumper.NewMongodbDumper(
+				config.Label,
+				config.TmpFolder,
+				config.Uri,
 				config.Database,
-				config.Tls,
+				config.IncludeCollections,
+				config.ExcludeCollections,
 			)
-		case PostgresDataSourceConfig:
-			dumpers[i] = dumper.NewPostgresDumper(
+			dataSourceOptions[config.Label] = config.Options
+		case RedisDataSourceConfig:
+			dumpers[i] = dumper.NewRedisDumper(
 				config.Label,
 				config.TmpFolder,
 				config.Host,
 				config.Port,
 				config.User,
 				config.Password,
-				config.Database,
-				config.Tls,
+				dumper.RedisTlsConfig{
+					Enabled:    config.Tls,
+					CaFile:     config.TlsCaFile,
+					CertFile:   config.TlsCertFile,
+					KeyFile:    config.TlsKeyFile,
+					SkipVerify: config.TlsSkipVerify,
+				},
 			)
-		case SqliteDataSourceConfig:
-			dumpers[i] = dumper.NewSqliteDumper(
+			dataSourceOptions[config.Label] = config.Options
+		case FilesystemDataSourceConfig:
+			dumpers[i] = dumper.NewFilesystemDumper(
 				config.Label,
 				config.TmpFolder,
-				config.DbPath,
+				config.Paths,
+				config.Include,
+				config.Exclude,
+				config.Compression,
 			)
+			dataSourceOptions[config.Label] = config.Options
 		default:
 			log.Fatal("Unsupported database type")
 		}
@@ -122,6 +248,7 @@ func NewApp(config AppConfig) *App {
 		}
 		db.Backup = mysql.NewBackupDaoMysql(dbConn)
 		db.DriveFile = mysql.NewDriveFileDaoMysql(dbConn)
+		db.BackupRun = mysql.NewBackupRunDaoMysql(dbConn)
 		db.Health = lib.NewHealthMysql(dbConn)
 	case PostgresDbConfig:
 		dbConn, err := lib.NewPostgresConnection(
@@ -137,6 +264,7 @@ func NewApp(config AppConfig) *App {
 		}
 		db.Backup = postgres.NewBackupDaoPostgres(dbConn)
 		db.DriveFile = postgres.NewDriveFileDaoPostgres(dbConn)
+		db.BackupRun = postgres.NewBackupRunDaoPostgres(dbConn)
 		db.Health = lib.NewHealthPostgres(dbConn)
 	case SqliteDbConfig:
 		dbConn, err := lib.NewSqliteConnection(config.DbPath)
@@ -145,11 +273,13 @@ func NewApp(config AppConfig) *App {
 		}
 		db.Backup = sqlite.NewBackupDaoSqlite(dbConn)
 		db.DriveFile = sqlite.NewDriveFileDaoSqlite(dbConn)
+		db.BackupRun = sqlite.NewBackupRunDaoSqlite(dbConn)
 		db.Health = lib.NewHealthSqlite(dbConn)
 	case MemoryDbConfig:
 		memoryDb := memory.NewMemoryDb()
 		db.Backup = memory.NewBackupDaoMemory(memoryDb)
 		db.DriveFile = memory.NewDriveFileDaoMemory(memoryDb)
+		db.BackupRun = memory.NewBackupRunDaoMemory(memoryDb)
 		db.Health = lib.MockUpHelthChecker{}
 	default:
 		log.Fatal("Unsupported dao type")
@@ -190,7 +320,9 @@ func NewApp(config AppConfig) *App {
 	}
 
 	app.Dumpers = dumpers
+	app.DataSourceOptions = dataSourceOptions
 	app.Drives = drives
+	app.DriveOptions = driveOptions
 	app.Db = db
 	app.Notifiers = notifiers
 
@@ -198,9 +330,34 @@ func NewApp(config AppConfig) *App {
 	app.Http.AppUrl = config.Http.AppUrl
 	app.Http.BackupJob.Enabled = config.Http.BackupJob.Enabled
 	app.Http.BackupJob.Cron = config.Http.BackupJob.Cron
+	app.Http.RetryJob = config.Http.RetryJob
 
 	app.Retention.Enabled = config.Retention.Enabled
 	app.Retention.Days = config.Retention.Days
+	app.Limiter = NewLimiter(config.Concurrency, driveOptions)
+	app.Running = NewRunningBackups()
 
 	return &app
 }
+
+func NewSqlDumpOptions(tableFilter TableFilterConfig, masking []MaskingRuleConfig, parallelism int, format string) dumper.SqlDumpOptions {
+	options := dumper.SqlDumpOptions{
+		TableFilter: dumper.TableFilter{
+			IncludeTables:    tableFilter.IncludeTables,
+			ExcludeTables:    tableFilter.ExcludeTables,
+			SchemaOnlyTables: tableFilter.SchemaOnlyTables,
+			Where:            tableFilter.Where,
+		},
+		Parallelism: parallelism,
+		Format:      format,
+	}
+	for _, rule := range masking {
+		options.Masking = append(options.Masking, dumper.MaskingRule{
+			Table:    rule.Table,
+			Column:   rule.Column,
+			Strategy: rule.Strategy,
+			Value:    rule.Value,
+		})
+	}
+	return options
+}
@@ -1,5 +1,7 @@
 package application
 
+import "time"
+
 type HttpConfig struct {
 	AppUrl    string
 	ApiKeys   []string
@@ -7,18 +9,58 @@ type HttpConfig struct {
 		Enabled bool
 		Cron    string
 	}
+	RetryJob RetryJobConfig
+}
+
+// RetryJobConfig schedules the upload of the failed drive files of recent
+// backups whose dump is still present
+type RetryJobConfig struct {
+	Enabled bool
+	Cron    string
+	// Age of the oldest backup retried
+	MaxAge time.Duration
+	// Upload attempts of a drive file after which it is not retried anymore
+	MaxAttempts int
 }
 
 type DriveConfig interface{}
+
+// Options shared by every drive provider
+type DriveOptions struct {
+	Retry RetryConfig
+	// Uploads to the drive at the same time, only limited by the uploads of
+	// ConcurrencyConfig when zero
+	Concurrency int
+	// Maximum duration of each upload attempt, no limit when zero
+	UploadTimeout time.Duration
+	// Store the dumps as deduplicated chunks, see drive.DedupDrive
+	Dedup bool
+	// Split the dumps into volumes of at most this size in bytes, see
+	// drive.VolumeDrive. Not split when zero.
+	MaxFileSize int64
+}
+
+// RetryConfig retries a failed upload with an exponential backoff: the delay
+// starts at InitialDelay and doubles after each attempt, up to MaxDelay
+type RetryConfig struct {
+	// Upload attempts, a single attempt when zero
+	Attempts     int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	// Fraction of the delay randomly added or removed, between 0 and 1
+	Jitter float64
+}
 type LocalDriveConfig struct {
-	Label  string
-	Folder string
+	Label   string
+	Folder  string
+	Options DriveOptions
 }
 type GoogleDriveConfig struct {
 	Label            string
 	Folder           string
 	ClientSecretFile string
 	TokenFile        string
+	Options          DriveOptions
 }
 type S3DriveConfig struct {
 	Label          string
@@ -29,9 +71,53 @@ type S3DriveConfig struct {
 	Endpoint       string
 	Prefix         string
 	ForcePathStyle bool
+	Options        DriveOptions
 }
 
 type DataSourceConfig interface{}
+
+// Options shared by every data source provider
+type DataSourceOptions struct {
+	// Labels of the drives receiving the dumps. Empty means every drive.
+	Drives      []string
+	Incremental IncrementalConfig
+	Hooks       HooksConfig
+	// Maximum duration of each dump, no limit when zero
+	DumpTimeout time.Duration
+	// Upload the dumps while they are written to the drives able to, without
+	// temporary file when every drive is
+	Streaming bool
+}
+
+// HooksConfig holds the commands run around the backups of a data source
+type HooksConfig struct {
+	PreDump    []string
+	PostDump   []string
+	PostUpload []string
+	OnFailure  []string
+	// Maximum duration of each hook, DEFAULT_HOOK_TIMEOUT of the service package
+	// when zero
+	Timeout time.Duration
+}
+
+// IncrementalConfig schedules the incremental backups taken between two full
+// backups
+type IncrementalConfig struct {
+	Enabled bool
+	Cron    string
+}
+type TableFilterConfig struct {
+	IncludeTables    []string
+	ExcludeTables    []string
+	SchemaOnlyTables []string
+	Where            map[string]string
+}
+type MaskingRuleConfig struct {
+	Table    string
+	Column   string
+	Strategy string
+	Value    string
+}
 type MysqlDataSourceConfig struct {
 	Label     string
 	TmpFolder string
@@ -40,7 +126,17 @@ type MysqlDataSourceConfig struct {
 	User      string
 	Password  string
 	Database  string
-	Tls       string
+	// Patterns of the databases discovered on the server, used instead of Database
+	Databases   []string
+	Tls         string
+	TableFilter TableFilterConfig
+	Masking     []MaskingRuleConfig
+	Parallelism int
+	// EXPORT_FORMAT_* of the dumper package
+	Format string
+	// Replica server id used to read the binary log for incremental backups
+	ServerId uint32
+	Options  DataSourceOptions
 }
 type PostgresDataSourceConfig struct {
 	Label     string
@@ -50,12 +146,81 @@ type PostgresDataSourceConfig struct {
 	User      string
 	Password  string
 	Database  string
-	Tls       bool
+	// Patterns of the databases discovered on the server, used instead of Database
+	Databases   []string
+	Tls         bool
+	TableFilter TableFilterConfig
+	Masking     []MaskingRuleConfig
+	Parallelism int
+	// EXPORT_FORMAT_* of the dumper package
+	Format  string
+	Pitr    PitrConfig
+	Options DataSourceOptions
+}
+
+// PitrConfig replaces the logical dumps of a PostgreSQL data source by base
+// backups, completed by the WAL segments archived by the server
+type PitrConfig struct {
+	Enabled bool
+	// Path of the pg_basebackup executable, found in PATH when empty
+	PgBasebackup string
 }
 type SqliteDataSourceConfig struct {
 	Label     string
 	TmpFolder string
 	DbPath    string
+	// EXPORT_FORMAT_* of the dumper package
+	Format  string
+	Options DataSourceOptions
+}
+type ExecDataSourceConfig struct {
+	Label         string
+	TmpFolder     string
+	Host          string
+	Port          int
+	User          string
+	Password      string
+	Database      string
+	Command       []string
+	HealthCommand []string
+	Env           map[string]string
+	Timeout       time.Duration
+	FileExtension string
+	Options       DataSourceOptions
+}
+type MongodbDataSourceConfig struct {
+	Label              string
+	TmpFolder          string
+	Uri                string
+	Database           string
+	IncludeCollections []string
+	ExcludeCollections []string
+	Options            DataSourceOptions
+}
+type RedisDataSourceConfig struct {
+	Label     string
+	TmpFolder string
+	Host      string
+	Port      int
+	User      string
+	Password  string
+	Tls       bool
+	// Certificate authorities, client certificate and verification of the
+	// TLS connection
+	TlsCaFile     string
+	TlsCertFile   string
+	TlsKeyFile    string
+	TlsSkipVerify bool
+	Options       DataSourceOptions
+}
+type FilesystemDataSourceConfig struct {
+	Label       string
+	TmpFolder   string
+	Paths       []string
+	Include     []string
+	Exclude     []string
+	Compression string
+	Options     DataSourceOptions
 }
 
 type DbConfig interface{}
@@ -106,6 +271,15 @@ type NotifierConfig struct {
 	Webhooks []WebhookNotifierConfig
 }
 
+// ConcurrencyConfig limits the dumps and the uploads running at the same time,
+// across every backup
+type ConcurrencyConfig struct {
+	// Databases dumped at the same time, one when zero
+	Dumps int
+	// Uploads at the same time to all the drives, one when zero
+	Uploads int
+}
+
 type RetentionConfig struct {
 	Enabled bool
 	Days    int
@@ -124,5 +298,6 @@ type AppConfig struct {
 	Db          DbConfig
 	Notifiers   NotifierConfig
 	Retention   RetentionConfig
+	Concurrency ConcurrencyConfig
 	Version     VersionConfig
 }
@@ -0,0 +1,138 @@
+package application
+
+import "context"
+
+// Limiter bounds the dumps and the uploads running at the same time, across
+// every backup of the application. A nil limiter does not limit anything.
+type Limiter struct {
+	dumps   chan struct{}
+	uploads chan struct{}
+	// Upload slots of the drives having their own limit, by drive label
+	drives map[string]chan struct{}
+	// Held while the slots of a streamed dump are reserved
+	streams chan struct{}
+}
+
+func NewLimiter(config ConcurrencyConfig, driveOptions map[string]DriveOptions) *Limiter {
+	limiter := &Limiter{
+		dumps:   make(chan struct{}, max(config.Dumps, 1)),
+		uploads: make(chan struct{}, max(config.Uploads, 1)),
+		drives:  make(map[string]chan struct{}),
+		streams: make(chan struct{}, 1),
+	}
+	for label, options := range driveOptions {
+		if options.Concurrency > 0 {
+			limiter.drives[label] = make(chan struct{}, options.Concurrency)
+		}
+	}
+	return limiter
+}
+
+// AcquireDump blocks until a dump can start, ReleaseDump is called once the
+// dump is done. The error of ctx is returned when it is done first.
+func (l *Limiter) AcquireDump(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	select {
+	case l.dumps <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *Limiter) ReleaseDump() {
+	if l == nil {
+		return
+	}
+	<-l.dumps
+}
+
+// AcquireUpload blocks until an upload to the drive can start, the slot of the
+// drive being taken before the global one
+func (l *Limiter) AcquireUpload(ctx context.Context, driveLabel string) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	drive, ok := l.drives[driveLabel]
+	if ok {
+		select {
+		case drive <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	select {
+	case l.uploads <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		if ok {
+			<-drive
+		}
+		return ctx.Err()
+	}
+}
+
+func (l *Limiter) ReleaseUpload(driveLabel string) {
+	if l == nil {
+		return
+	}
+	<-l.uploads
+	if drive, ok := l.drives[driveLabel]; ok {
+		<-drive
+	}
+}
+
+// AcquireStream blocks until a dump can be streamed to the drives, taking a
+// slot of each drive but a single global slot. One stream reserves at a time.
+func (l *Limiter) AcquireStream(ctx context.Context, driveLabels []string) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	select {
+	case l.streams <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-l.streams }()
+
+	acquired := make([]chan struct{}, 0, len(driveLabels))
+	release := func() {
+		for _, drive := range acquired {
+			<-drive
+		}
+	}
+	for _, label := range driveLabels {
+		drive, ok := l.drives[label]
+		if !ok {
+			continue
+		}
+		select {
+		case drive <- struct{}{}:
+			acquired = append(acquired, drive)
+		case <-ctx.Done():
+			release()
+			return ctx.Err()
+		}
+	}
+	select {
+	case l.uploads <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		release()
+		return ctx.Err()
+	}
+}
+
+func (l *Limiter) ReleaseStream(driveLabels []string) {
+	if l == nil {
+		return
+	}
+	<-l.uploads
+	for _, label := range driveLabels {
+		if drive, ok := l.drives[label]; ok {
+			<-drive
+		}
+	}
+}
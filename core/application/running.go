@@ -0,0 +1,82 @@
+package application
+
+import (
+	"context"
+	"sync"
+)
+
+// RunningBackups holds the cancel functions of the backups being run by the
+// application, so they can be cancelled while they dump or upload. A nil
+// registry does not track anything.
+type RunningBackups struct {
+	// A backup started twice, e.g. retried while it runs, has several cancels
+	cancels map[string]map[*runningBackup]bool
+	mu      sync.Mutex
+	// Signaled when no backup is running anymore
+	idle *sync.Cond
+}
+
+type runningBackup struct {
+	cancel context.CancelFunc
+}
+
+func NewRunningBackups() *RunningBackups {
+	r := &RunningBackups{cancels: make(map[string]map[*runningBackup]bool)}
+	r.idle = sync.NewCond(&r.mu)
+	return r
+}
+
+// Start returns the context of a backup, done when the backup is cancelled or
+// when ctx is done. The returned function is called once the backup is over.
+func (r *RunningBackups) Start(ctx context.Context, backupId string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	if r == nil {
+		return ctx, cancel
+	}
+	running := &runningBackup{cancel: cancel}
+	r.mu.Lock()
+	if r.cancels[backupId] == nil {
+		r.cancels[backupId] = make(map[*runningBackup]bool)
+	}
+	r.cancels[backupId][running] = true
+	r.mu.Unlock()
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.cancels[backupId], running)
+		if len(r.cancels[backupId]) == 0 {
+			delete(r.cancels, backupId)
+		}
+		if len(r.cancels) == 0 {
+			r.idle.Broadcast()
+		}
+		r.mu.Unlock()
+		cancel()
+	}
+}
+
+// Wait returns once no backup is running
+func (r *RunningBackups) Wait() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for len(r.cancels) > 0 {
+		r.idle.Wait()
+	}
+}
+
+// Cancel cancels the context of a running backup, it returns false when the
+// backup is not running
+func (r *RunningBackups) Cancel(backupId string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runnings, ok := r.cancels[backupId]
+	for running := range runnings {
+		running.cancel()
+	}
+	return ok
+}
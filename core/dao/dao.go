@@ -9,23 +9,42 @@ import (
 
 type BackupDao interface {
 	Create(data model.Backup) (string, error)
+	// Import records a backup with its id and creation date
+	Import(data model.Backup) error
 	Update(id string, data model.Backup) (string, error)
 	ReadFullById(Id string) (*model.BackupFull, error)
 	ReadAllFull() ([]model.BackupFull, error)
 	ReadOrError(id string) (*model.Backup, error)
 	ReadOlderThan(date time.Time) ([]model.BackupFull, error)
+	ReadByRunId(runId string) ([]model.BackupFull, error)
+	ReadByStatus(status string) ([]model.BackupFull, error)
+	// ReadByPosition returns the backups of a kind of a data source whose
+	// position is between from and to, an empty bound being ignored
+	ReadByPosition(label, kind, from, to string) ([]model.BackupFull, error)
+	// ReadRetryOf returns the backup dumping a failed backup again, nil when
+	// the failed backup was not dumped again
+	ReadRetryOf(id string) (*model.Backup, error)
 	Delete(id string) error
 }
 
 type DriveFileDao interface {
 	Create(data model.DriveFile) (string, error)
+	// Import records a drive file with its id and creation date
+	Import(data model.DriveFile) error
 	Update(Id string, data model.DriveFile) (string, error)
 	ReadOrError(id string) (*model.DriveFile, error)
 	Delete(id string) error
 }
 
+type BackupRunDao interface {
+	Create(data model.BackupRun) (string, error)
+	Update(id string, data model.BackupRun) (string, error)
+	ReadOrError(id string) (*model.BackupRun, error)
+}
+
 type Dao struct {
 	Backup    BackupDao
 	DriveFile DriveFileDao
+	BackupRun BackupRunDao
 	Health    lib.HealthChecker
 }
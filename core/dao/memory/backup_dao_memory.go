@@ -17,15 +17,22 @@ func NewBackupDaoMemory(db *MemoryDb) *BackupDaoMemory {
 	}
 }
 
+// ReadOrError returns a copy of the stored backup, which can be updated while
+// the backup is used elsewhere
 func (dao *BackupDaoMemory) ReadOrError(id string) (*model.Backup, error) {
 	backup := dao.db.Backup.ReadById(id)
 	if backup == nil {
 		return nil, fmt.Errorf("no backup found with id %s", id)
 	}
-	return backup, nil
+	copied := *backup
+	return &copied, nil
 }
 
 func (dao *BackupDaoMemory) Create(data model.Backup) (string, error) {
+	// Set on insert, like the default value of the SQL databases
+	if data.CreatedAt.IsZero() {
+		data.CreatedAt = time.Now()
+	}
 	result, err := dao.db.Backup.Create(&data)
 	if err != nil {
 		return "", err
@@ -33,6 +40,11 @@ func (dao *BackupDaoMemory) Create(data model.Backup) (string, error) {
 	return result.Id, nil
 }
 
+func (dao *BackupDaoMemory) Import(data model.Backup) error {
+	_, err := dao.db.Backup.Insert(&data)
+	return err
+}
+
 func (dao *BackupDaoMemory) Update(id string, data model.Backup) (string, error) {
 	_, err := dao.db.Backup.Update(id, &data)
 	if err != nil {
@@ -50,7 +62,7 @@ func (dao *BackupDaoMemory) ReadFullById(id string) (*model.BackupFull, error) {
 	var backupDriveFiles []*model.DriveFile
 	for _, driveFile := range driveFiles {
 		if driveFile.BackupId == id {
-			backupDriveFiles = append(backupDriveFiles, driveFile)
+			backupDriveFiles = append(backupDriveFiles, copyDriveFile(driveFile))
 		}
 	}
 	backupFull := &model.BackupFull{
@@ -58,6 +70,14 @@ func (dao *BackupDaoMemory) ReadFullById(id string) (*model.BackupFull, error) {
 		Status:     backup.Status,
 		Label:      backup.Label,
 		DumpPath:   backup.DumpPath,
+		Error:      backup.Error,
+		FileCount:  backup.FileCount,
+		TotalSize:  backup.TotalSize,
+		Kind:       backup.Kind,
+		ParentId:   backup.ParentId,
+		Position:   backup.Position,
+		RetryOfId:  backup.RetryOfId,
+		RunId:      backup.RunId,
 		CreatedAt:  backup.CreatedAt,
 		DriveFiles: backupDriveFiles,
 	}
@@ -72,7 +92,7 @@ func (dao *BackupDaoMemory) ReadAllFull() ([]model.BackupFull, error) {
 		var backupDriveFiles []*model.DriveFile
 		for _, driveFile := range driveFiles {
 			if driveFile.BackupId == backup.Id {
-				backupDriveFiles = append(backupDriveFiles, driveFile)
+				backupDriveFiles = append(backupDriveFiles, copyDriveFile(driveFile))
 			}
 		}
 		backupFull := model.BackupFull{
@@ -80,6 +100,14 @@ func (dao *BackupDaoMemory) ReadAllFull() ([]model.BackupFull, error) {
 			Status:     backup.Status,
 			Label:      backup.Label,
 			DumpPath:   backup.DumpPath,
+			Error:      backup.Error,
+			FileCount:  backup.FileCount,
+			TotalSize:  backup.TotalSize,
+			Kind:       backup.Kind,
+			ParentId:   backup.ParentId,
+			Position:   backup.Position,
+			RetryOfId:  backup.RetryOfId,
+			RunId:      backup.RunId,
 			CreatedAt:  backup.CreatedAt,
 			DriveFiles: backupDriveFiles,
 		}
@@ -97,7 +125,7 @@ func (dao *BackupDaoMemory) ReadOlderThan(date time.Time) ([]model.BackupFull, e
 			var backupDriveFiles []*model.DriveFile
 			for _, driveFile := range driveFiles {
 				if driveFile.BackupId == backup.Id {
-					backupDriveFiles = append(backupDriveFiles, driveFile)
+					backupDriveFiles = append(backupDriveFiles, copyDriveFile(driveFile))
 				}
 			}
 			backupFull := model.BackupFull{
@@ -105,6 +133,14 @@ func (dao *BackupDaoMemory) ReadOlderThan(date time.Time) ([]model.BackupFull, e
 				Status:     backup.Status,
 				Label:      backup.Label,
 				DumpPath:   backup.DumpPath,
+				Error:      backup.Error,
+				FileCount:  backup.FileCount,
+				TotalSize:  backup.TotalSize,
+				Kind:       backup.Kind,
+				ParentId:   backup.ParentId,
+				Position:   backup.Position,
+				RetryOfId:  backup.RetryOfId,
+				RunId:      backup.RunId,
 				CreatedAt:  backup.CreatedAt,
 				DriveFiles: backupDriveFiles,
 			}
@@ -114,6 +150,71 @@ func (dao *BackupDaoMemory) ReadOlderThan(date time.Time) ([]model.BackupFull, e
 	return backupFullList, nil
 }
 
+func (dao *BackupDaoMemory) ReadByRunId(runId string) ([]model.BackupFull, error) {
+	return dao.readFullWhere(func(backup model.Backup) bool {
+		return backup.RunId == runId
+	}), nil
+}
+
+func (dao *BackupDaoMemory) ReadByStatus(status string) ([]model.BackupFull, error) {
+	return dao.readFullWhere(func(backup model.Backup) bool {
+		return backup.Status == status
+	}), nil
+}
+
+func (dao *BackupDaoMemory) ReadByPosition(label, kind, from, to string) ([]model.BackupFull, error) {
+	return dao.readFullWhere(func(backup model.Backup) bool {
+		if backup.Label != label || backup.Kind != kind {
+			return false
+		}
+		return (from == "" || backup.Position >= from) && (to == "" || backup.Position <= to)
+	}), nil
+}
+
+func (dao *BackupDaoMemory) ReadRetryOf(id string) (*model.Backup, error) {
+	for _, backup := range dao.db.Backup.ReadAll() {
+		if backup.RetryOfId == id {
+			copied := *backup
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+// readFullWhere returns the backups kept by keep with their drive files
+func (dao *BackupDaoMemory) readFullWhere(keep func(backup model.Backup) bool) []model.BackupFull {
+	backupFullList := make([]model.BackupFull, 0)
+	driveFiles := dao.db.DriveFile.ReadAll()
+	for _, backup := range dao.db.Backup.ReadAll() {
+		if !keep(*backup) {
+			continue
+		}
+		var backupDriveFiles []*model.DriveFile
+		for _, driveFile := range driveFiles {
+			if driveFile.BackupId == backup.Id {
+				backupDriveFiles = append(backupDriveFiles, copyDriveFile(driveFile))
+			}
+		}
+		backupFullList = append(backupFullList, model.BackupFull{
+			Id:         backup.Id,
+			Status:     backup.Status,
+			Label:      backup.Label,
+			DumpPath:   backup.DumpPath,
+			Error:      backup.Error,
+			FileCount:  backup.FileCount,
+			TotalSize:  backup.TotalSize,
+			Kind:       backup.Kind,
+			ParentId:   backup.ParentId,
+			Position:   backup.Position,
+			RetryOfId:  backup.RetryOfId,
+			RunId:      backup.RunId,
+			CreatedAt:  backup.CreatedAt,
+			DriveFiles: backupDriveFiles,
+		})
+	}
+	return backupFullList
+}
+
 func (dao *BackupDaoMemory) Delete(id string) error {
 	backup := dao.db.Backup.ReadById(id)
 	if backup == nil {
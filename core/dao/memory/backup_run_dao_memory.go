@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"fmt"
+
+	"github.com/herytz/backupman/core/model"
+)
+
+type BackupRunDaoMemory struct {
+	db *MemoryDb
+}
+
+func NewBackupRunDaoMemory(db *MemoryDb) *BackupRunDaoMemory {
+	return &BackupRunDaoMemory{
+		db: db,
+	}
+}
+
+func (dao *BackupRunDaoMemory) ReadOrError(id string) (*model.BackupRun, error) {
+	run := dao.db.BackupRun.ReadById(id)
+	if run == nil {
+		return nil, fmt.Errorf("no backup run found with id %s", id)
+	}
+	copied := *run
+	return &copied, nil
+}
+
+func (dao *BackupRunDaoMemory) Create(data model.BackupRun) (string, error) {
+	result, err := dao.db.BackupRun.Create(&data)
+	if err != nil {
+		return "", err
+	}
+	return result.Id, nil
+}
+
+func (dao *BackupRunDaoMemory) Update(id string, data model.BackupRun) (string, error) {
+	result, err := dao.db.BackupRun.Update(id, &data)
+	if err != nil {
+		return "", err
+	}
+	return result.Id, nil
+}
@@ -24,6 +24,11 @@ func (dao *DriveFileDaoMemory) Create(data model.DriveFile) (string, error) {
 	return result.Id, nil
 }
 
+func (dao *DriveFileDaoMemory) Import(data model.DriveFile) error {
+	_, err := dao.db.DriveFile.Insert(&data)
+	return err
+}
+
 func (dao *DriveFileDaoMemory) Update(id string, data model.DriveFile) (string, error) {
 	result, err := dao.db.DriveFile.Update(id, &data)
 	if err != nil {
@@ -37,15 +42,30 @@ func (dao *DriveFileDaoMemory) ReadOrError(id string) (*model.DriveFile, error)
 	if driveFile == nil {
 		return nil, fmt.Errorf("no drive file found with id %s", id)
 	}
-	return driveFile, nil
+	return copyDriveFile(driveFile), nil
 }
 
 func (dao *DriveFileDaoMemory) ReadById(id string) *model.DriveFile {
-	return dao.db.DriveFile.ReadById(id)
+	driveFile := dao.db.DriveFile.ReadById(id)
+	if driveFile == nil {
+		return nil
+	}
+	return copyDriveFile(driveFile)
 }
 
 func (dao *DriveFileDaoMemory) ReadAll() []*model.DriveFile {
-	return dao.db.DriveFile.ReadAll()
+	driveFiles := dao.db.DriveFile.ReadAll()
+	for i, driveFile := range driveFiles {
+		driveFiles[i] = copyDriveFile(driveFile)
+	}
+	return driveFiles
+}
+
+// copyDriveFile copies a stored drive file, so the drive files read can be
+// updated while other goroutines read the stored ones
+func copyDriveFile(driveFile *model.DriveFile) *model.DriveFile {
+	copied := *driveFile
+	return &copied
 }
 
 func (dao *DriveFileDaoMemory) Delete(id string) error {
@@ -5,11 +5,13 @@ import "github.com/herytz/backupman/core/model"
 type MemoryDb struct {
 	Backup    *MemoryDbCrud[*model.Backup]
 	DriveFile *MemoryDbCrud[*model.DriveFile]
+	BackupRun *MemoryDbCrud[*model.BackupRun]
 }
 
 func NewMemoryDb() *MemoryDb {
 	return &MemoryDb{
 		Backup:    NewMemoryDbCrud[*model.Backup]("backup"),
 		DriveFile: NewMemoryDbCrud[*model.DriveFile]("drive_file"),
+		BackupRun: NewMemoryDbCrud[*model.BackupRun]("backup_run"),
 	}
 }
@@ -2,6 +2,7 @@ package memory
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/google/uuid"
 )
@@ -11,9 +12,12 @@ type Identifiable interface {
 	GetId() string
 }
 
+// MemoryDbCrud is a table of the memory database. The table can be used by
+// several goroutines, the stored items are not copied though.
 type MemoryDbCrud[T Identifiable] struct {
 	table string
 	data  map[string]*T
+	mu    sync.RWMutex
 }
 
 func NewMemoryDbCrud[T Identifiable](table string) *MemoryDbCrud[T] {
@@ -24,13 +28,29 @@ func NewMemoryDbCrud[T Identifiable](table string) *MemoryDbCrud[T] {
 }
 
 func (dao *MemoryDbCrud[T]) Create(data T) (T, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
 	id := uuid.NewString()
 	dao.data[id] = &data
 	data.SetId(id)
 	return data, nil
 }
 
+// Insert stores an item with its own id
+func (dao *MemoryDbCrud[T]) Insert(data T) (T, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	id := data.GetId()
+	if dao.data[id] != nil {
+		return data, fmt.Errorf("%s with id %s already exists", dao.table, id)
+	}
+	dao.data[id] = &data
+	return data, nil
+}
+
 func (dao *MemoryDbCrud[T]) Update(id string, data T) (T, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
 	if dao.data[id] == nil {
 		return data, fmt.Errorf("could not update %s with id %s", dao.table, id)
 	}
@@ -39,10 +59,19 @@ func (dao *MemoryDbCrud[T]) Update(id string, data T) (T, error) {
 }
 
 func (dao *MemoryDbCrud[T]) ReadById(id string) T {
-	return *dao.data[id]
+	dao.mu.RLock()
+	defer dao.mu.RUnlock()
+	item, ok := dao.data[id]
+	if !ok {
+		var zero T
+		return zero
+	}
+	return *item
 }
 
 func (dao *MemoryDbCrud[T]) ReadAll() []T {
+	dao.mu.RLock()
+	defer dao.mu.RUnlock()
 	var result []T
 	for _, item := range dao.data {
 		result = append(result, *item)
@@ -51,6 +80,8 @@ func (dao *MemoryDbCrud[T]) ReadAll() []T {
 }
 
 func (dao *MemoryDbCrud[T]) Delete(id string) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
 	if dao.data[id] == nil {
 		return fmt.Errorf("could not delete %s with id %s", dao.table, id)
 	}
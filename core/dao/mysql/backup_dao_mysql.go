@@ -20,10 +20,17 @@ func NewBackupDaoMysql(db *sql.DB) *BackupDaoMysql {
 
 func (dao *BackupDaoMysql) readById(id string, errorIfNotExists bool) (*model.Backup, error) {
 	var backup model.Backup
-	row := dao.db.QueryRow("SELECT * FROM backups WHERE id = ?", id)
+	row := dao.db.QueryRow("SELECT id, status, label, dump_path, error, file_count, total_size, kind, parent_id, position, retry_of_id, run_id, created_at, updated_at FROM backups WHERE id = ?", id)
+	var dumpPath, backupError sql.NullString
+	var fileCount, totalSize sql.NullInt64
+	var kind sql.NullString
+	var parentId sql.NullString
+	var position sql.NullString
+	var retryOfId sql.NullString
+	var runId sql.NullString
 	var createdAt lib.SqlNonNullableTime
 	var updatedAt lib.SqlNullableTime
-	err := row.Scan(&backup.Id, &backup.Status, &backup.Label, &backup.DumpPath, &createdAt, &updatedAt)
+	err := row.Scan(&backup.Id, &backup.Status, &backup.Label, &dumpPath, &backupError, &fileCount, &totalSize, &kind, &parentId, &position, &retryOfId, &runId, &createdAt, &updatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			if errorIfNotExists {
@@ -34,6 +41,15 @@ func (dao *BackupDaoMysql) readById(id string, errorIfNotExists bool) (*model.Ba
 		}
 		return nil, fmt.Errorf("failed to read backup by id => %s", err)
 	}
+	backup.DumpPath = dumpPath.String
+	backup.Error = backupError.String
+	backup.FileCount = fileCount.Int64
+	backup.TotalSize = totalSize.Int64
+	backup.Kind = kind.String
+	backup.ParentId = parentId.String
+	backup.Position = position.String
+	backup.RetryOfId = retryOfId.String
+	backup.RunId = runId.String
 	backup.CreatedAt = createdAt.Time
 	if updatedAt.Valid {
 		backup.UpdatedAt = updatedAt.Time
@@ -47,15 +63,23 @@ func (dao *BackupDaoMysql) ReadOrError(id string) (*model.Backup, error) {
 
 func (dao *BackupDaoMysql) Create(data model.Backup) (string, error) {
 	id := uuid.NewString()
-	_, err := dao.db.Exec("INSERT INTO backups (id, status, label, dump_path) VALUES (?, ?, ?, ?)", id, data.Status, data.Label, data.DumpPath)
+	_, err := dao.db.Exec("INSERT INTO backups (id, status, label, dump_path, error, file_count, total_size, kind, parent_id, position, retry_of_id, run_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", id, data.Status, data.Label, data.DumpPath, data.Error, data.FileCount, data.TotalSize, data.Kind, data.ParentId, data.Position, data.RetryOfId, data.RunId)
 	if err != nil {
 		return "", fmt.Errorf("failed to insert backup => %s", err)
 	}
 	return id, nil
 }
 
+func (dao *BackupDaoMysql) Import(data model.Backup) error {
+	_, err := dao.db.Exec("INSERT INTO backups (id, status, label, dump_path, error, file_count, total_size, kind, parent_id, position, retry_of_id, run_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", data.Id, data.Status, data.Label, data.DumpPath, data.Error, data.FileCount, data.TotalSize, data.Kind, data.ParentId, data.Position, data.RetryOfId, data.RunId, data.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to import backup => %s", err)
+	}
+	return nil
+}
+
 func (dao *BackupDaoMysql) Update(id string, data model.Backup) (string, error) {
-	_, err := dao.db.Exec("UPDATE backups SET status = ?, label = ?, dump_path = ? WHERE id = ?", data.Status, data.Label, data.DumpPath, id)
+	_, err := dao.db.Exec("UPDATE backups SET status = ?, label = ?, dump_path = ?, error = ?, file_count = ?, total_size = ?, kind = ?, parent_id = ?, position = ?, retry_of_id = ?, run_id = ? WHERE id = ?", data.Status, data.Label, data.DumpPath, data.Error, data.FileCount, data.TotalSize, data.Kind, data.ParentId, data.Position, data.RetryOfId, data.RunId, id)
 	if err != nil {
 		return "", fmt.Errorf("failed to update backup => %s", err)
 	}
@@ -70,25 +94,44 @@ func (dao *BackupDaoMysql) scanFullBackup(rows *sql.Rows) (map[string]*model.Bac
 			Status    string
 			Label     string
 			DumpPath  sql.NullString
+			Error     sql.NullString
+			FileCount sql.NullInt64
+			TotalSize sql.NullInt64
+			Kind      sql.NullString
+			ParentId  sql.NullString
+			Position  sql.NullString
+			RetryOfId sql.NullString
+			RunId     sql.NullString
 			CreatedAt lib.SqlNonNullableTime
 			UpdatedAt lib.SqlNullableTime
 		}
 
 		var driveFileScan struct {
-			Id        sql.NullString
-			BackupId  sql.NullString
-			Provider  sql.NullString
-			Label     sql.NullString
-			Path      sql.NullString
-			Status    sql.NullString
-			CreatedAt lib.SqlNullableTime
-			UpdatedAt lib.SqlNullableTime
+			Id          sql.NullString
+			BackupId    sql.NullString
+			Provider    sql.NullString
+			Label       sql.NullString
+			Path        sql.NullString
+			Status      sql.NullString
+			Attempts    sql.NullInt64
+			Parts       sql.NullString
+			CatalogPath sql.NullString
+			CreatedAt   lib.SqlNullableTime
+			UpdatedAt   lib.SqlNullableTime
 		}
 		err := rows.Scan(
 			&backupScan.Id,
 			&backupScan.Status,
 			&backupScan.Label,
 			&backupScan.DumpPath,
+			&backupScan.Error,
+			&backupScan.FileCount,
+			&backupScan.TotalSize,
+			&backupScan.Kind,
+			&backupScan.ParentId,
+			&backupScan.Position,
+			&backupScan.RetryOfId,
+			&backupScan.RunId,
 			&backupScan.CreatedAt,
 			&backupScan.UpdatedAt,
 			&driveFileScan.Id,
@@ -97,6 +140,9 @@ func (dao *BackupDaoMysql) scanFullBackup(rows *sql.Rows) (map[string]*model.Bac
 			&driveFileScan.Label,
 			&driveFileScan.Path,
 			&driveFileScan.Status,
+			&driveFileScan.Attempts,
+			&driveFileScan.Parts,
+			&driveFileScan.CatalogPath,
 			&driveFileScan.CreatedAt,
 			&driveFileScan.UpdatedAt,
 		)
@@ -109,6 +155,14 @@ func (dao *BackupDaoMysql) scanFullBackup(rows *sql.Rows) (map[string]*model.Bac
 			Status:    backupScan.Status,
 			Label:     backupScan.Label,
 			DumpPath:  backupScan.DumpPath.String,
+			Error:     backupScan.Error.String,
+			FileCount: backupScan.FileCount.Int64,
+			TotalSize: backupScan.TotalSize.Int64,
+			Kind:      backupScan.Kind.String,
+			ParentId:  backupScan.ParentId.String,
+			Position:  backupScan.Position.String,
+			RetryOfId: backupScan.RetryOfId.String,
+			RunId:     backupScan.RunId.String,
 			CreatedAt: backupScan.CreatedAt.Time,
 			UpdatedAt: backupScan.UpdatedAt.Time,
 		}
@@ -117,17 +171,24 @@ func (dao *BackupDaoMysql) scanFullBackup(rows *sql.Rows) (map[string]*model.Bac
 			results[backupFull.Id] = &backupFull
 		}
 
+		if !driveFileScan.Id.Valid {
+			continue
+		}
+
 		results[backupFull.Id].DriveFiles = append(
 			results[backupFull.Id].DriveFiles,
 			&model.DriveFile{
-				Id:        driveFileScan.Id.String,
-				BackupId:  driveFileScan.BackupId.String,
-				Provider:  driveFileScan.Provider.String,
-				Label:     driveFileScan.Label.String,
-				Path:      driveFileScan.Path.String,
-				Status:    driveFileScan.Status.String,
-				CreatedAt: driveFileScan.CreatedAt.Time,
-				UpdatedAt: driveFileScan.UpdatedAt.Time,
+				Id:          driveFileScan.Id.String,
+				BackupId:    driveFileScan.BackupId.String,
+				Provider:    driveFileScan.Provider.String,
+				Label:       driveFileScan.Label.String,
+				Path:        driveFileScan.Path.String,
+				Status:      driveFileScan.Status.String,
+				Attempts:    int(driveFileScan.Attempts.Int64),
+				Parts:       lib.SplitSqlList(driveFileScan.Parts.String),
+				CatalogPath: driveFileScan.CatalogPath.String,
+				CreatedAt:   driveFileScan.CreatedAt.Time,
+				UpdatedAt:   driveFileScan.UpdatedAt.Time,
 			},
 		)
 	}
@@ -139,7 +200,7 @@ func (dao *BackupDaoMysql) scanFullBackup(rows *sql.Rows) (map[string]*model.Bac
 }
 
 func (dao *BackupDaoMysql) ReadFullById(id string) (*model.BackupFull, error) {
-	rows, err := dao.db.Query("SELECT * FROM backups LEFT JOIN backup_drive_files ON backups.id = backup_drive_files.backup_id WHERE backups.id = ? ORDER BY backups.created_at DESC", id)
+	rows, err := dao.db.Query("SELECT b.id, b.status, b.label, b.dump_path, b.error, b.file_count, b.total_size, b.kind, b.parent_id, b.position, b.retry_of_id, b.run_id, b.created_at, b.updated_at, df.id, df.backup_id, df.provider, df.label, df.path, df.status, df.attempts, df.parts, df.catalog_path, df.created_at, df.updated_at FROM backups b LEFT JOIN backup_drive_files df ON b.id = df.backup_id WHERE b.id = ? ORDER BY b.created_at DESC", id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read backup full by id %s => %v", id, err)
 	}
@@ -155,7 +216,7 @@ func (dao *BackupDaoMysql) ReadFullById(id string) (*model.BackupFull, error) {
 }
 
 func (dao *BackupDaoMysql) ReadAllFull() ([]model.BackupFull, error) {
-	rows, err := dao.db.Query("SELECT * FROM backups LEFT JOIN backup_drive_files ON backups.id = backup_drive_files.backup_id ORDER BY backups.created_at DESC")
+	rows, err := dao.db.Query("SELECT b.id, b.status, b.label, b.dump_path, b.error, b.file_count, b.total_size, b.kind, b.parent_id, b.position, b.retry_of_id, b.run_id, b.created_at, b.updated_at, df.id, df.backup_id, df.provider, df.label, df.path, df.status, df.attempts, df.parts, df.catalog_path, df.created_at, df.updated_at FROM backups b LEFT JOIN backup_drive_files df ON b.id = df.backup_id ORDER BY b.created_at DESC")
 	if err != nil {
 		return nil, fmt.Errorf("failed to read backup all full => %v", err)
 	}
@@ -172,7 +233,7 @@ func (dao *BackupDaoMysql) ReadAllFull() ([]model.BackupFull, error) {
 }
 
 func (dao *BackupDaoMysql) ReadOlderThan(date time.Time) ([]model.BackupFull, error) {
-	rows, err := dao.db.Query("SELECT * FROM backups LEFT JOIN backup_drive_files ON backups.id = backup_drive_files.backup_id WHERE backups.created_at < ? ORDER BY backups.created_at DESC", date)
+	rows, err := dao.db.Query("SELECT b.id, b.status, b.label, b.dump_path, b.error, b.file_count, b.total_size, b.kind, b.parent_id, b.position, b.retry_of_id, b.run_id, b.created_at, b.updated_at, df.id, df.backup_id, df.provider, df.label, df.path, df.status, df.attempts, df.parts, df.catalog_path, df.created_at, df.updated_at FROM backups b LEFT JOIN backup_drive_files df ON b.id = df.backup_id WHERE b.created_at < ? ORDER BY b.created_at DESC", date)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read backup older than %s => %v", date, err)
 	}
@@ -188,6 +249,69 @@ func (dao *BackupDaoMysql) ReadOlderThan(date time.Time) ([]model.BackupFull, er
 	return backups, nil
 }
 
+func (dao *BackupDaoMysql) ReadByRunId(runId string) ([]model.BackupFull, error) {
+	rows, err := dao.db.Query("SELECT b.id, b.status, b.label, b.dump_path, b.error, b.file_count, b.total_size, b.kind, b.parent_id, b.position, b.retry_of_id, b.run_id, b.created_at, b.updated_at, df.id, df.backup_id, df.provider, df.label, df.path, df.status, df.attempts, df.parts, df.catalog_path, df.created_at, df.updated_at FROM backups b LEFT JOIN backup_drive_files df ON b.id = df.backup_id WHERE b.run_id = ? ORDER BY b.created_at DESC", runId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backups of run %s => %v", runId, err)
+	}
+	defer rows.Close()
+	results, err := dao.scanFullBackup(rows)
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]model.BackupFull, 0, len(results))
+	for _, backup := range results {
+		backups = append(backups, *backup)
+	}
+	return backups, nil
+}
+
+func (dao *BackupDaoMysql) ReadByStatus(status string) ([]model.BackupFull, error) {
+	rows, err := dao.db.Query("SELECT b.id, b.status, b.label, b.dump_path, b.error, b.file_count, b.total_size, b.kind, b.parent_id, b.position, b.retry_of_id, b.run_id, b.created_at, b.updated_at, df.id, df.backup_id, df.provider, df.label, df.path, df.status, df.attempts, df.parts, df.catalog_path, df.created_at, df.updated_at FROM backups b LEFT JOIN backup_drive_files df ON b.id = df.backup_id WHERE b.status = ? ORDER BY b.created_at DESC", status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backups with status %s => %v", status, err)
+	}
+	defer rows.Close()
+	results, err := dao.scanFullBackup(rows)
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]model.BackupFull, 0, len(results))
+	for _, backup := range results {
+		backups = append(backups, *backup)
+	}
+	return backups, nil
+}
+
+func (dao *BackupDaoMysql) ReadByPosition(label, kind, from, to string) ([]model.BackupFull, error) {
+	rows, err := dao.db.Query("SELECT b.id, b.status, b.label, b.dump_path, b.error, b.file_count, b.total_size, b.kind, b.parent_id, b.position, b.retry_of_id, b.run_id, b.created_at, b.updated_at, df.id, df.backup_id, df.provider, df.label, df.path, df.status, df.attempts, df.parts, df.catalog_path, df.created_at, df.updated_at FROM backups b LEFT JOIN backup_drive_files df ON b.id = df.backup_id WHERE b.label = ? AND b.kind = ? AND (? = '' OR b.position >= ?) AND (? = '' OR b.position <= ?)", label, kind, from, from, to, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s backups of %s => %v", kind, label, err)
+	}
+	defer rows.Close()
+	results, err := dao.scanFullBackup(rows)
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]model.BackupFull, 0, len(results))
+	for _, backup := range results {
+		backups = append(backups, *backup)
+	}
+	return backups, nil
+}
+
+func (dao *BackupDaoMysql) ReadRetryOf(id string) (*model.Backup, error) {
+	var retryId string
+	err := dao.db.QueryRow("SELECT id FROM backups WHERE retry_of_id = ? LIMIT 1", id).Scan(&retryId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read retry of backup %s => %s", id, err)
+	}
+	return dao.readById(retryId, true)
+}
+
 func (dao *BackupDaoMysql) Delete(id string) error {
 	_, err := dao.db.Exec("DELETE FROM backups WHERE id = ?", id)
 	if err != nil {
@@ -0,0 +1,54 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/herytz/backupman/core/lib"
+	"github.com/herytz/backupman/core/model"
+)
+
+type BackupRunDaoMysql struct {
+	db *sql.DB
+}
+
+func NewBackupRunDaoMysql(db *sql.DB) *BackupRunDaoMysql {
+	return &BackupRunDaoMysql{db: db}
+}
+
+func (dao *BackupRunDaoMysql) ReadOrError(id string) (*model.BackupRun, error) {
+	var run model.BackupRun
+	row := dao.db.QueryRow("SELECT id, trigger_source, api_key, status, started_at, ended_at FROM backup_runs WHERE id = ?", id)
+	var apiKey sql.NullString
+	var startedAt lib.SqlNonNullableTime
+	var endedAt lib.SqlNullableTime
+	err := row.Scan(&run.Id, &run.Trigger, &apiKey, &run.Status, &startedAt, &endedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("no backup run found with id %s", id)
+		}
+		return nil, fmt.Errorf("failed to read backup run by id => %s", err)
+	}
+	run.ApiKey = apiKey.String
+	run.StartedAt = startedAt.Time
+	run.EndedAt = endedAt.Time
+	return &run, nil
+}
+
+func (dao *BackupRunDaoMysql) Create(data model.BackupRun) (string, error) {
+	id := uuid.NewString()
+	_, err := dao.db.Exec("INSERT INTO backup_runs (id, trigger_source, api_key, status, started_at, ended_at) VALUES (?, ?, ?, ?, ?, ?)", id, data.Trigger, data.ApiKey, data.Status, data.StartedAt, sql.NullTime{Time: data.EndedAt, Valid: !data.EndedAt.IsZero()})
+	if err != nil {
+		return "", fmt.Errorf("failed to insert backup run => %s", err)
+	}
+	return id, nil
+}
+
+func (dao *BackupRunDaoMysql) Update(id string, data model.BackupRun) (string, error) {
+	_, err := dao.db.Exec("UPDATE backup_runs SET trigger_source = ?, api_key = ?, status = ?, started_at = ?, ended_at = ? WHERE id = ?", data.Trigger, data.ApiKey, data.Status, data.StartedAt, sql.NullTime{Time: data.EndedAt, Valid: !data.EndedAt.IsZero()}, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to update backup run => %s", err)
+	}
+	return id, nil
+}
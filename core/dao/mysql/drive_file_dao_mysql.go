@@ -19,10 +19,12 @@ func NewDriveFileDaoMysql(db *sql.DB) *DriveFileDaoMysql {
 
 func (dao *DriveFileDaoMysql) readById(id string, errorIfNotExists bool) (*model.DriveFile, error) {
 	var driveFile model.DriveFile
-	row := dao.db.QueryRow("SELECT * FROM backup_drive_files WHERE id = ?", id)
+	row := dao.db.QueryRow("SELECT id, backup_id, provider, label, path, status, attempts, parts, catalog_path, created_at, updated_at FROM backup_drive_files WHERE id = ?", id)
 	var createdAt lib.SqlNonNullableTime
 	var updatedAt lib.SqlNullableTime
-	err := row.Scan(&driveFile.Id, &driveFile.BackupId, &driveFile.Provider, &driveFile.Label, &driveFile.Path, &driveFile.Status, &createdAt, &updatedAt)
+	var parts sql.NullString
+	var catalogPath sql.NullString
+	err := row.Scan(&driveFile.Id, &driveFile.BackupId, &driveFile.Provider, &driveFile.Label, &driveFile.Path, &driveFile.Status, &driveFile.Attempts, &parts, &catalogPath, &createdAt, &updatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			if errorIfNotExists {
@@ -33,6 +35,8 @@ func (dao *DriveFileDaoMysql) readById(id string, errorIfNotExists bool) (*model
 		}
 		return nil, fmt.Errorf("failed to read drive files by id: %v", err)
 	}
+	driveFile.Parts = lib.SplitSqlList(parts.String)
+	driveFile.CatalogPath = catalogPath.String
 	driveFile.CreatedAt = createdAt.Time
 	if updatedAt.Valid {
 		driveFile.UpdatedAt = updatedAt.Time
@@ -46,15 +50,23 @@ func (dao *DriveFileDaoMysql) ReadOrError(id string) (*model.DriveFile, error) {
 
 func (dao *DriveFileDaoMysql) Create(data model.DriveFile) (string, error) {
 	id := uuid.NewString()
-	_, err := dao.db.Exec("INSERT INTO backup_drive_files (id, backup_id, provider, label, path, status) VALUES (?, ?, ?, ?, ?, ?)", id, data.BackupId, data.Provider, data.Label, data.Path, data.Status)
+	_, err := dao.db.Exec("INSERT INTO backup_drive_files (id, backup_id, provider, label, path, status, attempts, parts, catalog_path) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", id, data.BackupId, data.Provider, data.Label, data.Path, data.Status, data.Attempts, lib.JoinSqlList(data.Parts), data.CatalogPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to insert drive file: %v", err)
 	}
 	return id, nil
 }
 
+func (dao *DriveFileDaoMysql) Import(data model.DriveFile) error {
+	_, err := dao.db.Exec("INSERT INTO backup_drive_files (id, backup_id, provider, label, path, status, attempts, parts, catalog_path, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", data.Id, data.BackupId, data.Provider, data.Label, data.Path, data.Status, data.Attempts, lib.JoinSqlList(data.Parts), data.CatalogPath, data.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to import drive file: %v", err)
+	}
+	return nil
+}
+
 func (dao *DriveFileDaoMysql) Update(id string, data model.DriveFile) (string, error) {
-	_, err := dao.db.Exec("UPDATE backup_drive_files SET backup_id = ?, provider = ?, label = ?, path = ?, status = ? WHERE id = ?", data.BackupId, data.Provider, data.Label, data.Path, data.Status, id)
+	_, err := dao.db.Exec("UPDATE backup_drive_files SET backup_id = ?, provider = ?, label = ?, path = ?, status = ?, attempts = ?, parts = ?, catalog_path = ? WHERE id = ?", data.BackupId, data.Provider, data.Label, data.Path, data.Status, data.Attempts, lib.JoinSqlList(data.Parts), data.CatalogPath, id)
 	if err != nil {
 		return "", fmt.Errorf("failed to update drive file: %v", err)
 	}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/herytz/backupman/core/lib"
 	"github.com/herytz/backupman/core/model"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -21,10 +22,16 @@ func NewBackupDaoPostgres(db *pgxpool.Pool) *BackupDaoPostgres {
 
 func (dao *BackupDaoPostgres) readById(id string, errorIfNotExists bool) (*model.Backup, error) {
 	var backup model.Backup
-	var dumpPath *string
+	var dumpPath, backupError *string
+	var fileCount, totalSize *int64
+	var kind *string
+	var parentId *string
+	var position *string
+	var retryOfId *string
+	var runId *string
 	var updatedAt *time.Time
 
-	err := dao.db.QueryRow(context.Background(), "SELECT id, status, label, dump_path, created_at, updated_at FROM backups WHERE id = $1", id).Scan(&backup.Id, &backup.Status, &backup.Label, &dumpPath, &backup.CreatedAt, &updatedAt)
+	err := dao.db.QueryRow(context.Background(), "SELECT id, status, label, dump_path, error, file_count, total_size, kind, parent_id, position, retry_of_id, run_id, created_at, updated_at FROM backups WHERE id = $1", id).Scan(&backup.Id, &backup.Status, &backup.Label, &dumpPath, &backupError, &fileCount, &totalSize, &kind, &parentId, &position, &retryOfId, &runId, &backup.CreatedAt, &updatedAt)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			if errorIfNotExists {
@@ -38,6 +45,30 @@ func (dao *BackupDaoPostgres) readById(id string, errorIfNotExists bool) (*model
 	if dumpPath != nil {
 		backup.DumpPath = *dumpPath
 	}
+	if backupError != nil {
+		backup.Error = *backupError
+	}
+	if fileCount != nil {
+		backup.FileCount = *fileCount
+	}
+	if totalSize != nil {
+		backup.TotalSize = *totalSize
+	}
+	if kind != nil {
+		backup.Kind = *kind
+	}
+	if parentId != nil {
+		backup.ParentId = *parentId
+	}
+	if position != nil {
+		backup.Position = *position
+	}
+	if retryOfId != nil {
+		backup.RetryOfId = *retryOfId
+	}
+	if runId != nil {
+		backup.RunId = *runId
+	}
 	if updatedAt != nil {
 		backup.UpdatedAt = *updatedAt
 	}
@@ -50,15 +81,23 @@ func (dao *BackupDaoPostgres) ReadOrError(id string) (*model.Backup, error) {
 
 func (dao *BackupDaoPostgres) Create(data model.Backup) (string, error) {
 	id := uuid.NewString()
-	_, err := dao.db.Exec(context.Background(), "INSERT INTO backups (id, status, label, dump_path) VALUES ($1, $2, $3, $4)", id, data.Status, data.Label, data.DumpPath)
+	_, err := dao.db.Exec(context.Background(), "INSERT INTO backups (id, status, label, dump_path, error, file_count, total_size, kind, parent_id, position, retry_of_id, run_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)", id, data.Status, data.Label, data.DumpPath, data.Error, data.FileCount, data.TotalSize, data.Kind, data.ParentId, data.Position, data.RetryOfId, data.RunId)
 	if err != nil {
 		return "", fmt.Errorf("failed to insert backup => %s", err)
 	}
 	return id, nil
 }
 
+func (dao *BackupDaoPostgres) Import(data model.Backup) error {
+	_, err := dao.db.Exec(context.Background(), "INSERT INTO backups (id, status, label, dump_path, error, file_count, total_size, kind, parent_id, position, retry_of_id, run_id, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)", data.Id, data.Status, data.Label, data.DumpPath, data.Error, data.FileCount, data.TotalSize, data.Kind, data.ParentId, data.Position, data.RetryOfId, data.RunId, data.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to import backup => %s", err)
+	}
+	return nil
+}
+
 func (dao *BackupDaoPostgres) Update(id string, data model.Backup) (string, error) {
-	_, err := dao.db.Exec(context.Background(), "UPDATE backups SET status = $1, label = $2, dump_path = $3 WHERE id = $4", data.Status, data.Label, data.DumpPath, id)
+	_, err := dao.db.Exec(context.Background(), "UPDATE backups SET status = $1, label = $2, dump_path = $3, error = $4, file_count = $5, total_size = $6, kind = $7, parent_id = $8, position = $9, retry_of_id = $10, run_id = $11 WHERE id = $12", data.Status, data.Label, data.DumpPath, data.Error, data.FileCount, data.TotalSize, data.Kind, data.ParentId, data.Position, data.RetryOfId, data.RunId, id)
 	if err != nil {
 		return "", fmt.Errorf("failed to update backup => %s", err)
 	}
@@ -75,19 +114,30 @@ func (dao *BackupDaoPostgres) scanFullBackup(rows pgx.Rows) (map[string]*model.B
 			Status    string
 			Label     string
 			DumpPath  *string
+			Error     *string
+			FileCount *int64
+			TotalSize *int64
+			Kind      *string
+			ParentId  *string
+			Position  *string
+			RetryOfId *string
+			RunId     *string
 			CreatedAt time.Time
 			UpdatedAt *time.Time
 		}
 
 		var driveFileScan struct {
-			Id        *string
-			BackupId  *string
-			Provider  *string
-			Label     *string
-			Path      *string
-			Status    *string
-			CreatedAt *time.Time
-			UpdatedAt *time.Time
+			Id          *string
+			BackupId    *string
+			Provider    *string
+			Label       *string
+			Path        *string
+			Status      *string
+			Attempts    *int
+			Parts       *string
+			CatalogPath *string
+			CreatedAt   *time.Time
+			UpdatedAt   *time.Time
 		}
 
 		err := rows.Scan(
@@ -95,6 +145,14 @@ func (dao *BackupDaoPostgres) scanFullBackup(rows pgx.Rows) (map[string]*model.B
 			&backupScan.Status,
 			&backupScan.Label,
 			&backupScan.DumpPath,
+			&backupScan.Error,
+			&backupScan.FileCount,
+			&backupScan.TotalSize,
+			&backupScan.Kind,
+			&backupScan.ParentId,
+			&backupScan.Position,
+			&backupScan.RetryOfId,
+			&backupScan.RunId,
 			&backupScan.CreatedAt,
 			&backupScan.UpdatedAt,
 			&driveFileScan.Id,
@@ -103,6 +161,9 @@ func (dao *BackupDaoPostgres) scanFullBackup(rows pgx.Rows) (map[string]*model.B
 			&driveFileScan.Label,
 			&driveFileScan.Path,
 			&driveFileScan.Status,
+			&driveFileScan.Attempts,
+			&driveFileScan.Parts,
+			&driveFileScan.CatalogPath,
 			&driveFileScan.CreatedAt,
 			&driveFileScan.UpdatedAt,
 		)
@@ -120,6 +181,30 @@ func (dao *BackupDaoPostgres) scanFullBackup(rows pgx.Rows) (map[string]*model.B
 		if backupScan.DumpPath != nil {
 			backupFull.DumpPath = *backupScan.DumpPath
 		}
+		if backupScan.Error != nil {
+			backupFull.Error = *backupScan.Error
+		}
+		if backupScan.FileCount != nil {
+			backupFull.FileCount = *backupScan.FileCount
+		}
+		if backupScan.TotalSize != nil {
+			backupFull.TotalSize = *backupScan.TotalSize
+		}
+		if backupScan.Kind != nil {
+			backupFull.Kind = *backupScan.Kind
+		}
+		if backupScan.ParentId != nil {
+			backupFull.ParentId = *backupScan.ParentId
+		}
+		if backupScan.Position != nil {
+			backupFull.Position = *backupScan.Position
+		}
+		if backupScan.RetryOfId != nil {
+			backupFull.RetryOfId = *backupScan.RetryOfId
+		}
+		if backupScan.RunId != nil {
+			backupFull.RunId = *backupScan.RunId
+		}
 		if backupScan.UpdatedAt != nil {
 			backupFull.UpdatedAt = *backupScan.UpdatedAt
 		}
@@ -148,6 +233,15 @@ func (dao *BackupDaoPostgres) scanFullBackup(rows pgx.Rows) (map[string]*model.B
 			if driveFileScan.Status != nil {
 				driveFile.Status = *driveFileScan.Status
 			}
+			if driveFileScan.Attempts != nil {
+				driveFile.Attempts = *driveFileScan.Attempts
+			}
+			if driveFileScan.Parts != nil {
+				driveFile.Parts = lib.SplitSqlList(*driveFileScan.Parts)
+			}
+			if driveFileScan.CatalogPath != nil {
+				driveFile.CatalogPath = *driveFileScan.CatalogPath
+			}
 			if driveFileScan.CreatedAt != nil {
 				driveFile.CreatedAt = *driveFileScan.CreatedAt
 			}
@@ -166,7 +260,7 @@ func (dao *BackupDaoPostgres) scanFullBackup(rows pgx.Rows) (map[string]*model.B
 }
 
 func (dao *BackupDaoPostgres) ReadFullById(id string) (*model.BackupFull, error) {
-	rows, err := dao.db.Query(context.Background(), "SELECT b.id, b.status, b.label, b.dump_path, b.created_at, b.updated_at, df.id, df.backup_id, df.provider, df.label, df.path, df.status, df.created_at, df.updated_at FROM backups b LEFT JOIN backup_drive_files df ON b.id = df.backup_id WHERE b.id = $1 ORDER BY b.created_at DESC", id)
+	rows, err := dao.db.Query(context.Background(), "SELECT b.id, b.status, b.label, b.dump_path, b.error, b.file_count, b.total_size, b.kind, b.parent_id, b.position, b.retry_of_id, b.run_id, b.created_at, b.updated_at, df.id, df.backup_id, df.provider, df.label, df.path, df.status, df.attempts, df.parts, df.catalog_path, df.created_at, df.updated_at FROM backups b LEFT JOIN backup_drive_files df ON b.id = df.backup_id WHERE b.id = $1 ORDER BY b.created_at DESC", id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read backup full by id %s => %v", id, err)
 	}
@@ -181,7 +275,7 @@ func (dao *BackupDaoPostgres) ReadFullById(id string) (*model.BackupFull, error)
 }
 
 func (dao *BackupDaoPostgres) ReadAllFull() ([]model.BackupFull, error) {
-	rows, err := dao.db.Query(context.Background(), "SELECT b.id, b.status, b.label, b.dump_path, b.created_at, b.updated_at, df.id, df.backup_id, df.provider, df.label, df.path, df.status, df.created_at, df.updated_at FROM backups b LEFT JOIN backup_drive_files df ON b.id = df.backup_id ORDER BY b.created_at DESC")
+	rows, err := dao.db.Query(context.Background(), "SELECT b.id, b.status, b.label, b.dump_path, b.error, b.file_count, b.total_size, b.kind, b.parent_id, b.position, b.retry_of_id, b.run_id, b.created_at, b.updated_at, df.id, df.backup_id, df.provider, df.label, df.path, df.status, df.attempts, df.parts, df.catalog_path, df.created_at, df.updated_at FROM backups b LEFT JOIN backup_drive_files df ON b.id = df.backup_id ORDER BY b.created_at DESC")
 	if err != nil {
 		return nil, fmt.Errorf("failed to read backup all full => %v", err)
 	}
@@ -197,7 +291,7 @@ func (dao *BackupDaoPostgres) ReadAllFull() ([]model.BackupFull, error) {
 }
 
 func (dao *BackupDaoPostgres) ReadOlderThan(date time.Time) ([]model.BackupFull, error) {
-	rows, err := dao.db.Query(context.Background(), "SELECT b.id, b.status, b.label, b.dump_path, b.created_at, b.updated_at, df.id, df.backup_id, df.provider, df.label, df.path, df.status, df.created_at, df.updated_at FROM backups b LEFT JOIN backup_drive_files df ON b.id = df.backup_id WHERE b.created_at < $1 ORDER BY b.created_at DESC", date)
+	rows, err := dao.db.Query(context.Background(), "SELECT b.id, b.status, b.label, b.dump_path, b.error, b.file_count, b.total_size, b.kind, b.parent_id, b.position, b.retry_of_id, b.run_id, b.created_at, b.updated_at, df.id, df.backup_id, df.provider, df.label, df.path, df.status, df.attempts, df.parts, df.catalog_path, df.created_at, df.updated_at FROM backups b LEFT JOIN backup_drive_files df ON b.id = df.backup_id WHERE b.created_at < $1 ORDER BY b.created_at DESC", date)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read backup older than %s => %v", date, err)
 	}
@@ -212,6 +306,66 @@ func (dao *BackupDaoPostgres) ReadOlderThan(date time.Time) ([]model.BackupFull,
 	return backups, nil
 }
 
+func (dao *BackupDaoPostgres) ReadByRunId(runId string) ([]model.BackupFull, error) {
+	rows, err := dao.db.Query(context.Background(), "SELECT b.id, b.status, b.label, b.dump_path, b.error, b.file_count, b.total_size, b.kind, b.parent_id, b.position, b.retry_of_id, b.run_id, b.created_at, b.updated_at, df.id, df.backup_id, df.provider, df.label, df.path, df.status, df.attempts, df.parts, df.catalog_path, df.created_at, df.updated_at FROM backups b LEFT JOIN backup_drive_files df ON b.id = df.backup_id WHERE b.run_id = $1 ORDER BY b.created_at DESC", runId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backups of run %s => %v", runId, err)
+	}
+	results, err := dao.scanFullBackup(rows)
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]model.BackupFull, 0, len(results))
+	for _, backup := range results {
+		backups = append(backups, *backup)
+	}
+	return backups, nil
+}
+
+func (dao *BackupDaoPostgres) ReadByStatus(status string) ([]model.BackupFull, error) {
+	rows, err := dao.db.Query(context.Background(), "SELECT b.id, b.status, b.label, b.dump_path, b.error, b.file_count, b.total_size, b.kind, b.parent_id, b.position, b.retry_of_id, b.run_id, b.created_at, b.updated_at, df.id, df.backup_id, df.provider, df.label, df.path, df.status, df.attempts, df.parts, df.catalog_path, df.created_at, df.updated_at FROM backups b LEFT JOIN backup_drive_files df ON b.id = df.backup_id WHERE b.status = $1 ORDER BY b.created_at DESC", status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backups with status %s => %v", status, err)
+	}
+	results, err := dao.scanFullBackup(rows)
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]model.BackupFull, 0, len(results))
+	for _, backup := range results {
+		backups = append(backups, *backup)
+	}
+	return backups, nil
+}
+
+func (dao *BackupDaoPostgres) ReadByPosition(label, kind, from, to string) ([]model.BackupFull, error) {
+	rows, err := dao.db.Query(context.Background(), "SELECT b.id, b.status, b.label, b.dump_path, b.error, b.file_count, b.total_size, b.kind, b.parent_id, b.position, b.retry_of_id, b.run_id, b.created_at, b.updated_at, df.id, df.backup_id, df.provider, df.label, df.path, df.status, df.attempts, df.parts, df.catalog_path, df.created_at, df.updated_at FROM backups b LEFT JOIN backup_drive_files df ON b.id = df.backup_id WHERE b.label = $1 AND b.kind = $2 AND ($3 = '' OR b.position >= $3) AND ($4 = '' OR b.position <= $4)", label, kind, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s backups of %s => %v", kind, label, err)
+	}
+	results, err := dao.scanFullBackup(rows)
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]model.BackupFull, 0, len(results))
+	for _, backup := range results {
+		backups = append(backups, *backup)
+	}
+	return backups, nil
+}
+
+func (dao *BackupDaoPostgres) ReadRetryOf(id string) (*model.Backup, error) {
+	var retryId string
+	err := dao.db.QueryRow(context.Background(), "SELECT id FROM backups WHERE retry_of_id = $1 LIMIT 1", id).Scan(&retryId)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read retry of backup %s => %s", id, err)
+	}
+	return dao.readById(retryId, true)
+}
+
 func (dao *BackupDaoPostgres) Delete(id string) error {
 	_, err := dao.db.Exec(context.Background(), "DELETE FROM backups WHERE id = $1", id)
 	if err != nil {
@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/herytz/backupman/core/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type BackupRunDaoPostgres struct {
+	db *pgxpool.Pool
+}
+
+func NewBackupRunDaoPostgres(db *pgxpool.Pool) *BackupRunDaoPostgres {
+	return &BackupRunDaoPostgres{db: db}
+}
+
+func (dao *BackupRunDaoPostgres) ReadOrError(id string) (*model.BackupRun, error) {
+	var run model.BackupRun
+	var apiKey *string
+	var endedAt *time.Time
+
+	err := dao.db.QueryRow(context.Background(), "SELECT id, trigger_source, api_key, status, started_at, ended_at FROM backup_runs WHERE id = $1", id).Scan(&run.Id, &run.Trigger, &apiKey, &run.Status, &run.StartedAt, &endedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("no backup run found with id %s", id)
+		}
+		return nil, fmt.Errorf("failed to read backup run by id => %s", err)
+	}
+	if apiKey != nil {
+		run.ApiKey = *apiKey
+	}
+	if endedAt != nil {
+		run.EndedAt = *endedAt
+	}
+	return &run, nil
+}
+
+func (dao *BackupRunDaoPostgres) Create(data model.BackupRun) (string, error) {
+	id := uuid.NewString()
+	_, err := dao.db.Exec(context.Background(), "INSERT INTO backup_runs (id, trigger_source, api_key, status, started_at, ended_at) VALUES ($1, $2, $3, $4, $5, $6)", id, data.Trigger, data.ApiKey, data.Status, data.StartedAt, sql.NullTime{Time: data.EndedAt, Valid: !data.EndedAt.IsZero()})
+	if err != nil {
+		return "", fmt.Errorf("failed to insert backup run => %s", err)
+	}
+	return id, nil
+}
+
+func (dao *BackupRunDaoPostgres) Update(id string, data model.BackupRun) (string, error) {
+	_, err := dao.db.Exec(context.Background(), "UPDATE backup_runs SET trigger_source = $1, api_key = $2, status = $3, started_at = $4, ended_at = $5 WHERE id = $6", data.Trigger, data.ApiKey, data.Status, data.StartedAt, sql.NullTime{Time: data.EndedAt, Valid: !data.EndedAt.IsZero()}, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to update backup run => %s", err)
+	}
+	return id, nil
+}
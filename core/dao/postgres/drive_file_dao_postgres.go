@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/herytz/backupman/core/lib"
 	"github.com/herytz/backupman/core/model"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -22,8 +23,10 @@ func NewDriveFileDaoPostgres(db *pgxpool.Pool) *DriveFileDaoPostgres {
 func (dao *DriveFileDaoPostgres) readById(id string, errorIfNotExists bool) (*model.DriveFile, error) {
 	var driveFile model.DriveFile
 	var updatedAt *time.Time
+	var parts string
+	var catalogPath string
 
-	err := dao.db.QueryRow(context.Background(), "SELECT id, backup_id, provider, label, path, status, created_at, updated_at FROM backup_drive_files WHERE id = $1", id).Scan(&driveFile.Id, &driveFile.BackupId, &driveFile.Provider, &driveFile.Label, &driveFile.Path, &driveFile.Status, &driveFile.CreatedAt, &updatedAt)
+	err := dao.db.QueryRow(context.Background(), "SELECT id, backup_id, provider, label, path, status, attempts, parts, catalog_path, created_at, updated_at FROM backup_drive_files WHERE id = $1", id).Scan(&driveFile.Id, &driveFile.BackupId, &driveFile.Provider, &driveFile.Label, &driveFile.Path, &driveFile.Status, &driveFile.Attempts, &parts, &catalogPath, &driveFile.CreatedAt, &updatedAt)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			if errorIfNotExists {
@@ -34,6 +37,8 @@ func (dao *DriveFileDaoPostgres) readById(id string, errorIfNotExists bool) (*mo
 		}
 		return nil, fmt.Errorf("failed to read drive files by id: %v", err)
 	}
+	driveFile.Parts = lib.SplitSqlList(parts)
+	driveFile.CatalogPath = catalogPath
 	if updatedAt != nil {
 		driveFile.UpdatedAt = *updatedAt
 	}
@@ -46,15 +51,23 @@ func (dao *DriveFileDaoPostgres) ReadOrError(id string) (*model.DriveFile, error
 
 func (dao *DriveFileDaoPostgres) Create(data model.DriveFile) (string, error) {
 	id := uuid.NewString()
-	_, err := dao.db.Exec(context.Background(), "INSERT INTO backup_drive_files (id, backup_id, provider, label, path, status) VALUES ($1, $2, $3, $4, $5, $6)", id, data.BackupId, data.Provider, data.Label, data.Path, data.Status)
+	_, err := dao.db.Exec(context.Background(), "INSERT INTO backup_drive_files (id, backup_id, provider, label, path, status, attempts, parts, catalog_path) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)", id, data.BackupId, data.Provider, data.Label, data.Path, data.Status, data.Attempts, lib.JoinSqlList(data.Parts), data.CatalogPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to insert drive file: %v", err)
 	}
 	return id, nil
 }
 
+func (dao *DriveFileDaoPostgres) Import(data model.DriveFile) error {
+	_, err := dao.db.Exec(context.Background(), "INSERT INTO backup_drive_files (id, backup_id, provider, label, path, status, attempts, parts, catalog_path, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)", data.Id, data.BackupId, data.Provider, data.Label, data.Path, data.Status, data.Attempts, lib.JoinSqlList(data.Parts), data.CatalogPath, data.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to import drive file: %v", err)
+	}
+	return nil
+}
+
 func (dao *DriveFileDaoPostgres) Update(id string, data model.DriveFile) (string, error) {
-	_, err := dao.db.Exec(context.Background(), "UPDATE backup_drive_files SET backup_id = $1, provider = $2, label = $3, path = $4, status = $5 WHERE id = $6", data.BackupId, data.Provider, data.Label, data.Path, data.Status, id)
+	_, err := dao.db.Exec(context.Background(), "UPDATE backup_drive_files SET backup_id = $1, provider = $2, label = $3, path = $4, status = $5, attempts = $6, parts = $7, catalog_path = $8 WHERE id = $9", data.BackupId, data.Provider, data.Label, data.Path, data.Status, data.Attempts, lib.JoinSqlList(data.Parts), data.CatalogPath, id)
 	if err != nil {
 		return "", fmt.Errorf("failed to update drive file: %v", err)
 	}
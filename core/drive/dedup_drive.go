@@ -0,0 +1,312 @@
+package drive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/herytz/backupman/core/lib"
+)
+
+const DEDUP_CHUNKS_FOLDER = "chunks"
+const DEDUP_MANIFESTS_FOLDER = "manifests"
+const DEDUP_MANIFEST_VERSION = 1
+
+// Sizes of the chunks of the dumps
+const DEDUP_CHUNK_MIN_SIZE = 256 * 1024
+const DEDUP_CHUNK_AVG_SIZE = 1024 * 1024
+const DEDUP_CHUNK_MAX_SIZE = 4 * 1024 * 1024
+
+// Age under which an unreferenced chunk is kept, since it can belong to an
+// upload of another process whose manifest is not written yet
+const DEDUP_GC_GRACE_PERIOD = 24 * time.Hour
+
+// DedupManifest lists the chunks of a dump, in order
+type DedupManifest struct {
+	Version int
+	Size    int64
+	Sha256  string
+	Chunks  []DedupChunk
+}
+
+type DedupChunk struct {
+	Hash string
+	Size int64
+}
+
+// DedupDrive stores the dumps on a drive as content defined chunks, each
+// chunk being stored once by its SHA-256 whatever the number of dumps it
+// belongs to. A manifest per dump lists its chunks and is the path of its
+// drive file. Deleting a dump deletes its manifest, CollectGarbage deleting
+// the chunks no manifest references anymore.
+type DedupDrive struct {
+	Drive
+	store ObjectStore
+	// Held by the uploads, CollectGarbage waiting for them so the chunks of a
+	// dump whose manifest is not written yet are kept
+	mu sync.RWMutex
+}
+
+func NewDedupDrive(d Drive) *DedupDrive {
+	store, ok := d.(ObjectStore)
+	if !ok {
+		log.Fatalf("drive (%s) of provider %s cannot store deduplicated dumps", d.GetLabel(), d.GetProvider())
+	}
+	return &DedupDrive{Drive: d, store: store}
+}
+
+func (d *DedupDrive) Upload(ctx context.Context, srcPath string) (DriveFile, error) {
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return DriveFile{}, fmt.Errorf("failed to open file %s => %s", srcPath, err)
+	}
+	defer file.Close()
+	return d.UploadStream(ctx, srcPath, file)
+}
+
+// UploadStream stores the chunks of src missing on the drive, then its
+// manifest. The chunks already stored are touched, and checked again once the
+// manifest is written.
+func (d *DedupDrive) UploadStream(ctx context.Context, name string, src io.Reader) (DriveFile, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	manifest := DedupManifest{Version: DEDUP_MANIFEST_VERSION, Chunks: make([]DedupChunk, 0)}
+	dumpHash := sha256.New()
+	chunker := lib.NewChunker(src, DEDUP_CHUNK_MIN_SIZE, DEDUP_CHUNK_AVG_SIZE, DEDUP_CHUNK_MAX_SIZE)
+	stored := 0
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return DriveFile{}, fmt.Errorf("failed to read dump %s => %s", name, err)
+		}
+		dumpHash.Write(chunk)
+		sum := sha256.Sum256(chunk)
+		hash := hex.EncodeToString(sum[:])
+		manifest.Chunks = append(manifest.Chunks, DedupChunk{Hash: hash, Size: int64(len(chunk))})
+		manifest.Size += int64(len(chunk))
+
+		exists, err := d.store.ObjectExists(ctx, dedupChunkName(hash))
+		if err != nil {
+			return DriveFile{}, err
+		}
+		if exists {
+			err = d.store.TouchObject(ctx, dedupChunkName(hash))
+			if err != nil {
+				return DriveFile{}, err
+			}
+			continue
+		}
+		err = d.store.PutObject(ctx, dedupChunkName(hash), chunk)
+		if err != nil {
+			return DriveFile{}, err
+		}
+		stored++
+	}
+	manifest.Sha256 = hex.EncodeToString(dumpHash.Sum(nil))
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return DriveFile{}, fmt.Errorf("failed to encode manifest of %s => %s", name, err)
+	}
+	// The manifest keeps the name of the dump and its extension
+	manifestName := path.Join(DEDUP_MANIFESTS_FOLDER, remoteFilename(name))
+	err = d.store.PutObject(ctx, manifestName, data)
+	if err != nil {
+		return DriveFile{}, err
+	}
+	err = d.checkChunks(ctx, manifest)
+	if err != nil {
+		d.store.DeleteObject(ctx, manifestName)
+		return DriveFile{}, fmt.Errorf("failed to store dump %s => %s", name, err)
+	}
+	log.Printf("dump %s stored on drive (%s) with %d new chunks out of %d", name, d.GetLabel(), stored, len(manifest.Chunks))
+	return DriveFile{Path: manifestName, Checksum: manifest.Sha256}, nil
+}
+
+// Delete deletes the manifest of a dump, its chunks being deleted by
+// CollectGarbage once no other manifest references them
+func (d *DedupDrive) Delete(ctx context.Context, manifestName string) error {
+	if !isDedupManifest(manifestName) {
+		// Stored before the drive deduplicated its dumps, or stored as it is
+		// through the drive returned by Unwrap
+		return d.Drive.Delete(ctx, manifestName)
+	}
+	return d.store.DeleteObject(ctx, manifestName)
+}
+
+// Download reassembles a dump from the chunks listed by its manifest, every
+// chunk and the whole dump being checked against their SHA-256
+func (d *DedupDrive) Download(ctx context.Context, manifestName, dstPath string) error {
+	if !isDedupManifest(manifestName) {
+		downloader, ok := d.Drive.(Downloader)
+		if !ok {
+			return fmt.Errorf("download not supported by drive (%s)", d.GetLabel())
+		}
+		return downloader.Download(ctx, manifestName, dstPath)
+	}
+	manifest, err := d.readManifest(ctx, manifestName)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(dstPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s => %s", dstPath, err)
+	}
+	defer file.Close()
+
+	dumpHash := sha256.New()
+	for _, chunk := range manifest.Chunks {
+		data, err := d.store.GetObject(ctx, dedupChunkName(chunk.Hash))
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != chunk.Hash {
+			return fmt.Errorf("chunk %s of %s is corrupted", chunk.Hash, manifestName)
+		}
+		dumpHash.Write(data)
+		_, err = file.Write(data)
+		if err != nil {
+			return fmt.Errorf("failed to write file %s => %s", dstPath, err)
+		}
+	}
+	if hex.EncodeToString(dumpHash.Sum(nil)) != manifest.Sha256 {
+		return fmt.Errorf("dump %s does not match the checksum of its manifest", manifestName)
+	}
+	return nil
+}
+
+// CollectGarbage deletes the chunks referenced by no manifest and older than
+// DEDUP_GC_GRACE_PERIOD, and returns the number of chunks deleted
+func (d *DedupDrive) CollectGarbage(ctx context.Context) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	manifests, err := d.store.ListObjects(ctx, DEDUP_MANIFESTS_FOLDER+"/")
+	if err != nil {
+		return 0, err
+	}
+	referenced := make(map[string]bool)
+	for _, object := range manifests {
+		manifest, err := d.readManifest(ctx, object.Name)
+		if err != nil {
+			// A chunk of an unreadable manifest must not be deleted
+			return 0, err
+		}
+		for _, chunk := range manifest.Chunks {
+			referenced[chunk.Hash] = true
+		}
+	}
+
+	chunks, err := d.store.ListObjects(ctx, DEDUP_CHUNKS_FOLDER+"/")
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, object := range chunks {
+		if referenced[path.Base(object.Name)] {
+			continue
+		}
+		// A chunk without modification time is as recent as possible
+		if object.ModTime.IsZero() || time.Since(object.ModTime) < DEDUP_GC_GRACE_PERIOD {
+			continue
+		}
+		err := d.store.DeleteObject(ctx, object.Name)
+		if err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (d *DedupDrive) checkChunks(ctx context.Context, manifest DedupManifest) error {
+	checked := make(map[string]bool)
+	for _, chunk := range manifest.Chunks {
+		if checked[chunk.Hash] {
+			continue
+		}
+		exists, err := d.store.ObjectExists(ctx, dedupChunkName(chunk.Hash))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("chunk %s deleted during the upload", chunk.Hash)
+		}
+		checked[chunk.Hash] = true
+	}
+	return nil
+}
+
+func (d *DedupDrive) Unwrap() Drive {
+	return d.Drive
+}
+
+// List lists the manifests of the dumps and the files stored before the drive
+// deduplicated its dumps, the chunks being collected by CollectGarbage
+func (d *DedupDrive) List(ctx context.Context) ([]ObjectInfo, error) {
+	lister, ok := d.Drive.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("list not supported by drive (%s)", d.GetLabel())
+	}
+	objects, err := lister.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]ObjectInfo, 0, len(objects))
+	for _, object := range objects {
+		if strings.HasPrefix(object.Name, DEDUP_CHUNKS_FOLDER+"/") {
+			continue
+		}
+		if isDedupManifest(object.Name) {
+			object.Path = object.Name
+		}
+		files = append(files, object)
+	}
+	return files, nil
+}
+
+func (d *DedupDrive) readManifest(ctx context.Context, manifestName string) (DedupManifest, error) {
+	var manifest DedupManifest
+	data, err := d.store.GetObject(ctx, manifestName)
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to decode manifest %s => %s", manifestName, err)
+	}
+	if manifest.Version != DEDUP_MANIFEST_VERSION {
+		return manifest, fmt.Errorf("unsupported version %d of manifest %s", manifest.Version, manifestName)
+	}
+	return manifest, nil
+}
+
+func isDedupManifest(name string) bool {
+	return strings.HasPrefix(name, DEDUP_MANIFESTS_FOLDER+"/")
+}
+
+// dedupChunkName returns the object name of a chunk, spread in folders by hash prefix
+func dedupChunkName(hash string) string {
+	return path.Join(DEDUP_CHUNKS_FOLDER, hash[:2], hash)
+}
+
+// GarbageCollector is implemented by the drives whose deletions leave data to
+// collect afterwards
+type GarbageCollector interface {
+	CollectGarbage(ctx context.Context) (int, error)
+}
@@ -1,14 +1,92 @@
 package drive
 
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+)
+
 type DriveFile struct {
 	Path     string
 	Checksum string
+	// Paths of the volumes of a dump split by the drive, Path being the path
+	// of their manifest
+	Parts []string
 }
 
+// Drive stores the dumps. An upload or a deletion is aborted when its context
+// is done.
 type Drive interface {
-	Upload(srcPath string) (DriveFile, error)
-	Delete(srcPath string) error
+	Upload(ctx context.Context, srcPath string) (DriveFile, error)
+	Delete(ctx context.Context, srcPath string) error
 	GetLabel() string
 	GetProvider() string
 	Health() error
 }
+
+// remoteFilename names an uploaded file after the upload time and its source name
+func remoteFilename(srcPath string) string {
+	return fmt.Sprintf("%s-%s", time.Now().Format("20060102150405"), filepath.Base(srcPath))
+}
+
+// Downloader is implemented by the drives able to fetch back an uploaded file
+type Downloader interface {
+	Download(ctx context.Context, path, dstPath string) error
+}
+
+// StreamUploader is implemented by the drives able to upload a dump while it
+// is written, from a source which cannot be read twice. name is the name of
+// the dump, like the source path of Upload. A failing source aborts the upload
+// and nothing is left on the drive.
+type StreamUploader interface {
+	UploadStream(ctx context.Context, name string, src io.Reader) (DriveFile, error)
+}
+
+// ObjectInfo describes an object of an ObjectStore or a file of a Lister
+type ObjectInfo struct {
+	Name string
+	// Path of the object as recorded by the drive files
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// ObjectStore is implemented by the drives able to store objects by name, the
+// names being slash separated paths relative to the folder or the prefix of
+// the drive
+type ObjectStore interface {
+	PutObject(ctx context.Context, name string, data []byte) error
+	GetObject(ctx context.Context, name string) ([]byte, error)
+	ObjectExists(ctx context.Context, name string) (bool, error)
+	// TouchObject sets the modification time of an object to now
+	TouchObject(ctx context.Context, name string) error
+	DeleteObject(ctx context.Context, name string) error
+	// ListObjects returns the objects whose name starts with prefix
+	ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// Lister is implemented by the drives able to list the files they store, to
+// reconcile them with the drive files
+type Lister interface {
+	List(ctx context.Context) ([]ObjectInfo, error)
+}
+
+// Unwrapper is implemented by the drives storing their files through another
+// drive, like the deduplicated or split drives
+type Unwrapper interface {
+	Unwrap() Drive
+}
+
+// Unwrap returns the drive actually storing the files of d, the files uploaded
+// to it being stored as they are
+func Unwrap(d Drive) Drive {
+	for {
+		unwrapper, ok := d.(Unwrapper)
+		if !ok {
+			return d
+		}
+		d = unwrapper.Unwrap()
+	}
+}
@@ -1,14 +1,16 @@
 package drive
 
+import "context"
+
 type DriveMock struct{}
 
-func (d *DriveMock) Upload(srcPath string) (DriveFile, error) {
+func (d *DriveMock) Upload(ctx context.Context, srcPath string) (DriveFile, error) {
 	return DriveFile{
 		Path: "./drive_mock/file.txt",
 	}, nil
 }
 
-func (d *DriveMock) Delete(dstPath string) error {
+func (d *DriveMock) Delete(ctx context.Context, dstPath string) error {
 	return nil
 }
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path"
@@ -74,12 +75,13 @@ func (d *GoogleDrive) getDriveService() (*gdrive.Service, error) {
 	return gdrive.NewService(ctx, option.WithHTTPClient(client))
 }
 
-func (d *GoogleDrive) findOrCreateFolder(srv *gdrive.Service) (*gdrive.File, error) {
+func (d *GoogleDrive) findOrCreateFolder(ctx context.Context, srv *gdrive.Service) (*gdrive.File, error) {
 	query := fmt.Sprintf("mimeType='application/vnd.google-apps.folder' and name='%s' and trashed=false", d.Folder)
 	files, err := srv.Files.List().
 		Q(query).
 		Spaces("drive").
 		Fields("files(id, name)").
+		Context(ctx).
 		Do()
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving folder => %v", err)
@@ -93,7 +95,7 @@ func (d *GoogleDrive) findOrCreateFolder(srv *gdrive.Service) (*gdrive.File, err
 		Name:     d.Folder,
 		MimeType: "application/vnd.google-apps.folder",
 	}
-	folder, err := srv.Files.Create(folderMetadata).Do()
+	folder, err := srv.Files.Create(folderMetadata).Context(ctx).Do()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create folder => %v", err)
 	}
@@ -101,7 +103,7 @@ func (d *GoogleDrive) findOrCreateFolder(srv *gdrive.Service) (*gdrive.File, err
 	return folder, nil
 }
 
-func (d *GoogleDrive) Upload(srcPath string) (DriveFile, error) {
+func (d *GoogleDrive) Upload(ctx context.Context, srcPath string) (DriveFile, error) {
 	driveFile := DriveFile{}
 	srv, err := d.getDriveService()
 	if err != nil {
@@ -114,19 +116,19 @@ func (d *GoogleDrive) Upload(srcPath string) (DriveFile, error) {
 	}
 	defer file.Close()
 
-	folder, err := d.findOrCreateFolder(srv)
+	folder, err := d.findOrCreateFolder(ctx, srv)
 	if err != nil {
 		return driveFile, err
 	}
 
-	filename := fmt.Sprintf("%s%s", time.Now().Format("20060102150405"), filepath.Ext(srcPath))
+	filename := remoteFilename(srcPath)
 
 	fileMetadata := &gdrive.File{
 		Name:    filename,
 		Parents: []string{folder.Id},
 	}
 
-	uploadedFile, err := srv.Files.Create(fileMetadata).Media(file).Do()
+	uploadedFile, err := srv.Files.Create(fileMetadata).Media(file).Context(ctx).Do()
 	if err != nil {
 		return driveFile, fmt.Errorf("[Google Drive] Unable to upload file %s => %s", srcPath, err)
 	}
@@ -136,19 +138,15 @@ func (d *GoogleDrive) Upload(srcPath string) (DriveFile, error) {
 	return driveFile, nil
 }
 
-func (d *GoogleDrive) Delete(srcPath string) error {
+func (d *GoogleDrive) Delete(ctx context.Context, srcPath string) error {
 	srv, err := d.getDriveService()
 	if err != nil {
 		return fmt.Errorf("[Google Drive] Unable to retrieve Drive client => %s", err)
 	}
 
-	query := fmt.Sprintf("name='%s'", filepath.Base(srcPath))
-	files, err := srv.Files.List().
-		Q(query).
-		Fields("files(id, name)").
-		Do()
+	files, err := d.findFiles(ctx, srv, srcPath)
 	if err != nil {
-		log.Fatalf("Erreur lors de la récupération des fichiers => %v", err)
+		return err
 	}
 
 	if len(files.Files) == 0 {
@@ -157,7 +155,7 @@ func (d *GoogleDrive) Delete(srcPath string) error {
 	}
 
 	for _, file := range files.Files {
-		err = srv.Files.Delete(file.Id).Do()
+		err = srv.Files.Delete(file.Id).Context(ctx).Do()
 		if err != nil {
 			return fmt.Errorf("[Google Drive] Unable to delete file %s => %s", srcPath, err)
 		}
@@ -166,6 +164,88 @@ func (d *GoogleDrive) Delete(srcPath string) error {
 	return nil
 }
 
+func (d *GoogleDrive) Download(ctx context.Context, srcPath, dstPath string) error {
+	srv, err := d.getDriveService()
+	if err != nil {
+		return fmt.Errorf("[Google Drive] Unable to retrieve Drive client => %s", err)
+	}
+
+	files, err := d.findFiles(ctx, srv, srcPath)
+	if err != nil {
+		return err
+	}
+	if len(files.Files) == 0 {
+		return fmt.Errorf("[Google Drive] File %s not found", srcPath)
+	}
+
+	response, err := srv.Files.Get(files.Files[0].Id).Context(ctx).Download()
+	if err != nil {
+		return fmt.Errorf("[Google Drive] Unable to download file %s => %s", srcPath, err)
+	}
+	defer response.Body.Close()
+
+	file, err := os.Create(dstPath)
+	if err != nil {
+		return fmt.Errorf("[Google Drive] Unable to create file %s => %s", dstPath, err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, response.Body)
+	if err != nil {
+		return fmt.Errorf("[Google Drive] Unable to download file %s => %s", srcPath, err)
+	}
+	return nil
+}
+
+// findFiles finds the files named after srcPath in the folder of the drive
+func (d *GoogleDrive) findFiles(ctx context.Context, srv *gdrive.Service, srcPath string) (*gdrive.FileList, error) {
+	folder, err := d.findOrCreateFolder(ctx, srv)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("name='%s' and '%s' in parents and trashed=false", filepath.Base(srcPath), folder.Id)
+	files, err := srv.Files.List().
+		Q(query).
+		Fields("files(id, name)").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("[Google Drive] Unable to find file %s => %s", srcPath, err)
+	}
+	return files, nil
+}
+
+// List lists the files of the folder of the drive
+func (d *GoogleDrive) List(ctx context.Context) ([]ObjectInfo, error) {
+	srv, err := d.getDriveService()
+	if err != nil {
+		return nil, fmt.Errorf("[Google Drive] Unable to retrieve Drive client => %s", err)
+	}
+	folder, err := d.findOrCreateFolder(ctx, srv)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]ObjectInfo, 0)
+	query := fmt.Sprintf("'%s' in parents and trashed=false", folder.Id)
+	err = srv.Files.List().
+		Q(query).
+		Fields("nextPageToken, files(id, name, size, modifiedTime)").
+		Pages(ctx, func(files *gdrive.FileList) error {
+			for _, file := range files.Files {
+				info := ObjectInfo{Name: file.Name, Path: file.Name, Size: file.Size}
+				info.ModTime, _ = time.Parse(time.RFC3339, file.ModifiedTime)
+				objects = append(objects, info)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("[Google Drive] Unable to list files => %s", err)
+	}
+	return objects, nil
+}
+
 func (d *GoogleDrive) Health() error {
 	folder := "./tmp"
 	err := os.MkdirAll(folder, 0755)
@@ -179,12 +259,12 @@ func (d *GoogleDrive) Health() error {
 		return fmt.Errorf("Failed to create health test file => %s", err)
 	}
 
-	file, err := d.Upload(healthTest)
+	file, err := d.Upload(context.Background(), healthTest)
 	if err != nil {
 		return fmt.Errorf("Failed to upload health test file to Google Drive => %s", err)
 	}
 
-	err = d.Delete(file.Path)
+	err = d.Delete(context.Background(), file.Path)
 	if err != nil {
 		return fmt.Errorf("Failed to delete health test file from Google Drive => %s", err)
 	}
@@ -1,11 +1,18 @@
 package drive
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+
+	"github.com/herytz/backupman/core/lib"
 )
 
 type LocalDrive struct {
@@ -22,7 +29,7 @@ func NewLocalDrive(label, folder string) *LocalDrive {
 	return &drive
 }
 
-func (d *LocalDrive) Upload(srcPath string) (DriveFile, error) {
+func (d *LocalDrive) Upload(ctx context.Context, srcPath string) (DriveFile, error) {
 	srcFile, err := os.Open(srcPath)
 	if err != nil {
 		log.Printf("failed to open file => %s", err)
@@ -30,7 +37,11 @@ func (d *LocalDrive) Upload(srcPath string) (DriveFile, error) {
 	}
 	defer srcFile.Close()
 
-	dstFilename := fmt.Sprintf("%s%s", time.Now().Format("20060102150405"), filepath.Ext(srcPath))
+	return d.UploadStream(ctx, srcPath, srcFile)
+}
+
+func (d *LocalDrive) UploadStream(ctx context.Context, name string, src io.Reader) (DriveFile, error) {
+	dstFilename := remoteFilename(name)
 	dstPath := filepath.Join(d.Folder, dstFilename)
 	dstFile, err := os.Create(dstPath)
 	if err != nil {
@@ -39,9 +50,11 @@ func (d *LocalDrive) Upload(srcPath string) (DriveFile, error) {
 	}
 	defer dstFile.Close()
 
-	_, err = srcFile.WriteTo(dstFile)
+	_, err = io.Copy(dstFile, lib.NewContextReader(ctx, src))
 	if err != nil {
 		log.Printf("failed to copy file => %s", err)
+		dstFile.Close()
+		os.Remove(dstPath)
 		return DriveFile{}, err
 	}
 
@@ -50,7 +63,7 @@ func (d *LocalDrive) Upload(srcPath string) (DriveFile, error) {
 	}, nil
 }
 
-func (d *LocalDrive) Delete(srcPath string) error {
+func (d *LocalDrive) Delete(ctx context.Context, srcPath string) error {
 	err := os.Remove(srcPath)
 	if err != nil {
 		switch err.(type) {
@@ -64,6 +77,26 @@ func (d *LocalDrive) Delete(srcPath string) error {
 	return nil
 }
 
+func (d *LocalDrive) Download(ctx context.Context, path, dstPath string) error {
+	srcFile, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s => %s", path, err)
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(dstPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s => %s", dstPath, err)
+	}
+	defer dstFile.Close()
+
+	_, err = io.Copy(dstFile, lib.NewContextReader(ctx, srcFile))
+	if err != nil {
+		return fmt.Errorf("failed to copy file %s => %s", path, err)
+	}
+	return nil
+}
+
 func (d *LocalDrive) Health() error {
 	folder := "./tmp"
 	err := os.MkdirAll(folder, 0755)
@@ -77,12 +110,12 @@ func (d *LocalDrive) Health() error {
 		return fmt.Errorf("failed to create health test file => %s", err)
 	}
 
-	_, err = d.Upload(healthTest)
+	_, err = d.Upload(context.Background(), healthTest)
 	if err != nil {
 		return fmt.Errorf("failed to upload health test file => %s", err)
 	}
 
-	err = d.Delete(healthTest)
+	err = d.Delete(context.Background(), healthTest)
 	if err != nil {
 		return fmt.Errorf("failed to delete health test file => %s", err)
 	}
@@ -103,3 +136,99 @@ func (d *LocalDrive) setup() {
 func (d *LocalDrive) GetProvider() string {
 	return "local"
 }
+
+func (d *LocalDrive) PutObject(ctx context.Context, name string, data []byte) error {
+	objectPath := d.objectPath(name)
+	err := os.MkdirAll(filepath.Dir(objectPath), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create folder of object %s => %s", name, err)
+	}
+	// Written aside and renamed, so an interrupted write leaves no object
+	tmpPath := objectPath + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0644)
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write object %s => %s", name, err)
+	}
+	err = os.Rename(tmpPath, objectPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write object %s => %s", name, err)
+	}
+	return nil
+}
+
+func (d *LocalDrive) GetObject(ctx context.Context, name string) ([]byte, error) {
+	data, err := os.ReadFile(d.objectPath(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s => %s", name, err)
+	}
+	return data, nil
+}
+
+func (d *LocalDrive) ObjectExists(ctx context.Context, name string) (bool, error) {
+	_, err := os.Stat(d.objectPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check object %s => %s", name, err)
+	}
+	return true, nil
+}
+
+func (d *LocalDrive) TouchObject(ctx context.Context, name string) error {
+	now := time.Now()
+	err := os.Chtimes(d.objectPath(name), now, now)
+	if err != nil {
+		return fmt.Errorf("failed to touch object %s => %s", name, err)
+	}
+	return nil
+}
+
+func (d *LocalDrive) DeleteObject(ctx context.Context, name string) error {
+	err := os.Remove(d.objectPath(name))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete object %s => %s", name, err)
+	}
+	return nil
+}
+
+func (d *LocalDrive) ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects := make([]ObjectInfo, 0)
+	err := filepath.WalkDir(d.Folder, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return ctx.Err()
+		}
+		relative, err := filepath.Rel(d.Folder, filePath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relative)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Name: name, Path: filePath, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects of folder %s => %s", d.Folder, err)
+	}
+	return objects, nil
+}
+
+func (d *LocalDrive) List(ctx context.Context) ([]ObjectInfo, error) {
+	return d.ListObjects(ctx, "")
+}
+
+// objectPath returns the path of the file of an object
+func (d *LocalDrive) objectPath(name string) string {
+	return filepath.Join(d.Folder, filepath.FromSlash(name))
+}
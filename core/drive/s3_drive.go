@@ -1,20 +1,38 @@
 package drive
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Size of the first parts of the streamed uploads, S3 requiring at least 5 MiB
+// for every part but the last
+const S3_STREAM_PART_SIZE = 8 * 1024 * 1024
+
+// The part size of the streamed uploads doubles every S3_STREAM_PART_GROWTH
+// parts, so the size of a stream is not bounded by the number of parts
+const S3_STREAM_PART_GROWTH = 1000
+
+// Limits of the multipart uploads of S3
+const (
+	S3_MAX_PARTS     = 10000
+	S3_MAX_PART_SIZE = 5 * 1024 * 1024 * 1024
 )
 
 type S3Drive struct {
@@ -44,9 +62,7 @@ func NewS3Drive(label, bucket, region, accessKey, secretKey, endpoint, prefix st
 	return &drive
 }
 
-func (d *S3Drive) getS3Client() (*s3.Client, error) {
-	ctx := context.Background()
-
+func (d *S3Drive) getS3Client(ctx context.Context) (*s3.Client, error) {
 	cfg, err := config.LoadDefaultConfig(ctx,
 		config.WithRegion(d.Region),
 	)
@@ -71,10 +87,10 @@ func (d *S3Drive) getS3Client() (*s3.Client, error) {
 	return s3.NewFromConfig(cfg, clientOptions...), nil
 }
 
-func (d *S3Drive) Upload(srcPath string) (DriveFile, error) {
+func (d *S3Drive) Upload(ctx context.Context, srcPath string) (DriveFile, error) {
 	driveFile := DriveFile{}
 
-	client, err := d.getS3Client()
+	client, err := d.getS3Client(ctx)
 	if err != nil {
 		return driveFile, fmt.Errorf("[S3 Drive] Unable to create S3 client => %s", err)
 	}
@@ -100,13 +116,7 @@ func (d *S3Drive) Upload(srcPath string) (DriveFile, error) {
 		}
 	}
 
-	filename := fmt.Sprintf("%s%s", time.Now().Format("20060102150405"), filepath.Ext(srcPath))
-
-	// Build S3 key with prefix
-	key := filename
-	if d.Prefix != "" {
-		key = fmt.Sprintf("%s/%s", strings.TrimPrefix(d.Prefix, "/"), filename)
-	}
+	key := d.key(remoteFilename(srcPath))
 
 	// Upload with metadata for integrity verification
 	putObjectInput := &s3.PutObjectInput{
@@ -122,17 +132,17 @@ func (d *S3Drive) Upload(srcPath string) (DriveFile, error) {
 		}
 	}
 
-	result, err := client.PutObject(context.Background(), putObjectInput)
+	result, err := client.PutObject(ctx, putObjectInput)
 	if err != nil {
 		return driveFile, fmt.Errorf("[S3 Drive] Unable to upload file %s => %s", srcPath, err)
 	}
 
 	// Verify upload integrity if enabled
 	if d.EnableIntegrityCheck && result.ETag != nil {
-		err = d.verifyUploadIntegrity(client, key, *result.ETag, localMD5, localSHA256)
+		err = d.verifyUploadIntegrity(ctx, client, key, *result.ETag, localMD5, localSHA256)
 		if err != nil {
-			// Attempt to clean up failed upload
-			_ = d.Delete(key)
+			// Attempt to clean up failed upload, even when the upload is cancelled
+			_ = d.Delete(context.Background(), key)
 			return driveFile, fmt.Errorf("[S3 Drive] Upload integrity verification failed => %s", err)
 		}
 	}
@@ -145,8 +155,131 @@ func (d *S3Drive) Upload(srcPath string) (DriveFile, error) {
 	return driveFile, nil
 }
 
-func (d *S3Drive) Delete(srcPath string) error {
-	client, err := d.getS3Client()
+// S3StreamPartSize returns the size of a part of a streamed upload, from
+// S3_STREAM_PART_SIZE for the first parts up to S3_MAX_PART_SIZE
+func S3StreamPartSize(partNumber int32) int {
+	size := int64(S3_STREAM_PART_SIZE)
+	for growth := (partNumber - 1) / S3_STREAM_PART_GROWTH; growth > 0 && size < S3_MAX_PART_SIZE; growth-- {
+		size *= 2
+	}
+	return int(min(size, S3_MAX_PART_SIZE))
+}
+
+// UploadStream uploads a stream with a multipart upload, a part being sent
+// each S3StreamPartSize bytes read. The upload is aborted when the stream
+// fails. As the checksums of the stream are only known once it is read, the
+// integrity check compares the size of the object with the size of the stream.
+func (d *S3Drive) UploadStream(ctx context.Context, name string, src io.Reader) (DriveFile, error) {
+	driveFile := DriveFile{}
+
+	client, err := d.getS3Client(ctx)
+	if err != nil {
+		return driveFile, fmt.Errorf("[S3 Drive] Unable to create S3 client => %s", err)
+	}
+
+	key := d.key(remoteFilename(name))
+	created, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: &d.Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return driveFile, fmt.Errorf("[S3 Drive] Unable to start upload of %s => %s", name, err)
+	}
+	abort := func() {
+		// Even when the upload is cancelled, so no part is left on the bucket
+		_, _ = client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   &d.Bucket,
+			Key:      &key,
+			UploadId: created.UploadId,
+		})
+	}
+
+	parts := make([]types.CompletedPart, 0)
+	var buffer []byte
+	var size int64
+	for partNumber := int32(1); ; partNumber++ {
+		if partNumber > S3_MAX_PARTS {
+			abort()
+			return driveFile, fmt.Errorf("[S3 Drive] Unable to upload stream %s => more than %d parts", name, S3_MAX_PARTS)
+		}
+		partSize := S3StreamPartSize(partNumber)
+		if len(buffer) != partSize {
+			buffer = make([]byte, partSize)
+		}
+		n, err := io.ReadFull(src, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			abort()
+			return driveFile, fmt.Errorf("[S3 Drive] Unable to read stream %s => %s", name, err)
+		}
+		// An empty stream is uploaded as a single empty part
+		if n == 0 && len(parts) > 0 {
+			break
+		}
+		part, err := client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     &d.Bucket,
+			Key:        &key,
+			UploadId:   created.UploadId,
+			PartNumber: aws.Int32(partNumber),
+			Body:       bytes.NewReader(buffer[:n]),
+		})
+		if err != nil {
+			abort()
+			return driveFile, fmt.Errorf("[S3 Drive] Unable to upload part %d of %s => %s", partNumber, name, err)
+		}
+		parts = append(parts, types.CompletedPart{ETag: part.ETag, PartNumber: aws.Int32(partNumber)})
+		size += int64(n)
+		if n < len(buffer) {
+			break
+		}
+	}
+
+	result, err := client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &d.Bucket,
+		Key:             &key,
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		abort()
+		return driveFile, fmt.Errorf("[S3 Drive] Unable to complete upload of %s => %s", name, err)
+	}
+
+	if d.EnableIntegrityCheck {
+		headResult, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: &d.Bucket,
+			Key:    &key,
+		})
+		if err == nil && (headResult.ContentLength == nil || *headResult.ContentLength != size) {
+			err = fmt.Errorf("size mismatch: stream of %d bytes", size)
+		}
+		if err != nil {
+			_ = d.Delete(context.Background(), key)
+			return driveFile, fmt.Errorf("[S3 Drive] Upload integrity verification failed => %s", err)
+		}
+	}
+
+	driveFile.Path = key
+	if result.ETag != nil {
+		driveFile.Checksum = *result.ETag
+	}
+	return driveFile, nil
+}
+
+// key returns the S3 key of a file, under the prefix of the drive
+func (d *S3Drive) key(filename string) string {
+	return d.keyPrefix() + filename
+}
+
+// keyPrefix returns the prefix of the keys of the drive, empty without prefix
+func (d *S3Drive) keyPrefix() string {
+	if d.Prefix == "" {
+		return ""
+	}
+	return strings.TrimPrefix(d.Prefix, "/") + "/"
+}
+
+func (d *S3Drive) Delete(ctx context.Context, srcPath string) error {
+	client, err := d.getS3Client(ctx)
 	if err != nil {
 		return fmt.Errorf("[S3 Drive] Unable to create S3 client => %s", err)
 	}
@@ -154,7 +287,7 @@ func (d *S3Drive) Delete(srcPath string) error {
 	// Use the full path as key since Upload returns the full S3 key
 	key := srcPath
 
-	_, err = client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: &d.Bucket,
 		Key:    &key,
 	})
@@ -166,6 +299,34 @@ func (d *S3Drive) Delete(srcPath string) error {
 	return nil
 }
 
+func (d *S3Drive) Download(ctx context.Context, path, dstPath string) error {
+	client, err := d.getS3Client(ctx)
+	if err != nil {
+		return fmt.Errorf("[S3 Drive] Unable to create S3 client => %s", err)
+	}
+
+	result, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &d.Bucket,
+		Key:    &path,
+	})
+	if err != nil {
+		return fmt.Errorf("[S3 Drive] Unable to download file %s => %s", path, err)
+	}
+	defer result.Body.Close()
+
+	file, err := os.Create(dstPath)
+	if err != nil {
+		return fmt.Errorf("[S3 Drive] Unable to create file %s => %s", dstPath, err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, result.Body)
+	if err != nil {
+		return fmt.Errorf("[S3 Drive] Unable to download file %s => %s", path, err)
+	}
+	return nil
+}
+
 func (d *S3Drive) Health() error {
 	folder := "./tmp"
 	err := os.MkdirAll(folder, 0755)
@@ -180,12 +341,12 @@ func (d *S3Drive) Health() error {
 		return fmt.Errorf("Failed to create health test file => %s", err)
 	}
 
-	file, err := d.Upload(healthTest)
+	file, err := d.Upload(context.Background(), healthTest)
 	if err != nil {
 		return fmt.Errorf("Failed to upload health test file to S3 => %s", err)
 	}
 
-	err = d.Delete(file.Path)
+	err = d.Delete(context.Background(), file.Path)
 	if err != nil {
 		return fmt.Errorf("Failed to delete health test file from S3 => %s", err)
 	}
@@ -225,9 +386,9 @@ func (d *S3Drive) calculateChecksums(file io.ReadSeeker) (string, string, error)
 }
 
 // verifyUploadIntegrity verifies the uploaded file integrity using S3 ETag
-func (d *S3Drive) verifyUploadIntegrity(client *s3.Client, key, etag, localMD5, localSHA256 string) error {
+func (d *S3Drive) verifyUploadIntegrity(ctx context.Context, client *s3.Client, key, etag, localMD5, localSHA256 string) error {
 	// Get object metadata to verify ETag
-	headResult, err := client.HeadObject(context.Background(), &s3.HeadObjectInput{
+	headResult, err := client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: &d.Bucket,
 		Key:    &key,
 	})
@@ -272,3 +433,120 @@ func (d *S3Drive) verifyUploadIntegrity(client *s3.Client, key, etag, localMD5,
 
 	return nil
 }
+
+func (d *S3Drive) PutObject(ctx context.Context, name string, data []byte) error {
+	client, err := d.getS3Client(ctx)
+	if err != nil {
+		return fmt.Errorf("[S3 Drive] Unable to create S3 client => %s", err)
+	}
+	key := d.key(name)
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: &d.Bucket,
+		Key:    &key,
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("[S3 Drive] Unable to put object %s => %s", name, err)
+	}
+	return nil
+}
+
+func (d *S3Drive) GetObject(ctx context.Context, name string) ([]byte, error) {
+	client, err := d.getS3Client(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("[S3 Drive] Unable to create S3 client => %s", err)
+	}
+	key := d.key(name)
+	result, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &d.Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("[S3 Drive] Unable to get object %s => %s", name, err)
+	}
+	defer result.Body.Close()
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("[S3 Drive] Unable to read object %s => %s", name, err)
+	}
+	return data, nil
+}
+
+func (d *S3Drive) ObjectExists(ctx context.Context, name string) (bool, error) {
+	client, err := d.getS3Client(ctx)
+	if err != nil {
+		return false, fmt.Errorf("[S3 Drive] Unable to create S3 client => %s", err)
+	}
+	key := d.key(name)
+	_, err = client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &d.Bucket,
+		Key:    &key,
+	})
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("[S3 Drive] Unable to check object %s => %s", name, err)
+	}
+	return true, nil
+}
+
+// TouchObject copies an object onto itself, S3 having no other way to update
+// its modification time
+func (d *S3Drive) TouchObject(ctx context.Context, name string) error {
+	client, err := d.getS3Client(ctx)
+	if err != nil {
+		return fmt.Errorf("[S3 Drive] Unable to create S3 client => %s", err)
+	}
+	key := d.key(name)
+	source := (&url.URL{Path: d.Bucket + "/" + key}).EscapedPath()
+	_, err = client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:            &d.Bucket,
+		Key:               &key,
+		CopySource:        &source,
+		MetadataDirective: types.MetadataDirectiveReplace,
+	})
+	if err != nil {
+		return fmt.Errorf("[S3 Drive] Unable to touch object %s => %s", name, err)
+	}
+	return nil
+}
+
+func (d *S3Drive) DeleteObject(ctx context.Context, name string) error {
+	return d.Delete(ctx, d.key(name))
+}
+
+func (d *S3Drive) ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	client, err := d.getS3Client(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("[S3 Drive] Unable to create S3 client => %s", err)
+	}
+	keyPrefix := d.key(prefix)
+	objects := make([]ObjectInfo, 0)
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: &d.Bucket,
+		Prefix: &keyPrefix,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("[S3 Drive] Unable to list objects => %s", err)
+		}
+		for _, object := range page.Contents {
+			info := ObjectInfo{Name: strings.TrimPrefix(*object.Key, d.keyPrefix()), Path: *object.Key}
+			if object.Size != nil {
+				info.Size = *object.Size
+			}
+			if object.LastModified != nil {
+				info.ModTime = *object.LastModified
+			}
+			objects = append(objects, info)
+		}
+	}
+	return objects, nil
+}
+
+func (d *S3Drive) List(ctx context.Context) ([]ObjectInfo, error) {
+	return d.ListObjects(ctx, "")
+}
@@ -0,0 +1,230 @@
+package drive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/herytz/backupman/core/lib"
+)
+
+const VOLUME_MANIFEST_VERSION = 1
+
+// Prefix of the name of the manifest of the volumes, which keeps the name of
+// the dump and its extension
+const VOLUME_MANIFEST_PREFIX = "manifest-"
+
+// VolumeManifest lists the volumes of a dump, in order
+type VolumeManifest struct {
+	Version int
+	Size    int64
+	Sha256  string
+	Volumes []Volume
+}
+
+type Volume struct {
+	Path   string
+	Size   int64
+	Sha256 string
+}
+
+// VolumeDrive splits the dumps uploaded to a drive into numbered volumes of
+// at most maxFileSize bytes, for the storages failing on large files. A JSON
+// manifest listing the volumes is uploaded last: it is the path of the drive
+// file, the volumes being its parts.
+type VolumeDrive struct {
+	Drive
+	maxFileSize int64
+}
+
+func NewVolumeDrive(d Drive, maxFileSize int64) *VolumeDrive {
+	if maxFileSize <= 0 {
+		log.Fatalf("drive (%s): max file size must be positive", d.GetLabel())
+	}
+	return &VolumeDrive{Drive: d, maxFileSize: maxFileSize}
+}
+
+func (d *VolumeDrive) Upload(ctx context.Context, srcPath string) (DriveFile, error) {
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return DriveFile{}, fmt.Errorf("failed to open file %s => %s", srcPath, err)
+	}
+	defer file.Close()
+	return d.UploadStream(ctx, srcPath, file)
+}
+
+// UploadStream uploads src as the volumes <name>.001, <name>.002... then their
+// manifest. The volumes of a failed upload are deleted.
+func (d *VolumeDrive) UploadStream(ctx context.Context, name string, src io.Reader) (DriveFile, error) {
+	reader := bufio.NewReader(src)
+	dumpHash := sha256.New()
+	manifest := VolumeManifest{Version: VOLUME_MANIFEST_VERSION, Volumes: make([]Volume, 0)}
+	parts := make([]string, 0)
+	for number := 1; ; number++ {
+		volumeHash := sha256.New()
+		limited := &io.LimitedReader{R: reader, N: d.maxFileSize}
+		file, err := d.uploadVolume(ctx, fmt.Sprintf("%s.%03d", name, number), io.TeeReader(limited, io.MultiWriter(dumpHash, volumeHash)))
+		if err != nil {
+			d.deleteVolumes(ctx, parts)
+			return DriveFile{}, fmt.Errorf("failed to upload volume %d of %s => %s", number, name, err)
+		}
+		parts = append(parts, file.Path)
+		size := d.maxFileSize - limited.N
+		manifest.Volumes = append(manifest.Volumes, Volume{Path: file.Path, Size: size, Sha256: hex.EncodeToString(volumeHash.Sum(nil))})
+		manifest.Size += size
+
+		_, err = reader.Peek(1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			d.deleteVolumes(ctx, parts)
+			return DriveFile{}, fmt.Errorf("failed to read dump %s => %s", name, err)
+		}
+	}
+	manifest.Sha256 = hex.EncodeToString(dumpHash.Sum(nil))
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		d.deleteVolumes(ctx, parts)
+		return DriveFile{}, fmt.Errorf("failed to encode manifest of %s => %s", name, err)
+	}
+	manifestName := filepath.Join(filepath.Dir(name), VOLUME_MANIFEST_PREFIX+filepath.Base(name))
+	file, err := d.uploadVolume(ctx, manifestName, bytes.NewReader(data))
+	if err != nil {
+		d.deleteVolumes(ctx, parts)
+		return DriveFile{}, fmt.Errorf("failed to upload manifest of %s => %s", name, err)
+	}
+	log.Printf("dump %s uploaded to drive (%s) in %d volumes", name, d.GetLabel(), len(parts))
+	return DriveFile{Path: file.Path, Checksum: manifest.Sha256, Parts: parts}, nil
+}
+
+// Download downloads a file of the drive, the volumes of a dump being
+// reassembled by DownloadVolumes
+func (d *VolumeDrive) Download(ctx context.Context, path, dstPath string) error {
+	downloader, ok := d.Drive.(Downloader)
+	if !ok {
+		return fmt.Errorf("download not supported by drive (%s)", d.GetLabel())
+	}
+	return downloader.Download(ctx, path, dstPath)
+}
+
+func (d *VolumeDrive) List(ctx context.Context) ([]ObjectInfo, error) {
+	lister, ok := d.Drive.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("list not supported by drive (%s)", d.GetLabel())
+	}
+	return lister.List(ctx)
+}
+
+func (d *VolumeDrive) Unwrap() Drive {
+	return d.Drive
+}
+
+// uploadVolume uploads a volume, through a temporary file when the drive cannot stream
+func (d *VolumeDrive) uploadVolume(ctx context.Context, name string, src io.Reader) (DriveFile, error) {
+	uploader, ok := d.Drive.(StreamUploader)
+	if ok {
+		return uploader.UploadStream(ctx, name, src)
+	}
+
+	tmpFolder, err := os.MkdirTemp("", "backupman-volume-*")
+	if err != nil {
+		return DriveFile{}, fmt.Errorf("failed to create volume folder => %s", err)
+	}
+	defer os.RemoveAll(tmpFolder)
+	volumePath := filepath.Join(tmpFolder, filepath.Base(name))
+	file, err := os.Create(volumePath)
+	if err != nil {
+		return DriveFile{}, fmt.Errorf("failed to create volume file %s => %s", volumePath, err)
+	}
+	_, err = io.Copy(file, lib.NewContextReader(ctx, src))
+	file.Close()
+	if err != nil {
+		return DriveFile{}, fmt.Errorf("failed to write volume file %s => %s", volumePath, err)
+	}
+	return d.Drive.Upload(ctx, volumePath)
+}
+
+func (d *VolumeDrive) deleteVolumes(ctx context.Context, parts []string) {
+	// The volumes of a cancelled upload are deleted too
+	ctx = context.WithoutCancel(ctx)
+	for _, part := range parts {
+		err := d.Drive.Delete(ctx, part)
+		if err != nil {
+			log.Printf("failed to delete volume %s from drive (%s) => %s", part, d.GetLabel(), err)
+		}
+	}
+}
+
+// DownloadVolumes reassembles the volumes listed by the manifest at
+// manifestPath into dstPath, every volume and the whole dump being checked
+// against their SHA-256
+func DownloadVolumes(ctx context.Context, d Downloader, manifestPath, dstPath string) error {
+	manifest, err := downloadVolumeManifest(ctx, d, manifestPath, dstPath+".manifest")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(dstPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s => %s", dstPath, err)
+	}
+	defer file.Close()
+
+	dumpHash := sha256.New()
+	volumePath := dstPath + ".volume"
+	defer os.Remove(volumePath)
+	for i, volume := range manifest.Volumes {
+		err := d.Download(ctx, volume.Path, volumePath)
+		if err != nil {
+			return fmt.Errorf("failed to download volume %d of %s => %s", i+1, manifestPath, err)
+		}
+		volumeFile, err := os.Open(volumePath)
+		if err != nil {
+			return fmt.Errorf("failed to open volume %d of %s => %s", i+1, manifestPath, err)
+		}
+		volumeHash := sha256.New()
+		_, err = io.Copy(io.MultiWriter(file, dumpHash, volumeHash), volumeFile)
+		volumeFile.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write file %s => %s", dstPath, err)
+		}
+		if hex.EncodeToString(volumeHash.Sum(nil)) != volume.Sha256 {
+			return fmt.Errorf("volume %d of %s is corrupted", i+1, manifestPath)
+		}
+	}
+	if hex.EncodeToString(dumpHash.Sum(nil)) != manifest.Sha256 {
+		return fmt.Errorf("dump %s does not match the checksum of its manifest", manifestPath)
+	}
+	return nil
+}
+
+func downloadVolumeManifest(ctx context.Context, d Downloader, manifestPath, dstPath string) (VolumeManifest, error) {
+	var manifest VolumeManifest
+	err := d.Download(ctx, manifestPath, dstPath)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to download manifest %s => %s", manifestPath, err)
+	}
+	defer os.Remove(dstPath)
+	data, err := os.ReadFile(dstPath)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to read manifest %s => %s", manifestPath, err)
+	}
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to decode manifest %s => %s", manifestPath, err)
+	}
+	if manifest.Version != VOLUME_MANIFEST_VERSION {
+		return manifest, fmt.Errorf("unsupported version %d of manifest %s", manifest.Version, manifestPath)
+	}
+	return manifest, nil
+}
@@ -0,0 +1,57 @@
+package dumper
+
+import (
+	"fmt"
+	"io"
+)
+
+// Discoverer is implemented by the dumpers backing up several databases of a
+// server. The databases are listed at each run and a dumper is returned for
+// each of them, so databases created or dropped between two runs are
+// followed without changing the configuration.
+type Discoverer interface {
+	Discover() ([]Dumper, error)
+}
+
+// DatabaseRestorer is implemented by the discovering dumpers able to restore
+// the backups of their databases. The restorer of a database is released by
+// closing it, the database must exist.
+type DatabaseRestorer interface {
+	RestorerFor(database string) (Restorer, error)
+}
+
+// DatabaseLabel is the label of the backups of a discovered database
+func DatabaseLabel(label, database string) string {
+	return label + "/" + database
+}
+
+// DiscoveredDumperError is returned by the Dump method of a discovering
+// dumper, which only dumps through the dumpers it discovers.
+func DiscoveredDumperError(label string) error {
+	return fmt.Errorf("data source (%s) dumps each of its databases separately, use Discover", label)
+}
+
+// closeDumpers releases the dumpers discovered before a failure
+func closeDumpers(dumpers []Dumper) {
+	for _, d := range dumpers {
+		closer, ok := d.(io.Closer)
+		if ok {
+			closer.Close()
+		}
+	}
+}
+
+// filterDatabases keeps the databases matching one of the patterns, system
+// databases are never kept.
+func filterDatabases(databases, patterns, system []string) []string {
+	filtered := make([]string, 0, len(databases))
+	for _, database := range databases {
+		if matchAny(system, database) {
+			continue
+		}
+		if matchAny(patterns, database) {
+			filtered = append(filtered, database)
+		}
+	}
+	return filtered
+}
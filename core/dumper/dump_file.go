@@ -0,0 +1,88 @@
+package dumper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"text/template"
+
+	"github.com/google/uuid"
+)
+
+func createDumpFile(tmpFolder, extension string) (*os.File, string, error) {
+	filenamePath := newDumpPath(tmpFolder, extension)
+
+	_, err := os.Stat(filenamePath)
+	canCreateFile := false
+	if err != nil {
+		switch err.(type) {
+		case *fs.PathError:
+			canCreateFile = true
+		default:
+			return nil, "", fmt.Errorf("failed to check if dump filename (%s) already exists or not: %s", filenamePath, err)
+		}
+	}
+
+	if !canCreateFile {
+		return nil, "", fmt.Errorf("dump filename (%s) already exists", filenamePath)
+	}
+
+	file, err := os.Create(filenamePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot create dump filename (%s): %s", filenamePath, err)
+	}
+
+	return file, filenamePath, nil
+}
+
+// writeDumpFile writes a dump to a new file of tmpFolder through dumpTo, the
+// file being removed when the dump fails
+func writeDumpFile(ctx context.Context, tmpFolder, extension string, dumpTo func(ctx context.Context, dumpPath string, w io.Writer) error) (string, error) {
+	file, filenamePath, err := createDumpFile(tmpFolder, extension)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	err = dumpTo(ctx, filenamePath, file)
+	if err == nil {
+		err = file.Sync()
+		if err != nil {
+			err = fmt.Errorf("failed to sync file to disk: %s", err)
+		}
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(filenamePath)
+		return "", err
+	}
+	return filenamePath, nil
+}
+
+// sqlDumpExtension returns the extension of the dumps of a SQL dumper
+func sqlDumpExtension(format string) string {
+	if IsTableExport(format) {
+		return ".tar"
+	}
+	return ".sql"
+}
+
+// newDumpPath returns a new path of tmpFolder for a dump, without creating it
+func newDumpPath(tmpFolder, extension string) string {
+	return path.Join(tmpFolder, uuid.NewString()+extension)
+}
+
+func parseDumpTemplates(name, header, table, footer string) (*template.Template, *template.Template, *template.Template, error) {
+	templates := make([]*template.Template, 3)
+	for i, text := range []string{header, table, footer} {
+		tm, err := template.New(name).Parse(text)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to parse template: %s", err)
+		}
+		templates[i] = tm
+	}
+	return templates[0], templates[1], templates[2], nil
+}
@@ -1,7 +1,40 @@
 package dumper
 
+import (
+	"context"
+	"io"
+)
+
+// Dumper writes a dump of its database to a temporary file. The dump is
+// aborted when the context is done.
 type Dumper interface {
-	Dump() (string, error)
+	Dump(ctx context.Context) (string, error)
 	GetLabel() string
 	Health() error
 }
+
+// DumpStats describes the content of a dump
+type DumpStats struct {
+	FileCount int64
+	TotalSize int64
+}
+
+// StatsReporter is implemented by the dumpers able to describe their dumps.
+// The stats of a dump are returned once, the caller stores them on the
+// backup.
+type StatsReporter interface {
+	DumpStats(dumpPath string) (DumpStats, bool)
+}
+
+// StreamDumper is implemented by the dumpers able to write their dump to a
+// stream, so the dump can be uploaded while it is written instead of from a
+// temporary file.
+type StreamDumper interface {
+	Dumper
+	// NewDumpPath returns a new path of the temporary folder naming a dump,
+	// no file being created
+	NewDumpPath() string
+	// DumpTo writes a dump named dumpPath to w. The dump is aborted when the
+	// context is done.
+	DumpTo(ctx context.Context, dumpPath string, w io.Writer) error
+}
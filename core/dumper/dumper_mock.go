@@ -1,8 +1,10 @@
 package dumper
 
+import "context"
+
 type DumperMock struct{}
 
-func (d *DumperMock) Dump() (string, error) {
+func (d *DumperMock) Dump(ctx context.Context) (string, error) {
 	return "./dumper_mock_db", nil
 }
 
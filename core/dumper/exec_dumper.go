@@ -0,0 +1,221 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/herytz/backupman/core/lib"
+)
+
+// Maximum amount of stderr kept in the error returned to the caller
+const execStderrLimit = 4096
+
+type ExecConnection struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Database string
+}
+
+// Data available in the command templates. The password is deliberately
+// absent: secrets must be passed through the environment.
+type execCommandParams struct {
+	Label    string
+	Host     string
+	Port     int
+	User     string
+	Database string
+}
+
+type ExecDumper struct {
+	Label         string
+	TmpFolder     string
+	Connection    ExecConnection
+	Command       []string
+	HealthCommand []string
+	Env           map[string]string
+	Timeout       time.Duration
+	FileExtension string
+}
+
+func NewExecDumper(label, tmpFolder string, connection ExecConnection, command, healthCommand []string, env map[string]string, timeout time.Duration, fileExtension string) *ExecDumper {
+	if len(command) == 0 {
+		log.Fatalf("ExecDumper (%s) requires a command", label)
+	}
+	if fileExtension == "" {
+		fileExtension = ".sql"
+	}
+	if !strings.HasPrefix(fileExtension, ".") {
+		fileExtension = "." + fileExtension
+	}
+	execDumper := &ExecDumper{
+		Label:         label,
+		TmpFolder:     tmpFolder,
+		Connection:    connection,
+		Command:       command,
+		HealthCommand: healthCommand,
+		Env:           env,
+		Timeout:       timeout,
+		FileExtension: fileExtension,
+	}
+	execDumper.setup()
+	return execDumper
+}
+
+func (e *ExecDumper) Dump(ctx context.Context) (string, error) {
+	file, filenamePath, err := createDumpFile(e.TmpFolder, e.FileExtension)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	err = e.run(ctx, e.Command, file)
+	if err != nil {
+		file.Close()
+		os.Remove(filenamePath)
+		return "", err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		file.Close()
+		os.Remove(filenamePath)
+		return "", fmt.Errorf("failed to sync file to disk: %s", err)
+	}
+
+	return filenamePath, nil
+}
+
+func (e *ExecDumper) NewDumpPath() string {
+	return newDumpPath(e.TmpFolder, e.FileExtension)
+}
+
+// DumpTo streams the standard output of the dump command to w
+func (e *ExecDumper) DumpTo(ctx context.Context, dumpPath string, w io.Writer) error {
+	return e.run(ctx, e.Command, w)
+}
+
+func (e *ExecDumper) Health() error {
+	if len(e.HealthCommand) == 0 {
+		_, err := exec.LookPath(e.Command[0])
+		if err != nil {
+			return fmt.Errorf("dump command (%s) not found => %s", e.Command[0], err)
+		}
+		return nil
+	}
+	return e.run(context.Background(), e.HealthCommand, nil)
+}
+
+func (e *ExecDumper) GetLabel() string {
+	return e.Label
+}
+
+func (e *ExecDumper) run(parent context.Context, command []string, stdout io.Writer) error {
+	argv, err := e.renderCommand(command)
+	if err != nil {
+		return err
+	}
+	env, err := e.renderEnv()
+	if err != nil {
+		return err
+	}
+
+	ctx := parent
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+
+	stderr := lib.NewTailBuffer(execStderrLimit)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stderr = stderr
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
+
+	err = cmd.Run()
+	if err != nil {
+		if parent.Err() != nil {
+			return fmt.Errorf("command (%s) aborted => %s: %s", argv[0], parent.Err(), stderr.String())
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("command (%s) timed out after %s: %s", argv[0], e.Timeout, stderr.String())
+		}
+		return fmt.Errorf("command (%s) failed => %s: %s", argv[0], err, stderr.String())
+	}
+
+	return nil
+}
+
+func (e *ExecDumper) renderCommand(command []string) ([]string, error) {
+	params := execCommandParams{
+		Label:    e.Label,
+		Host:     e.Connection.Host,
+		Port:     e.Connection.Port,
+		User:     e.Connection.User,
+		Database: e.Connection.Database,
+	}
+	argv := make([]string, len(command))
+	for i, arg := range command {
+		rendered, err := renderExecTemplate(arg, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render command argument (%s) => %s", arg, err)
+		}
+		argv[i] = rendered
+	}
+	return argv, nil
+}
+
+// Connection parameters are always exposed as BACKUPMAN_* variables, on top
+// of the user defined variables which may reference the password.
+func (e *ExecDumper) renderEnv() ([]string, error) {
+	env := []string{
+		"BACKUPMAN_LABEL=" + e.Label,
+		"BACKUPMAN_HOST=" + e.Connection.Host,
+		"BACKUPMAN_PORT=" + strconv.Itoa(e.Connection.Port),
+		"BACKUPMAN_USER=" + e.Connection.User,
+		"BACKUPMAN_PASSWORD=" + e.Connection.Password,
+		"BACKUPMAN_DATABASE=" + e.Connection.Database,
+	}
+	for key, value := range e.Env {
+		rendered, err := renderExecTemplate(value, e.Connection)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render environment variable (%s) => %s", key, err)
+		}
+		env = append(env, key+"="+rendered)
+	}
+	return env, nil
+}
+
+func renderExecTemplate(text string, data any) (string, error) {
+	tm, err := template.New("exec").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = tm.Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (e *ExecDumper) setup() {
+	err := os.MkdirAll(e.TmpFolder, 0755)
+	if err != nil {
+		log.Fatalf("failed to setup ExecDumper (%s) tmpFolder (%s). %s", e.Label, e.TmpFolder, err)
+	}
+}
@@ -0,0 +1,280 @@
+package dumper
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/herytz/backupman/core/lib"
+)
+
+const (
+	FILESYSTEM_COMPRESSION_NONE = ""
+	FILESYSTEM_COMPRESSION_GZIP = "gzip"
+)
+
+// FilesystemDumper archives files and folders in a tar file. Permissions,
+// owners and modification times are kept, and symlinks are stored as links
+// instead of being followed.
+type FilesystemDumper struct {
+	Label     string
+	TmpFolder string
+	Paths     []string
+	// Patterns matched against the path relative to the archived folder and
+	// against the file name. Include patterns only apply to files.
+	Include     []string
+	Exclude     []string
+	Compression string
+	stats       map[string]DumpStats
+	mu          sync.Mutex
+}
+
+func NewFilesystemDumper(label, tmpFolder string, paths, include, exclude []string, compression string) *FilesystemDumper {
+	if len(paths) == 0 {
+		log.Fatalf("FilesystemDumper (%s) requires at least one path", label)
+	}
+	filesystemDumper := &FilesystemDumper{
+		Label:       label,
+		TmpFolder:   tmpFolder,
+		Paths:       paths,
+		Include:     include,
+		Exclude:     exclude,
+		Compression: compression,
+		stats:       make(map[string]DumpStats),
+	}
+	filesystemDumper.setup()
+	return filesystemDumper
+}
+
+func (f *FilesystemDumper) Dump(ctx context.Context) (string, error) {
+	file, filenamePath, err := createDumpFile(f.TmpFolder, f.extension())
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	stats, err := f.dump(ctx, file)
+	if err != nil {
+		file.Close()
+		os.Remove(filenamePath)
+		return "", err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return "", fmt.Errorf("failed to sync file to disk: %s", err)
+	}
+
+	f.mu.Lock()
+	f.stats[filenamePath] = stats
+	f.mu.Unlock()
+
+	return filenamePath, nil
+}
+
+func (f *FilesystemDumper) NewDumpPath() string {
+	return newDumpPath(f.TmpFolder, f.extension())
+}
+
+// DumpTo streams the archive to w, its stats being kept for dumpPath
+func (f *FilesystemDumper) DumpTo(ctx context.Context, dumpPath string, w io.Writer) error {
+	stats, err := f.dump(ctx, w)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.stats[dumpPath] = stats
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *FilesystemDumper) extension() string {
+	if f.Compression == FILESYSTEM_COMPRESSION_GZIP {
+		return ".tar.gz"
+	}
+	return ".tar"
+}
+
+func (f *FilesystemDumper) DumpStats(dumpPath string) (DumpStats, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats, ok := f.stats[dumpPath]
+	delete(f.stats, dumpPath)
+	return stats, ok
+}
+
+func (f *FilesystemDumper) dump(ctx context.Context, w io.Writer) (DumpStats, error) {
+	stats := DumpStats{}
+
+	var gz *gzip.Writer
+	if f.Compression == FILESYSTEM_COMPRESSION_GZIP {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	archive := tar.NewWriter(w)
+
+	// The temporary folder may be inside an archived folder
+	tmpFolder, err := filepath.Abs(f.TmpFolder)
+	if err != nil {
+		return stats, fmt.Errorf("cannot resolve tmp folder (%s): %s", f.TmpFolder, err)
+	}
+
+	for _, root := range f.Paths {
+		err := f.archivePath(ctx, archive, filepath.Clean(root), tmpFolder, &stats)
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	err = archive.Close()
+	if err != nil {
+		return stats, fmt.Errorf("failed to close archive: %s", err)
+	}
+	if gz != nil {
+		err = gz.Close()
+		if err != nil {
+			return stats, fmt.Errorf("failed to close compressed archive: %s", err)
+		}
+	}
+	return stats, nil
+}
+
+func (f *FilesystemDumper) archivePath(ctx context.Context, archive *tar.Writer, root, tmpFolder string, stats *DumpStats) error {
+	_, err := os.Lstat(root)
+	if err != nil {
+		return fmt.Errorf("cannot read path (%s): %s", root, err)
+	}
+
+	return filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Files removed while the archive is being written are skipped
+			if errors.Is(err, fs.ErrNotExist) && filePath != root {
+				return nil
+			}
+			return fmt.Errorf("cannot read path (%s): %s", filePath, err)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("dump aborted: %s", ctx.Err())
+		}
+
+		if entry.IsDir() {
+			absolute, err := filepath.Abs(filePath)
+			if err == nil && absolute == tmpFolder {
+				return filepath.SkipDir
+			}
+		}
+
+		relative, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		relative = filepath.ToSlash(relative)
+		if relative != "." && !f.match(relative, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("cannot read path (%s): %s", filePath, err)
+		}
+		return f.archiveEntry(ctx, archive, filePath, info, stats)
+	})
+}
+
+// match reports whether a path relative to an archived folder is kept.
+// Excluded folders are skipped with their content.
+func (f *FilesystemDumper) match(relative string, isDir bool) bool {
+	name := path.Base(relative)
+	if matchAny(f.Exclude, relative) || matchAny(f.Exclude, name) {
+		return false
+	}
+	if isDir || len(f.Include) == 0 {
+		return true
+	}
+	return matchAny(f.Include, relative) || matchAny(f.Include, name)
+}
+
+func (f *FilesystemDumper) archiveEntry(ctx context.Context, archive *tar.Writer, filePath string, info fs.FileInfo, stats *DumpStats) error {
+	var link string
+	if info.Mode()&fs.ModeSymlink != 0 {
+		var err error
+		link, err = os.Readlink(filePath)
+		if err != nil {
+			return fmt.Errorf("cannot read symlink (%s): %s", filePath, err)
+		}
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return fmt.Errorf("cannot archive path (%s): %s", filePath, err)
+	}
+	// Absolute paths are stored relative to the root, like tar does
+	header.Name = strings.TrimPrefix(filepath.ToSlash(filePath), "/")
+	if info.IsDir() {
+		header.Name += "/"
+	}
+
+	if !info.Mode().IsRegular() {
+		return archive.WriteHeader(header)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("cannot open file (%s): %s", filePath, err)
+	}
+	defer file.Close()
+
+	err = archive.WriteHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to write archive header: %s", err)
+	}
+	// The header size is kept even if the file changes while being copied
+	written, err := io.CopyN(archive, lib.NewContextReader(ctx, file), header.Size)
+	if err != nil {
+		return fmt.Errorf("failed to archive file (%s) after %d bytes: %s", filePath, written, err)
+	}
+
+	stats.FileCount++
+	stats.TotalSize += written
+	return nil
+}
+
+func (f *FilesystemDumper) Health() error {
+	for _, root := range f.Paths {
+		_, err := os.Stat(root)
+		if err != nil {
+			return fmt.Errorf("cannot read path (%s): %s", root, err)
+		}
+	}
+	return nil
+}
+
+func (f *FilesystemDumper) GetLabel() string {
+	return f.Label
+}
+
+func (f *FilesystemDumper) setup() {
+	err := os.MkdirAll(f.TmpFolder, 0755)
+	if err != nil {
+		log.Fatalf("failed to setup FilesystemDumper (%s) tmpFolder (%s). %s", f.Label, f.TmpFolder, err)
+	}
+}
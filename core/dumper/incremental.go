@@ -0,0 +1,51 @@
+package dumper
+
+import (
+	"context"
+	"time"
+)
+
+// IncrementalDumper is implemented by the dumpers able to capture the changes
+// made since a previous backup. A full dump records the position the changes
+// are captured from, then each incremental dump continues from the position
+// reached by the previous one.
+type IncrementalDumper interface {
+	Dumper
+	PositionReporter
+	// IsIncremental reports whether incremental backups are enabled
+	IsIncremental() bool
+	// CurrentPosition returns the position currently reached by the server
+	CurrentPosition() (string, error)
+	// DumpIncremental captures the changes made since position and returns
+	// the dump with the position it ends at
+	DumpIncremental(ctx context.Context, position string) (string, string, error)
+}
+
+// PositionReporter is implemented by the dumpers recording where the chain of
+// a full dump starts. The position of a dump is returned once, the caller
+// stores it on the backup.
+type PositionReporter interface {
+	DumpPosition(dumpPath string) (string, bool)
+}
+
+// BaseBackupDumper is implemented by the dumpers taking physical base
+// backups. The WAL segments archived by the server are stored as the chain of
+// the base backup they follow, and replayed by the server when it starts on a
+// restored base backup.
+type BaseBackupDumper interface {
+	Dumper
+	PositionReporter
+	// RestoreBaseBackup extracts a base backup in the data directory
+	// targetDir, with the WAL segments to replay by segment name. The server
+	// recovers up to until, or to the last segment when until is zero.
+	RestoreBaseBackup(dumpPath string, segments map[string]string, targetDir string, until time.Time) error
+}
+
+// Restorer is implemented by the dumpers able to load their dumps back into
+// the data source.
+type Restorer interface {
+	Restore(dumpPath string) error
+	// RestoreIncremental replays an incremental dump. The transactions
+	// started after until are skipped, unless until is zero.
+	RestoreIncremental(dumpPath string, until time.Time) error
+}
@@ -0,0 +1,141 @@
+package dumper
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+)
+
+const (
+	MASKING_STRATEGY_NULL       = "null"
+	MASKING_STRATEGY_FIXED      = "fixed"
+	MASKING_STRATEGY_HASH       = "hash"
+	MASKING_STRATEGY_FAKE_EMAIL = "fake_email"
+	MASKING_STRATEGY_FAKE_NAME  = "fake_name"
+	MASKING_STRATEGY_REDACT     = "redact"
+)
+
+var fakeFirstNames = []string{
+	"Alice", "Bob", "Carol", "David", "Emma", "Frank", "Grace", "Henry",
+	"Irene", "Jack", "Karen", "Louis", "Maria", "Nathan", "Olivia", "Paul",
+}
+
+var fakeLastNames = []string{
+	"Anderson", "Brown", "Clark", "Davis", "Evans", "Garcia", "Harris", "Jones",
+	"King", "Lewis", "Martin", "Moore", "Smith", "Taylor", "Walker", "Young",
+}
+
+// MaskingRule anonymizes a column. Table and Column accept the glob syntax
+// of path.Match, so "*.email" masks the email column of every table.
+type MaskingRule struct {
+	Table    string
+	Column   string
+	Strategy string
+	// Replacement for the fixed strategy, salt for the hash strategy
+	Value string
+}
+
+type Masking []MaskingRule
+
+func (m Masking) Validate() error {
+	for _, rule := range m {
+		if rule.Table == "" || rule.Column == "" {
+			return fmt.Errorf("masking rule must target a table.column, got (%s.%s)", rule.Table, rule.Column)
+		}
+		for _, pattern := range []string{rule.Table, rule.Column} {
+			_, err := path.Match(pattern, "")
+			if err != nil {
+				return fmt.Errorf("invalid masking pattern (%s): %s", pattern, err)
+			}
+		}
+		switch rule.Strategy {
+		case MASKING_STRATEGY_NULL, MASKING_STRATEGY_FIXED, MASKING_STRATEGY_HASH,
+			MASKING_STRATEGY_FAKE_EMAIL, MASKING_STRATEGY_FAKE_NAME, MASKING_STRATEGY_REDACT:
+		default:
+			return fmt.Errorf("unsupported masking strategy (%s) for %s.%s", rule.Strategy, rule.Table, rule.Column)
+		}
+	}
+	return nil
+}
+
+// Rule returns the first rule matching the column, or nil when the column is
+// dumped as is.
+func (m Masking) Rule(table, column string) *MaskingRule {
+	for i, rule := range m {
+		tableMatched, _ := path.Match(rule.Table, table)
+		columnMatched, _ := path.Match(rule.Column, column)
+		if tableMatched && columnMatched {
+			return &m[i]
+		}
+	}
+	return nil
+}
+
+// ColumnRules resolves the rules of a table once, so row emission does not
+// match patterns for every value.
+func (m Masking) ColumnRules(table string, columns []string) []*MaskingRule {
+	if len(m) == 0 {
+		return nil
+	}
+	rules := make([]*MaskingRule, len(columns))
+	for i, column := range columns {
+		rules[i] = m.Rule(table, column)
+	}
+	return rules
+}
+
+// Apply returns the masked value. A nil value is a SQL NULL and stays NULL.
+// Fake values are derived from the original value, so the same input is
+// always masked the same way and joins between tables keep working.
+func (r MaskingRule) Apply(value *string) *string {
+	if value == nil {
+		return nil
+	}
+
+	var masked string
+	switch r.Strategy {
+	case MASKING_STRATEGY_NULL:
+		return nil
+	case MASKING_STRATEGY_FIXED:
+		masked = r.Value
+	case MASKING_STRATEGY_HASH:
+		sum := sha256.Sum256([]byte(r.Value + *value))
+		masked = hex.EncodeToString(sum[:])
+	case MASKING_STRATEGY_FAKE_EMAIL:
+		sum := sha256.Sum256([]byte(*value))
+		masked = fmt.Sprintf("user_%s@example.com", hex.EncodeToString(sum[:5]))
+	case MASKING_STRATEGY_FAKE_NAME:
+		sum := sha256.Sum256([]byte(*value))
+		first := fakeFirstNames[binary.BigEndian.Uint32(sum[0:4])%uint32(len(fakeFirstNames))]
+		last := fakeLastNames[binary.BigEndian.Uint32(sum[4:8])%uint32(len(fakeLastNames))]
+		masked = first + " " + last
+	case MASKING_STRATEGY_REDACT:
+		masked = redact(*value)
+	default:
+		masked = *value
+	}
+	return &masked
+}
+
+// redact keeps the format of the value (length, separators, case) while
+// hiding its content: "John.Doe+42@mail.com" => "Xxxx.Xxx+00@xxxx.xxx".
+func redact(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case unicode.IsUpper(r):
+			b.WriteRune('X')
+		case unicode.IsLetter(r):
+			b.WriteRune('x')
+		case unicode.IsDigit(r):
+			b.WriteRune('0')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
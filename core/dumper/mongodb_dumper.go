@@ -0,0 +1,275 @@
+package dumper
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+)
+
+// Databases skipped when the whole server is dumped
+var mongodbSystemDatabases = []string{"admin", "config", "local"}
+
+// MongodbDumper exports collections to a tar archive laid out like the output
+// of mongodump: <database>/<collection>.bson holds the documents and
+// <database>/<collection>.metadata.json the options and indexes, so the
+// extracted archive can be restored with mongorestore.
+type MongodbDumper struct {
+	Label     string
+	TmpFolder string
+	// Database to dump, all the non system databases when empty
+	Database string
+	// Collection patterns, matched against "collection" and "database.collection"
+	IncludeCollections []string
+	ExcludeCollections []string
+	client             *mongo.Client
+}
+
+func NewMongodbDumper(label, tmpFolder, uri, database string, includeCollections, excludeCollections []string) *MongodbDumper {
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+	mongodbDumper := &MongodbDumper{
+		Label:              label,
+		TmpFolder:          tmpFolder,
+		Database:           database,
+		IncludeCollections: includeCollections,
+		ExcludeCollections: excludeCollections,
+		client:             client,
+	}
+	mongodbDumper.setup()
+	return mongodbDumper
+}
+
+func (m *MongodbDumper) Dump(ctx context.Context) (string, error) {
+	file, filenamePath, err := createDumpFile(m.TmpFolder, ".tar")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	err = m.dump(ctx, file, filenamePath)
+	if err != nil {
+		file.Close()
+		os.Remove(filenamePath)
+		return "", err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return "", fmt.Errorf("failed to sync file to disk: %s", err)
+	}
+
+	return filenamePath, nil
+}
+
+func (m *MongodbDumper) dump(ctx context.Context, file *os.File, filenamePath string) error {
+	databases, err := m.getDatabases(ctx)
+	if err != nil {
+		return err
+	}
+
+	archive := tar.NewWriter(file)
+	for _, database := range databases {
+		specs, err := m.client.Database(database).ListCollectionSpecifications(ctx, bson.D{})
+		if err != nil {
+			return fmt.Errorf("failed to list collections of database %s: %s", database, err)
+		}
+		for _, spec := range specs {
+			if !m.matchCollection(database, spec.Name) {
+				continue
+			}
+			err = m.dumpCollection(ctx, archive, filenamePath, database, spec)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = archive.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close archive: %s", err)
+	}
+	return nil
+}
+
+func (m *MongodbDumper) getDatabases(ctx context.Context) ([]string, error) {
+	if m.Database != "" {
+		return []string{m.Database}, nil
+	}
+	names, err := m.client.ListDatabaseNames(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %s", err)
+	}
+	databases := make([]string, 0, len(names))
+	for _, name := range names {
+		if !matchAny(mongodbSystemDatabases, name) {
+			databases = append(databases, name)
+		}
+	}
+	return databases, nil
+}
+
+func (m *MongodbDumper) matchCollection(database, collection string) bool {
+	if strings.HasPrefix(collection, "system.") {
+		return false
+	}
+	names := []string{collection, database + "." + collection}
+	if len(m.IncludeCollections) > 0 && !matchAny(m.IncludeCollections, names[0]) && !matchAny(m.IncludeCollections, names[1]) {
+		return false
+	}
+	return !matchAny(m.ExcludeCollections, names[0]) && !matchAny(m.ExcludeCollections, names[1])
+}
+
+func (m *MongodbDumper) dumpCollection(ctx context.Context, archive *tar.Writer, filenamePath, database string, spec mongo.CollectionSpecification) error {
+	collection := m.client.Database(database).Collection(spec.Name)
+
+	metadata, err := m.collectionMetadata(ctx, collection, spec)
+	if err != nil {
+		return err
+	}
+	err = writeArchiveEntry(archive, path.Join(database, spec.Name+".metadata.json"), metadata)
+	if err != nil {
+		return err
+	}
+
+	// Views have no documents of their own
+	if spec.Type == "view" {
+		return nil
+	}
+
+	// The tar header needs the size of the entry, so the documents are
+	// written to a temporary file before being archived
+	documentsPath := filenamePath + ".bson.part"
+	defer os.Remove(documentsPath)
+	documents, err := os.Create(documentsPath)
+	if err != nil {
+		return fmt.Errorf("cannot create collection dump (%s): %s", documentsPath, err)
+	}
+	defer documents.Close()
+
+	cursor, err := collection.Find(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("cannot get collection %s.%s documents: %s", database, spec.Name, err)
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		_, err = documents.Write(cursor.Current)
+		if err != nil {
+			return fmt.Errorf("failed to write collection %s.%s documents: %s", database, spec.Name, err)
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return fmt.Errorf("error iterating collection %s.%s documents: %s", database, spec.Name, err)
+	}
+
+	info, err := documents.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat collection dump (%s): %s", documentsPath, err)
+	}
+	err = archive.WriteHeader(&tar.Header{
+		Name:    path.Join(database, spec.Name+".bson"),
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write archive header: %s", err)
+	}
+	_, err = documents.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("failed to read collection dump (%s): %s", documentsPath, err)
+	}
+	_, err = io.Copy(archive, documents)
+	if err != nil {
+		return fmt.Errorf("failed to archive collection %s.%s: %s", database, spec.Name, err)
+	}
+	return nil
+}
+
+func (m *MongodbDumper) collectionMetadata(ctx context.Context, collection *mongo.Collection, spec mongo.CollectionSpecification) ([]byte, error) {
+	indexes := bson.A{}
+	if spec.Type != "view" {
+		cursor, err := collection.Indexes().List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list indexes of collection %s: %s", spec.Name, err)
+		}
+		defer cursor.Close(ctx)
+		for cursor.Next(ctx) {
+			indexes = append(indexes, bson.Raw(append([]byte(nil), cursor.Current...)))
+		}
+		if err := cursor.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating indexes of collection %s: %s", spec.Name, err)
+		}
+	}
+
+	options := spec.Options
+	if options == nil {
+		options, _ = bson.Marshal(bson.D{})
+	}
+	metadata := bson.D{
+		{Key: "indexes", Value: indexes},
+		{Key: "collectionName", Value: spec.Name},
+		{Key: "type", Value: spec.Type},
+		{Key: "options", Value: options},
+	}
+	if spec.UUID != nil {
+		metadata = append(metadata, bson.E{Key: "uuid", Value: hex.EncodeToString(spec.UUID.Data)})
+	}
+
+	content, err := bson.MarshalExtJSON(metadata, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata of collection %s: %s", spec.Name, err)
+	}
+	return content, nil
+}
+
+func writeArchiveEntry(archive *tar.Writer, name string, content []byte) error {
+	err := archive.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write archive header: %s", err)
+	}
+	_, err = archive.Write(content)
+	if err != nil {
+		return fmt.Errorf("failed to write archive entry (%s): %s", name, err)
+	}
+	return nil
+}
+
+func (m *MongodbDumper) Health() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := m.client.Ping(ctx, readpref.Primary())
+	if err != nil {
+		return fmt.Errorf("failed to ping MongoDB => %s", err)
+	}
+	return nil
+}
+
+func (m *MongodbDumper) GetLabel() string {
+	return m.Label
+}
+
+func (m *MongodbDumper) setup() {
+	err := os.MkdirAll(m.TmpFolder, 0755)
+	if err != nil {
+		log.Fatalf("failed to setup MongodbDumper (%s) tmpFolder (%s). %s", m.Label, m.TmpFolder, err)
+	}
+}
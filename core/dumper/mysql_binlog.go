@@ -0,0 +1,371 @@
+package dumper
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	golog "github.com/siddontang/go-log/log"
+)
+
+// Time allowed to receive the next binlog event before the capture is aborted
+const binlogEventTimeout = 30 * time.Second
+
+// BinlogOptions enables the incremental backups of a MySQL data source. The
+// changes are read from the binary log like a replica does, so ServerId must
+// be unique among the replicas of the server.
+type BinlogOptions struct {
+	Enabled  bool
+	ServerId uint32
+}
+
+// binlogPosition is stored on the backups as "<file>:<position>"
+type binlogPosition struct {
+	Name string
+	Pos  uint32
+}
+
+func (p binlogPosition) String() string {
+	return fmt.Sprintf("%s:%d", p.Name, p.Pos)
+}
+
+// reached reports whether p is at or after target. Binlog files of a server
+// share the same base name and a fixed width sequence number.
+func (p binlogPosition) reached(target binlogPosition) bool {
+	if p.Name != target.Name {
+		return p.Name > target.Name
+	}
+	return p.Pos >= target.Pos
+}
+
+func parseBinlogPosition(position string) (binlogPosition, error) {
+	name, pos, found := strings.Cut(position, ":")
+	if !found || name == "" {
+		return binlogPosition{}, fmt.Errorf("invalid binlog position: %s", position)
+	}
+	value, err := strconv.ParseUint(pos, 10, 32)
+	if err != nil {
+		return binlogPosition{}, fmt.Errorf("invalid binlog position: %s", position)
+	}
+	return binlogPosition{Name: name, Pos: uint32(value)}, nil
+}
+
+func (m *MysqlDumper) IsIncremental() bool {
+	return m.Binlog.Enabled
+}
+
+func (m *MysqlDumper) DumpPosition(dumpPath string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	position, ok := m.positions[dumpPath]
+	delete(m.positions, dumpPath)
+	return position, ok
+}
+
+func (m *MysqlDumper) CurrentPosition() (string, error) {
+	position, err := m.binlogPosition(m.db)
+	if err != nil {
+		return "", err
+	}
+	return position.String(), nil
+}
+
+// binlogPosition reads the current position of the binary log.
+// SHOW MASTER STATUS was renamed SHOW BINARY LOG STATUS in MySQL 8.4.
+func (m *MysqlDumper) binlogPosition(q mysqlQuerier) (binlogPosition, error) {
+	var rows *sql.Rows
+	var err error
+	for _, query := range []string{"SHOW MASTER STATUS", "SHOW BINARY LOG STATUS"} {
+		rows, err = q.QueryContext(context.Background(), query)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return binlogPosition{}, fmt.Errorf("failed to read binlog position => %s", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return binlogPosition{}, fmt.Errorf("failed to read binlog position => %s", err)
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return binlogPosition{}, fmt.Errorf("failed to read binlog position => %s", err)
+		}
+		return binlogPosition{}, fmt.Errorf("binary log is disabled on the server")
+	}
+	values := make([]sql.NullString, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	err = rows.Scan(ptrs...)
+	if err != nil {
+		return binlogPosition{}, fmt.Errorf("failed to scan binlog position => %s", err)
+	}
+
+	position := binlogPosition{}
+	for i, column := range columns {
+		switch column {
+		case "File":
+			position.Name = values[i].String
+		case "Position":
+			pos, err := strconv.ParseUint(values[i].String, 10, 32)
+			if err != nil {
+				return binlogPosition{}, fmt.Errorf("invalid binlog position: %s", values[i].String)
+			}
+			position.Pos = uint32(pos)
+		}
+	}
+	return position, nil
+}
+
+func (m *MysqlDumper) DumpIncremental(ctx context.Context, position string) (string, string, error) {
+	start, err := parseBinlogPosition(position)
+	if err != nil {
+		return "", "", err
+	}
+	end, err := m.binlogPosition(m.db)
+	if err != nil {
+		return "", "", err
+	}
+
+	file, filenamePath, err := createDumpFile(m.TmpFolder, ".binlog")
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	err = m.captureBinlog(ctx, file, start, end)
+	if err != nil {
+		file.Close()
+		os.Remove(filenamePath)
+		return "", "", err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sync file to disk: %s", err)
+	}
+
+	return filenamePath, end.String(), nil
+}
+
+// captureBinlog writes the binlog events between start and end as a binlog
+// file, readable by mysqlbinlog.
+func (m *MysqlDumper) captureBinlog(ctx context.Context, w io.Writer, start, end binlogPosition) error {
+	serverVersion, err := m.getServerVersion(ctx)
+	if err != nil {
+		return err
+	}
+	flavor := mysql.MySQLFlavor
+	if strings.Contains(strings.ToLower(serverVersion), "mariadb") {
+		flavor = mysql.MariaDBFlavor
+	}
+
+	syncer := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{
+		ServerID:  m.Binlog.ServerId,
+		Flavor:    flavor,
+		Host:      m.Host,
+		Port:      uint16(m.Port),
+		User:      m.User,
+		Password:  m.Password,
+		TLSConfig: binlogTlsConfig(m.Tls, m.Host),
+		Logger:    golog.NewDefault(&golog.NullHandler{}),
+	})
+	defer syncer.Close()
+
+	streamer, err := syncer.StartSync(mysql.Position{Name: start.Name, Pos: start.Pos})
+	if err != nil {
+		return fmt.Errorf("failed to start binlog sync from %s => %s", start, err)
+	}
+
+	_, err = w.Write(replication.BinLogFileHeader)
+	if err != nil {
+		return fmt.Errorf("failed to write binlog header: %s", err)
+	}
+
+	current := start
+	formatWritten := false
+	for !current.reached(end) {
+		eventCtx, cancel := context.WithTimeout(ctx, binlogEventTimeout)
+		event, err := streamer.GetEvent(eventCtx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to read binlog event after %s => %s", current, err)
+		}
+
+		switch e := event.Event.(type) {
+		case *replication.RotateEvent:
+			current = binlogPosition{Name: string(e.NextLogName), Pos: uint32(e.Position)}
+			continue
+		case *replication.FormatDescriptionEvent:
+			// Each binlog file starts with its own description, the first
+			// one describes the whole capture
+			if formatWritten {
+				continue
+			}
+			formatWritten = true
+		case *replication.GenericEvent:
+			if event.Header.EventType == replication.HEARTBEAT_EVENT {
+				continue
+			}
+		}
+
+		_, err = w.Write(event.RawData)
+		if err != nil {
+			return fmt.Errorf("failed to write binlog event: %s", err)
+		}
+		if event.Header.LogPos > 0 {
+			current.Pos = event.Header.LogPos
+		}
+	}
+	return nil
+}
+
+func binlogTlsConfig(mode, host string) *tls.Config {
+	switch mode {
+	case "true":
+		return &tls.Config{ServerName: host}
+	case "skip-verify", "preferred":
+		return &tls.Config{InsecureSkipVerify: true}
+	default:
+		return nil
+	}
+}
+
+// RestoreIncremental replays the transactions of a binlog file captured by
+// DumpIncremental. Row events are applied through BINLOG statements, like the
+// output of mysqlbinlog, which requires the BINLOG_ADMIN or SUPER privilege.
+// The binary log holds the changes of the whole server, only the ones of the
+// dumped database are replayed.
+func (m *MysqlDumper) RestoreIncremental(dumpPath string, until time.Time) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open connection => %s", err)
+	}
+	defer conn.Close()
+
+	replay := &binlogReplay{conn: conn, until: until, database: m.Database, skippedTables: make(map[uint64]bool)}
+	err = replication.NewBinlogParser().ParseFile(dumpPath, 0, replay.apply)
+	if replay.stopped {
+		err = nil
+	}
+	if err != nil {
+		if replay.inTransaction {
+			conn.ExecContext(ctx, "ROLLBACK")
+		}
+		return fmt.Errorf("failed to replay binlog (%s) => %s", dumpPath, err)
+	}
+	if replay.inTransaction {
+		// The capture ends on a transaction boundary, a transaction left
+		// open belongs to a truncated file
+		conn.ExecContext(ctx, "ROLLBACK")
+		return fmt.Errorf("failed to replay binlog (%s) => last transaction is incomplete", dumpPath)
+	}
+	return nil
+}
+
+type binlogReplay struct {
+	conn          *sql.Conn
+	until         time.Time
+	database      string
+	inTransaction bool
+	stopped       bool
+	// Table maps of the current statement, sent with each of its row events
+	tableMaps []byte
+	// Tables of the other databases, by table id
+	skippedTables map[uint64]bool
+}
+
+var errBinlogReplayStopped = fmt.Errorf("binlog replay reached the restore time")
+
+func (r *binlogReplay) apply(event *replication.BinlogEvent) error {
+	switch e := event.Event.(type) {
+	case *replication.FormatDescriptionEvent:
+		return r.exec("BINLOG '" + base64.StdEncoding.EncodeToString(event.RawData) + "'")
+	case *replication.MariadbGTIDEvent:
+		if e.IsStandalone() {
+			return nil
+		}
+		return r.begin(event)
+	case *replication.QueryEvent:
+		query := string(e.Query)
+		if query == "BEGIN" {
+			return r.begin(event)
+		}
+		if query == "COMMIT" {
+			r.inTransaction = false
+			return r.exec(query)
+		}
+		if !r.inTransaction && r.after(event) {
+			return errBinlogReplayStopped
+		}
+		if string(e.Schema) != r.database {
+			return nil
+		}
+		err := r.exec("USE `" + strings.ReplaceAll(r.database, "`", "``") + "`")
+		if err != nil {
+			return err
+		}
+		return r.exec(query)
+	case *replication.TableMapEvent:
+		if string(e.Schema) != r.database {
+			r.skippedTables[e.TableID] = true
+			return nil
+		}
+		delete(r.skippedTables, e.TableID)
+		r.tableMaps = append(r.tableMaps, event.RawData...)
+		return nil
+	case *replication.RowsEvent:
+		if r.skippedTables[e.TableID] {
+			return nil
+		}
+		data := append(append([]byte(nil), r.tableMaps...), event.RawData...)
+		// The table maps are kept until the end of the statement
+		if e.Flags&0x0001 != 0 {
+			r.tableMaps = nil
+		}
+		return r.exec("BINLOG '" + base64.StdEncoding.EncodeToString(data) + "'")
+	case *replication.XIDEvent:
+		r.inTransaction = false
+		return r.exec("COMMIT")
+	}
+	return nil
+}
+
+func (r *binlogReplay) begin(event *replication.BinlogEvent) error {
+	if r.after(event) {
+		return errBinlogReplayStopped
+	}
+	r.inTransaction = true
+	return r.exec("BEGIN")
+}
+
+func (r *binlogReplay) after(event *replication.BinlogEvent) bool {
+	if r.until.IsZero() || !time.Unix(int64(event.Header.Timestamp), 0).After(r.until) {
+		return false
+	}
+	r.stopped = true
+	return true
+}
+
+func (r *binlogReplay) exec(query string) error {
+	_, err := r.conn.ExecContext(context.Background(), query)
+	if err != nil {
+		return fmt.Errorf("failed to execute binlog statement => %s", err)
+	}
+	return nil
+}
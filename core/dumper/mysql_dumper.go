@@ -1,24 +1,35 @@
 package dumper
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"io/fs"
+	"io"
 	"log"
 	"os"
 	"path"
 	"strings"
-	"text/template"
+	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/herytz/backupman/core/lib"
 )
 
 type MysqlDumper struct {
 	Label     string
 	TmpFolder string
+	Host      string
+	Port      int
+	User      string
+	Password  string
+	Database  string
+	Tls       string
+	Options   SqlDumpOptions
+	Binlog    BinlogOptions
 	db        *sql.DB
+	// Binlog positions of the dumps, by dump path
+	positions map[string]string
+	mu        sync.Mutex
 }
 
 // Take from: https://github.com/JamesStewy/go-mysqldump
@@ -32,13 +43,21 @@ type table struct {
 type dump struct {
 	DumpVersion   string
 	ServerVersion string
-	Tables        []*table
 	CompleteTime  string
 }
 
+type mysqlQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+type mysqlTableJob struct {
+	Name string
+	Type string
+}
+
 const version = "0.1.0"
 
-const tmpl = `-- Backupmap SQL Dump {{ .DumpVersion }}
+const headerTmpl = `-- Backupmap SQL Dump {{ .DumpVersion }}
 --
 -- ------------------------------------------------------
 -- Server version	{{ .ServerVersion }}
@@ -49,7 +68,9 @@ SET foreign_key_checks = 0;
 SET sql_mode = 'NO_AUTO_VALUE_ON_ZERO';
 SET NAMES utf8mb4;
 
-{{range .Tables}}
+`
+
+const tableTmpl = `
 --
 -- Table structure for table {{ .Name }} 
 --
@@ -64,112 +85,243 @@ DROP TABLE IF EXISTS {{ .Name }};
 {{ if .Values }}
 INSERT INTO {{ .Name }} VALUES {{ .Values }};
 {{ end }}
-{{ end }}
+`
+
+const footerTmpl = `
 
 -- Dump completed on {{ .CompleteTime }}
 `
 
-func NewMysqlDumper(label, tmpFolder, host string, port int, user, password, database, tls string) *MysqlDumper {
+func NewMysqlDumper(label, tmpFolder, host string, port int, user, password, database, tls string, options SqlDumpOptions, binlog BinlogOptions) *MysqlDumper {
+	mysqlDumper, err := newMysqlDumper(label, tmpFolder, host, port, user, password, database, tls, options, binlog)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return mysqlDumper
+}
+
+// newMysqlDumper returns an error instead of exiting, for the dumpers created
+// while the application runs
+func newMysqlDumper(label, tmpFolder, host string, port int, user, password, database, tls string, options SqlDumpOptions, binlog BinlogOptions) (*MysqlDumper, error) {
+	if binlog.Enabled && binlog.ServerId == 0 {
+		return nil, fmt.Errorf("MysqlDumper (%s) requires a server id for incremental backups", label)
+	}
 	db, err := lib.NewConnection(host, port, user, password, database, tls)
 	if err != nil {
-		log.Fatalf("Failed to connect to MySQL: %v", err)
+		return nil, fmt.Errorf("failed to connect to MySQL => %s", err)
 	}
 	mysqlDumper := &MysqlDumper{
 		db:        db,
 		Label:     label,
 		TmpFolder: tmpFolder,
+		Host:      host,
+		Port:      port,
+		User:      user,
+		Password:  password,
+		Database:  database,
+		Tls:       tls,
+		Options:   options,
+		Binlog:    binlog,
+		positions: make(map[string]string),
 	}
-	mysqlDumper.setup()
-	return mysqlDumper
+	err = mysqlDumper.setup()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return mysqlDumper, nil
 }
 
-func (m *MysqlDumper) Dump() (string, error) {
-	filename := uuid.NewString() + ".sql"
-	filenamePath := path.Join(m.TmpFolder, filename)
+func (m *MysqlDumper) Dump(ctx context.Context) (string, error) {
+	return writeDumpFile(ctx, m.TmpFolder, sqlDumpExtension(m.Options.Format), m.DumpTo)
+}
 
-	_, err := os.Stat(filenamePath)
-	canCreateFile := false
-	if err != nil {
-		switch err.(type) {
-		case *fs.PathError:
-			canCreateFile = true
-		default:
-			return "", fmt.Errorf("failed to check if dump filename (%s) already exists or not: %s", filenamePath, err)
-		}
+func (m *MysqlDumper) NewDumpPath() string {
+	return newDumpPath(m.TmpFolder, sqlDumpExtension(m.Options.Format))
+}
+
+// DumpTo writes the SQL script or the table export of the database to w
+func (m *MysqlDumper) DumpTo(ctx context.Context, dumpPath string, w io.Writer) error {
+	if IsTableExport(m.Options.Format) {
+		return m.exportTables(ctx, dumpPath, w)
 	}
 
-	if !canCreateFile {
-		return "", fmt.Errorf("dump filename (%s) already exists", filenamePath)
+	data := dump{
+		DumpVersion: version,
 	}
 
-	file, err := os.Create(filenamePath)
+	var err error
+	data.ServerVersion, err = m.getServerVersion(ctx)
 	if err != nil {
-		return "", fmt.Errorf("cannot create dump filename (%s): %s", filenamePath, err)
+		return err
 	}
-	defer file.Close()
 
-	data := dump{
-		DumpVersion: version,
-		Tables:      make([]*table, 0),
+	jobs := make([]mysqlTableJob, 0)
+	for _, tableType := range []string{"BASE TABLE", "VIEW"} {
+		tables, err := m.getTables(ctx, tableType)
+		if err != nil {
+			return err
+		}
+		for _, name := range tables {
+			jobs = append(jobs, mysqlTableJob{Name: name, Type: tableType})
+		}
 	}
 
-	data.ServerVersion, err = m.getServerVersion()
+	header, table, footer, err := parseDumpTemplates("mysqldump", headerTmpl, tableTmpl, footerTmpl)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	tables, err := m.getTables("BASE TABLE")
+	parallelism := min(max(m.Options.Parallelism, 1), max(len(jobs), 1))
+	queriers, position, release, err := m.snapshotQueriers(ctx, parallelism)
 	if err != nil {
-		return "", err
+		return err
 	}
+	defer release()
 
-	for _, name := range tables {
-		t, err := m.createTable(name, "BASE TABLE")
+	err = header.Execute(w, data)
+	if err != nil {
+		return fmt.Errorf("failed to execute template: %s", err)
+	}
+
+	err = lib.WriteSegments(w, dumpPath, len(jobs), parallelism, func(worker, index int, w io.Writer) error {
+		t, err := m.createTable(ctx, queriers[worker], jobs[index].Name, jobs[index].Type)
 		if err != nil {
-			return "", err
+			return err
 		}
-		data.Tables = append(data.Tables, t)
+		err = table.Execute(w, t)
+		if err != nil {
+			return fmt.Errorf("failed to execute template: %s", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	views, err := m.getTables("VIEW")
+	data.CompleteTime = time.Now().String()
+	err = footer.Execute(w, data)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("failed to execute template: %s", err)
 	}
 
-	for _, name := range views {
-		t, err := m.createTable(name, "VIEW")
-		if err != nil {
-			return "", err
-		}
-		data.Tables = append(data.Tables, t)
+	if m.Binlog.Enabled {
+		m.mu.Lock()
+		m.positions[dumpPath] = position.String()
+		m.mu.Unlock()
 	}
 
-	data.CompleteTime = time.Now().String()
+	return nil
+}
 
-	tm, err := template.New("mysqldump").Parse(tmpl)
+// exportTables writes the rows of the base tables in the export format, the
+// views are not exported
+func (m *MysqlDumper) exportTables(ctx context.Context, dumpPath string, w io.Writer) error {
+	tables, err := m.getTables(ctx, "BASE TABLE")
 	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %s", err)
+		return err
 	}
-	err = tm.Execute(file, data)
+
+	parallelism := min(max(m.Options.Parallelism, 1), max(len(tables), 1))
+	queriers, _, release, err := m.snapshotQueriers(ctx, parallelism)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute template: %s", err)
+		return err
 	}
+	defer release()
 
-	return filenamePath, nil
+	return exportTables(w, dumpPath, m.Options.Format, tables, parallelism, func(worker int, table string) (tableRows, error) {
+		return m.queryTableRows(ctx, queriers[worker], table)
+	})
 }
 
-func (m *MysqlDumper) getServerVersion() (string, error) {
+// snapshotQueriers opens one connection per worker. With several workers,
+// the tables are locked while every connection starts a consistent snapshot
+// transaction, so all the workers see the same data. The lock requires the
+// RELOAD privilege; without it the dump is still done but each table may be
+// read at a slightly different time. With incremental backups, the binlog
+// position matching the snapshot is read while the tables are locked, so the
+// lock is required even for a single worker.
+func (m *MysqlDumper) snapshotQueriers(ctx context.Context, workers int) ([]mysqlQuerier, binlogPosition, func(), error) {
+	position := binlogPosition{}
+	if workers <= 1 && !m.Binlog.Enabled {
+		return []mysqlQuerier{m.db}, position, func() {}, nil
+	}
+
+	conns := make([]*sql.Conn, 0, workers)
+	release := func() {
+		for _, conn := range conns {
+			// The transactions are rolled back even when the dump is cancelled
+			conn.ExecContext(context.Background(), "ROLLBACK")
+			conn.Close()
+		}
+	}
+
+	lockConn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, position, release, fmt.Errorf("failed to open connection => %s", err)
+	}
+	defer lockConn.Close()
+
+	_, err = lockConn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK")
+	locked := err == nil
+	if !locked {
+		if m.Binlog.Enabled {
+			return nil, position, release, fmt.Errorf("cannot lock tables to read the binlog position => %s", err)
+		}
+		log.Printf("MysqlDumper (%s): cannot lock tables, the parallel dump may not be consistent between tables => %s", m.Label, err)
+	}
+
+	for i := 0; i < workers; i++ {
+		conn, err := m.db.Conn(ctx)
+		if err != nil {
+			release()
+			return nil, position, func() {}, fmt.Errorf("failed to open connection => %s", err)
+		}
+		conns = append(conns, conn)
+		for _, query := range []string{"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ", "START TRANSACTION WITH CONSISTENT SNAPSHOT"} {
+			_, err = conn.ExecContext(ctx, query)
+			if err != nil {
+				release()
+				return nil, position, func() {}, fmt.Errorf("failed to start snapshot transaction => %s", err)
+			}
+		}
+	}
+
+	if m.Binlog.Enabled {
+		position, err = m.binlogPosition(lockConn)
+		if err != nil {
+			release()
+			return nil, position, func() {}, err
+		}
+	}
+
+	if locked {
+		_, err = lockConn.ExecContext(ctx, "UNLOCK TABLES")
+		if err != nil {
+			release()
+			return nil, position, func() {}, fmt.Errorf("failed to unlock tables => %s", err)
+		}
+	}
+
+	queriers := make([]mysqlQuerier, len(conns))
+	for i, conn := range conns {
+		queriers[i] = conn
+	}
+	return queriers, position, release, nil
+}
+
+func (m *MysqlDumper) getServerVersion(ctx context.Context) (string, error) {
 	var serverVersion sql.NullString
-	err := m.db.QueryRow("SELECT version()").Scan(&serverVersion)
+	err := m.db.QueryRowContext(ctx, "SELECT version()").Scan(&serverVersion)
 	if err != nil {
 		return "", fmt.Errorf("failed to get server version %s", err)
 	}
 	return serverVersion.String, nil
 }
 
-func (m *MysqlDumper) getTables(tableType string) ([]string, error) {
+func (m *MysqlDumper) getTables(ctx context.Context, tableType string) ([]string, error) {
 	tables := make([]string, 0)
-	rows, err := m.db.Query("SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = ?", tableType)
+	rows, err := m.db.QueryContext(ctx, "SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = ?", tableType)
 	if err != nil {
 		return tables, fmt.Errorf("failed to show tables %s", err)
 	}
@@ -183,20 +335,23 @@ func (m *MysqlDumper) getTables(tableType string) ([]string, error) {
 		}
 		tables = append(tables, table.String)
 	}
-	return tables, rows.Err()
+	if err := rows.Err(); err != nil {
+		return tables, err
+	}
+	return m.Options.TableFilter.Apply(tables), nil
 }
 
-func (m *MysqlDumper) createTable(name, tableType string) (*table, error) {
+func (m *MysqlDumper) createTable(ctx context.Context, q mysqlQuerier, name, tableType string) (*table, error) {
 	var err error
 	t := &table{Name: name}
 
-	t.SQL, err = m.createTableSQL(name, tableType)
+	t.SQL, err = m.createTableSQL(ctx, q, name, tableType)
 	if err != nil {
 		return t, err
 	}
 
-	if tableType == "BASE TABLE" {
-		t.Values, err = m.createTableValues(name)
+	if tableType == "BASE TABLE" && !m.Options.TableFilter.IsSchemaOnly(name) {
+		t.Values, err = m.createTableValues(ctx, q, name)
 		if err != nil {
 			return t, err
 		}
@@ -205,12 +360,12 @@ func (m *MysqlDumper) createTable(name, tableType string) (*table, error) {
 	return t, nil
 }
 
-func (m *MysqlDumper) createTableSQL(name string, tableType string) (string, error) {
-	q := "SHOW CREATE TABLE " + name
+func (m *MysqlDumper) createTableSQL(ctx context.Context, q mysqlQuerier, name string, tableType string) (string, error) {
+	query := "SHOW CREATE TABLE " + name
 	if tableType == "VIEW" {
-		q = "SHOW CREATE VIEW " + name
+		query = "SHOW CREATE VIEW " + name
 	}
-	rows, err := m.db.Query(q)
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return "", fmt.Errorf("failed to show create table (%s) => %s", name, err)
 	}
@@ -244,40 +399,24 @@ func (m *MysqlDumper) createTableSQL(name string, tableType string) (string, err
 	return tableSql.String, nil
 }
 
-func (m *MysqlDumper) createTableValues(name string) (string, error) {
-	rows, err := m.db.Query("SELECT * FROM " + name)
+func (m *MysqlDumper) createTableValues(ctx context.Context, q mysqlQuerier, name string) (string, error) {
+	rows, err := m.queryTableRows(ctx, q, name)
 	if err != nil {
-		return "", fmt.Errorf("cannot get table %s values", name)
+		return "", err
 	}
 	defer rows.Close()
 
-	columns, err := rows.Columns()
-	if err != nil {
-		return "", fmt.Errorf("cannot get columns from table %s: %s", name, err)
-	}
-	if len(columns) == 0 {
-		return "", fmt.Errorf("table %s has no columns", name)
-	}
-
 	values := make([]string, 0)
 	for rows.Next() {
-		// data will store the values of each column
-		data := make([]*sql.NullString, len(columns))
-		// Scan need a pointer to work so we create ptrs to store data pointers
-		ptrs := make([]interface{}, len(columns))
-		for i := range data {
-			ptrs[i] = &data[i]
-		}
-
-		err := rows.Scan(ptrs...)
+		data, err := rows.Values()
 		if err != nil {
-			return "", fmt.Errorf("failed to scan row %s", err)
+			return "", err
 		}
 
-		dataStrings := make([]string, len(columns))
+		dataStrings := make([]string, len(data))
 		for i, value := range data {
-			if value != nil && value.Valid {
-				escaped := strings.ReplaceAll(value.String, "'", "''")
+			if value != nil {
+				escaped := strings.ReplaceAll(value.(string), "'", "''")
 				dataStrings[i] = "'" + escaped + "'"
 			} else {
 				dataStrings[i] = "NULL"
@@ -290,17 +429,170 @@ func (m *MysqlDumper) createTableValues(name string) (string, error) {
 	return strings.Join(values, ","), rows.Err()
 }
 
+// mysqlTableRows reads every value as a string, the text form MySQL uses
+// to insert it back
+type mysqlTableRows struct {
+	rows    *sql.Rows
+	columns []TableColumn
+	rules   []*MaskingRule
+	// data will store the values of each column
+	data []*sql.NullString
+	// Scan need a pointer to work so we create ptrs to store data pointers
+	ptrs []any
+}
+
+// queryTableRows reads the rows of a table selected by the table filter
+func (m *MysqlDumper) queryTableRows(ctx context.Context, q mysqlQuerier, name string) (*mysqlTableRows, error) {
+	query := "SELECT * FROM " + name
+	if m.Options.TableFilter.IsSchemaOnly(name) {
+		query += " LIMIT 0"
+	} else if where := m.Options.TableFilter.WhereClause(name); where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get table %s values: %s", name, err)
+	}
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("cannot get columns from table %s: %s", name, err)
+	}
+	if len(columnTypes) == 0 {
+		rows.Close()
+		return nil, fmt.Errorf("table %s has no columns", name)
+	}
+
+	names := make([]string, len(columnTypes))
+	for i, columnType := range columnTypes {
+		names[i] = columnType.Name()
+	}
+	rules := m.Options.Masking.ColumnRules(name, names)
+
+	columns := make([]TableColumn, len(columnTypes))
+	for i, columnType := range columnTypes {
+		columns[i] = TableColumn{
+			Name:         columnType.Name(),
+			DatabaseType: columnType.DatabaseTypeName(),
+			Type:         mysqlExportType(columnType.DatabaseTypeName()),
+		}
+		if rules != nil && rules[i] != nil {
+			columns[i].Type = EXPORT_TYPE_STRING
+		}
+	}
+
+	t := &mysqlTableRows{
+		rows:    rows,
+		columns: columns,
+		rules:   rules,
+		data:    make([]*sql.NullString, len(columns)),
+		ptrs:    make([]any, len(columns)),
+	}
+	for i := range t.data {
+		t.ptrs[i] = &t.data[i]
+	}
+	return t, nil
+}
+
+func mysqlExportType(databaseType string) string {
+	switch databaseType {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT",
+		"UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT":
+		return EXPORT_TYPE_INTEGER
+	case "FLOAT", "DOUBLE":
+		return EXPORT_TYPE_FLOAT
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "BIT", "GEOMETRY":
+		return EXPORT_TYPE_BYTES
+	default:
+		// DECIMAL and UNSIGNED BIGINT do not fit a float64 or an int64
+		return EXPORT_TYPE_STRING
+	}
+}
+
+func (t *mysqlTableRows) Columns() []TableColumn {
+	return t.columns
+}
+
+func (t *mysqlTableRows) Next() bool {
+	return t.rows.Next()
+}
+
+func (t *mysqlTableRows) Values() ([]any, error) {
+	err := t.rows.Scan(t.ptrs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan row %s", err)
+	}
+
+	values := make([]any, len(t.data))
+	for i, value := range t.data {
+		var v *string
+		if value != nil && value.Valid {
+			v = &value.String
+		}
+		if t.rules != nil && t.rules[i] != nil {
+			v = t.rules[i].Apply(v)
+		}
+		if v != nil {
+			values[i] = *v
+		}
+	}
+	return values, nil
+}
+
+func (t *mysqlTableRows) Err() error {
+	return t.rows.Err()
+}
+
+func (t *mysqlTableRows) Close() {
+	t.rows.Close()
+}
+
+// Restore executes a dump on the database of the dumper
+func (m *MysqlDumper) Restore(dumpPath string) error {
+	if path.Ext(dumpPath) == ".tar" {
+		return fmt.Errorf("table exports cannot be restored (%s)", dumpPath)
+	}
+	file, err := os.Open(dumpPath)
+	if err != nil {
+		return fmt.Errorf("cannot open dump (%s): %s", dumpPath, err)
+	}
+	defer file.Close()
+
+	// Session settings of the dump header apply to the following statements
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open connection => %s", err)
+	}
+	defer conn.Close()
+
+	return splitSqlStatements(file, func(statement string) error {
+		_, err := conn.ExecContext(ctx, statement)
+		if err != nil {
+			return fmt.Errorf("failed to restore dump (%s) => %s", dumpPath, err)
+		}
+		return nil
+	})
+}
+
 func (m *MysqlDumper) Health() error {
 	return lib.NewHealthMysql(m.db).Check()
 }
 
+// Close releases the connections of the dumper
+func (m *MysqlDumper) Close() error {
+	return m.db.Close()
+}
+
 func (m *MysqlDumper) GetLabel() string {
 	return m.Label
 }
 
-func (m *MysqlDumper) setup() {
+func (m *MysqlDumper) setup() error {
 	err := os.MkdirAll(m.TmpFolder, 0755)
 	if err != nil {
-		log.Fatalf("failed to setup MysqlDumper (%s) tmpFolder (%s). %s", m.Label, m.TmpFolder, err)
+		return fmt.Errorf("failed to setup MysqlDumper (%s) tmpFolder (%s) => %s", m.Label, m.TmpFolder, err)
 	}
+	return nil
 }
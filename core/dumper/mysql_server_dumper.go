@@ -0,0 +1,120 @@
+package dumper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/herytz/backupman/core/lib"
+)
+
+var mysqlSystemDatabases = []string{"information_schema", "performance_schema", "mysql", "sys"}
+
+// MysqlServerDumper backs up every database of a MySQL server matching one of
+// the Databases patterns, each database in its own backup.
+type MysqlServerDumper struct {
+	Label     string
+	TmpFolder string
+	Host      string
+	Port      int
+	User      string
+	Password  string
+	Tls       string
+	Databases []string
+	Options   SqlDumpOptions
+	db        *sql.DB
+}
+
+func NewMysqlServerDumper(label, tmpFolder, host string, port int, user, password, tls string, databases []string, options SqlDumpOptions) *MysqlServerDumper {
+	db, err := lib.NewConnection(host, port, user, password, "", tls)
+	if err != nil {
+		log.Fatalf("Failed to connect to MySQL: %v", err)
+	}
+	return &MysqlServerDumper{
+		Label:     label,
+		TmpFolder: tmpFolder,
+		Host:      host,
+		Port:      port,
+		User:      user,
+		Password:  password,
+		Tls:       tls,
+		Databases: databases,
+		Options:   options,
+		db:        db,
+	}
+}
+
+func (m *MysqlServerDumper) Discover() ([]Dumper, error) {
+	rows, err := m.db.Query("SHOW DATABASES")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %s", err)
+	}
+	defer rows.Close()
+
+	databases := make([]string, 0)
+	for rows.Next() {
+		var database string
+		err := rows.Scan(&database)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row %s", err)
+		}
+		databases = append(databases, database)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	dumpers := make([]Dumper, 0)
+	for _, database := range filterDatabases(databases, m.Databases, mysqlSystemDatabases) {
+		d, err := newMysqlDumper(
+			DatabaseLabel(m.Label, database),
+			m.TmpFolder,
+			m.Host,
+			m.Port,
+			m.User,
+			m.Password,
+			database,
+			m.Tls,
+			m.Options,
+			BinlogOptions{},
+		)
+		if err != nil {
+			closeDumpers(dumpers)
+			return nil, fmt.Errorf("failed to create dumper of database (%s) => %s", database, err)
+		}
+		dumpers = append(dumpers, d)
+	}
+	return dumpers, nil
+}
+
+func (m *MysqlServerDumper) RestorerFor(database string) (Restorer, error) {
+	restorer, err := newMysqlDumper(
+		DatabaseLabel(m.Label, database),
+		m.TmpFolder,
+		m.Host,
+		m.Port,
+		m.User,
+		m.Password,
+		database,
+		m.Tls,
+		m.Options,
+		BinlogOptions{},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return restorer, nil
+}
+
+func (m *MysqlServerDumper) Dump(ctx context.Context) (string, error) {
+	return "", DiscoveredDumperError(m.Label)
+}
+
+func (m *MysqlServerDumper) Health() error {
+	return lib.NewHealthMysql(m.db).Check()
+}
+
+func (m *MysqlServerDumper) GetLabel() string {
+	return m.Label
+}
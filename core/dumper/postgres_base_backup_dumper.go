@@ -0,0 +1,318 @@
+package dumper
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/herytz/backupman/core/lib"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Folder of the restored data directory receiving the archived WAL segments
+const PostgresRestoreWalFolder = "backupman_wal"
+
+var backupLabelStartWal = regexp.MustCompile(`START WAL LOCATION: \S+ \(file ([0-9A-F]{24})\)`)
+
+// PostgresBaseBackupDumper takes physical base backups of a PostgreSQL
+// cluster with pg_basebackup. The WAL segments are not part of the base
+// backup: the server archives them through `backupman wal-archive`, which
+// allows restoring the cluster at any point in time after the base backup.
+type PostgresBaseBackupDumper struct {
+	Label     string
+	TmpFolder string
+	Host      string
+	Port      int
+	User      string
+	Password  string
+	Tls       bool
+	// Path of the pg_basebackup executable
+	PgBasebackup string
+	db           *pgxpool.Pool
+	// Start WAL segments of the base backups, by dump path
+	positions map[string]string
+	mu        sync.Mutex
+}
+
+func NewPostgresBaseBackupDumper(label, tmpFolder, host string, port int, user, password string, tls bool, pgBasebackup string) *PostgresBaseBackupDumper {
+	db, err := lib.NewPostgresConnection(host, port, user, password, "postgres", tls)
+	if err != nil {
+		log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+	}
+	if pgBasebackup == "" {
+		pgBasebackup = "pg_basebackup"
+	}
+	baseBackupDumper := &PostgresBaseBackupDumper{
+		Label:        label,
+		TmpFolder:    tmpFolder,
+		Host:         host,
+		Port:         port,
+		User:         user,
+		Password:     password,
+		Tls:          tls,
+		PgBasebackup: pgBasebackup,
+		db:           db,
+		positions:    make(map[string]string),
+	}
+	baseBackupDumper.setup()
+	return baseBackupDumper
+}
+
+// Dump writes the base backup as a tar of the data directory. pg_basebackup
+// waits for the WAL segments needed by the base backup to be archived.
+func (p *PostgresBaseBackupDumper) Dump(ctx context.Context) (string, error) {
+	file, filenamePath, err := createDumpFile(p.TmpFolder, ".tar")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	sslMode := "disable"
+	if p.Tls {
+		sslMode = "require"
+	}
+	stderr := lib.NewTailBuffer(execStderrLimit)
+	cmd := exec.CommandContext(ctx, p.PgBasebackup,
+		"--pgdata=-",
+		"--format=tar",
+		"--wal-method=none",
+		"--no-password",
+		"--host="+p.Host,
+		"--port="+strconv.Itoa(p.Port),
+		"--username="+p.User,
+	)
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+p.Password, "PGSSLMODE="+sslMode)
+	cmd.Stdout = file
+	cmd.Stderr = stderr
+	err = cmd.Run()
+	if err != nil {
+		file.Close()
+		os.Remove(filenamePath)
+		return "", fmt.Errorf("command (%s) failed => %s: %s", p.PgBasebackup, err, stderr.String())
+	}
+
+	err = file.Sync()
+	if err != nil {
+		file.Close()
+		os.Remove(filenamePath)
+		return "", fmt.Errorf("failed to sync file to disk: %s", err)
+	}
+
+	segment, err := readBaseBackupStartSegment(filenamePath)
+	if err != nil {
+		os.Remove(filenamePath)
+		return "", err
+	}
+	p.mu.Lock()
+	p.positions[filenamePath] = segment
+	p.mu.Unlock()
+
+	return filenamePath, nil
+}
+
+// readBaseBackupStartSegment reads the first WAL segment needed by a base
+// backup from its backup_label file.
+func readBaseBackupStartSegment(dumpPath string) (string, error) {
+	file, err := os.Open(dumpPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot open base backup (%s): %s", dumpPath, err)
+	}
+	defer file.Close()
+
+	archive := tar.NewReader(file)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return "", fmt.Errorf("backup_label not found in base backup (%s)", dumpPath)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read base backup (%s): %s", dumpPath, err)
+		}
+		if strings.TrimPrefix(header.Name, "./") != "backup_label" {
+			continue
+		}
+		content, err := io.ReadAll(archive)
+		if err != nil {
+			return "", fmt.Errorf("failed to read backup_label: %s", err)
+		}
+		match := backupLabelStartWal.FindSubmatch(content)
+		if match == nil {
+			return "", fmt.Errorf("start WAL location not found in backup_label")
+		}
+		return string(match[1]), nil
+	}
+}
+
+func (p *PostgresBaseBackupDumper) DumpPosition(dumpPath string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	position, ok := p.positions[dumpPath]
+	delete(p.positions, dumpPath)
+	return position, ok
+}
+
+// RestoreBaseBackup prepares a data directory in archive recovery: the server
+// started on it copies the WAL segments from the PostgresRestoreWalFolder
+// folder and replays them up to the recovery target, then it is promoted.
+func (p *PostgresBaseBackupDumper) RestoreBaseBackup(dumpPath string, segments map[string]string, targetDir string, until time.Time) error {
+	entries, err := os.ReadDir(targetDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("cannot read target directory (%s): %s", targetDir, err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("target directory (%s) is not empty", targetDir)
+	}
+	targetDir, err = filepath.Abs(targetDir)
+	if err != nil {
+		return fmt.Errorf("cannot resolve target directory (%s): %s", targetDir, err)
+	}
+	// PostgreSQL refuses data directories readable by other users
+	err = os.MkdirAll(targetDir, 0700)
+	if err != nil {
+		return fmt.Errorf("cannot create target directory (%s): %s", targetDir, err)
+	}
+
+	err = extractTar(dumpPath, targetDir)
+	if err != nil {
+		return err
+	}
+
+	walFolder := filepath.Join(targetDir, PostgresRestoreWalFolder)
+	err = os.MkdirAll(walFolder, 0700)
+	if err != nil {
+		return fmt.Errorf("cannot create WAL folder (%s): %s", walFolder, err)
+	}
+	for name, segmentPath := range segments {
+		err = copyFile(segmentPath, filepath.Join(walFolder, name), 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	settings := fmt.Sprintf("\n# Added by backupman restore\nrestore_command = 'cp \"%s/%%f\" \"%%p\"'\nrecovery_target_action = 'promote'\n", walFolder)
+	if !until.IsZero() {
+		settings += fmt.Sprintf("recovery_target_time = '%s'\n", until.UTC().Format("2006-01-02 15:04:05.999999Z07:00"))
+	}
+	autoConf, err := os.OpenFile(filepath.Join(targetDir, "postgresql.auto.conf"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot open postgresql.auto.conf: %s", err)
+	}
+	defer autoConf.Close()
+	_, err = autoConf.WriteString(settings)
+	if err != nil {
+		return fmt.Errorf("failed to write recovery settings: %s", err)
+	}
+
+	err = os.WriteFile(filepath.Join(targetDir, "recovery.signal"), nil, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create recovery.signal: %s", err)
+	}
+	return nil
+}
+
+// extractTar extracts the directories, files and links of an archive, the
+// entries pointing outside of the target directory are refused.
+func extractTar(archivePath, targetDir string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("cannot open archive (%s): %s", archivePath, err)
+	}
+	defer file.Close()
+
+	archive := tar.NewReader(file)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive (%s): %s", archivePath, err)
+		}
+
+		name := filepath.Clean(header.Name)
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(os.PathSeparator)) {
+			return fmt.Errorf("archive entry (%s) is outside of the target directory", header.Name)
+		}
+		target := filepath.Join(targetDir, name)
+
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, mode|0700)
+		case tar.TypeReg:
+			err = os.MkdirAll(filepath.Dir(target), 0700)
+			if err == nil {
+				err = writeFile(target, archive, mode)
+			}
+		case tar.TypeSymlink:
+			err = os.Symlink(header.Linkname, target)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to extract archive entry (%s): %s", header.Name, err)
+		}
+	}
+}
+
+func writeFile(path string, content io.Reader, mode os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, content)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func copyFile(srcPath, dstPath string, mode os.FileMode) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("cannot open file (%s): %s", srcPath, err)
+	}
+	defer src.Close()
+	err = writeFile(dstPath, src, mode)
+	if err != nil {
+		return fmt.Errorf("failed to copy file (%s): %s", srcPath, err)
+	}
+	return nil
+}
+
+func (p *PostgresBaseBackupDumper) Health() error {
+	_, err := exec.LookPath(p.PgBasebackup)
+	if err != nil {
+		return fmt.Errorf("dump command (%s) not found => %s", p.PgBasebackup, err)
+	}
+	return lib.NewHealthPostgres(p.db).Check()
+}
+
+// Close releases the connections of the dumper
+func (p *PostgresBaseBackupDumper) Close() error {
+	p.db.Close()
+	return nil
+}
+
+func (p *PostgresBaseBackupDumper) GetLabel() string {
+	return p.Label
+}
+
+func (p *PostgresBaseBackupDumper) setup() {
+	err := os.MkdirAll(p.TmpFolder, 0755)
+	if err != nil {
+		log.Fatalf("failed to setup PostgresBaseBackupDumper (%s) tmpFolder (%s). %s", p.Label, p.TmpFolder, err)
+	}
+}
@@ -3,17 +3,15 @@ package dumper
 import (
 	"context"
 	"fmt"
-	"io/fs"
+	"io"
 	"log"
 	"os"
-	"path"
 	"strconv"
 	"strings"
-	"text/template"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/herytz/backupman/core/lib"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -21,6 +19,7 @@ import (
 type PostgresDumper struct {
 	Label     string
 	TmpFolder string
+	Options   SqlDumpOptions
 	db        *pgxpool.Pool
 }
 
@@ -33,14 +32,17 @@ type postgresTable struct {
 type postgresDump struct {
 	DumpVersion   string
 	ServerVersion string
-	Tables        []*postgresTable
 	ForeignKeys   []string
 	CompleteTime  string
 }
 
+type postgresQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
 const postgresVersion = "0.1.0"
 
-const postgresTmpl = `-- Backupmap PostgreSQL Dump {{ .DumpVersion }}
+const postgresHeaderTmpl = `-- Backupmap PostgreSQL Dump {{ .DumpVersion }}
 --
 -- ------------------------------------------------------
 -- Server version	{{ .ServerVersion }}
@@ -55,7 +57,9 @@ SET client_min_messages = warning;
 -- Disable foreign key checks
 SET session_replication_role = 'replica';
 
-{{range .Tables}}
+`
+
+const postgresTableTmpl = `
 --
 -- Table structure for table "{{ .Name }}"
 --
@@ -70,7 +74,9 @@ DROP TABLE IF EXISTS "{{ .Name }}" CASCADE;
 {{ if .Values }}
 {{ .Values }}
 {{ end }}
-{{ end }}
+`
+
+const postgresFooterTmpl = `
 
 {{ if .ForeignKeys }}
 --
@@ -88,97 +94,189 @@ SET session_replication_role = 'origin';
 -- Dump completed on {{ .CompleteTime }}
 `
 
-func NewPostgresDumper(label, tmpFolder, host string, port int, user, password, database string, tls bool) *PostgresDumper {
+func NewPostgresDumper(label, tmpFolder, host string, port int, user, password, database string, tls bool, options SqlDumpOptions) *PostgresDumper {
+	postgresDumper, err := newPostgresDumper(label, tmpFolder, host, port, user, password, database, tls, options)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return postgresDumper
+}
+
+// newPostgresDumper returns an error instead of exiting, for the dumpers
+// created while the application runs
+func newPostgresDumper(label, tmpFolder, host string, port int, user, password, database string, tls bool, options SqlDumpOptions) (*PostgresDumper, error) {
 	db, err := lib.NewPostgresConnection(host, port, user, password, database, tls)
 	if err != nil {
-		log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+		return nil, fmt.Errorf("failed to connect to PostgreSQL => %s", err)
 	}
 	postgresDumper := &PostgresDumper{
 		db:        db,
 		Label:     label,
 		TmpFolder: tmpFolder,
+		Options:   options,
 	}
-	postgresDumper.setup()
-	return postgresDumper
+	err = postgresDumper.setup()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return postgresDumper, nil
 }
 
-func (p *PostgresDumper) Dump() (string, error) {
-	filename := uuid.NewString() + ".sql"
-	filenamePath := path.Join(p.TmpFolder, filename)
+func (p *PostgresDumper) Dump(ctx context.Context) (string, error) {
+	return writeDumpFile(ctx, p.TmpFolder, sqlDumpExtension(p.Options.Format), p.DumpTo)
+}
 
-	_, err := os.Stat(filenamePath)
-	canCreateFile := false
-	if err != nil {
-		switch err.(type) {
-		case *fs.PathError:
-			canCreateFile = true
-		default:
-			return "", fmt.Errorf("failed to check if dump filename (%s) already exists or not: %s", filenamePath, err)
-		}
+func (p *PostgresDumper) NewDumpPath() string {
+	return newDumpPath(p.TmpFolder, sqlDumpExtension(p.Options.Format))
+}
+
+// DumpTo writes the SQL script or the table export of the database to w
+func (p *PostgresDumper) DumpTo(ctx context.Context, dumpPath string, w io.Writer) error {
+	if IsTableExport(p.Options.Format) {
+		return p.exportTables(ctx, dumpPath, w)
 	}
 
-	if !canCreateFile {
-		return "", fmt.Errorf("dump filename (%s) already exists", filenamePath)
+	data := postgresDump{
+		DumpVersion: postgresVersion,
 	}
 
-	file, err := os.Create(filenamePath)
+	var err error
+	data.ServerVersion, err = p.getServerVersion(ctx)
 	if err != nil {
-		return "", fmt.Errorf("cannot create dump filename (%s): %s", filenamePath, err)
+		return err
 	}
-	defer file.Close()
 
-	data := postgresDump{
-		DumpVersion: postgresVersion,
-		Tables:      make([]*postgresTable, 0),
+	tables, err := p.getTables(ctx)
+	if err != nil {
+		return err
 	}
 
-	data.ServerVersion, err = p.getServerVersion()
+	header, table, footer, err := parseDumpTemplates("postgresdump", postgresHeaderTmpl, postgresTableTmpl, postgresFooterTmpl)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	tables, err := p.getTables()
+	// The snapshot exporting transaction holds a connection of the pool
+	parallelism := min(max(p.Options.Parallelism, 1), max(len(tables), 1), max(int(p.db.Config().MaxConns)-1, 1))
+	queriers, release, err := p.snapshotQueriers(ctx, parallelism)
 	if err != nil {
-		return "", err
+		return err
 	}
+	defer release()
 
-	for _, name := range tables {
-		t, err := p.createTable(name)
+	err = header.Execute(w, data)
+	if err != nil {
+		return fmt.Errorf("failed to execute template: %s", err)
+	}
+
+	err = lib.WriteSegments(w, dumpPath, len(tables), parallelism, func(worker, index int, w io.Writer) error {
+		t, err := p.createTable(ctx, queriers[worker], tables[index])
 		if err != nil {
-			return "", err
+			return err
 		}
-		data.Tables = append(data.Tables, t)
+		err = table.Execute(w, t)
+		if err != nil {
+			return fmt.Errorf("failed to execute template: %s", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	data.ForeignKeys, err = p.getForeignKeys()
+	data.ForeignKeys, err = p.getForeignKeys(ctx, tables)
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	data.CompleteTime = time.Now().String()
+	err = footer.Execute(w, data)
+	if err != nil {
+		return fmt.Errorf("failed to execute template: %s", err)
+	}
 
-	tm, err := template.New("postgresdump").Parse(postgresTmpl)
+	return nil
+}
+
+// exportTables writes the rows of the tables in the export format
+func (p *PostgresDumper) exportTables(ctx context.Context, dumpPath string, w io.Writer) error {
+	tables, err := p.getTables(ctx)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %s", err)
+		return err
 	}
-	err = tm.Execute(file, data)
+
+	parallelism := min(max(p.Options.Parallelism, 1), max(len(tables), 1), max(int(p.db.Config().MaxConns)-1, 1))
+	queriers, release, err := p.snapshotQueriers(ctx, parallelism)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute template: %s", err)
+		return err
 	}
+	defer release()
 
-	return filenamePath, nil
+	return exportTables(w, dumpPath, p.Options.Format, tables, parallelism, func(worker int, table string) (tableRows, error) {
+		return p.queryTableRows(ctx, queriers[worker], table)
+	})
 }
 
-func (p *PostgresDumper) getServerVersion() (string, error) {
+// snapshotQueriers opens one transaction per worker. With several workers,
+// a coordinator transaction exports its snapshot and every worker imports it,
+// so all the workers see the same data.
+func (p *PostgresDumper) snapshotQueriers(ctx context.Context, workers int) ([]postgresQuerier, func(), error) {
+	if workers <= 1 {
+		return []postgresQuerier{p.db}, func() {}, nil
+	}
+
+	txOptions := pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+	txs := make([]pgx.Tx, 0, workers+1)
+	release := func() {
+		for _, tx := range txs {
+			// The transactions are rolled back even when the dump is cancelled
+			tx.Rollback(context.Background())
+		}
+	}
+
+	coordinator, err := p.db.BeginTx(ctx, txOptions)
+	if err != nil {
+		return nil, func() {}, fmt.Errorf("failed to start snapshot transaction => %s", err)
+	}
+	txs = append(txs, coordinator)
+
+	var snapshot string
+	err = coordinator.QueryRow(ctx, "SELECT pg_export_snapshot()").Scan(&snapshot)
+	if err != nil {
+		release()
+		return nil, func() {}, fmt.Errorf("failed to export snapshot => %s", err)
+	}
+
+	queriers := make([]postgresQuerier, workers)
+	for i := 0; i < workers; i++ {
+		tx, err := p.db.BeginTx(ctx, txOptions)
+		if err != nil {
+			release()
+			return nil, func() {}, fmt.Errorf("failed to start snapshot transaction => %s", err)
+		}
+		txs = append(txs, tx)
+		_, err = tx.Exec(ctx, fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s'", snapshot))
+		if err != nil {
+			release()
+			return nil, func() {}, fmt.Errorf("failed to import snapshot (%s) => %s", snapshot, err)
+		}
+		queriers[i] = tx
+	}
+
+	return queriers, release, nil
+}
+
+func (p *PostgresDumper) getServerVersion(ctx context.Context) (string, error) {
 	var serverVersion string
-	err := p.db.QueryRow(context.Background(), "SELECT version()").Scan(&serverVersion)
+	err := p.db.QueryRow(ctx, "SELECT version()").Scan(&serverVersion)
 	if err != nil {
 		return "", fmt.Errorf("failed to get server version %s", err)
 	}
 	return serverVersion, nil
 }
 
-func (p *PostgresDumper) getTables() ([]string, error) {
+func (p *PostgresDumper) getTables(ctx context.Context) ([]string, error) {
 	tables := make([]string, 0)
 	query := `
 		SELECT table_name
@@ -187,7 +285,7 @@ func (p *PostgresDumper) getTables() ([]string, error) {
 		AND table_type = 'BASE TABLE'
 		ORDER BY table_name
 	`
-	rows, err := p.db.Query(context.Background(), query)
+	rows, err := p.db.Query(ctx, query)
 	if err != nil {
 		return tables, fmt.Errorf("failed to get tables: %s", err)
 	}
@@ -201,19 +299,26 @@ func (p *PostgresDumper) getTables() ([]string, error) {
 		}
 		tables = append(tables, tableName)
 	}
-	return tables, rows.Err()
+	if err := rows.Err(); err != nil {
+		return tables, err
+	}
+	return p.Options.TableFilter.Apply(tables), nil
 }
 
-func (p *PostgresDumper) createTable(name string) (*postgresTable, error) {
+func (p *PostgresDumper) createTable(ctx context.Context, q postgresQuerier, name string) (*postgresTable, error) {
 	var err error
 	t := &postgresTable{Name: name}
 
-	t.SQL, err = p.createTableSQL(name)
+	t.SQL, err = p.createTableSQL(ctx, q, name)
 	if err != nil {
 		return t, err
 	}
 
-	t.Values, err = p.createTableValues(name)
+	if p.Options.TableFilter.IsSchemaOnly(name) {
+		return t, nil
+	}
+
+	t.Values, err = p.createTableValues(ctx, q, name)
 	if err != nil {
 		return t, err
 	}
@@ -221,7 +326,7 @@ func (p *PostgresDumper) createTable(name string) (*postgresTable, error) {
 	return t, nil
 }
 
-func (p *PostgresDumper) createTableSQL(name string) (string, error) {
+func (p *PostgresDumper) createTableSQL(ctx context.Context, q postgresQuerier, name string) (string, error) {
 	// Get column definitions
 	columnsQuery := `
 		SELECT
@@ -234,7 +339,7 @@ func (p *PostgresDumper) createTableSQL(name string) (string, error) {
 		WHERE table_schema = 'public' AND table_name = $1
 		ORDER BY ordinal_position
 	`
-	rows, err := p.db.Query(context.Background(), columnsQuery, name)
+	rows, err := q.Query(ctx, columnsQuery, name)
 	if err != nil {
 		return "", fmt.Errorf("failed to get columns for table %s: %s", name, err)
 	}
@@ -278,7 +383,7 @@ func (p *PostgresDumper) createTableSQL(name string) (string, error) {
 		WHERE n.nspname = 'public' AND c.relname = $1 AND i.indisprimary
 		ORDER BY a.attnum
 	`
-	pkRows, err := p.db.Query(context.Background(), pkQuery, name)
+	pkRows, err := q.Query(ctx, pkQuery, name)
 	if err != nil {
 		return "", fmt.Errorf("failed to get primary key for table %s: %s", name, err)
 	}
@@ -313,7 +418,7 @@ func (p *PostgresDumper) createTableSQL(name string) (string, error) {
 		AND NOT i.indisprimary
 		GROUP BY ic.relname
 	`
-	uniqueRows, err := p.db.Query(context.Background(), uniqueQuery, name)
+	uniqueRows, err := q.Query(ctx, uniqueQuery, name)
 	if err != nil {
 		return "", fmt.Errorf("failed to get unique constraints for table %s: %s", name, err)
 	}
@@ -342,7 +447,7 @@ func (p *PostgresDumper) createTableSQL(name string) (string, error) {
 		AND nsp.nspname = 'public'
 		AND rel.relname = $1
 	`
-	checkRows, err := p.db.Query(context.Background(), checkQuery, name)
+	checkRows, err := q.Query(ctx, checkQuery, name)
 	if err != nil {
 		return "", fmt.Errorf("failed to get check constraints for table %s: %s", name, err)
 	}
@@ -361,7 +466,14 @@ func (p *PostgresDumper) createTableSQL(name string) (string, error) {
 	return createSQL, nil
 }
 
-func (p *PostgresDumper) getForeignKeys() ([]string, error) {
+// Only the foreign keys between dumped tables are kept, otherwise restoring
+// a filtered dump would fail on the missing referenced tables.
+func (p *PostgresDumper) getForeignKeys(ctx context.Context, tables []string) ([]string, error) {
+	dumped := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		dumped[table] = true
+	}
+
 	fkQuery := `
 		SELECT
 			cl.relname AS table_name,
@@ -384,7 +496,7 @@ func (p *PostgresDumper) getForeignKeys() ([]string, error) {
 		GROUP BY cl.relname, con.conname, cl2.relname, con.confupdtype, con.confdeltype
 		ORDER BY cl.relname, con.conname
 	`
-	rows, err := p.db.Query(context.Background(), fkQuery)
+	rows, err := p.db.Query(ctx, fkQuery)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get foreign keys: %s", err)
 	}
@@ -398,6 +510,9 @@ func (p *PostgresDumper) getForeignKeys() ([]string, error) {
 		if err := rows.Scan(&tableName, &conName, &columns, &refTable, &refColumns, &updateAction, &deleteAction); err != nil {
 			return nil, fmt.Errorf("failed to scan foreign key: %s", err)
 		}
+		if !dumped[tableName] || !dumped[refTable] {
+			continue
+		}
 		quotedCols := make([]string, len(columns))
 		for i, col := range columns {
 			quotedCols[i] = fmt.Sprintf("\"%s\"", col)
@@ -457,17 +572,13 @@ func (p *PostgresDumper) mapDataType(dataType string, charMaxLength *int) string
 	}
 }
 
-func (p *PostgresDumper) createTableValues(name string) (string, error) {
-	query := fmt.Sprintf("SELECT * FROM \"%s\"", name)
-	rows, err := p.db.Query(context.Background(), query)
+func (p *PostgresDumper) createTableValues(ctx context.Context, q postgresQuerier, name string) (string, error) {
+	rows, err := p.queryTableRows(ctx, q, name)
 	if err != nil {
-		return "", fmt.Errorf("cannot get table %s values: %s", name, err)
+		return "", err
 	}
 	defer rows.Close()
-
-	// Get column names and count
-	fieldDescriptions := rows.FieldDescriptions()
-	if len(fieldDescriptions) == 0 {
+	if len(rows.Columns()) == 0 {
 		return "", nil
 	}
 
@@ -475,7 +586,7 @@ func (p *PostgresDumper) createTableValues(name string) (string, error) {
 	for rows.Next() {
 		values, err := rows.Values()
 		if err != nil {
-			return "", fmt.Errorf("failed to scan row: %s", err)
+			return "", err
 		}
 
 		dataStrings := make([]string, len(values))
@@ -519,17 +630,137 @@ func (p *PostgresDumper) createTableValues(name string) (string, error) {
 	return strings.Join(insertStatements, "\n"), nil
 }
 
+// postgresTableRows reads the values decoded by pgx
+type postgresTableRows struct {
+	rows    pgx.Rows
+	columns []TableColumn
+	rules   []*MaskingRule
+}
+
+// queryTableRows reads the rows of a table selected by the table filter
+func (p *PostgresDumper) queryTableRows(ctx context.Context, q postgresQuerier, name string) (*postgresTableRows, error) {
+	query := fmt.Sprintf("SELECT * FROM \"%s\"", name)
+	if p.Options.TableFilter.IsSchemaOnly(name) {
+		query += " LIMIT 0"
+	} else if where := p.Options.TableFilter.WhereClause(name); where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := q.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get table %s values: %s", name, err)
+	}
+
+	fieldDescriptions := rows.FieldDescriptions()
+	names := make([]string, len(fieldDescriptions))
+	for i, fd := range fieldDescriptions {
+		names[i] = fd.Name
+	}
+	rules := p.Options.Masking.ColumnRules(name, names)
+
+	columns := make([]TableColumn, len(fieldDescriptions))
+	for i, fd := range fieldDescriptions {
+		databaseType := "unknown"
+		if dataType, ok := rows.Conn().TypeMap().TypeForOID(fd.DataTypeOID); ok {
+			databaseType = dataType.Name
+		}
+		columns[i] = TableColumn{
+			Name:         fd.Name,
+			DatabaseType: databaseType,
+			Type:         postgresExportType(databaseType),
+		}
+		if rules != nil && rules[i] != nil {
+			columns[i].Type = EXPORT_TYPE_STRING
+		}
+	}
+
+	return &postgresTableRows{rows: rows, columns: columns, rules: rules}, nil
+}
+
+func postgresExportType(databaseType string) string {
+	switch databaseType {
+	case "int2", "int4", "int8":
+		return EXPORT_TYPE_INTEGER
+	case "float4", "float8":
+		return EXPORT_TYPE_FLOAT
+	case "bool":
+		return EXPORT_TYPE_BOOLEAN
+	case "bytea":
+		return EXPORT_TYPE_BYTES
+	default:
+		return EXPORT_TYPE_STRING
+	}
+}
+
+func (t *postgresTableRows) Columns() []TableColumn {
+	return t.columns
+}
+
+func (t *postgresTableRows) Next() bool {
+	return t.rows.Next()
+}
+
+// Masked values are always strings, PostgreSQL casts them to the column
+// type on restore.
+func (t *postgresTableRows) Values() ([]any, error) {
+	values, err := t.rows.Values()
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan row: %s", err)
+	}
+	for i, value := range values {
+		if t.rules == nil || t.rules[i] == nil {
+			continue
+		}
+		var v *string
+		if value != nil {
+			var s string
+			switch typed := value.(type) {
+			case string:
+				s = typed
+			case []byte:
+				s = string(typed)
+			case time.Time:
+				s = typed.Format("2006-01-02 15:04:05")
+			default:
+				s = fmt.Sprintf("%v", typed)
+			}
+			v = &s
+		}
+		masked := t.rules[i].Apply(v)
+		if masked == nil {
+			values[i] = nil
+		} else {
+			values[i] = *masked
+		}
+	}
+	return values, nil
+}
+
+func (t *postgresTableRows) Err() error {
+	return t.rows.Err()
+}
+
+func (t *postgresTableRows) Close() {
+	t.rows.Close()
+}
+
 func (p *PostgresDumper) Health() error {
 	return lib.NewHealthPostgres(p.db).Check()
 }
 
+// Close releases the connections of the dumper
+func (p *PostgresDumper) Close() error {
+	p.db.Close()
+	return nil
+}
+
 func (p *PostgresDumper) GetLabel() string {
 	return p.Label
 }
 
-func (p *PostgresDumper) setup() {
+func (p *PostgresDumper) setup() error {
 	err := os.MkdirAll(p.TmpFolder, 0755)
 	if err != nil {
-		log.Fatalf("failed to setup PostgresDumper (%s) tmpFolder (%s). %s", p.Label, p.TmpFolder, err)
+		return fmt.Errorf("failed to setup PostgresDumper (%s) tmpFolder (%s) => %s", p.Label, p.TmpFolder, err)
 	}
+	return nil
 }
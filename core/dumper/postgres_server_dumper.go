@@ -0,0 +1,103 @@
+package dumper
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/herytz/backupman/core/lib"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Database used to list the databases of the server
+const postgresMaintenanceDatabase = "postgres"
+
+var postgresSystemDatabases = []string{postgresMaintenanceDatabase}
+
+// PostgresServerDumper backs up every database of a PostgreSQL server matching
+// one of the Databases patterns, each database in its own backup.
+type PostgresServerDumper struct {
+	Label     string
+	TmpFolder string
+	Host      string
+	Port      int
+	User      string
+	Password  string
+	Tls       bool
+	Databases []string
+	Options   SqlDumpOptions
+	db        *pgxpool.Pool
+}
+
+func NewPostgresServerDumper(label, tmpFolder, host string, port int, user, password string, tls bool, databases []string, options SqlDumpOptions) *PostgresServerDumper {
+	db, err := lib.NewPostgresConnection(host, port, user, password, postgresMaintenanceDatabase, tls)
+	if err != nil {
+		log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+	}
+	return &PostgresServerDumper{
+		Label:     label,
+		TmpFolder: tmpFolder,
+		Host:      host,
+		Port:      port,
+		User:      user,
+		Password:  password,
+		Tls:       tls,
+		Databases: databases,
+		Options:   options,
+		db:        db,
+	}
+}
+
+func (p *PostgresServerDumper) Discover() ([]Dumper, error) {
+	rows, err := p.db.Query(context.Background(), "SELECT datname FROM pg_database WHERE NOT datistemplate AND datallowconn ORDER BY datname")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %s", err)
+	}
+	defer rows.Close()
+
+	databases := make([]string, 0)
+	for rows.Next() {
+		var database string
+		err := rows.Scan(&database)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		databases = append(databases, database)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	dumpers := make([]Dumper, 0)
+	for _, database := range filterDatabases(databases, p.Databases, postgresSystemDatabases) {
+		d, err := newPostgresDumper(
+			DatabaseLabel(p.Label, database),
+			p.TmpFolder,
+			p.Host,
+			p.Port,
+			p.User,
+			p.Password,
+			database,
+			p.Tls,
+			p.Options,
+		)
+		if err != nil {
+			closeDumpers(dumpers)
+			return nil, fmt.Errorf("failed to create dumper of database (%s) => %s", database, err)
+		}
+		dumpers = append(dumpers, d)
+	}
+	return dumpers, nil
+}
+
+func (p *PostgresServerDumper) Dump(ctx context.Context) (string, error) {
+	return "", DiscoveredDumperError(p.Label)
+}
+
+func (p *PostgresServerDumper) Health() error {
+	return lib.NewHealthPostgres(p.db).Check()
+}
+
+func (p *PostgresServerDumper) GetLabel() string {
+	return p.Label
+}
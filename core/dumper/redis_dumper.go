@@ -0,0 +1,325 @@
+package dumper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const redisDialTimeout = 10 * time.Second
+
+// Longest wait for data from the server. The server sends newlines while the
+// background save is running, so only a stalled server reaches it.
+const redisReadTimeout = time.Minute
+
+// Length of the delimiter announced by a diskless transfer ("$EOF:<mark>")
+const redisEofMarkLength = 40
+
+// RedisDumper fetches an RDB snapshot the same way `redis-cli --rdb` does: it
+// asks the server for a full replication sync, which makes the server run a
+// background save and stream the resulting RDB file. Unlike BGSAVE, it does
+// not need access to the server filesystem.
+type RedisDumper struct {
+	Label     string
+	TmpFolder string
+	Host      string
+	Port      int
+	// ACL user, only the password is sent when empty
+	User     string
+	Password string
+	Tls      RedisTlsConfig
+	// Reset by every read, the dump failing when the server stalls longer
+	ReadTimeout time.Duration
+	tlsConfig   *tls.Config
+}
+
+type RedisTlsConfig struct {
+	Enabled bool
+	// PEM file of the certificate authorities verifying the server, the
+	// system ones being used when empty
+	CaFile string
+	// PEM files of the client certificate, for servers requiring one
+	CertFile string
+	KeyFile  string
+	// Do not verify the server certificate
+	SkipVerify bool
+}
+
+func NewRedisDumper(label, tmpFolder, host string, port int, user, password string, tlsConfig RedisTlsConfig) *RedisDumper {
+	redisDumper := &RedisDumper{
+		Label:       label,
+		TmpFolder:   tmpFolder,
+		Host:        host,
+		Port:        port,
+		User:        user,
+		Password:    password,
+		Tls:         tlsConfig,
+		ReadTimeout: redisReadTimeout,
+	}
+	redisDumper.setup()
+	return redisDumper
+}
+
+func (r *RedisDumper) Dump(ctx context.Context) (string, error) {
+	file, filenamePath, err := createDumpFile(r.TmpFolder, ".rdb")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	err = r.dump(ctx, file)
+	if err != nil {
+		file.Close()
+		os.Remove(filenamePath)
+		return "", err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return "", fmt.Errorf("failed to sync file to disk: %s", err)
+	}
+
+	return filenamePath, nil
+}
+
+func (r *RedisDumper) dump(ctx context.Context, dst io.Writer) error {
+	conn, reader, err := r.connect(ctx, r.ReadTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// Closing the connection interrupts the transfer once the context is done
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	err = r.sync(conn, reader, dst)
+	if ctx.Err() != nil {
+		return fmt.Errorf("dump aborted: %s", ctx.Err())
+	}
+	return err
+}
+
+func (r *RedisDumper) sync(conn net.Conn, reader *bufio.Reader, dst io.Writer) error {
+	err := redisWriteCommand(conn, "SYNC")
+	if err != nil {
+		return err
+	}
+
+	var line string
+	for {
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read SYNC reply: %s", err)
+		}
+		// The server sends newlines to keep the connection alive while the
+		// background save is running
+		if line != "\n" {
+			break
+		}
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	switch {
+	case strings.HasPrefix(line, "-"):
+		return fmt.Errorf("SYNC failed: %s", line[1:])
+	case strings.HasPrefix(line, "$EOF:"):
+		mark := []byte(line[5:])
+		if len(mark) != redisEofMarkLength {
+			return fmt.Errorf("invalid SYNC reply: %s", line)
+		}
+		return redisCopyUntilMark(dst, reader, mark)
+	case strings.HasPrefix(line, "$"):
+		size, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid SYNC reply: %s", line)
+		}
+		_, err = io.CopyN(dst, reader, size)
+		if err != nil {
+			return fmt.Errorf("failed to read RDB payload: %s", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unexpected SYNC reply: %s", line)
+	}
+}
+
+// connect opens an authenticated connection whose reads fail after waiting
+// readTimeout for the server
+func (r *RedisDumper) connect(ctx context.Context, readTimeout time.Duration) (net.Conn, *bufio.Reader, error) {
+	address := net.JoinHostPort(r.Host, strconv.Itoa(r.Port))
+	dialer := &net.Dialer{Timeout: redisDialTimeout}
+
+	var conn net.Conn
+	var err error
+	if r.tlsConfig != nil {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: r.tlsConfig}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to Redis (%s): %s", address, err)
+	}
+	reader := bufio.NewReader(&redisDeadlineReader{conn: conn, timeout: readTimeout})
+
+	if r.Password != "" {
+		args := []string{"AUTH", r.Password}
+		if r.User != "" {
+			args = []string{"AUTH", r.User, r.Password}
+		}
+		reply, err := redisCommand(conn, reader, args...)
+		if err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("failed to authenticate => %s", err)
+		}
+		if reply != "OK" {
+			conn.Close()
+			return nil, nil, fmt.Errorf("failed to authenticate => unexpected reply: %s", reply)
+		}
+	}
+
+	return conn, reader, nil
+}
+
+func (r *RedisDumper) Health() error {
+	conn, reader, err := r.connect(context.Background(), redisDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(redisDialTimeout))
+	reply, err := redisCommand(conn, reader, "PING")
+	if err != nil {
+		return fmt.Errorf("failed to ping Redis => %s", err)
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("failed to ping Redis => unexpected reply: %s", reply)
+	}
+	return nil
+}
+
+func (r *RedisDumper) GetLabel() string {
+	return r.Label
+}
+
+func (r *RedisDumper) setup() {
+	err := os.MkdirAll(r.TmpFolder, 0755)
+	if err != nil {
+		log.Fatalf("failed to setup RedisDumper (%s) tmpFolder (%s). %s", r.Label, r.TmpFolder, err)
+	}
+	if r.Tls.Enabled {
+		r.tlsConfig, err = r.Tls.build(r.Host)
+		if err != nil {
+			log.Fatalf("failed to setup RedisDumper (%s) TLS. %s", r.Label, err)
+		}
+	}
+}
+
+func (c RedisTlsConfig) build(host string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: host, InsecureSkipVerify: c.SkipVerify}
+	if c.CaFile != "" {
+		pem, err := os.ReadFile(c.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file (%s): %s", c.CaFile, err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA file (%s)", c.CaFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate (%s): %s", c.CertFile, err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// redisDeadlineReader pushes back the read deadline of a connection before
+// every read, so the keepalive newlines of the server extend it
+type redisDeadlineReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (r *redisDeadlineReader) Read(p []byte) (int, error) {
+	if r.timeout > 0 {
+		r.conn.SetReadDeadline(time.Now().Add(r.timeout))
+	}
+	return r.conn.Read(p)
+}
+
+func redisWriteCommand(w io.Writer, args ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(w, b.String())
+	if err != nil {
+		return fmt.Errorf("failed to send %s command: %s", args[0], err)
+	}
+	return nil
+}
+
+// redisCommand sends a command expecting a simple string reply
+func redisCommand(conn net.Conn, reader *bufio.Reader, args ...string) (string, error) {
+	err := redisWriteCommand(conn, args...)
+	if err != nil {
+		return "", err
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s reply: %s", args[0], err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "-") {
+		return "", fmt.Errorf("%s", line[1:])
+	}
+	return strings.TrimPrefix(line, "+"), nil
+}
+
+// redisCopyUntilMark copies a diskless transfer, which has no announced size
+// and ends with the mark given in its header.
+func redisCopyUntilMark(dst io.Writer, src io.Reader, mark []byte) error {
+	buf := make([]byte, 32*1024)
+	pending := make([]byte, 0, len(buf)+len(mark))
+	for {
+		n, err := src.Read(buf)
+		pending = append(pending, buf[:n]...)
+		if bytes.HasSuffix(pending, mark) {
+			_, werr := dst.Write(pending[:len(pending)-len(mark)])
+			if werr != nil {
+				return fmt.Errorf("failed to write RDB payload: %s", werr)
+			}
+			return nil
+		}
+		// Keep the tail, it may be the beginning of the mark
+		if len(pending) > len(mark) {
+			flushed := len(pending) - len(mark)
+			_, werr := dst.Write(pending[:flushed])
+			if werr != nil {
+				return fmt.Errorf("failed to write RDB payload: %s", werr)
+			}
+			pending = append(pending[:0], pending[flushed:]...)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read RDB payload: %s", err)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package dumper
+
+import "fmt"
+
+// SqlDumpOptions gathers the options shared by the MySQL and PostgreSQL dumpers
+type SqlDumpOptions struct {
+	TableFilter TableFilter
+	Masking     Masking
+	// Number of tables dumped concurrently, 0 or 1 dumps them sequentially
+	Parallelism int
+	// EXPORT_FORMAT_*, a SQL script when empty
+	Format string
+}
+
+func (o SqlDumpOptions) Validate() error {
+	if o.Parallelism < 0 {
+		return fmt.Errorf("parallelism must be positive, got %d", o.Parallelism)
+	}
+	err := ValidateExportFormat(o.Format)
+	if err != nil {
+		return err
+	}
+	err = o.TableFilter.Validate()
+	if err != nil {
+		return err
+	}
+	return o.Masking.Validate()
+}
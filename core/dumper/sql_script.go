@@ -0,0 +1,85 @@
+package dumper
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// splitSqlStatements reads a SQL script and calls fn with each of its
+// statements. Line comments are dropped, and semicolons inside quoted strings
+// or identifiers do not end a statement.
+func splitSqlStatements(r io.Reader, fn func(statement string) error) error {
+	reader := bufio.NewReader(r)
+	var statement strings.Builder
+	var quote byte
+
+	emit := func() error {
+		s := strings.TrimSpace(statement.String())
+		statement.Reset()
+		if s == "" {
+			return nil
+		}
+		return fn(s)
+	}
+
+	for {
+		c, err := reader.ReadByte()
+		if err == io.EOF {
+			if quote != 0 {
+				return fmt.Errorf("unterminated quoted string in SQL script")
+			}
+			return emit()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read SQL script: %s", err)
+		}
+
+		if quote != 0 {
+			statement.WriteByte(c)
+			switch {
+			case c == '\\' && quote != '`':
+				next, err := reader.ReadByte()
+				if err == nil {
+					statement.WriteByte(next)
+				}
+			case c == quote:
+				// A doubled quote is an escaped quote
+				next, err := reader.Peek(1)
+				if err == nil && next[0] == quote {
+					reader.ReadByte()
+					statement.WriteByte(quote)
+				} else {
+					quote = 0
+				}
+			}
+			continue
+		}
+
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+			statement.WriteByte(c)
+		case ';':
+			err := emit()
+			if err != nil {
+				return err
+			}
+		case '#':
+			reader.ReadString('\n')
+			statement.WriteByte('\n')
+		case '-':
+			// "--" starts a comment when followed by a whitespace
+			next, _ := reader.Peek(2)
+			if len(next) > 0 && next[0] == '-' && (len(next) == 1 || strings.ContainsRune(" \t\r\n", rune(next[1]))) {
+				reader.ReadString('\n')
+				statement.WriteByte('\n')
+			} else {
+				statement.WriteByte(c)
+			}
+		default:
+			statement.WriteByte(c)
+		}
+	}
+}
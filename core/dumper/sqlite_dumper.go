@@ -1,15 +1,14 @@
 package dumper
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io"
-	"io/fs"
 	"log"
 	"os"
-	"path"
+	"strings"
 
-	"github.com/google/uuid"
 	"github.com/herytz/backupman/core/lib"
 )
 
@@ -17,10 +16,12 @@ type SqliteDumper struct {
 	Label     string
 	TmpFolder string
 	DbPath    string
-	db        *sql.DB
+	// EXPORT_FORMAT_*, a copy of the database file when empty or sql
+	Format string
+	db     *sql.DB
 }
 
-func NewSqliteDumper(label, tmpFolder, dbPath string) *SqliteDumper {
+func NewSqliteDumper(label, tmpFolder, dbPath, format string) *SqliteDumper {
 	db, err := lib.NewSqliteConnection(dbPath)
 	if err != nil {
 		log.Fatalf("Failed to connect to SQLite: %v", err)
@@ -30,53 +31,163 @@ func NewSqliteDumper(label, tmpFolder, dbPath string) *SqliteDumper {
 		Label:     label,
 		TmpFolder: tmpFolder,
 		DbPath:    dbPath,
+		Format:    format,
 	}
 	sqliteDumper.setup()
 	return sqliteDumper
 }
 
-func (s *SqliteDumper) Dump() (string, error) {
-	filename := uuid.NewString() + ".db"
-	filenamePath := path.Join(s.TmpFolder, filename)
+func (s *SqliteDumper) Dump(ctx context.Context) (string, error) {
+	return writeDumpFile(ctx, s.TmpFolder, s.dumpExtension(), s.DumpTo)
+}
 
-	_, err := os.Stat(filenamePath)
-	canCreateFile := false
-	if err != nil {
-		switch err.(type) {
-		case *fs.PathError:
-			canCreateFile = true
-		default:
-			return "", fmt.Errorf("failed to check if dump filename (%s) already exists or not: %s", filenamePath, err)
-		}
-	}
+func (s *SqliteDumper) NewDumpPath() string {
+	return newDumpPath(s.TmpFolder, s.dumpExtension())
+}
 
-	if !canCreateFile {
-		return "", fmt.Errorf("dump filename (%s) already exists", filenamePath)
+// DumpTo writes a copy of the database file or the table export to w
+func (s *SqliteDumper) DumpTo(ctx context.Context, dumpPath string, w io.Writer) error {
+	if IsTableExport(s.Format) {
+		return s.exportTables(ctx, dumpPath, w)
 	}
 
 	sourceFile, err := os.Open(s.DbPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to open source database file (%s): %s", s.DbPath, err)
+		return fmt.Errorf("failed to open source database file (%s): %s", s.DbPath, err)
 	}
 	defer sourceFile.Close()
 
-	destFile, err := os.Create(filenamePath)
+	_, err = io.Copy(w, lib.NewContextReader(ctx, sourceFile))
+	if err != nil {
+		return fmt.Errorf("failed to copy database file: %s", err)
+	}
+	return nil
+}
+
+func (s *SqliteDumper) dumpExtension() string {
+	if IsTableExport(s.Format) {
+		return ".tar"
+	}
+	return ".db"
+}
+
+// exportTables writes the rows of the tables in the export format. The
+// tables are read in a single transaction, so they are consistent.
+func (s *SqliteDumper) exportTables(ctx context.Context, dumpPath string, w io.Writer) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return "", fmt.Errorf("cannot create dump filename (%s): %s", filenamePath, err)
+		return fmt.Errorf("failed to start transaction => %s", err)
 	}
-	defer destFile.Close()
+	defer tx.Rollback()
 
-	_, err = io.Copy(destFile, sourceFile)
+	tables, err := s.getTables(tx)
 	if err != nil {
-		return "", fmt.Errorf("failed to copy database file: %s", err)
+		return err
 	}
 
-	err = destFile.Sync()
+	return exportTables(w, dumpPath, s.Format, tables, 1, func(worker int, table string) (tableRows, error) {
+		return s.queryTableRows(tx, table)
+	})
+}
+
+func (s *SqliteDumper) getTables(tx *sql.Tx) ([]string, error) {
+	tables := make([]string, 0)
+	rows, err := tx.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
 	if err != nil {
-		return "", fmt.Errorf("failed to sync file to disk: %s", err)
+		return tables, fmt.Errorf("failed to get tables: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table string
+		err := rows.Scan(&table)
+		if err != nil {
+			return tables, fmt.Errorf("failed to scan row: %s", err)
+		}
+		tables = append(tables, table)
 	}
+	return tables, rows.Err()
+}
+
+// sqliteTableRows reads the values with their storage class
+type sqliteTableRows struct {
+	rows    *sql.Rows
+	columns []TableColumn
+	data    []any
+	ptrs    []any
+}
+
+func (s *SqliteDumper) queryTableRows(tx *sql.Tx, name string) (*sqliteTableRows, error) {
+	rows, err := tx.Query(fmt.Sprintf("SELECT * FROM \"%s\"", strings.ReplaceAll(name, "\"", "\"\"")))
+	if err != nil {
+		return nil, fmt.Errorf("cannot get table %s values: %s", name, err)
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("cannot get columns from table %s: %s", name, err)
+	}
+
+	t := &sqliteTableRows{
+		rows:    rows,
+		columns: make([]TableColumn, len(columnTypes)),
+		data:    make([]any, len(columnTypes)),
+		ptrs:    make([]any, len(columnTypes)),
+	}
+	for i, columnType := range columnTypes {
+		t.columns[i] = TableColumn{
+			Name:         columnType.Name(),
+			DatabaseType: columnType.DatabaseTypeName(),
+			Type:         sqliteExportType(columnType.DatabaseTypeName()),
+		}
+		t.ptrs[i] = &t.data[i]
+	}
+	return t, nil
+}
+
+// sqliteExportType follows the type affinity rules of SQLite
+func sqliteExportType(databaseType string) string {
+	databaseType = strings.ToUpper(databaseType)
+	switch {
+	case strings.Contains(databaseType, "INT"):
+		return EXPORT_TYPE_INTEGER
+	case strings.Contains(databaseType, "CHAR"), strings.Contains(databaseType, "CLOB"), strings.Contains(databaseType, "TEXT"):
+		return EXPORT_TYPE_STRING
+	case strings.Contains(databaseType, "BLOB"):
+		return EXPORT_TYPE_BYTES
+	case strings.Contains(databaseType, "REAL"), strings.Contains(databaseType, "FLOA"), strings.Contains(databaseType, "DOUB"):
+		return EXPORT_TYPE_FLOAT
+	case strings.Contains(databaseType, "BOOL"):
+		return EXPORT_TYPE_BOOLEAN
+	default:
+		return EXPORT_TYPE_STRING
+	}
+}
+
+func (t *sqliteTableRows) Columns() []TableColumn {
+	return t.columns
+}
+
+func (t *sqliteTableRows) Next() bool {
+	return t.rows.Next()
+}
+
+func (t *sqliteTableRows) Values() ([]any, error) {
+	err := t.rows.Scan(t.ptrs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan row: %s", err)
+	}
+	values := make([]any, len(t.data))
+	copy(values, t.data)
+	return values, nil
+}
+
+func (t *sqliteTableRows) Err() error {
+	return t.rows.Err()
+}
 
-	return filenamePath, nil
+func (t *sqliteTableRows) Close() {
+	t.rows.Close()
 }
 
 func (s *SqliteDumper) Health() error {
@@ -0,0 +1,502 @@
+package dumper
+
+import (
+	"archive/tar"
+	"bufio"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/herytz/backupman/core/lib"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress/snappy"
+)
+
+// Formats of the SQL data sources. The sql format is a script restoring the
+// database, the other ones export the rows of each table to its own file.
+const (
+	EXPORT_FORMAT_SQL     = "sql"
+	EXPORT_FORMAT_CSV     = "csv"
+	EXPORT_FORMAT_JSONL   = "jsonl"
+	EXPORT_FORMAT_PARQUET = "parquet"
+)
+
+// Types of the exported values
+const (
+	EXPORT_TYPE_STRING  = "string"
+	EXPORT_TYPE_INTEGER = "integer"
+	EXPORT_TYPE_FLOAT   = "float"
+	EXPORT_TYPE_BOOLEAN = "boolean"
+	EXPORT_TYPE_BYTES   = "bytes"
+)
+
+// Name of the manifest entry of a table export archive
+const ExportManifestName = "manifest.json"
+
+func ValidateExportFormat(format string) error {
+	switch format {
+	case "", EXPORT_FORMAT_SQL, EXPORT_FORMAT_CSV, EXPORT_FORMAT_JSONL, EXPORT_FORMAT_PARQUET:
+		return nil
+	default:
+		return fmt.Errorf("unsupported format (%s), expected sql, csv, jsonl or parquet", format)
+	}
+}
+
+// IsTableExport reports whether the format exports tables instead of a SQL
+// script
+func IsTableExport(format string) bool {
+	return format != "" && format != EXPORT_FORMAT_SQL
+}
+
+// ExportManifest describes the content of a table export archive
+type ExportManifest struct {
+	Format    string        `json:"format"`
+	CreatedAt time.Time     `json:"created_at"`
+	Tables    []ExportTable `json:"tables"`
+}
+
+type ExportTable struct {
+	Name     string        `json:"name"`
+	File     string        `json:"file"`
+	RowCount int64         `json:"row_count"`
+	Columns  []TableColumn `json:"columns"`
+}
+
+type TableColumn struct {
+	Name string `json:"name"`
+	// Type of the column in the database
+	DatabaseType string `json:"database_type"`
+	// EXPORT_TYPE_* of the exported values
+	Type string `json:"type"`
+}
+
+// tableRows iterates the rows of a table with the masking rules applied. The
+// SQL dumps and the table exports are written from the same iteration.
+type tableRows interface {
+	Columns() []TableColumn
+	Next() bool
+	// Values returns the values of the current row, nil for NULL. The
+	// masked values are strings.
+	Values() ([]any, error)
+	Err() error
+	Close()
+}
+
+// exportTables writes an archive holding a file per table in the given
+// format, with the manifest. The tables are read on `parallelism` workers,
+// each table is written to a temporary file, named after filenamePath, then
+// archived in the table order.
+func exportTables(w io.Writer, filenamePath, format string, tables []string, parallelism int, open func(worker int, table string) (tableRows, error)) error {
+	manifest := ExportManifest{
+		Format:    format,
+		CreatedAt: time.Now().UTC(),
+		Tables:    make([]ExportTable, len(tables)),
+	}
+	parts := make([]string, len(tables))
+	for i := range parts {
+		parts[i] = fmt.Sprintf("%s.%d.part", filenamePath, i)
+	}
+	defer func() {
+		for _, part := range parts {
+			os.Remove(part)
+		}
+	}()
+
+	err := lib.RunJobs(len(tables), parallelism, func(worker, index int) error {
+		rows, err := open(worker, tables[index])
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		count, err := exportTable(parts[index], format, rows)
+		if err != nil {
+			return fmt.Errorf("failed to export table %s: %s", tables[index], err)
+		}
+		manifest.Tables[index] = ExportTable{
+			Name:     tables[index],
+			File:     tables[index] + "." + format,
+			RowCount: count,
+			Columns:  rows.Columns(),
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	archive := tar.NewWriter(w)
+	for i, table := range manifest.Tables {
+		err = archiveFile(archive, table.File, parts[i])
+		if err != nil {
+			return err
+		}
+	}
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %s", err)
+	}
+	err = writeArchiveEntry(archive, ExportManifestName, content)
+	if err != nil {
+		return err
+	}
+	err = archive.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close archive: %s", err)
+	}
+	return nil
+}
+
+func archiveFile(archive *tar.Writer, name, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("cannot open table export (%s): %s", filePath, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat table export (%s): %s", filePath, err)
+	}
+	err = archive.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write archive header: %s", err)
+	}
+	_, err = io.Copy(archive, file)
+	if err != nil {
+		return fmt.Errorf("failed to archive table export (%s): %s", name, err)
+	}
+	return nil
+}
+
+// exportTable writes the rows to filePath and returns the number of rows
+func exportTable(filePath, format string, rows tableRows) (int64, error) {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("cannot create table export (%s): %s", filePath, err)
+	}
+	defer file.Close()
+
+	columns := rows.Columns()
+	var writer tableWriter
+	switch format {
+	case EXPORT_FORMAT_CSV:
+		writer, err = newCsvTableWriter(file, columns)
+	case EXPORT_FORMAT_JSONL:
+		writer = newJsonlTableWriter(file, columns)
+	case EXPORT_FORMAT_PARQUET:
+		writer = newParquetTableWriter(file, columns)
+	default:
+		err = fmt.Errorf("unsupported format (%s)", format)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return count, err
+		}
+		for i, value := range values {
+			values[i], err = exportValue(columns[i], value)
+			if err != nil {
+				return count, err
+			}
+		}
+		err = writer.WriteRow(values)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err = rows.Err(); err != nil {
+		return count, fmt.Errorf("error iterating rows: %s", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		return count, err
+	}
+	return count, file.Close()
+}
+
+// exportValue converts a value read from the database to the Go type of the
+// column export type: string, int64, float64, bool or []byte.
+func exportValue(column TableColumn, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	invalid := func() error {
+		return fmt.Errorf("column %s: value (%v) is not of type %s", column.Name, value, column.Type)
+	}
+
+	switch column.Type {
+	case EXPORT_TYPE_INTEGER:
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case int32:
+			return int64(v), nil
+		case int16:
+			return int64(v), nil
+		case int8:
+			return int64(v), nil
+		case int:
+			return int64(v), nil
+		}
+		integer, err := strconv.ParseInt(exportString(value), 10, 64)
+		if err != nil {
+			return nil, invalid()
+		}
+		return integer, nil
+	case EXPORT_TYPE_FLOAT:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+		float, err := strconv.ParseFloat(exportString(value), 64)
+		if err != nil {
+			return nil, invalid()
+		}
+		return float, nil
+	case EXPORT_TYPE_BOOLEAN:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			return v != 0, nil
+		}
+		boolean, err := strconv.ParseBool(exportString(value))
+		if err != nil {
+			return nil, invalid()
+		}
+		return boolean, nil
+	case EXPORT_TYPE_BYTES:
+		switch v := value.(type) {
+		case []byte:
+			return v, nil
+		case string:
+			return []byte(v), nil
+		}
+		return nil, invalid()
+	default:
+		return exportString(value), nil
+	}
+}
+
+// exportString formats the values without a dedicated export type
+func exportString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case [16]byte:
+		// uuid
+		return fmt.Sprintf("%s-%s-%s-%s-%s", hex.EncodeToString(v[0:4]), hex.EncodeToString(v[4:6]), hex.EncodeToString(v[6:8]), hex.EncodeToString(v[8:10]), hex.EncodeToString(v[10:16]))
+	case driver.Valuer:
+		converted, err := v.Value()
+		if err == nil && converted != nil {
+			return exportString(converted)
+		}
+	case map[string]any, []any:
+		content, err := json.Marshal(v)
+		if err == nil {
+			return string(content)
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+type tableWriter interface {
+	WriteRow(values []any) error
+	Close() error
+}
+
+// csvTableWriter writes a header row with the column names. NULL is written
+// as an empty field, bytes are base64 encoded.
+type csvTableWriter struct {
+	writer *csv.Writer
+	record []string
+}
+
+func newCsvTableWriter(w io.Writer, columns []TableColumn) (*csvTableWriter, error) {
+	writer := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	err := writer.Write(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write csv header: %s", err)
+	}
+	return &csvTableWriter{writer: writer, record: make([]string, len(columns))}, nil
+}
+
+func (c *csvTableWriter) WriteRow(values []any) error {
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+			c.record[i] = ""
+		case string:
+			c.record[i] = v
+		case int64:
+			c.record[i] = strconv.FormatInt(v, 10)
+		case float64:
+			c.record[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		case bool:
+			c.record[i] = strconv.FormatBool(v)
+		case []byte:
+			c.record[i] = base64.StdEncoding.EncodeToString(v)
+		}
+	}
+	err := c.writer.Write(c.record)
+	if err != nil {
+		return fmt.Errorf("failed to write csv row: %s", err)
+	}
+	return nil
+}
+
+func (c *csvTableWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// jsonlTableWriter writes a JSON object per row, with the keys in the column
+// order. Bytes are base64 encoded.
+type jsonlTableWriter struct {
+	writer *bufio.Writer
+	keys   [][]byte
+}
+
+func newJsonlTableWriter(w io.Writer, columns []TableColumn) *jsonlTableWriter {
+	keys := make([][]byte, len(columns))
+	for i, column := range columns {
+		keys[i], _ = json.Marshal(column.Name)
+	}
+	return &jsonlTableWriter{writer: bufio.NewWriter(w), keys: keys}
+}
+
+func (j *jsonlTableWriter) WriteRow(values []any) error {
+	var line strings.Builder
+	line.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			line.WriteByte(',')
+		}
+		content, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode value of column %s: %s", j.keys[i], err)
+		}
+		line.Write(j.keys[i])
+		line.WriteByte(':')
+		line.Write(content)
+	}
+	line.WriteString("}\n")
+	_, err := j.writer.WriteString(line.String())
+	if err != nil {
+		return fmt.Errorf("failed to write json row: %s", err)
+	}
+	return nil
+}
+
+func (j *jsonlTableWriter) Close() error {
+	return j.writer.Flush()
+}
+
+// parquetTableWriter writes optional columns compressed with snappy. The
+// columns of a parquet schema are sorted by name.
+type parquetTableWriter struct {
+	writer *parquet.Writer
+	// Parquet column index of each table column
+	indexes []int
+}
+
+func newParquetTableWriter(w io.Writer, columns []TableColumn) *parquetTableWriter {
+	group := parquet.Group{}
+	for _, column := range columns {
+		var node parquet.Node
+		switch column.Type {
+		case EXPORT_TYPE_INTEGER:
+			node = parquet.Int(64)
+		case EXPORT_TYPE_FLOAT:
+			node = parquet.Leaf(parquet.DoubleType)
+		case EXPORT_TYPE_BOOLEAN:
+			node = parquet.Leaf(parquet.BooleanType)
+		case EXPORT_TYPE_BYTES:
+			node = parquet.Leaf(parquet.ByteArrayType)
+		default:
+			node = parquet.String()
+		}
+		group[column.Name] = parquet.Optional(node)
+	}
+	schema := parquet.NewSchema("table", group)
+
+	positions := make(map[string]int)
+	for i, field := range schema.Fields() {
+		positions[field.Name()] = i
+	}
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		indexes[i] = positions[column.Name]
+	}
+
+	return &parquetTableWriter{
+		writer:  parquet.NewWriter(w, schema, parquet.Compression(&snappy.Codec{})),
+		indexes: indexes,
+	}
+}
+
+func (p *parquetTableWriter) WriteRow(values []any) error {
+	row := make(parquet.Row, len(values))
+	for i, value := range values {
+		var v parquet.Value
+		switch typed := value.(type) {
+		case nil:
+			row[p.indexes[i]] = parquet.NullValue().Level(0, 0, p.indexes[i])
+			continue
+		case string:
+			v = parquet.ByteArrayValue([]byte(typed))
+		case int64:
+			v = parquet.Int64Value(typed)
+		case float64:
+			v = parquet.DoubleValue(typed)
+		case bool:
+			v = parquet.BooleanValue(typed)
+		case []byte:
+			v = parquet.ByteArrayValue(typed)
+		}
+		row[p.indexes[i]] = v.Level(0, 1, p.indexes[i])
+	}
+	_, err := p.writer.WriteRows([]parquet.Row{row})
+	if err != nil {
+		return fmt.Errorf("failed to write parquet row: %s", err)
+	}
+	return nil
+}
+
+func (p *parquetTableWriter) Close() error {
+	err := p.writer.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close parquet file: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package dumper
+
+import (
+	"fmt"
+	"path"
+)
+
+// TableFilter selects the tables dumped by the SQL dumpers. Patterns use the
+// glob syntax of path.Match (e.g. "audit_*").
+type TableFilter struct {
+	// When not empty, only tables matching one of these patterns are dumped
+	IncludeTables []string
+	// Tables matching one of these patterns are skipped
+	ExcludeTables []string
+	// Tables matching one of these patterns are dumped without their rows
+	SchemaOnlyTables []string
+	// Optional WHERE clause per table name, to dump only part of the rows
+	Where map[string]string
+}
+
+func (f TableFilter) Validate() error {
+	for _, patterns := range [][]string{f.IncludeTables, f.ExcludeTables, f.SchemaOnlyTables} {
+		for _, pattern := range patterns {
+			_, err := path.Match(pattern, "")
+			if err != nil {
+				return fmt.Errorf("invalid table pattern (%s): %s", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (f TableFilter) Match(table string) bool {
+	if len(f.IncludeTables) > 0 && !matchAny(f.IncludeTables, table) {
+		return false
+	}
+	return !matchAny(f.ExcludeTables, table)
+}
+
+func (f TableFilter) IsSchemaOnly(table string) bool {
+	return matchAny(f.SchemaOnlyTables, table)
+}
+
+func (f TableFilter) WhereClause(table string) string {
+	return f.Where[table]
+}
+
+func (f TableFilter) Apply(tables []string) []string {
+	filtered := make([]string, 0, len(tables))
+	for _, table := range tables {
+		if f.Match(table) {
+			filtered = append(filtered, table)
+		}
+	}
+	return filtered
+}
+
+func matchAny(patterns []string, table string) bool {
+	for _, pattern := range patterns {
+		matched, err := path.Match(pattern, table)
+		if err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// FileSha256 returns the hex encoded SHA-256 of the content of a file
+func FileSha256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %s => %s", path, err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %s => %s", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"bufio"
+	"io"
+	"math/bits"
+)
+
+// gearTable maps each byte to a random value of the gear hash. It is seeded
+// with a constant: changing it changes every chunk boundary.
+var gearTable = newGearTable(0x6261636b75706d61)
+
+// Chunker splits a stream into content defined chunks. A boundary is cut
+// where a rolling gear hash of the last 64 bytes matches a mask, so inserting
+// data only changes the chunks around the insertion. The chunks are between
+// min and max bytes, avg bytes long on average.
+type Chunker struct {
+	reader *bufio.Reader
+	min    int
+	max    int
+	mask   uint64
+	buffer []byte
+}
+
+// NewChunker returns a chunker of src, avg being rounded down to a power of 2
+func NewChunker(src io.Reader, min, avg, max int) *Chunker {
+	maskBits := bits.Len(uint(avg)) - 1
+	return &Chunker{
+		reader: bufio.NewReaderSize(src, 64*1024),
+		min:    min,
+		max:    max,
+		// The high bits of the hash depend on the most bytes
+		mask:   (uint64(1)<<maskBits - 1) << (64 - maskBits),
+		buffer: make([]byte, 0, max),
+	}
+}
+
+// Next returns the next chunk, valid until the following call, or io.EOF
+// after the last chunk
+func (c *Chunker) Next() ([]byte, error) {
+	c.buffer = c.buffer[:0]
+	var hash uint64
+	for len(c.buffer) < c.max {
+		b, err := c.reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.buffer = append(c.buffer, b)
+		hash = hash<<1 + gearTable[b]
+		if len(c.buffer) >= c.min && hash&c.mask == 0 {
+			break
+		}
+	}
+	if len(c.buffer) == 0 {
+		return nil, io.EOF
+	}
+	return c.buffer, nil
+}
+
+// newGearTable generates the gear values with splitmix64
+func newGearTable(seed uint64) [256]uint64 {
+	var table [256]uint64
+	state := seed
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		table[i] = z ^ z>>31
+	}
+	return table
+}
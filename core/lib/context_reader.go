@@ -0,0 +1,25 @@
+package lib
+
+import (
+	"context"
+	"io"
+)
+
+// ContextReader is an io.Reader failing with the error of its context once
+// the context is done, so long copies can be aborted.
+type ContextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func NewContextReader(ctx context.Context, reader io.Reader) *ContextReader {
+	return &ContextReader{ctx: ctx, reader: reader}
+}
+
+func (r *ContextReader) Read(p []byte) (int, error) {
+	err := r.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
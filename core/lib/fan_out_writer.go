@@ -0,0 +1,51 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+)
+
+// FanOutWriter writes the same data to several writers. A failing writer is
+// left out of the following writes while the others keep receiving the data,
+// the write only failing once every writer failed.
+type FanOutWriter struct {
+	writers []io.Writer
+	errs    []error
+}
+
+func NewFanOutWriter(writers ...io.Writer) *FanOutWriter {
+	return &FanOutWriter{
+		writers: writers,
+		errs:    make([]error, len(writers)),
+	}
+}
+
+func (w *FanOutWriter) Write(p []byte) (int, error) {
+	var lastErr error
+	written := false
+	for i, writer := range w.writers {
+		if w.errs[i] != nil {
+			lastErr = w.errs[i]
+			continue
+		}
+		n, err := writer.Write(p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			w.errs[i] = err
+			lastErr = err
+			continue
+		}
+		written = true
+	}
+	if !written && lastErr != nil {
+		return 0, fmt.Errorf("every writer failed => %s", lastErr)
+	}
+	return len(p), nil
+}
+
+// Err returns the error of the writer at index i, nil when it did not fail
+func (w *FanOutWriter) Err(i int) error {
+	return w.errs[i]
+}
@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// WriteSegments runs `count` jobs and writes their output to dst in the job
+// order. With a parallelism above 1, the jobs run on that many workers and
+// each job writes to its own temporary segment file, named after
+// segmentPrefix, so the output does not depend on the scheduling.
+// The worker index given to the job lets the caller bind per worker
+// resources like database connections.
+func WriteSegments(dst io.Writer, segmentPrefix string, count, parallelism int, job func(worker, index int, w io.Writer) error) error {
+	if parallelism <= 1 || count <= 1 {
+		for i := 0; i < count; i++ {
+			err := job(0, i, dst)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	segments := make([]string, count)
+	for i := range segments {
+		segments[i] = fmt.Sprintf("%s.%d.part", segmentPrefix, i)
+	}
+	defer func() {
+		for _, segment := range segments {
+			os.Remove(segment)
+		}
+	}()
+
+	err := RunJobs(count, parallelism, func(worker, index int) error {
+		return writeSegment(segments[index], func(w io.Writer) error {
+			return job(worker, index, w)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, segment := range segments {
+		err := appendSegment(dst, segment)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunJobs runs `count` jobs on `parallelism` workers and returns the first
+// error. The remaining jobs are skipped after an error.
+func RunJobs(count, parallelism int, job func(worker, index int) error) error {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	for worker := 0; worker < min(max(parallelism, 1), count); worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for index := range jobs {
+				if failed() {
+					continue
+				}
+				err := job(worker, index)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}(worker)
+	}
+
+	for i := 0; i < count; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return firstErr
+}
+
+func writeSegment(segment string, job func(w io.Writer) error) error {
+	file, err := os.Create(segment)
+	if err != nil {
+		return fmt.Errorf("cannot create dump segment (%s): %s", segment, err)
+	}
+	defer file.Close()
+	return job(file)
+}
+
+func appendSegment(dst io.Writer, segment string) error {
+	file, err := os.Open(segment)
+	if err != nil {
+		return fmt.Errorf("cannot open dump segment (%s): %s", segment, err)
+	}
+	defer file.Close()
+	_, err = io.Copy(dst, file)
+	if err != nil {
+		return fmt.Errorf("failed to append dump segment (%s): %s", segment, err)
+	}
+	return nil
+}
@@ -4,6 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
@@ -28,14 +32,26 @@ func NewMysqlConnection(host string, port int, user string, password string, dat
 	return dbConn, nil
 }
 
-func NewPostgresConnection(host string, port int, user string, password string, database string, tls bool) (*pgxpool.Pool, error) {
-	connString := fmt.Sprintf("postgres://%s:%s@%s:%d/%s", user, password, host, port, database)
+// PostgresConnString returns the URL of a PostgreSQL database, its user,
+// password and database name being escaped
+func PostgresConnString(host string, port int, user string, password string, database string, tls bool) string {
+	sslMode := "disable"
 	if tls {
-		connString += "?sslmode=require"
-	} else {
-		connString += "?sslmode=disable"
+		sslMode = "require"
+	}
+	connUrl := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(user, password),
+		Host:     net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:     "/" + database,
+		RawPath:  "/" + url.PathEscape(database),
+		RawQuery: "sslmode=" + sslMode,
 	}
-	dbConn, err := pgxpool.New(context.Background(), connString)
+	return connUrl.String()
+}
+
+func NewPostgresConnection(host string, port int, user string, password string, database string, tls bool) (*pgxpool.Pool, error) {
+	dbConn, err := pgxpool.New(context.Background(), PostgresConnString(host, port, user, password, database, tls))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
 	}
@@ -121,3 +137,16 @@ func (nt *SqlNonNullableTime) Scan(value interface{}) error {
 		return fmt.Errorf("[SqlNonNullableTime] type non supporté: %T", value)
 	}
 }
+
+// JoinSqlList stores a list of values without new lines in a text column
+func JoinSqlList(values []string) string {
+	return strings.Join(values, "\n")
+}
+
+// SplitSqlList reads a list stored by JoinSqlList, nil when it is empty
+func SplitSqlList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, "\n")
+}
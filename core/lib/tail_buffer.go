@@ -0,0 +1,37 @@
+package lib
+
+import "sync"
+
+// TailBuffer is an io.Writer keeping only the last `limit` bytes written.
+// It is used to capture the output of external commands without holding
+// arbitrarily large outputs in memory.
+type TailBuffer struct {
+	mu        sync.Mutex
+	limit     int
+	data      []byte
+	truncated bool
+}
+
+func NewTailBuffer(limit int) *TailBuffer {
+	return &TailBuffer{limit: limit}
+}
+
+func (b *TailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	if len(b.data) > b.limit {
+		b.data = b.data[len(b.data)-b.limit:]
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *TailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.truncated {
+		return "..." + string(b.data)
+	}
+	return string(b.data)
+}
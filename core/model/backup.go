@@ -6,6 +6,15 @@ const (
 	BACKUP_STATUS_PENDING  = "pending"
 	BACKUP_STATUS_FINISHED = "finished"
 	BACKUP_STATUS_FAILED   = "failed"
+	// Backup aborted while it was running, it is not retried
+	BACKUP_STATUS_CANCELLED = "cancelled"
+)
+
+const (
+	BACKUP_KIND_FULL        = "full"
+	BACKUP_KIND_INCREMENTAL = "incremental"
+	// WAL segment archived by a PostgreSQL server, chained to a base backup
+	BACKUP_KIND_WAL = "wal"
 )
 
 type Backup struct {
@@ -13,6 +22,20 @@ type Backup struct {
 	Label     string
 	Status    string
 	DumpPath  string
+	Error     string
+	FileCount int64
+	TotalSize int64
+	// BACKUP_KIND_*, empty for the backups taken before incremental backups
+	Kind string
+	// Full backup an incremental backup or a WAL segment is replayed on
+	ParentId string
+	// Position of the data source the dump ends at, for incremental backups.
+	// Start WAL segment of a base backup, or name of a WAL segment.
+	Position string
+	// Failed backup this backup dumps again
+	RetryOfId string
+	// Run of the backups this backup belongs to
+	RunId     string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
@@ -30,6 +53,14 @@ type BackupFull struct {
 	Status     string
 	Label      string
 	DumpPath   string
+	Error      string
+	FileCount  int64
+	TotalSize  int64
+	Kind       string
+	ParentId   string
+	Position   string
+	RetryOfId  string
+	RunId      string
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
 	DriveFiles []*DriveFile
@@ -0,0 +1,52 @@
+package model
+
+import "time"
+
+// Sources starting a run of the backups
+const (
+	RUN_TRIGGER_CRON = "cron"
+	RUN_TRIGGER_API  = "api"
+	RUN_TRIGGER_CLI  = "cli"
+)
+
+const (
+	RUN_STATUS_RUNNING  = "running"
+	RUN_STATUS_FINISHED = "finished"
+	// At least one backup of the run failed
+	RUN_STATUS_FAILED = "failed"
+	// At least one backup of the run was cancelled, none failed
+	RUN_STATUS_CANCELLED = "cancelled"
+)
+
+// BackupRun groups the backups of the data sources started at once, by the
+// scheduler, the HTTP API or the CLI
+type BackupRun struct {
+	Id string
+	// RUN_TRIGGER_*
+	Trigger string
+	// Fingerprint of the API key of the request starting the run, empty for the
+	// other triggers
+	ApiKey    string
+	Status    string
+	StartedAt time.Time
+	// Zero while the run is running
+	EndedAt time.Time
+}
+
+func (r *BackupRun) GetId() string {
+	return r.Id
+}
+
+func (r *BackupRun) SetId(id string) {
+	r.Id = id
+}
+
+type BackupRunFull struct {
+	Id        string
+	Trigger   string
+	ApiKey    string
+	Status    string
+	StartedAt time.Time
+	EndedAt   time.Time
+	Backups   []BackupFull
+}
@@ -6,17 +6,27 @@ const (
 	DRIVE_FILE_STATUS_PENDING  = "pending"
 	DRIVE_FILE_STATUS_FINISHED = "finished"
 	DRIVE_FILE_STATUS_FAILED   = "failed"
+	// The file of a finished upload was not found on its drive anymore
+	DRIVE_FILE_STATUS_MISSING = "missing"
 )
 
 type DriveFile struct {
-	Id        string
-	BackupId  string
-	Provider  string
-	Label     string
-	Path      string
-	Status    string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	Id       string
+	BackupId string
+	Provider string
+	Label    string
+	Path     string
+	Status   string
+	// Number of upload attempts made, automatic retries included
+	Attempts int
+	// Paths of the volumes of a dump split by its drive, Path being the path
+	// of their manifest
+	Parts []string
+	// Path of the catalog entry describing the drive file and its backup, to
+	// rebuild the records from the drive
+	CatalogPath string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
 }
 
 func (b *DriveFile) GetId() string {
@@ -1,6 +1,7 @@
 package notifier
 
 import (
+	"context"
 	"github.com/herytz/backupman/core/dao"
 	"github.com/herytz/backupman/core/mailer"
 	"github.com/herytz/backupman/core/notifier/message"
@@ -16,7 +17,7 @@ func NewMailNotifier(mailer mailer.Mailer, db dao.Dao, recipients []mailer.Recip
 	return &MailNotifier{Mailer: mailer, Db: db, Recipients: recipients}
 }
 
-func (m *MailNotifier) BackupReport(backupId string) error {
+func (m *MailNotifier) BackupReport(ctx context.Context, backupId string) error {
 	backup, err := m.Db.Backup.ReadFullById(backupId)
 	if err != nil {
 		return err
@@ -32,6 +33,10 @@ func (m *MailNotifier) BackupReport(backupId string) error {
 	input.Subject = "Backup Report"
 	input.Message = msg
 
+	// The mailer cannot abort a mail being sent
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	return m.Mailer.Send(input)
 }
 
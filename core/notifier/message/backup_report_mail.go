@@ -78,6 +78,18 @@ const tmpl = `
                 <td style="padding: 8px; background-color: #f8f9fa;">Database Name</td>
                 <td style="padding: 8px;">{{.DatabaseName}}</td>
             </tr>
+            {{if .FileCount}}
+            <tr>
+                <td style="padding: 8px; background-color: #f8f9fa;">Files</td>
+                <td style="padding: 8px;">{{.FileCount}} ({{.TotalSize}} bytes)</td>
+            </tr>
+            {{end}}
+            {{if .Error}}
+            <tr>
+                <td style="padding: 8px; background-color: #f8f9fa;">Error</td>
+                <td style="padding: 8px; color: #721c24;"><pre style="white-space: pre-wrap; margin: 0;">{{.Error}}</pre></td>
+            </tr>
+            {{end}}
         </table>
 
         <!-- Upload Status -->
@@ -118,6 +130,9 @@ type EmailData struct {
 	BackupID     string
 	BackupDate   string
 	DatabaseName string
+	Error        string
+	FileCount    int64
+	TotalSize    int64
 	UploadStatus []UploadStatus
 }
 
@@ -134,6 +149,9 @@ func BackupReportMail(backup *model.BackupFull) (string, error) {
 		BackupID:     backup.Id,
 		BackupDate:   backup.CreatedAt.Format("2006-01-02 15:04:05"),
 		DatabaseName: backup.Label,
+		Error:        backup.Error,
+		FileCount:    backup.FileCount,
+		TotalSize:    backup.TotalSize,
 	}
 	for _, driveFile := range backup.DriveFiles {
 		data.UploadStatus = append(data.UploadStatus, UploadStatus{
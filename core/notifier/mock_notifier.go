@@ -1,8 +1,10 @@
 package notifier
 
+import "context"
+
 type MockNotifier struct{}
 
-func (m *MockNotifier) BackupReport(backupId string) error {
+func (m *MockNotifier) BackupReport(ctx context.Context, backupId string) error {
 	return nil
 }
 
@@ -1,7 +1,10 @@
 package notifier
 
+import "context"
+
+// Notifier reports the backups. A report is aborted when its context is done.
 type Notifier interface {
-	BackupReport(backupId string) error
+	BackupReport(ctx context.Context, backupId string) error
 	Health() error
 	GetName() string
 }
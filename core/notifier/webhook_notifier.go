@@ -2,6 +2,7 @@ package notifier
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -25,7 +26,7 @@ func NewWebhookNotifier(webhooks []WebhookNotifierConfig, db dao.Dao) *WebhookNo
 	return &WebhookNotifier{Webhooks: webhooks, Db: db}
 }
 
-func (m *WebhookNotifier) BackupReport(backupId string) error {
+func (m *WebhookNotifier) BackupReport(ctx context.Context, backupId string) error {
 	backup, err := m.Db.Backup.ReadFullById(backupId)
 	if err != nil {
 		return fmt.Errorf("failed to read backup => %s", err)
@@ -40,7 +41,7 @@ func (m *WebhookNotifier) BackupReport(backupId string) error {
 		if err != nil {
 			return fmt.Errorf("failed to marshal body => %w", err)
 		}
-		err = send(wh, jsonBody)
+		err = send(ctx, wh, jsonBody)
 		if err != nil {
 			log.Printf("failed to send webhook[backup_report] (%s) => %s", wh.Url, err)
 			continue
@@ -50,10 +51,10 @@ func (m *WebhookNotifier) BackupReport(backupId string) error {
 	return nil
 }
 
-func send(wh WebhookNotifierConfig, body []byte) error {
+func send(ctx context.Context, wh WebhookNotifierConfig, body []byte) error {
 	client := &http.Client{}
 
-	req, err := http.NewRequest("POST", wh.Url, bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, "POST", wh.Url, bytes.NewBuffer(body))
 	if err != nil {
 		return fmt.Errorf("failed to create request => %w", err)
 	}
@@ -1,101 +1,127 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
 	"github.com/herytz/backupman/core/model"
 )
 
-func Backup(app *application.App) ([]string, error) {
-	backupIds := make([]string, 0)
+// backupJob is the backup of a database run by Backup
+type backupJob struct {
+	dataSourceLabel string
+	// Nil when the databases of the data source could not be discovered
+	dumper dumper.Dumper
+	// Dumper of a discovered database, closed after its backup
+	discovered bool
+	backupId   string
+	err        error
+}
 
-	for _, dumper := range app.Dumpers {
-		backupId, err := app.Db.Backup.Create(model.Backup{
-			Label:  dumper.GetLabel(),
-			Status: model.BACKUP_STATUS_PENDING,
-		})
-		if err != nil {
-			return backupIds, fmt.Errorf("failed to create backup => %s", err)
-		}
-		backupIds = append(backupIds, backupId)
+// Backup backs up the databases of every data source, or of the data sources
+// labeled labels only. The databases are backed up at the same time within the
+// limits of the application, the IDs of their backups being returned in the
+// order of the data sources. The backups belong to the run runId, see
+// StartBackupRun, which is ended once they are done. The backups still running
+// when ctx is done are cancelled.
+func Backup(ctx context.Context, app *application.App, runId string, labels ...string) (backupIds []string, err error) {
+	backupIds = make([]string, 0)
+	_, err = app.Db.BackupRun.ReadOrError(runId)
+	if err != nil {
+		return backupIds, fmt.Errorf("failed to read backup run => %s", err)
+	}
+	defer func() {
+		endBackupRun(app, runId, backupIds, err)
+	}()
+	err = CheckDataSources(app, labels)
+	if err != nil {
+		return backupIds, err
+	}
 
-		backup, err := app.Db.Backup.ReadOrError(backupId)
-		if err != nil {
-			return backupIds, fmt.Errorf("failed to read backup => %s", err)
+	jobs := make([]*backupJob, 0)
+	for _, dataSource := range app.Dumpers {
+		if len(labels) > 0 && !slices.Contains(labels, dataSource.GetLabel()) {
+			continue
 		}
-
-		dump, err := dumper.Dump()
+		dumpers, err := discoverDumpers(dataSource)
 		if err != nil {
-			log.Printf("failed to dump database (%s) => %s", dumper.GetLabel(), err)
-			backup.Status = model.BACKUP_STATUS_FAILED
-			_, err := app.Db.Backup.Update(backup.Id, *backup)
+			log.Printf("failed to discover databases of data source (%s) => %s", dataSource.GetLabel(), err)
+			failed := model.Backup{
+				Label:  dataSource.GetLabel(),
+				Status: model.BACKUP_STATUS_FAILED,
+				Kind:   model.BACKUP_KIND_FULL,
+				Error:  err.Error(),
+				RunId:  runId,
+			}
+			backupId, err := app.Db.Backup.Create(failed)
 			if err != nil {
-				log.Printf("failed to update backup (%s) status to failed => %s", backup.Id, err)
+				closeDiscoveredDumpers(jobs)
+				return backupIds, fmt.Errorf("failed to create backup => %s", err)
 			}
-
-			continue
-		}
-
-		backup.DumpPath = dump
-		_, err = app.Db.Backup.Update(backup.Id, *backup)
-		if err != nil {
-			log.Printf("failed to update backup (%s) with dump path (%s): %s", backup.Id, dump, err)
+			failed.Id = backupId
+			runHookOrLog(context.WithoutCancel(ctx), app, dataSource.GetLabel(), HOOK_ON_FAILURE, failed)
+			err = AfterBackup(context.WithoutCancel(ctx), app, backupId)
+			if err != nil {
+				log.Printf("failed to execute after backup tasks for backup (%s) => %s", backupId, err)
+			}
+			jobs = append(jobs, &backupJob{dataSourceLabel: dataSource.GetLabel(), backupId: backupId})
 			continue
 		}
 
-		for _, drive := range app.Drives {
-			driveFileId, err := app.Db.DriveFile.Create(model.DriveFile{
-				BackupId: backup.Id,
-				Status:   model.DRIVE_FILE_STATUS_PENDING,
-				Label:    drive.GetLabel(),
-				Provider: drive.GetProvider(),
+		for _, d := range dumpers {
+			jobs = append(jobs, &backupJob{
+				dataSourceLabel: dataSource.GetLabel(),
+				dumper:          d,
+				discovered:      d != dataSource,
 			})
-			if err != nil {
-				log.Printf("failed to create drive (%s) for database (%s) => %s", drive.GetLabel(), dumper.GetLabel(), err)
-				continue
-			}
+		}
+	}
 
-			driveFile, err := app.Db.DriveFile.ReadOrError(driveFileId)
-			if err != nil {
-				log.Printf("failed to read drive file (%s) => %s", driveFileId, err)
-				continue
-			}
-			file, err := drive.Upload(dump)
-			if err != nil {
-				log.Printf("failed to upload dump (%s) for database (%s) to drive (%s) => %s", dump, dumper.GetLabel(), drive.GetLabel(), err)
-				driveFile.Status = model.DRIVE_FILE_STATUS_FAILED
-				_, err := app.Db.DriveFile.Update(driveFile.Id, *driveFile)
-				if err != nil {
-					log.Printf("failed to update drive file (%s) status to failed => %s", driveFile.Id, err)
-				}
-				continue
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		if job.dumper == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			job.backupId, job.err = backupDumper(ctx, app, runId, job.dataSourceLabel, job.dumper, "")
+			if job.discovered {
+				closeDumper(job.dumper)
 			}
+		}()
+	}
+	wg.Wait()
 
-			driveFile.Status = model.DRIVE_FILE_STATUS_FINISHED
-			driveFile.Path = file.Path
-			_, err = app.Db.DriveFile.Update(driveFile.Id, *driveFile)
-			if err != nil {
-				log.Printf("failed to update drive file (%s) status to finished => %s", driveFile.Id, err)
-			}
+	for _, job := range jobs {
+		if job.backupId != "" {
+			backupIds = append(backupIds, job.backupId)
 		}
-
-		err = AfterBackup(app, backupId)
-		if err != nil {
-			log.Printf("failed to execute after backup tasks for backup (%s) => %s", backupId, err)
+		if err == nil {
+			err = job.err
 		}
 	}
+	if err != nil {
+		return backupIds, err
+	}
 
 	if app.Retention.Enabled {
 		if app.Mode == application.APP_MODE_CLI {
-			err := RemoveOldBackup(app)
+			err := RemoveOldBackup(ctx, app)
 			if err != nil {
 				log.Println(err)
 			}
 		} else {
 			go func(app *application.App) {
-				err := RemoveOldBackup(app)
+				err := RemoveOldBackup(ctx, app)
 				if err != nil {
 					log.Println(err)
 				}
@@ -105,3 +131,239 @@ func Backup(app *application.App) ([]string, error) {
 
 	return backupIds, nil
 }
+
+// CheckDataSources returns an error when a label of labels is not the label of
+// a data source of the application
+func CheckDataSources(app *application.App, labels []string) error {
+	for _, label := range labels {
+		found := slices.ContainsFunc(app.Dumpers, func(d dumper.Dumper) bool {
+			return d.GetLabel() == label
+		})
+		if !found {
+			return fmt.Errorf("unknown data source (%s)", label)
+		}
+	}
+	return nil
+}
+
+// discoverDumpers returns the dumpers of the databases of a server, or the data source itself
+func discoverDumpers(dataSource dumper.Dumper) ([]dumper.Dumper, error) {
+	discoverer, ok := dataSource.(dumper.Discoverer)
+	if !ok {
+		return []dumper.Dumper{dataSource}, nil
+	}
+	return discoverer.Discover()
+}
+
+func closeDiscoveredDumpers(jobs []*backupJob) {
+	for _, job := range jobs {
+		if job.discovered {
+			closeDumper(job.dumper)
+		}
+	}
+}
+
+func closeDumper(d dumper.Dumper) {
+	closer, ok := d.(io.Closer)
+	if !ok {
+		return
+	}
+	err := closer.Close()
+	if err != nil {
+		log.Printf("failed to close dumper (%s) => %s", d.GetLabel(), err)
+	}
+}
+
+// backupDumper dumps a database and uploads the dump to the drives of its data source
+func backupDumper(ctx context.Context, app *application.App, runId, dataSourceLabel string, dumper dumper.Dumper, retryOfId string) (string, error) {
+	backupId, err := app.Db.Backup.Create(model.Backup{
+		Label:     dumper.GetLabel(),
+		Status:    model.BACKUP_STATUS_PENDING,
+		Kind:      model.BACKUP_KIND_FULL,
+		RetryOfId: retryOfId,
+		RunId:     runId,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup => %s", err)
+	}
+	ctx, done := app.Running.Start(ctx, backupId)
+	defer done()
+
+	backup, err := app.Db.Backup.ReadOrError(backupId)
+	if err != nil {
+		return backupId, fmt.Errorf("failed to read backup => %s", err)
+	}
+
+	dumpFn, drives := dumpFunc(app, dataSourceLabel, dumper, backup)
+	dump, err := dumpDatabase(ctx, app, dataSourceLabel, dumper, backup, dumpFn)
+	if err != nil && ctx.Err() != nil {
+		cancelBackup(app, backup)
+		return backupId, nil
+	}
+	if err != nil {
+		failBackup(context.WithoutCancel(ctx), app, dataSourceLabel, backup, err)
+		return backupId, nil
+	}
+
+	backup.DumpPath = dump
+	SetBackupDumpStats(dumper, backup, dump)
+	SetBackupPosition(dumper, backup, dump)
+	_, err = app.Db.Backup.Update(backup.Id, *backup)
+	if err != nil {
+		log.Printf("failed to update backup (%s) with dump path (%s): %s", backup.Id, dump, err)
+		return backupId, nil
+	}
+
+	uploadDumpToDrives(ctx, app, drives, backup, dump)
+
+	// The hooks run before AfterBackup removes the dump
+	if ctx.Err() != nil {
+		cancelBackup(app, backup)
+	} else {
+		uploaded, err := HandleBackupStatus(app, backupId)
+		if err != nil {
+			log.Printf("failed to handle backup (%s) status => %s", backupId, err)
+		} else {
+			runHookOrLog(ctx, app, dataSourceLabel, HOOK_POST_UPLOAD, uploaded)
+			if uploaded.Status == model.BACKUP_STATUS_FAILED {
+				runHookOrLog(ctx, app, dataSourceLabel, HOOK_ON_FAILURE, uploaded)
+			}
+		}
+	}
+
+	// The report of a cancelled backup is still sent
+	err = AfterBackup(context.WithoutCancel(ctx), app, backupId)
+	if err != nil {
+		log.Printf("failed to execute after backup tasks for backup (%s) => %s", backupId, err)
+	}
+
+	return backupId, nil
+}
+
+// dumpDatabase dumps the database of a backup between the dump hooks of its data source
+func dumpDatabase(ctx context.Context, app *application.App, dataSourceLabel string, d dumper.Dumper, backup *model.Backup, dump func(ctx context.Context) (string, error)) (string, error) {
+	err := app.Limiter.AcquireDump(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer app.Limiter.ReleaseDump()
+
+	err = runHook(ctx, app, dataSourceLabel, HOOK_PRE_DUMP, *backup)
+	if err != nil {
+		log.Printf("backup (%s) of data source (%s): %s", backup.Id, dataSourceLabel, err)
+		return "", err
+	}
+
+	dumpPath, err := dumpWithTimeout(ctx, app.DataSourceOptions[dataSourceLabel].DumpTimeout, dump)
+	if err != nil {
+		log.Printf("failed to dump database (%s) => %s", d.GetLabel(), err)
+		// The post dump hook undoes the pre dump hook whatever the dump result
+		failed := *backup
+		failed.Status = model.BACKUP_STATUS_FAILED
+		failed.Error = err.Error()
+		runHookOrLog(context.WithoutCancel(ctx), app, dataSourceLabel, HOOK_POST_DUMP, failed)
+		return "", err
+	}
+
+	dumped := *backup
+	dumped.DumpPath = dumpPath
+	runHookOrLog(context.WithoutCancel(ctx), app, dataSourceLabel, HOOK_POST_DUMP, dumped)
+	return dumpPath, nil
+}
+
+// dumpWithTimeout runs a dump aborted after timeout
+func dumpWithTimeout(ctx context.Context, timeout time.Duration, dump func(ctx context.Context) (string, error)) (string, error) {
+	if timeout <= 0 {
+		return dump(ctx)
+	}
+	dumpCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	path, err := dump(dumpCtx)
+	if err != nil && ctx.Err() == nil && dumpCtx.Err() != nil {
+		return "", fmt.Errorf("dump timed out after %s => %s", timeout, err)
+	}
+	return path, err
+}
+
+// failBackup records the error of a backup which could not be dumped
+func failBackup(ctx context.Context, app *application.App, dataSourceLabel string, backup *model.Backup, cause error) {
+	backup.Status = model.BACKUP_STATUS_FAILED
+	backup.Error = cause.Error()
+	_, err := app.Db.Backup.Update(backup.Id, *backup)
+	if err != nil {
+		log.Printf("failed to update backup (%s) status to failed => %s", backup.Id, err)
+	}
+	runHookOrLog(ctx, app, dataSourceLabel, HOOK_ON_FAILURE, *backup)
+}
+
+// uploadDump uploads the dump of a backup to the drives of its data source at the same time
+func uploadDump(ctx context.Context, app *application.App, dataSourceLabel string, backup *model.Backup, dump string) {
+	uploadDumpToDrives(ctx, app, GetDataSourceDrives(app, dataSourceLabel), backup, dump)
+}
+
+// uploadDumpToDrives uploads the dump of a backup to drives at the same time
+func uploadDumpToDrives(ctx context.Context, app *application.App, drives []drive.Drive, backup *model.Backup, dump string) {
+	var wg sync.WaitGroup
+	for _, d := range drives {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			uploadDumpToDrive(ctx, app, d, backup, dump)
+		}()
+	}
+	wg.Wait()
+}
+
+// uploadDumpToDrive uploads the dump of a backup to a drive
+func uploadDumpToDrive(ctx context.Context, app *application.App, d drive.Drive, backup *model.Backup, dump string) {
+	driveFile := createDriveFile(app, d, backup)
+	if driveFile == nil {
+		return
+	}
+	file, err := uploadWithRetry(ctx, app, d, dump, driveFile)
+	if err != nil {
+		log.Printf("failed to upload dump (%s) for database (%s) to drive (%s) => %s", dump, backup.Label, d.GetLabel(), err)
+	}
+	finishDriveFile(app, driveFile, file, err)
+}
+
+// createDriveFile records a pending upload, nil when it cannot be recorded
+func createDriveFile(app *application.App, d drive.Drive, backup *model.Backup) *model.DriveFile {
+	driveFileId, err := app.Db.DriveFile.Create(model.DriveFile{
+		BackupId: backup.Id,
+		Status:   model.DRIVE_FILE_STATUS_PENDING,
+		Label:    d.GetLabel(),
+		Provider: d.GetProvider(),
+	})
+	if err != nil {
+		log.Printf("failed to create drive (%s) for database (%s) => %s", d.GetLabel(), backup.Label, err)
+		return nil
+	}
+
+	driveFile, err := app.Db.DriveFile.ReadOrError(driveFileId)
+	if err != nil {
+		log.Printf("failed to read drive file (%s) => %s", driveFileId, err)
+		return nil
+	}
+	return driveFile
+}
+
+// finishDriveFile records the result of the upload of a drive file
+func finishDriveFile(app *application.App, driveFile *model.DriveFile, file drive.DriveFile, uploadErr error) {
+	if uploadErr != nil {
+		driveFile.Status = model.DRIVE_FILE_STATUS_FAILED
+		_, err := app.Db.DriveFile.Update(driveFile.Id, *driveFile)
+		if err != nil {
+			log.Printf("failed to update drive file (%s) status to failed => %s", driveFile.Id, err)
+		}
+		return
+	}
+
+	driveFile.Status = model.DRIVE_FILE_STATUS_FINISHED
+	driveFile.Path = file.Path
+	driveFile.Parts = file.Parts
+	_, err := app.Db.DriveFile.Update(driveFile.Id, *driveFile)
+	if err != nil {
+		log.Printf("failed to update drive file (%s) status to finished => %s", driveFile.Id, err)
+	}
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/model"
+)
+
+var ErrBackupNotRunning = errors.New("backup is not running")
+
+// CancelBackup aborts a backup running in the application: its dump or its
+// uploads are stopped and the backup is marked cancelled. ErrBackupNotRunning
+// is returned when the backup exists but is not running.
+func CancelBackup(app *application.App, backupId string) error {
+	_, err := app.Db.Backup.ReadOrError(backupId)
+	if err != nil {
+		return fmt.Errorf("failed to read backup => %s", err)
+	}
+	if !app.Running.Cancel(backupId) {
+		return ErrBackupNotRunning
+	}
+	log.Printf("backup (%s) cancelled", backupId)
+	return nil
+}
+
+// cancelBackup records a backup whose context was done before it finished
+func cancelBackup(app *application.App, backup *model.Backup) {
+	backup.Status = model.BACKUP_STATUS_CANCELLED
+	backup.Error = "backup cancelled"
+	_, err := app.Db.Backup.Update(backup.Id, *backup)
+	if err != nil {
+		log.Printf("failed to update backup (%s) status to cancelled => %s", backup.Id, err)
+	}
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/model"
+)
+
+// BackupIncremental captures the changes made on the data sources having
+// incremental backups enabled since their last backup, or only on the given
+// data sources. A data source is skipped until it has a full backup to
+// continue, or when nothing changed since its last backup. The backup still
+// running when ctx is done is cancelled.
+func BackupIncremental(ctx context.Context, app *application.App, labels ...string) ([]string, error) {
+	backupIds := make([]string, 0)
+	for _, d := range app.Dumpers {
+		incremental, ok := d.(dumper.IncrementalDumper)
+		if !ok || !incremental.IsIncremental() {
+			continue
+		}
+		if len(labels) > 0 && !slices.Contains(labels, d.GetLabel()) {
+			continue
+		}
+		backupId, err := backupIncremental(ctx, app, incremental)
+		if backupId != "" {
+			backupIds = append(backupIds, backupId)
+		}
+		if err != nil {
+			return backupIds, err
+		}
+	}
+	return backupIds, nil
+}
+
+func backupIncremental(ctx context.Context, app *application.App, d dumper.IncrementalDumper) (string, error) {
+	parent, last, err := lastChainBackup(app, d.GetLabel())
+	if err != nil {
+		return "", err
+	}
+	if parent == nil {
+		log.Printf("no full backup to continue for data source (%s), incremental backup skipped", d.GetLabel())
+		return "", nil
+	}
+
+	backup := model.Backup{
+		Label:    d.GetLabel(),
+		Status:   model.BACKUP_STATUS_PENDING,
+		Kind:     model.BACKUP_KIND_INCREMENTAL,
+		ParentId: parent.Id,
+	}
+
+	current, err := d.CurrentPosition()
+	if err == nil && current == last.Position {
+		log.Printf("no change on data source (%s) since backup (%s), incremental backup skipped", d.GetLabel(), last.Id)
+		return "", nil
+	}
+	if err != nil {
+		log.Printf("failed to read position of data source (%s) => %s", d.GetLabel(), err)
+		backup.Status = model.BACKUP_STATUS_FAILED
+		backup.Error = err.Error()
+	}
+
+	backupId, err := app.Db.Backup.Create(backup)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup => %s", err)
+	}
+	if backup.Status == model.BACKUP_STATUS_FAILED {
+		return backupId, nil
+	}
+	ctx, done := app.Running.Start(ctx, backupId)
+	defer done()
+
+	created, err := app.Db.Backup.ReadOrError(backupId)
+	if err != nil {
+		return backupId, fmt.Errorf("failed to read backup => %s", err)
+	}
+
+	var dump, position string
+	err = app.Limiter.AcquireDump(ctx)
+	if err == nil {
+		dump, err = dumpWithTimeout(ctx, app.DataSourceOptions[d.GetLabel()].DumpTimeout, func(ctx context.Context) (string, error) {
+			dump, dumpPosition, err := d.DumpIncremental(ctx, last.Position)
+			position = dumpPosition
+			return dump, err
+		})
+		app.Limiter.ReleaseDump()
+	}
+	if err != nil && ctx.Err() != nil {
+		cancelBackup(app, created)
+		return backupId, nil
+	}
+	if err != nil {
+		log.Printf("failed to dump changes of database (%s) => %s", d.GetLabel(), err)
+		created.Status = model.BACKUP_STATUS_FAILED
+		created.Error = err.Error()
+		_, err := app.Db.Backup.Update(created.Id, *created)
+		if err != nil {
+			log.Printf("failed to update backup (%s) status to failed => %s", created.Id, err)
+		}
+		return backupId, nil
+	}
+
+	created.DumpPath = dump
+	created.Position = position
+	_, err = app.Db.Backup.Update(created.Id, *created)
+	if err != nil {
+		log.Printf("failed to update backup (%s) with dump path (%s): %s", created.Id, dump, err)
+		return backupId, nil
+	}
+
+	uploadDump(ctx, app, d.GetLabel(), created, dump)
+	if ctx.Err() != nil {
+		cancelBackup(app, created)
+	}
+
+	// The report of a cancelled backup is still sent
+	err = AfterBackup(context.WithoutCancel(ctx), app, backupId)
+	if err != nil {
+		log.Printf("failed to execute after backup tasks for backup (%s) => %s", backupId, err)
+	}
+
+	return backupId, nil
+}
+
+// lastChainBackup returns the latest full backup starting a chain, with the last backup of its chain
+func lastChainBackup(app *application.App, label string) (*model.BackupFull, *model.BackupFull, error) {
+	backups, err := app.Db.Backup.ReadAllFull()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read backups => %s", err)
+	}
+
+	var parent *model.BackupFull
+	for i, backup := range backups {
+		if backup.Label != label || backup.Kind != model.BACKUP_KIND_FULL || backup.Position == "" || backup.Status != model.BACKUP_STATUS_FINISHED {
+			continue
+		}
+		if parent == nil || backup.CreatedAt.After(parent.CreatedAt) {
+			parent = &backups[i]
+		}
+	}
+	if parent == nil {
+		return nil, nil, nil
+	}
+
+	chain := incrementalChain(backups, parent.Id)
+	if len(chain) == 0 {
+		return parent, parent, nil
+	}
+	return parent, chain[len(chain)-1], nil
+}
+
+// incrementalChain returns the finished incremental backups of a full backup, oldest first
+func incrementalChain(backups []model.BackupFull, parentId string) []*model.BackupFull {
+	chain := make([]*model.BackupFull, 0)
+	for i, backup := range backups {
+		if backup.Kind == model.BACKUP_KIND_INCREMENTAL && backup.ParentId == parentId && backup.Status == model.BACKUP_STATUS_FINISHED {
+			chain = append(chain, &backups[i])
+		}
+	}
+	slices.SortStableFunc(chain, func(a, b *model.BackupFull) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return chain
+}
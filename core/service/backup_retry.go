@@ -1,61 +1,280 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/herytz/backupman/core/application"
 	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
 	"github.com/herytz/backupman/core/model"
 )
 
-func BackupRetry(app *application.App, backupId string) error {
+// BackupRetry retries a failed backup and returns the ID of the backup holding
+// the retry. The failed uploads of a backup whose dump is present are uploaded
+// again. A backup whose dump step failed is dumped again by the dumper of its
+// data source, the new backup being linked to the failed one.
+func BackupRetry(ctx context.Context, app *application.App, backupId string) (string, error) {
 	backup, err := app.Db.Backup.ReadFullById(backupId)
 	if err != nil {
-		return fmt.Errorf("failed to read backup => %s", err)
+		return "", fmt.Errorf("failed to read backup => %s", err)
+	}
+	if backup.Status != model.BACKUP_STATUS_FAILED {
+		return "", fmt.Errorf("backup status is not failed")
 	}
 	if backup.DumpPath == "" {
-		return fmt.Errorf("backup dump path is empty")
+		return redumpBackup(ctx, app, backup)
 	}
-	if backup.Status != model.BACKUP_STATUS_FAILED {
-		return fmt.Errorf("backup status is not failed")
+
+	retryDriveFiles(ctx, app, backup, 0)
+
+	err = AfterBackup(ctx, app, backupId)
+	if err != nil {
+		return backupId, fmt.Errorf("failed to execute after backup actions => %s", err)
 	}
 
-	for _, driveFile := range backup.DriveFiles {
-		if driveFile.Status != model.DRIVE_FILE_STATUS_FAILED {
-			continue
-		}
+	return backupId, nil
+}
 
-		uploadResult, err := upload(app, backup.DumpPath, driveFile)
-		if err != nil {
-			log.Printf("failed to upload dump (%s) for database (%s) to drive (%s) => %s", backup.DumpPath, backup.Label, driveFile.Provider, err)
+// redumpBackup runs a new backup of the database of a backup whose dump step failed
+func redumpBackup(ctx context.Context, app *application.App, backup *model.BackupFull) (string, error) {
+	if backup.Kind != model.BACKUP_KIND_FULL {
+		return "", fmt.Errorf("backup (%s) of kind (%s) cannot be dumped again", backup.Id, backup.Kind)
+	}
+	retry, err := app.Db.Backup.ReadRetryOf(backup.Id)
+	if err != nil {
+		return "", fmt.Errorf("failed to read retry of backup => %s", err)
+	}
+	if retry != nil {
+		return "", fmt.Errorf("backup (%s) is already dumped again by backup (%s)", backup.Id, retry.Id)
+	}
 
-			driveFile.Status = model.DRIVE_FILE_STATUS_FAILED
-			_, err := app.Db.DriveFile.Update(driveFile.Id, *driveFile)
-			if err != nil {
-				log.Printf("failed to update drive file (%s) status to failed => %s", driveFile.Id, err)
+	dataSourceLabel, d, err := findBackupDumper(app, backup.Label)
+	if err != nil {
+		return "", err
+	}
+	if d.GetLabel() != dataSourceLabel {
+		defer closeDumper(d)
+	}
+
+	newBackupId, err := backupDumper(ctx, app, "", dataSourceLabel, d, backup.Id)
+	if err != nil {
+		return newBackupId, err
+	}
+	log.Printf("backup (%s) dumped again by backup (%s)", backup.Id, newBackupId)
+	return newBackupId, nil
+}
+
+// findBackupDumper returns the data source label and the dumper of the backups labelled label
+func findBackupDumper(app *application.App, label string) (string, dumper.Dumper, error) {
+	for _, dataSource := range app.Dumpers {
+		_, isDiscoverer := dataSource.(dumper.Discoverer)
+		if dataSource.GetLabel() == label {
+			if isDiscoverer {
+				return "", nil, fmt.Errorf("backups of data source (%s) failed to discover its databases, run a new backup instead", label)
 			}
+			return label, dataSource, nil
+		}
+		if !isDiscoverer || !strings.HasPrefix(label, dataSource.GetLabel()+"/") {
 			continue
 		}
 
-		driveFile.Status = model.DRIVE_FILE_STATUS_FINISHED
-		driveFile.Path = uploadResult.Path
-		_, err = app.Db.DriveFile.Update(driveFile.Id, *driveFile)
+		dumpers, err := discoverDumpers(dataSource)
 		if err != nil {
-			log.Printf("failed to update drive file (%s) status to finished => %s", driveFile.Id, err)
+			return "", nil, fmt.Errorf("failed to discover databases of data source (%s) => %s", dataSource.GetLabel(), err)
+		}
+		var found dumper.Dumper
+		for _, d := range dumpers {
+			if found == nil && d.GetLabel() == label {
+				found = d
+				continue
+			}
+			closeDumper(d)
+		}
+		if found == nil {
+			return "", nil, fmt.Errorf("database of backup (%s) not found in data source (%s)", label, dataSource.GetLabel())
+		}
+		return dataSource.GetLabel(), found, nil
+	}
+	return "", nil, fmt.Errorf("data source of backup (%s) not found", label)
+}
+
+const DEFAULT_RETRY_CONCURRENCY = 4
+const MAX_RETRY_CONCURRENCY = 16
+
+type BackupRetryAllInput struct {
+	// Only retry the backups created within this duration, zero meaning no limit
+	Since time.Duration
+	// Only retry the backups of this data source
+	DataSource string
+	// Number of backups retried at the same time, DEFAULT_RETRY_CONCURRENCY
+	// when zero and at most MAX_RETRY_CONCURRENCY
+	Concurrency int
+}
+
+type BackupRetryResult struct {
+	BackupId string
+	Label    string
+	// ID of the new backup when the failed backup is dumped again
+	NewBackupId string
+	// Status of the backup after the retry
+	Status string
+	Error  string
+}
+
+type BackupRetryAllOutput struct {
+	Results []BackupRetryResult
+}
+
+// BackupRetryAllFailed retries the failed backups whose dump is still present
+// and dumps again the backups whose dump step failed, several backups being
+// retried at the same time. The result of each backup is returned, a backup
+// which cannot be retried does not stop the others.
+func BackupRetryAllFailed(ctx context.Context, app *application.App, input BackupRetryAllInput) (BackupRetryAllOutput, error) {
+	output, err := FailedBackupsToRetry(app, input)
+	if err != nil {
+		return output, err
+	}
+	RetryBackups(ctx, app, output, input.Concurrency)
+	return output, nil
+}
+
+// FailedBackupsToRetry returns the backups retried by BackupRetryAllFailed,
+// their results being filled by RetryBackups
+func FailedBackupsToRetry(app *application.App, input BackupRetryAllInput) (BackupRetryAllOutput, error) {
+	output := BackupRetryAllOutput{
+		Results: make([]BackupRetryResult, 0),
+	}
+	if input.Since < 0 {
+		return output, fmt.Errorf("since cannot be negative")
+	}
+	backups, err := app.Db.Backup.ReadByStatus(model.BACKUP_STATUS_FAILED)
+	if err != nil {
+		return output, fmt.Errorf("failed to read failed backups => %s", err)
+	}
+
+	minCreatedAt := time.Now().Add(-input.Since)
+	for _, backup := range backups {
+		if input.Since > 0 && backup.CreatedAt.Before(minCreatedAt) {
 			continue
 		}
+		// The backups of the databases of a server are labelled <label>/<database>
+		if input.DataSource != "" && backup.Label != input.DataSource && !strings.HasPrefix(backup.Label, input.DataSource+"/") {
+			continue
+		}
+		if backup.DumpPath == "" {
+			// Only the backups whose dump step failed can be dumped again
+			if backup.Kind != model.BACKUP_KIND_FULL || !isRedumpable(app, backup.Label) {
+				continue
+			}
+			// A failed backup is dumped again once
+			retry, err := app.Db.Backup.ReadRetryOf(backup.Id)
+			if err != nil {
+				return output, fmt.Errorf("failed to read retry of backup (%s) => %s", backup.Id, err)
+			}
+			if retry != nil {
+				continue
+			}
+		} else {
+			_, err := os.Stat(backup.DumpPath)
+			if err != nil {
+				continue
+			}
+		}
+		output.Results = append(output.Results, BackupRetryResult{
+			BackupId: backup.Id,
+			Label:    backup.Label,
+		})
+	}
+	return output, nil
+}
+
+// RetryBackups retries the backups of output, concurrency at the same time
+func RetryBackups(ctx context.Context, app *application.App, output BackupRetryAllOutput, concurrency int) {
+	if concurrency <= 0 {
+		concurrency = DEFAULT_RETRY_CONCURRENCY
+	}
+	concurrency = min(concurrency, MAX_RETRY_CONCURRENCY)
+	jobs := make(chan *BackupRetryResult)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for result := range jobs {
+				retryBackupResult(ctx, app, result)
+			}
+		}()
+	}
+	for i := range output.Results {
+		jobs <- &output.Results[i]
 	}
+	close(jobs)
+	wg.Wait()
+}
 
-	err = AfterBackup(app, backupId)
+func retryBackupResult(ctx context.Context, app *application.App, result *BackupRetryResult) {
+	retryId, err := BackupRetry(ctx, app, result.BackupId)
+	if err != nil {
+		log.Printf("failed to retry backup (%s) => %s", result.BackupId, err)
+		result.Error = err.Error()
+	}
+	if retryId == "" {
+		retryId = result.BackupId
+	}
+	if retryId != result.BackupId {
+		result.NewBackupId = retryId
+	}
+	backup, err := app.Db.Backup.ReadOrError(retryId)
 	if err != nil {
-		return fmt.Errorf("failed to execute after backup actions => %s", err)
+		if result.Error == "" {
+			result.Error = err.Error()
+		}
+		return
 	}
+	result.Status = backup.Status
+}
 
-	return nil
+// isRedumpable tells whether the backups labelled label can be dumped again
+func isRedumpable(app *application.App, label string) bool {
+	for _, dataSource := range app.Dumpers {
+		_, isDiscoverer := dataSource.(dumper.Discoverer)
+		if dataSource.GetLabel() == label {
+			return !isDiscoverer
+		}
+		if isDiscoverer && strings.HasPrefix(label, dataSource.GetLabel()+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDriveFiles uploads the dump of a backup again to the drives of its failed drive files
+func retryDriveFiles(ctx context.Context, app *application.App, backup *model.BackupFull, maxAttempts int) {
+	ctx, done := app.Running.Start(ctx, backup.Id)
+	defer done()
+	for _, driveFile := range backup.DriveFiles {
+		if ctx.Err() != nil {
+			return
+		}
+		if !isRetryable(driveFile, maxAttempts) {
+			continue
+		}
+
+		uploadResult, err := upload(ctx, app, backup.DumpPath, driveFile)
+		if err != nil {
+			log.Printf("failed to upload dump (%s) for database (%s) to drive (%s) => %s", backup.DumpPath, backup.Label, driveFile.Provider, err)
+		}
+		finishDriveFile(app, driveFile, uploadResult, err)
+	}
 }
 
-func upload(app *application.App, dumpPath string, driveFile *model.DriveFile) (drive.DriveFile, error) {
+func upload(ctx context.Context, app *application.App, dumpPath string, driveFile *model.DriveFile) (drive.DriveFile, error) {
 	var uploadResult drive.DriveFile
 
 	driveFile.Status = model.DRIVE_FILE_STATUS_PENDING
@@ -64,12 +283,12 @@ func upload(app *application.App, dumpPath string, driveFile *model.DriveFile) (
 		return uploadResult, fmt.Errorf("failed to update drive file (%s) status to pending => %s", driveFile.Id, err)
 	}
 
-	drive, err := GetDrive(app, driveFile.Provider)
+	drive, err := GetDrive(app, driveFile.Label, driveFile.Provider)
 	if err != nil {
-		return uploadResult, fmt.Errorf("failed to get drive (%s) => %s", driveFile.Provider, err)
+		return uploadResult, fmt.Errorf("failed to get drive (%s) => %s", driveFile.Label, err)
 	}
 
-	uploadResult, err = drive.Upload(dumpPath)
+	uploadResult, err = uploadWithRetry(ctx, app, drive, dumpPath, driveFile)
 	if err != nil {
 		return uploadResult, fmt.Errorf("failed to upload dump (%s) => %s", dumpPath, err)
 	}
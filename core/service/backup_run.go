@@ -0,0 +1,105 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/model"
+)
+
+// StartBackupRun records a new run of the backups started by trigger, one of
+// the RUN_TRIGGER_* of the model package. apiKey is the key of the HTTP request
+// starting an API run, only its fingerprint is stored.
+func StartBackupRun(app *application.App, trigger, apiKey string) (string, error) {
+	run := model.BackupRun{
+		Trigger:   trigger,
+		Status:    model.RUN_STATUS_RUNNING,
+		StartedAt: time.Now(),
+	}
+	if apiKey != "" {
+		run.ApiKey = ApiKeyFingerprint(apiKey)
+	}
+	runId, err := app.Db.BackupRun.Create(run)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup run => %s", err)
+	}
+	return runId, nil
+}
+
+// ApiKeyFingerprint identifies an API key without storing it: the first 8
+// hexadecimal characters of its SHA-256
+func ApiKeyFingerprint(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+// endBackupRun records the end of a run with the status of its backups
+func endBackupRun(app *application.App, runId string, backupIds []string, backupErr error) {
+	run, err := app.Db.BackupRun.ReadOrError(runId)
+	if err != nil {
+		log.Printf("failed to read backup run (%s) => %s", runId, err)
+		return
+	}
+
+	run.Status = model.RUN_STATUS_FINISHED
+	if backupErr != nil {
+		run.Status = model.RUN_STATUS_FAILED
+	}
+	for _, backupId := range backupIds {
+		if run.Status == model.RUN_STATUS_FAILED {
+			break
+		}
+		backup, err := app.Db.Backup.ReadOrError(backupId)
+		if err != nil {
+			log.Printf("failed to read backup (%s) of run (%s) => %s", backupId, runId, err)
+			run.Status = model.RUN_STATUS_FAILED
+			break
+		}
+		if backup.Status == model.BACKUP_STATUS_CANCELLED {
+			run.Status = model.RUN_STATUS_CANCELLED
+			continue
+		}
+		if backup.Status != model.BACKUP_STATUS_FINISHED {
+			run.Status = model.RUN_STATUS_FAILED
+			break
+		}
+	}
+	run.EndedAt = time.Now()
+	_, err = app.Db.BackupRun.Update(runId, *run)
+	if err != nil {
+		log.Printf("failed to update backup run (%s) status to %s => %s", runId, run.Status, err)
+	}
+}
+
+// GetBackupRun returns a run with its backups, oldest first, to follow its
+// progress
+func GetBackupRun(app *application.App, runId string) (*model.BackupRunFull, error) {
+	run, err := app.Db.BackupRun.ReadOrError(runId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup run => %s", err)
+	}
+	backups, err := app.Db.Backup.ReadByRunId(runId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backups of run => %s", err)
+	}
+
+	runFull := &model.BackupRunFull{
+		Id:        run.Id,
+		Trigger:   run.Trigger,
+		ApiKey:    run.ApiKey,
+		Status:    run.Status,
+		StartedAt: run.StartedAt,
+		EndedAt:   run.EndedAt,
+		Backups:   make([]model.BackupFull, 0),
+	}
+	runFull.Backups = append(runFull.Backups, backups...)
+	slices.SortStableFunc(runFull.Backups, func(a, b model.BackupFull) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return runFull, nil
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/lib"
+	"github.com/herytz/backupman/core/model"
+)
+
+// streamUpload is the upload of a dump to a drive while the dump is written
+type streamUpload struct {
+	drive     drive.Drive
+	driveFile *model.DriveFile
+	pipe      *io.PipeWriter
+	file      drive.DriveFile
+	err       error
+	done      chan struct{}
+}
+
+// dumpFunc returns the dump of a backup and the drives uploading the dump once written
+func dumpFunc(app *application.App, dataSourceLabel string, d dumper.Dumper, backup *model.Backup) (func(ctx context.Context) (string, error), []drive.Drive) {
+	drives := GetDataSourceDrives(app, dataSourceLabel)
+	streamer, ok := d.(dumper.StreamDumper)
+	if !ok || !app.DataSourceOptions[dataSourceLabel].Streaming {
+		return d.Dump, drives
+	}
+
+	streamed := make([]drive.Drive, 0)
+	fromFile := make([]drive.Drive, 0)
+	for _, dr := range drives {
+		_, ok := dr.(drive.StreamUploader)
+		if ok && app.DriveOptions[dr.GetLabel()].Retry.Attempts <= 1 {
+			streamed = append(streamed, dr)
+		} else {
+			fromFile = append(fromFile, dr)
+		}
+	}
+	if len(streamed) == 0 {
+		return d.Dump, drives
+	}
+	return func(ctx context.Context) (string, error) {
+		return streamDump(ctx, app, streamer, backup, streamed, len(fromFile) > 0)
+	}, fromFile
+}
+
+// streamDump writes a dump to the streaming drives and, when keepFile is true, to a temporary file
+func streamDump(ctx context.Context, app *application.App, d dumper.StreamDumper, backup *model.Backup, drives []drive.Drive, keepFile bool) (string, error) {
+	dumpPath := d.NewDumpPath()
+	writers := make([]io.Writer, 0)
+	var file *os.File
+	if keepFile {
+		var err error
+		file, err = os.Create(dumpPath)
+		if err != nil {
+			return "", fmt.Errorf("cannot create dump file (%s) => %s", dumpPath, err)
+		}
+		defer file.Close()
+		writers = append(writers, file)
+	}
+
+	driveFiles := make(map[string]*model.DriveFile)
+	labels := make([]string, 0)
+	for _, dr := range drives {
+		driveFile := createDriveFile(app, dr, backup)
+		if driveFile != nil {
+			driveFiles[dr.GetLabel()] = driveFile
+			labels = append(labels, dr.GetLabel())
+		}
+	}
+	// The dump is written to every upload, so they all start at once
+	err := app.Limiter.AcquireStream(ctx, labels)
+	if err != nil {
+		for _, driveFile := range driveFiles {
+			finishDriveFile(app, driveFile, drive.DriveFile{}, err)
+		}
+		if file != nil {
+			file.Close()
+			os.Remove(dumpPath)
+		}
+		return "", err
+	}
+	defer app.Limiter.ReleaseStream(labels)
+
+	uploads := make([]*streamUpload, 0)
+	for _, dr := range drives {
+		driveFile, ok := driveFiles[dr.GetLabel()]
+		if !ok {
+			continue
+		}
+		upload := startStreamUpload(ctx, app, dr, driveFile, dumpPath)
+		uploads = append(uploads, upload)
+		writers = append(writers, upload.pipe)
+	}
+
+	if len(writers) == 0 {
+		err = fmt.Errorf("no drive to stream the dump to")
+	} else {
+		fanOut := lib.NewFanOutWriter(writers...)
+		err = d.DumpTo(ctx, dumpPath, fanOut)
+		// The other drives upload the whole temporary file or nothing
+		if err == nil && file != nil && fanOut.Err(0) != nil {
+			err = fmt.Errorf("failed to write dump file (%s) => %s", dumpPath, fanOut.Err(0))
+		}
+	}
+	if err == nil && file != nil {
+		err = file.Sync()
+	}
+	for _, upload := range uploads {
+		// The uploads of a failed dump fail instead of completing
+		upload.pipe.CloseWithError(err)
+	}
+	for _, upload := range uploads {
+		<-upload.done
+		if upload.err != nil {
+			log.Printf("failed to stream dump (%s) for database (%s) to drive (%s) => %s", dumpPath, backup.Label, upload.drive.GetLabel(), upload.err)
+		}
+		finishDriveFile(app, upload.driveFile, upload.file, upload.err)
+	}
+
+	if err != nil {
+		if file != nil {
+			file.Close()
+			os.Remove(dumpPath)
+		}
+		return "", err
+	}
+	SetBackupDumpStats(d, backup, dumpPath)
+	SetBackupPosition(d, backup, dumpPath)
+	if file == nil {
+		return "", nil
+	}
+	return dumpPath, nil
+}
+
+// startStreamUpload starts the upload of a dump to a drive, read from the returned pipe
+func startStreamUpload(ctx context.Context, app *application.App, d drive.Drive, driveFile *model.DriveFile, dumpPath string) *streamUpload {
+	driveFile.Attempts++
+
+	reader, writer := io.Pipe()
+	upload := &streamUpload{
+		drive:     d,
+		driveFile: driveFile,
+		pipe:      writer,
+		done:      make(chan struct{}),
+	}
+	go func() {
+		defer close(upload.done)
+		uploader := d.(drive.StreamUploader)
+		upload.file, upload.err = uploadStreamWithTimeout(ctx, app.DriveOptions[d.GetLabel()].UploadTimeout, uploader, dumpPath, reader)
+		// The dump is no longer written to an upload which stopped reading
+		reader.CloseWithError(upload.err)
+	}()
+	return upload
+}
+
+// uploadStreamWithTimeout runs a streamed upload aborted after timeout
+func uploadStreamWithTimeout(ctx context.Context, timeout time.Duration, d drive.StreamUploader, name string, src io.Reader) (drive.DriveFile, error) {
+	if timeout <= 0 {
+		return d.UploadStream(ctx, name, src)
+	}
+	uploadCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	file, err := d.UploadStream(uploadCtx, name, src)
+	if err != nil && ctx.Err() == nil && uploadCtx.Err() != nil {
+		return file, fmt.Errorf("upload timed out after %s => %s", timeout, err)
+	}
+	return file, err
+}
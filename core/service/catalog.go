@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/model"
+)
+
+const CATALOG_VERSION = 1
+
+// Suffix of the names of the catalog entries stored on the drives
+const CATALOG_ENTRY_SUFFIX = ".backupman.json"
+
+const (
+	CATALOG_REBUILD_STATUS_CREATED = "created"
+	// The drive file was already recorded
+	CATALOG_REBUILD_STATUS_SKIPPED = "skipped"
+	CATALOG_REBUILD_STATUS_FAILED  = "failed"
+)
+
+// CatalogEntry describes a finished drive file and its backup. It is stored
+// on the drive of the file, so the records can be rebuilt from the drive when
+// the database is lost. The status of the backup is the one it had when the
+// entry was written, the rebuilt backups getting theirs from their drive files.
+type CatalogEntry struct {
+	Version   int
+	Backup    model.Backup
+	DriveFile model.DriveFile
+}
+
+type CatalogRebuildResult struct {
+	// Path of the catalog entry on the drive
+	Path        string
+	BackupId    string
+	DriveFileId string
+	Status      string
+	Error       string
+}
+
+type CatalogRebuildOutput struct {
+	Results []CatalogRebuildResult
+}
+
+// writeCatalog stores the missing catalog entries of the finished drive files of a backup
+func writeCatalog(ctx context.Context, app *application.App, backupId string) {
+	backup, err := app.Db.Backup.ReadFullById(backupId)
+	if err != nil || backup == nil {
+		log.Printf("failed to read backup (%s) to write its catalog entries => %v", backupId, err)
+		return
+	}
+	for _, driveFile := range backup.DriveFiles {
+		if driveFile.Status != model.DRIVE_FILE_STATUS_FINISHED || driveFile.CatalogPath != "" {
+			continue
+		}
+		d, err := GetDrive(app, driveFile.Label, driveFile.Provider)
+		if err != nil {
+			continue
+		}
+		_, ok := drive.Unwrap(d).(drive.Lister)
+		if !ok {
+			continue
+		}
+		err = writeCatalogEntry(ctx, app, d, *backup, driveFile)
+		if err != nil {
+			log.Printf("failed to write catalog entry of drive file (%s) to drive (%s) => %s", driveFile.Id, d.GetLabel(), err)
+		}
+	}
+}
+
+// writeCatalogEntry uploads the catalog entry of a drive file and records its path
+func writeCatalogEntry(ctx context.Context, app *application.App, d drive.Drive, backup model.BackupFull, driveFile *model.DriveFile) error {
+	entry := CatalogEntry{
+		Version: CATALOG_VERSION,
+		// The dump path is only meaningful on the host which made the dump
+		Backup: model.Backup{
+			Id:        backup.Id,
+			Label:     backup.Label,
+			Status:    backup.Status,
+			Error:     backup.Error,
+			FileCount: backup.FileCount,
+			TotalSize: backup.TotalSize,
+			Kind:      backup.Kind,
+			ParentId:  backup.ParentId,
+			Position:  backup.Position,
+			RetryOfId: backup.RetryOfId,
+			RunId:     backup.RunId,
+			CreatedAt: backup.CreatedAt,
+		},
+		DriveFile: *driveFile,
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode catalog entry => %s", err)
+	}
+	tmpFolder, err := os.MkdirTemp("", "backupman-catalog-*")
+	if err != nil {
+		return fmt.Errorf("failed to create catalog folder => %s", err)
+	}
+	defer os.RemoveAll(tmpFolder)
+	entryPath := filepath.Join(tmpFolder, driveFile.Id+CATALOG_ENTRY_SUFFIX)
+	err = os.WriteFile(entryPath, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write catalog entry %s => %s", entryPath, err)
+	}
+
+	file, err := drive.Unwrap(d).Upload(ctx, entryPath)
+	if err != nil {
+		return fmt.Errorf("failed to upload catalog entry => %s", err)
+	}
+	driveFile.CatalogPath = file.Path
+	_, err = app.Db.DriveFile.Update(driveFile.Id, *driveFile)
+	if err != nil {
+		return fmt.Errorf("failed to record catalog entry (%s) => %s", file.Path, err)
+	}
+	return nil
+}
+
+// deleteCatalogEntry deletes the catalog entry of a drive file, if any
+func deleteCatalogEntry(ctx context.Context, d drive.Drive, driveFile *model.DriveFile) error {
+	if driveFile.CatalogPath == "" {
+		return nil
+	}
+	err := drive.Unwrap(d).Delete(ctx, driveFile.CatalogPath)
+	if err != nil {
+		return fmt.Errorf("failed to delete catalog entry (%s) of drive file (%s) => %s", driveFile.CatalogPath, driveFile.Id, err)
+	}
+	return nil
+}
+
+// RebuildCatalog recreates the backups and drive files described by the
+// catalog entries of a drive, after the database was lost. They keep their ids
+// and creation dates, so the incremental backups stay chained and the
+// retention applies to them. The drive files already recorded are skipped.
+func RebuildCatalog(ctx context.Context, app *application.App, label string) (CatalogRebuildOutput, error) {
+	output := CatalogRebuildOutput{
+		Results: make([]CatalogRebuildResult, 0),
+	}
+	d, err := findDrive(app, label)
+	if err != nil {
+		return output, err
+	}
+	lister, ok := d.(drive.Lister)
+	if !ok {
+		return output, fmt.Errorf("drive (%s) cannot list its files", label)
+	}
+	downloader, ok := d.(drive.Downloader)
+	if !ok {
+		return output, fmt.Errorf("drive (%s) does not support download", label)
+	}
+	files, err := lister.List(ctx)
+	if err != nil {
+		return output, fmt.Errorf("failed to list files of drive (%s) => %s", label, err)
+	}
+
+	backups, err := app.Db.Backup.ReadAllFull()
+	if err != nil {
+		return output, fmt.Errorf("failed to read backups => %s", err)
+	}
+	backupIds := make(map[string]bool)
+	driveFileIds := make(map[string]bool)
+	for _, backup := range backups {
+		backupIds[backup.Id] = true
+		for _, driveFile := range backup.DriveFiles {
+			driveFileIds[driveFile.Id] = true
+		}
+	}
+	tmpFolder, err := os.MkdirTemp("", "backupman-catalog-*")
+	if err != nil {
+		return output, fmt.Errorf("failed to create catalog folder => %s", err)
+	}
+	defer os.RemoveAll(tmpFolder)
+
+	for _, file := range files {
+		if !strings.HasSuffix(file.Path, CATALOG_ENTRY_SUFFIX) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return output, ctx.Err()
+		}
+		result := CatalogRebuildResult{
+			Path:   file.Path,
+			Status: CATALOG_REBUILD_STATUS_CREATED,
+		}
+		entry, err := readCatalogEntry(ctx, downloader, file.Path, filepath.Join(tmpFolder, "entry"))
+		if err == nil {
+			result.BackupId = entry.Backup.Id
+			result.DriveFileId = entry.DriveFile.Id
+			if driveFileIds[entry.DriveFile.Id] {
+				result.Status = CATALOG_REBUILD_STATUS_SKIPPED
+				output.Results = append(output.Results, result)
+				continue
+			}
+			err = importCatalogEntry(app, d, entry, file.Path, backupIds)
+		}
+		if err != nil {
+			log.Printf("failed to rebuild catalog entry (%s) of drive (%s) => %s", file.Path, label, err)
+			result.Status = CATALOG_REBUILD_STATUS_FAILED
+			result.Error = err.Error()
+		} else {
+			driveFileIds[entry.DriveFile.Id] = true
+		}
+		output.Results = append(output.Results, result)
+	}
+	return output, nil
+}
+
+func readCatalogEntry(ctx context.Context, d drive.Downloader, path, dstPath string) (CatalogEntry, error) {
+	var entry CatalogEntry
+	err := d.Download(ctx, path, dstPath)
+	if err != nil {
+		return entry, fmt.Errorf("failed to download catalog entry => %s", err)
+	}
+	defer os.Remove(dstPath)
+	data, err := os.ReadFile(dstPath)
+	if err != nil {
+		return entry, fmt.Errorf("failed to read catalog entry => %s", err)
+	}
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		return entry, fmt.Errorf("failed to decode catalog entry => %s", err)
+	}
+	if entry.Version != CATALOG_VERSION {
+		return entry, fmt.Errorf("unsupported version %d of catalog entry", entry.Version)
+	}
+	if entry.Backup.Id == "" || entry.DriveFile.Id == "" {
+		return entry, fmt.Errorf("catalog entry without backup or drive file id")
+	}
+	return entry, nil
+}
+
+// importCatalogEntry records the drive file of a catalog entry, with its backup when unknown
+func importCatalogEntry(app *application.App, d drive.Drive, entry CatalogEntry, path string, backupIds map[string]bool) error {
+	if !backupIds[entry.Backup.Id] {
+		err := app.Db.Backup.Import(entry.Backup)
+		if err != nil {
+			return fmt.Errorf("failed to import backup (%s) => %s", entry.Backup.Id, err)
+		}
+		backupIds[entry.Backup.Id] = true
+	}
+	driveFile := entry.DriveFile
+	driveFile.BackupId = entry.Backup.Id
+	// The drive may have been renamed since the upload
+	driveFile.Label = d.GetLabel()
+	driveFile.Provider = d.GetProvider()
+	driveFile.CatalogPath = path
+	err := app.Db.DriveFile.Import(driveFile)
+	if err != nil {
+		return fmt.Errorf("failed to import drive file (%s) => %s", driveFile.Id, err)
+	}
+	_, err = HandleBackupStatus(app, entry.Backup.Id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
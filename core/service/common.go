@@ -1,13 +1,16 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/herytz/backupman/core/application"
 	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
 	"github.com/herytz/backupman/core/model"
 )
 
@@ -16,20 +19,21 @@ func HandleBackupStatus(app *application.App, id string) (model.Backup, error) {
 	if err != nil {
 		return model.Backup{}, fmt.Errorf("failed to read backup full by id (%s): %s", id, err)
 	}
-	if backup.Status == model.BACKUP_STATUS_FINISHED {
-		return model.Backup{}, nil
-	}
-
 	countPending := 0
 	countFailed := 0
 	countFinished := 0
+	countMissing := 0
 
 	for _, driveFile := range backup.DriveFiles {
 		switch driveFile.Status {
 		case model.DRIVE_FILE_STATUS_PENDING:
 			countPending++
+		// The file of a missing drive file cannot be restored anymore
 		case model.DRIVE_FILE_STATUS_FAILED:
 			countFailed++
+		case model.DRIVE_FILE_STATUS_MISSING:
+			countFailed++
+			countMissing++
 		case model.DRIVE_FILE_STATUS_FINISHED:
 			countFinished++
 		default:
@@ -42,8 +46,29 @@ func HandleBackupStatus(app *application.App, id string) (model.Backup, error) {
 		Status:    backup.Status,
 		Label:     backup.Label,
 		DumpPath:  backup.DumpPath,
+		Error:     backup.Error,
+		FileCount: backup.FileCount,
+		TotalSize: backup.TotalSize,
+		Kind:      backup.Kind,
+		ParentId:  backup.ParentId,
+		Position:  backup.Position,
+		RetryOfId: backup.RetryOfId,
+		RunId:     backup.RunId,
 		CreatedAt: backup.CreatedAt,
 	}
+	// A finished backup is returned as it is, so its dump can still be removed,
+	// unless the file of one of its drive files went missing
+	if backup.Status == model.BACKUP_STATUS_FINISHED && countMissing == 0 {
+		return sampleBackup, nil
+	}
+	// A backup failed before its upload has no drive file to change it
+	if backup.Status == model.BACKUP_STATUS_FAILED && len(backup.DriveFiles) == 0 {
+		return sampleBackup, nil
+	}
+	// The status of the drive files of a cancelled backup does not change it
+	if backup.Status == model.BACKUP_STATUS_CANCELLED {
+		return sampleBackup, nil
+	}
 
 	if countPending > 0 {
 		sampleBackup.Status = model.BACKUP_STATUS_PENDING
@@ -91,45 +116,167 @@ func RemoveBackupDump(app *application.App, backup model.Backup) error {
 	return nil
 }
 
-func RemoveOldBackup(app *application.App) error {
+// RemoveOldBackup deletes the backups older than the retention. The backups
+// chained to a full backup, incremental backups and WAL segments, are needed
+// to restore it: a chain is deleted at once when all its backups are old. The
+// WAL segments of a deleted chain still needed by a newer base backup are
+// moved to its chain instead.
+func RemoveOldBackup(ctx context.Context, app *application.App) error {
 	maxAge := time.Now().AddDate(0, 0, -app.Retention.Days)
 	backups, err := app.Db.Backup.ReadOlderThan(maxAge)
 	if err != nil {
 		return fmt.Errorf("failed to read backups older than %s => %s", maxAge, err)
 	}
+	all, err := app.Db.Backup.ReadAllFull()
+	if err != nil {
+		return fmt.Errorf("failed to read backups => %s", err)
+	}
 
+	old := make(map[string]bool)
 	for _, backup := range backups {
-		for _, driveFile := range backup.DriveFiles {
-			var drive drive.Drive
-			for _, d := range app.Drives {
-				if d.GetProvider() == driveFile.Provider {
-					drive = d
-					break
-				}
-			}
-			if drive == nil {
-				return fmt.Errorf("drive not found for provider %s", driveFile.Provider)
+		old[backup.Id] = true
+	}
+	exists := make(map[string]bool)
+	for _, backup := range all {
+		exists[backup.Id] = true
+	}
+
+	for _, backup := range backups {
+		if backup.ParentId != "" && exists[backup.ParentId] {
+			continue
+		}
+
+		members := make([]model.BackupFull, 0)
+		for _, member := range all {
+			if member.ParentId == backup.Id {
+				members = append(members, member)
 			}
-			err := drive.Delete(driveFile.Path)
-			if err != nil {
-				return fmt.Errorf("failed to delete drive file (%s) => %s", driveFile.Path, err)
+		}
+		kept := slices.ContainsFunc(members, func(member model.BackupFull) bool {
+			return !old[member.Id]
+		})
+		if kept {
+			continue
+		}
+
+		for _, member := range members {
+			base := newerBaseBackup(all, old, backup, member)
+			if base != nil {
+				moved, err := app.Db.Backup.ReadOrError(member.Id)
+				if err != nil {
+					return fmt.Errorf("failed to read backup (%s) => %s", member.Id, err)
+				}
+				moved.ParentId = base.Id
+				_, err = app.Db.Backup.Update(moved.Id, *moved)
+				if err != nil {
+					return fmt.Errorf("failed to move backup (%s) to the chain of backup (%s) => %s", member.Id, base.Id, err)
+				}
+				continue
 			}
-			err = app.Db.DriveFile.Delete(driveFile.Id)
+			err := deleteBackup(ctx, app, member)
 			if err != nil {
-				return fmt.Errorf("failed to delete drive file (%s) => %s", driveFile.Id, err)
+				return err
 			}
 		}
+		err := deleteBackup(ctx, app, backup)
+		if err != nil {
+			return err
+		}
+	}
 
-		err := app.Db.Backup.Delete(backup.Id)
+	collectGarbage(ctx, app)
+	return nil
+}
+
+// collectGarbage deletes the data left on the drives by the deleted backups
+func collectGarbage(ctx context.Context, app *application.App) {
+	for _, d := range app.Drives {
+		collector, ok := d.(drive.GarbageCollector)
+		if !ok {
+			continue
+		}
+		deleted, err := collector.CollectGarbage(ctx)
 		if err != nil {
-			return fmt.Errorf("failed to delete backup (%s) => %s", backup.Id, err)
+			log.Printf("failed to collect garbage of drive (%s) => %s", d.GetLabel(), err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("%d unreferenced chunks deleted from drive (%s)", deleted, d.GetLabel())
 		}
 	}
+}
 
+// newerBaseBackup returns the latest kept base backup a WAL segment of full is replayed on
+func newerBaseBackup(all []model.BackupFull, old map[string]bool, full, member model.BackupFull) *model.BackupFull {
+	if member.Kind != model.BACKUP_KIND_WAL {
+		return nil
+	}
+	var base *model.BackupFull
+	for i, backup := range all {
+		if backup.Label != full.Label || backup.Kind != model.BACKUP_KIND_FULL || backup.Status != model.BACKUP_STATUS_FINISHED || old[backup.Id] {
+			continue
+		}
+		if backup.Position == "" || backup.Position > member.Position || !backup.CreatedAt.After(full.CreatedAt) {
+			continue
+		}
+		if base == nil || backup.CreatedAt.After(base.CreatedAt) {
+			base = &all[i]
+		}
+	}
+	return base
+}
+
+func deleteBackup(ctx context.Context, app *application.App, backup model.BackupFull) error {
+	for _, driveFile := range backup.DriveFiles {
+		drive, err := GetDrive(app, driveFile.Label, driveFile.Provider)
+		if err != nil {
+			return err
+		}
+		// Deleted first, so a rebuilt catalog never references deleted files
+		err = deleteCatalogEntry(ctx, drive, driveFile)
+		if err != nil {
+			return err
+		}
+		err = deleteUploadedFile(ctx, drive, driveFile.Path, driveFile.Parts)
+		if err != nil {
+			return err
+		}
+		err = app.Db.DriveFile.Delete(driveFile.Id)
+		if err != nil {
+			return fmt.Errorf("failed to delete drive file (%s) => %s", driveFile.Id, err)
+		}
+	}
+
+	err := app.Db.Backup.Delete(backup.Id)
+	if err != nil {
+		return fmt.Errorf("failed to delete backup (%s) => %s", backup.Id, err)
+	}
+	return nil
+}
+
+// deleteUploadedFile deletes a file uploaded to a drive with its volumes
+func deleteUploadedFile(ctx context.Context, d drive.Drive, path string, parts []string) error {
+	for _, part := range parts {
+		err := d.Delete(ctx, part)
+		if err != nil {
+			return fmt.Errorf("failed to delete part (%s) of drive file (%s) => %s", part, path, err)
+		}
+	}
+	err := d.Delete(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to delete drive file (%s) => %s", path, err)
+	}
 	return nil
 }
 
-func GetDrive(app *application.App, provider string) (drive.Drive, error) {
+// GetDrive finds the drive a drive file belongs to. The provider is used as a
+// fallback when the drive label changed in the configuration.
+func GetDrive(app *application.App, label, provider string) (drive.Drive, error) {
+	for _, d := range app.Drives {
+		if d.GetLabel() == label && d.GetProvider() == provider {
+			return d, nil
+		}
+	}
 	for _, d := range app.Drives {
 		if d.GetProvider() == provider {
 			return d, nil
@@ -138,13 +285,30 @@ func GetDrive(app *application.App, provider string) (drive.Drive, error) {
 	return nil, fmt.Errorf("drive not found for provider %s", provider)
 }
 
-func AfterBackup(app *application.App, backupId string) error {
+// GetDataSourceDrives returns the drives receiving the dumps of a data source
+func GetDataSourceDrives(app *application.App, label string) []drive.Drive {
+	options, ok := app.DataSourceOptions[label]
+	if !ok || len(options.Drives) == 0 {
+		return app.Drives
+	}
+	drives := make([]drive.Drive, 0, len(options.Drives))
+	for _, d := range app.Drives {
+		if slices.Contains(options.Drives, d.GetLabel()) {
+			drives = append(drives, d)
+		}
+	}
+	return drives
+}
+
+func AfterBackup(ctx context.Context, app *application.App, backupId string) error {
 	backupWithStatus, err := HandleBackupStatus(app, backupId)
 	if err != nil {
 		return fmt.Errorf("failed to handle backup (%s) status => %s", backupId, err)
 	}
+	writeCatalog(ctx, app, backupId)
 
-	if backupWithStatus.Status == model.BACKUP_STATUS_FINISHED {
+	// A cancelled backup is not retried, its dump is not needed anymore
+	if backupWithStatus.Status == model.BACKUP_STATUS_FINISHED || backupWithStatus.Status == model.BACKUP_STATUS_CANCELLED {
 		if app.Mode == application.APP_MODE_CLI {
 			err = RemoveBackupDump(app, backupWithStatus)
 			if err != nil {
@@ -157,13 +321,13 @@ func AfterBackup(app *application.App, backupId string) error {
 
 	for _, notifier := range app.Notifiers {
 		if app.Mode == application.APP_MODE_CLI {
-			err := notifier.BackupReport(backupId)
+			err := notifier.BackupReport(ctx, backupId)
 			if err != nil {
 				log.Printf("failed to send backup report notification => %s", err)
 			}
 		} else {
 			go func(id string) {
-				err := notifier.BackupReport(id)
+				err := notifier.BackupReport(ctx, id)
 				if err != nil {
 					log.Printf("failed to send backup report notification => %s", err)
 				}
@@ -174,3 +338,32 @@ func AfterBackup(app *application.App, backupId string) error {
 
 	return nil
 }
+
+// SetBackupDumpStats records the content of the dump on the backup when the
+// dumper is able to describe it
+func SetBackupDumpStats(d dumper.Dumper, backup *model.Backup, dumpPath string) {
+	reporter, ok := d.(dumper.StatsReporter)
+	if !ok {
+		return
+	}
+	stats, ok := reporter.DumpStats(dumpPath)
+	if !ok {
+		return
+	}
+	backup.FileCount = stats.FileCount
+	backup.TotalSize = stats.TotalSize
+}
+
+// SetBackupPosition records the position a full dump starts the chain of
+// incremental backups or WAL segments from
+func SetBackupPosition(d dumper.Dumper, backup *model.Backup, dumpPath string) {
+	reporter, ok := d.(dumper.PositionReporter)
+	if !ok {
+		return
+	}
+	position, ok := reporter.DumpPosition(dumpPath)
+	if !ok {
+		return
+	}
+	backup.Position = position
+}
@@ -1,10 +1,12 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"os"
 
 	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
 	"github.com/herytz/backupman/core/model"
 )
 
@@ -14,7 +16,7 @@ type DownloadOutput struct {
 	MimeType string
 }
 
-func Download(app *application.App, driveFileId string) (DownloadOutput, error) {
+func Download(ctx context.Context, app *application.App, driveFileId string) (DownloadOutput, error) {
 	var output DownloadOutput
 	driveFile, err := app.Db.DriveFile.ReadOrError(driveFileId)
 	if err != nil {
@@ -29,7 +31,17 @@ func Download(app *application.App, driveFileId string) (DownloadOutput, error)
 		return output, fmt.Errorf("unexpected drive provider (%s). This route only supports local drive", driveFile.Provider)
 	}
 
-	data, err := os.ReadFile(driveFile.Path)
+	tmpFile, err := os.CreateTemp("", "backupman-download-*")
+	if err != nil {
+		return output, fmt.Errorf("failed to create download file => %s", err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+	err = downloadDriveFile(ctx, app, driveFile, tmpFile.Name())
+	if err != nil {
+		return output, fmt.Errorf("failed to download file %s => %s", driveFile.Path, err)
+	}
+	data, err := os.ReadFile(tmpFile.Name())
 	if err != nil {
 		return output, fmt.Errorf("failed to read file %s => %s", driveFile.Path, err)
 	}
@@ -40,3 +52,19 @@ func Download(app *application.App, driveFileId string) (DownloadOutput, error)
 
 	return output, nil
 }
+
+// downloadDriveFile downloads the dump of a drive file, reassembling its volumes
+func downloadDriveFile(ctx context.Context, app *application.App, driveFile *model.DriveFile, dstPath string) error {
+	d, err := GetDrive(app, driveFile.Label, driveFile.Provider)
+	if err != nil {
+		return err
+	}
+	downloader, ok := d.(drive.Downloader)
+	if !ok {
+		return fmt.Errorf("drive (%s) does not support download", d.GetLabel())
+	}
+	if len(driveFile.Parts) > 0 {
+		return drive.DownloadVolumes(ctx, downloader, driveFile.Path, dstPath)
+	}
+	return downloader.Download(ctx, driveFile.Path, dstPath)
+}
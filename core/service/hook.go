@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/lib"
+	"github.com/herytz/backupman/core/model"
+)
+
+const (
+	HOOK_PRE_DUMP    = "pre_dump"
+	HOOK_POST_DUMP   = "post_dump"
+	HOOK_POST_UPLOAD = "post_upload"
+	HOOK_ON_FAILURE  = "on_failure"
+)
+
+const DEFAULT_HOOK_TIMEOUT = 5 * time.Minute
+
+// Maximum amount of output kept in the error of a failed hook
+const hookOutputLimit = 4096
+
+// runHook runs a hook of a data source, nothing being run when it is not configured
+func runHook(ctx context.Context, app *application.App, dataSourceLabel, hook string, backup model.Backup) error {
+	hooks := app.DataSourceOptions[dataSourceLabel].Hooks
+	var command []string
+	switch hook {
+	case HOOK_PRE_DUMP:
+		command = hooks.PreDump
+	case HOOK_POST_DUMP:
+		command = hooks.PostDump
+	case HOOK_POST_UPLOAD:
+		command = hooks.PostUpload
+	case HOOK_ON_FAILURE:
+		command = hooks.OnFailure
+	default:
+		return fmt.Errorf("unknown hook (%s)", hook)
+	}
+	if len(command) == 0 {
+		return nil
+	}
+
+	timeout := hooks.Timeout
+	if timeout <= 0 {
+		timeout = DEFAULT_HOOK_TIMEOUT
+	}
+	hookCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	output := lib.NewTailBuffer(hookOutputLimit)
+	cmd := exec.CommandContext(hookCtx, command[0], command[1:]...)
+	cmd.Env = append(os.Environ(),
+		"BACKUPMAN_HOOK="+hook,
+		"BACKUPMAN_DATA_SOURCE="+dataSourceLabel,
+		"BACKUPMAN_BACKUP_ID="+backup.Id,
+		"BACKUPMAN_LABEL="+backup.Label,
+		"BACKUPMAN_DUMP_PATH="+backup.DumpPath,
+		"BACKUPMAN_STATUS="+backup.Status,
+		"BACKUPMAN_ERROR="+backup.Error,
+	)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// Processes started by the hook may keep the output open after it is killed
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("hook (%s) cancelled => %s: %s", hook, ctx.Err(), output.String())
+		}
+		if errors.Is(hookCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("hook (%s) timed out after %s: %s", hook, timeout, output.String())
+		}
+		return fmt.Errorf("hook (%s) failed => %s: %s", hook, err, output.String())
+	}
+	return nil
+}
+
+// runHookOrLog runs a hook whose failure does not change the backup status
+func runHookOrLog(ctx context.Context, app *application.App, dataSourceLabel, hook string, backup model.Backup) {
+	err := runHook(ctx, app, dataSourceLabel, hook, backup)
+	if err != nil {
+		log.Printf("backup (%s) of data source (%s): %s", backup.Id, dataSourceLabel, err)
+	}
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/model"
+)
+
+type ReconcileInput struct {
+	// Labels of the drives reconciled, every drive when empty
+	Drives []string
+	// Record the finished drive files whose file is missing as missing
+	MarkMissing bool
+	// Delete the orphan files older than this duration, zero meaning the
+	// orphan files are only reported
+	DeleteOrphansOlderThan time.Duration
+}
+
+// ReconcileMissing is a finished drive file whose file or one of its parts is
+// not on its drive
+type ReconcileMissing struct {
+	DriveFileId string
+	BackupId    string
+	Path        string
+	Marked      bool
+}
+
+// ReconcileOrphan is a file of a drive referenced by no drive file
+type ReconcileOrphan struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Deleted bool
+}
+
+type ReconcileReport struct {
+	Label   string
+	Missing []ReconcileMissing
+	Orphans []ReconcileOrphan
+	// Set when the drive could not be reconciled
+	Error string
+}
+
+type ReconcileOutput struct {
+	Reports []ReconcileReport
+}
+
+// Reconcile compares the files of the drives to the drive files recorded for
+// them. The finished drive files whose file is missing and the files no drive
+// file references, left by interrupted uploads or added by hand, are reported
+// and optionally marked or deleted. A drive which cannot be listed does not
+// stop the others.
+func Reconcile(ctx context.Context, app *application.App, input ReconcileInput) (ReconcileOutput, error) {
+	output := ReconcileOutput{
+		Reports: make([]ReconcileReport, 0),
+	}
+	if input.DeleteOrphansOlderThan < 0 {
+		return output, fmt.Errorf("orphan age cannot be negative")
+	}
+	drives := app.Drives
+	if len(input.Drives) > 0 {
+		drives = make([]drive.Drive, 0, len(input.Drives))
+		for _, label := range input.Drives {
+			d, err := findDrive(app, label)
+			if err != nil {
+				return output, err
+			}
+			drives = append(drives, d)
+		}
+	}
+	backups, err := app.Db.Backup.ReadAllFull()
+	if err != nil {
+		return output, fmt.Errorf("failed to read backups => %s", err)
+	}
+
+	for _, d := range drives {
+		if ctx.Err() != nil {
+			return output, ctx.Err()
+		}
+		report, err := reconcileDrive(ctx, app, d, backups, input)
+		if err != nil {
+			log.Printf("failed to reconcile drive (%s) => %s", d.GetLabel(), err)
+			report.Error = err.Error()
+		}
+		output.Reports = append(output.Reports, report)
+	}
+	return output, nil
+}
+
+func reconcileDrive(ctx context.Context, app *application.App, d drive.Drive, backups []model.BackupFull, input ReconcileInput) (ReconcileReport, error) {
+	report := ReconcileReport{
+		Label:   d.GetLabel(),
+		Missing: make([]ReconcileMissing, 0),
+		Orphans: make([]ReconcileOrphan, 0),
+	}
+	lister, ok := d.(drive.Lister)
+	if !ok {
+		return report, fmt.Errorf("drive (%s) cannot list its files", d.GetLabel())
+	}
+	files, err := lister.List(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to list files => %s", err)
+	}
+	exists := make(map[string]bool)
+	for _, file := range files {
+		exists[file.Path] = true
+	}
+
+	// The files of every drive file are referenced, a failed upload keeping
+	// the files it uploaded. The drive files are matched to their drive by
+	// label, the drive files of a renamed drive being counted as unknown.
+	referenced := make(map[string]bool)
+	unknown := 0
+	for _, backup := range backups {
+		for _, driveFile := range backup.DriveFiles {
+			if driveFile.Label != d.GetLabel() {
+				_, err := findDrive(app, driveFile.Label)
+				if err != nil && driveFile.Provider == d.GetProvider() {
+					unknown++
+				}
+				continue
+			}
+			paths := append([]string{driveFile.Path}, driveFile.Parts...)
+			for _, path := range paths {
+				referenced[path] = true
+			}
+			if driveFile.CatalogPath != "" {
+				referenced[driveFile.CatalogPath] = true
+			}
+			if driveFile.Status != model.DRIVE_FILE_STATUS_FINISHED {
+				continue
+			}
+			missing := slices.IndexFunc(paths, func(path string) bool {
+				return !exists[path]
+			})
+			if missing < 0 {
+				continue
+			}
+			result := ReconcileMissing{
+				DriveFileId: driveFile.Id,
+				BackupId:    backup.Id,
+				Path:        paths[missing],
+			}
+			if input.MarkMissing {
+				driveFile.Status = model.DRIVE_FILE_STATUS_MISSING
+				_, err := app.Db.DriveFile.Update(driveFile.Id, *driveFile)
+				if err != nil {
+					return report, fmt.Errorf("failed to mark drive file (%s) as missing => %s", driveFile.Id, err)
+				}
+				result.Marked = true
+				_, err = HandleBackupStatus(app, backup.Id)
+				if err != nil {
+					return report, err
+				}
+			}
+			report.Missing = append(report.Missing, result)
+		}
+	}
+
+	// The orphans may be the files of the unknown drive files
+	deleteOrphans := input.DeleteOrphansOlderThan > 0 && unknown == 0
+	maxModTime := time.Now().Add(-input.DeleteOrphansOlderThan)
+	deleted := false
+	for _, file := range files {
+		if referenced[file.Path] {
+			continue
+		}
+		orphan := ReconcileOrphan{
+			Path:    file.Path,
+			Size:    file.Size,
+			ModTime: file.ModTime,
+		}
+		if deleteOrphans && file.ModTime.Before(maxModTime) {
+			err := d.Delete(ctx, file.Path)
+			if err != nil {
+				return report, fmt.Errorf("failed to delete orphan file (%s) => %s", file.Path, err)
+			}
+			orphan.Deleted = true
+			deleted = true
+		}
+		report.Orphans = append(report.Orphans, orphan)
+	}
+	// The chunks of the deleted manifests of a deduplicated drive
+	collector, ok := d.(drive.GarbageCollector)
+	if deleted && ok {
+		_, err := collector.CollectGarbage(ctx)
+		if err != nil {
+			return report, fmt.Errorf("failed to collect garbage => %s", err)
+		}
+	}
+	if input.DeleteOrphansOlderThan > 0 && unknown > 0 {
+		return report, fmt.Errorf("orphan files not deleted, %d drive files of provider %s belong to no configured drive", unknown, d.GetProvider())
+	}
+	return report, nil
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/lib"
+	"github.com/herytz/backupman/core/model"
+)
+
+const (
+	REPLICATE_STATUS_REPLICATED = "replicated"
+	// Already replicated by a previous run
+	REPLICATE_STATUS_SKIPPED = "skipped"
+	REPLICATE_STATUS_FAILED  = "failed"
+)
+
+type ReplicateInput struct {
+	// Labels of the drives the backups are copied from and to
+	From string
+	To   string
+	// Only replicate the backups created within this duration, zero meaning
+	// no limit
+	Since time.Duration
+}
+
+type ReplicateResult struct {
+	BackupId string
+	Label    string
+	Status   string
+	Error    string
+}
+
+type ReplicateOutput struct {
+	Results []ReplicateResult
+}
+
+// Replicate copies the finished backups uploaded to a drive to another drive,
+// each copy being recorded as a new drive file of its backup. A copy is
+// downloaded back from the destination and compared to the source before
+// being finished. The backups already replicated are skipped, so an
+// interrupted replication is resumed by running it again.
+func Replicate(ctx context.Context, app *application.App, input ReplicateInput) (ReplicateOutput, error) {
+	output := ReplicateOutput{
+		Results: make([]ReplicateResult, 0),
+	}
+	if input.Since < 0 {
+		return output, fmt.Errorf("since cannot be negative")
+	}
+	if input.From == input.To {
+		return output, fmt.Errorf("cannot replicate drive (%s) to itself", input.From)
+	}
+	from, err := findDrive(app, input.From)
+	if err != nil {
+		return output, err
+	}
+	to, err := findDrive(app, input.To)
+	if err != nil {
+		return output, err
+	}
+	for _, d := range []drive.Drive{from, to} {
+		_, ok := d.(drive.Downloader)
+		if !ok {
+			return output, fmt.Errorf("drive (%s) does not support download", d.GetLabel())
+		}
+	}
+
+	backups, err := app.Db.Backup.ReadAllFull()
+	if err != nil {
+		return output, fmt.Errorf("failed to read backups => %s", err)
+	}
+	tmpFolder, err := os.MkdirTemp("", "backupman-replicate-*")
+	if err != nil {
+		return output, fmt.Errorf("failed to create replication folder => %s", err)
+	}
+	defer os.RemoveAll(tmpFolder)
+
+	// The oldest backups first, the parents of the incremental backups being
+	// replicated before them
+	slices.SortStableFunc(backups, func(a, b model.BackupFull) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	minCreatedAt := time.Now().Add(-input.Since)
+	for _, backup := range backups {
+		// A failed backup can have a finished drive file to copy, like the
+		// backup failed by a drive file marked as missing
+		if backup.Status != model.BACKUP_STATUS_FINISHED && backup.Status != model.BACKUP_STATUS_FAILED {
+			continue
+		}
+		if input.Since > 0 && backup.CreatedAt.Before(minCreatedAt) {
+			continue
+		}
+		srcFile := findDriveFile(backup, from.GetLabel())
+		if srcFile == nil || srcFile.Status != model.DRIVE_FILE_STATUS_FINISHED {
+			continue
+		}
+		if ctx.Err() != nil {
+			return output, ctx.Err()
+		}
+
+		result := ReplicateResult{
+			BackupId: backup.Id,
+			Label:    backup.Label,
+			Status:   REPLICATE_STATUS_REPLICATED,
+		}
+		dstFile := findDriveFile(backup, to.GetLabel())
+		if dstFile != nil && dstFile.Status == model.DRIVE_FILE_STATUS_FINISHED {
+			result.Status = REPLICATE_STATUS_SKIPPED
+			output.Results = append(output.Results, result)
+			continue
+		}
+		err := replicateBackup(ctx, app, to, backup, srcFile, dstFile, tmpFolder)
+		if err != nil {
+			log.Printf("failed to replicate backup (%s) to drive (%s) => %s", backup.Id, to.GetLabel(), err)
+			result.Status = REPLICATE_STATUS_FAILED
+			result.Error = err.Error()
+		}
+		output.Results = append(output.Results, result)
+	}
+	return output, nil
+}
+
+// replicateBackup copies the dump of srcFile to the drive to, reusing dstFile when set
+func replicateBackup(ctx context.Context, app *application.App, to drive.Drive, backup model.BackupFull, srcFile, dstFile *model.DriveFile, tmpFolder string) error {
+	// Named after the backup, the name of the source file being the one given
+	// by its drive
+	name := fmt.Sprintf("%s-%s-%s%s", strings.ReplaceAll(backup.Label, "/", "-"), backup.CreatedAt.Format("20060102150405"), backup.Id[:8], filepath.Ext(srcFile.Path))
+	dumpPath := filepath.Join(tmpFolder, name)
+	defer os.Remove(dumpPath)
+	err := downloadDriveFile(ctx, app, srcFile, dumpPath)
+	if err != nil {
+		return fmt.Errorf("failed to download drive file (%s) => %s", srcFile.Id, err)
+	}
+	checksum, err := lib.FileSha256(dumpPath)
+	if err != nil {
+		return err
+	}
+
+	if dstFile == nil {
+		dstFile = createDriveFile(app, to, &model.Backup{Id: backup.Id, Label: backup.Label})
+		if dstFile == nil {
+			return fmt.Errorf("failed to record drive file of drive (%s)", to.GetLabel())
+		}
+	}
+	// The catalog entry of a missing file describes its former upload
+	err = deleteCatalogEntry(ctx, to, dstFile)
+	if err != nil {
+		log.Printf("failed to delete catalog entry of drive file (%s) => %s", dstFile.Id, err)
+	}
+	dstFile.CatalogPath = ""
+	file, err := uploadWithRetry(ctx, app, to, dumpPath, dstFile)
+	if err == nil {
+		err = verifyReplica(ctx, app, to, dstFile, file, checksum, tmpFolder)
+	}
+	finishDriveFile(app, dstFile, file, err)
+	if err != nil {
+		return err
+	}
+	// A failed backup whose drive files are all finished again is finished
+	_, err = HandleBackupStatus(app, backup.Id)
+	if err != nil {
+		return err
+	}
+	writeCatalog(ctx, app, backup.Id)
+	return nil
+}
+
+// verifyReplica compares a replicated file to the checksum of its source
+func verifyReplica(ctx context.Context, app *application.App, to drive.Drive, dstFile *model.DriveFile, file drive.DriveFile, checksum, tmpFolder string) error {
+	uploaded := *dstFile
+	uploaded.Path = file.Path
+	uploaded.Parts = file.Parts
+	verifyPath := filepath.Join(tmpFolder, "verify")
+	defer os.Remove(verifyPath)
+	err := downloadDriveFile(ctx, app, &uploaded, verifyPath)
+	if err == nil {
+		var uploadedChecksum string
+		uploadedChecksum, err = lib.FileSha256(verifyPath)
+		if err == nil && uploadedChecksum != checksum {
+			err = fmt.Errorf("checksum of the replica (%s) does not match the source (%s)", uploadedChecksum, checksum)
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	deleteErr := deleteUploadedFile(ctx, to, file.Path, file.Parts)
+	if deleteErr != nil {
+		log.Printf("failed to delete unverified replica (%s) from drive (%s) => %s", file.Path, to.GetLabel(), deleteErr)
+	}
+	return fmt.Errorf("failed to verify replica => %s", err)
+}
+
+func findDrive(app *application.App, label string) (drive.Drive, error) {
+	for _, d := range app.Drives {
+		if d.GetLabel() == label {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown drive (%s)", label)
+}
+
+// findDriveFile returns the drive file of a backup on a drive, the finished one first
+func findDriveFile(backup model.BackupFull, label string) *model.DriveFile {
+	var found *model.DriveFile
+	for _, driveFile := range backup.DriveFiles {
+		if driveFile.Label != label {
+			continue
+		}
+		if found == nil || driveFile.Status == model.DRIVE_FILE_STATUS_FINISHED {
+			found = driveFile
+		}
+	}
+	return found
+}
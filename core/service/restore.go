@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/model"
+)
+
+type RestoreOptions struct {
+	// Restore the state of the data source at this time, when set
+	Until time.Time
+	// Data directory receiving a restored base backup
+	TargetDir string
+}
+
+// Restore loads a backup back into its data source. An incremental backup is
+// restored by loading its full backup, then replaying the incremental backups
+// of the chain up to it. When until is set, the chain of the backup is
+// replayed up to this time instead. A base backup is restored in a new data
+// directory with the WAL segments to replay instead, see restoreBaseBackup.
+func Restore(app *application.App, backupId string, options RestoreOptions) error {
+	until := options.Until
+	backup, err := app.Db.Backup.ReadFullById(backupId)
+	if err != nil {
+		return fmt.Errorf("failed to read backup (%s) => %s", backupId, err)
+	}
+	if backup == nil {
+		return fmt.Errorf("backup (%s) not found", backupId)
+	}
+
+	baseBackupDumper, err := getBaseBackupDumper(app, backup.Label)
+	if err == nil {
+		return restoreBaseBackup(app, baseBackupDumper, backup, options)
+	}
+
+	restorer, release, err := getRestorer(app, backup.Label)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	full, err := readChainFull(app, backup, until)
+	if err != nil {
+		return err
+	}
+
+	chain, err := restoreChain(app, full, backup, until)
+	if err != nil {
+		return err
+	}
+
+	tmpFolder, err := os.MkdirTemp("", "backupman-restore-")
+	if err != nil {
+		return fmt.Errorf("failed to create restore folder => %s", err)
+	}
+	defer os.RemoveAll(tmpFolder)
+
+	dump, err := fetchBackupDump(app, full, tmpFolder)
+	if err != nil {
+		return err
+	}
+	log.Printf("restoring full backup (%s) of data source (%s)", full.Id, full.Label)
+	err = restorer.Restore(dump)
+	if err != nil {
+		return fmt.Errorf("failed to restore backup (%s) => %s", full.Id, err)
+	}
+
+	for _, incremental := range chain {
+		dump, err := fetchBackupDump(app, incremental, tmpFolder)
+		if err != nil {
+			return err
+		}
+		log.Printf("replaying incremental backup (%s) of data source (%s)", incremental.Id, incremental.Label)
+		err = restorer.RestoreIncremental(dump, until)
+		if err != nil {
+			return fmt.Errorf("failed to restore backup (%s) => %s", incremental.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// readChainFull returns the full backup starting the chain of a backup
+func readChainFull(app *application.App, backup *model.BackupFull, until time.Time) (*model.BackupFull, error) {
+	full := backup
+	if backup.Kind != model.BACKUP_KIND_FULL && backup.ParentId != "" {
+		var err error
+		full, err = app.Db.Backup.ReadFullById(backup.ParentId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read full backup (%s) => %s", backup.ParentId, err)
+		}
+		if full == nil {
+			return nil, fmt.Errorf("full backup (%s) of backup (%s) not found", backup.ParentId, backup.Id)
+		}
+	}
+	if full.Kind == model.BACKUP_KIND_WAL {
+		return nil, fmt.Errorf("WAL segment (%s) does not follow a base backup", backup.Id)
+	}
+	if full.Status != model.BACKUP_STATUS_FINISHED {
+		return nil, fmt.Errorf("backup (%s) is not finished", full.Id)
+	}
+	if !until.IsZero() && until.Before(full.CreatedAt) {
+		return nil, fmt.Errorf("restore time (%s) is before the full backup (%s)", until.Format(time.RFC3339), full.Id)
+	}
+	return full, nil
+}
+
+// restoreBaseBackup restores a base backup in options.TargetDir with the WAL segments archived after it
+func restoreBaseBackup(app *application.App, d dumper.BaseBackupDumper, backup *model.BackupFull, options RestoreOptions) error {
+	if options.TargetDir == "" {
+		return fmt.Errorf("a target directory is required to restore backup (%s) of data source (%s)", backup.Id, backup.Label)
+	}
+	base, err := readChainFull(app, backup, options.Until)
+	if err != nil {
+		return err
+	}
+	if base.Position == "" {
+		return fmt.Errorf("backup (%s) is not a base backup", base.Id)
+	}
+
+	wals, err := app.Db.Backup.ReadByPosition(base.Label, model.BACKUP_KIND_WAL, "", "")
+	if err != nil {
+		return fmt.Errorf("failed to read backups => %s", err)
+	}
+
+	tmpFolder, err := os.MkdirTemp("", "backupman-restore-")
+	if err != nil {
+		return fmt.Errorf("failed to create restore folder => %s", err)
+	}
+	defer os.RemoveAll(tmpFolder)
+
+	segments := make(map[string]string)
+	for i, wal := range wals {
+		if wal.Status != model.BACKUP_STATUS_FINISHED {
+			continue
+		}
+		// The timeline history files are needed whatever the segment is
+		if !strings.HasSuffix(wal.Position, ".history") {
+			if wal.Position < base.Position {
+				continue
+			}
+			if options.Until.IsZero() && backup.Kind == model.BACKUP_KIND_WAL && wal.Position > backup.Position {
+				continue
+			}
+		}
+		if _, ok := segments[wal.Position]; ok {
+			continue
+		}
+		segment, err := fetchBackupDump(app, &wals[i], tmpFolder)
+		if err != nil {
+			return err
+		}
+		segments[wal.Position] = segment
+	}
+
+	dump, err := fetchBackupDump(app, base, tmpFolder)
+	if err != nil {
+		return err
+	}
+	log.Printf("restoring base backup (%s) of data source (%s) with %d WAL segments in (%s)", base.Id, base.Label, len(segments), options.TargetDir)
+	err = d.RestoreBaseBackup(dump, segments, options.TargetDir, options.Until)
+	if err != nil {
+		return fmt.Errorf("failed to restore backup (%s) => %s", base.Id, err)
+	}
+	return nil
+}
+
+// restoreChain returns the incremental backups replayed on a full backup to restore target
+func restoreChain(app *application.App, full, target *model.BackupFull, until time.Time) ([]*model.BackupFull, error) {
+	backups, err := app.Db.Backup.ReadAllFull()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backups => %s", err)
+	}
+
+	restored := make([]*model.BackupFull, 0)
+	previous := full.CreatedAt
+	for _, incremental := range incrementalChain(backups, full.Id) {
+		if !until.IsZero() {
+			// An incremental backup holds the changes made since the previous
+			// backup of the chain
+			if !previous.Before(until) {
+				break
+			}
+		} else if target.Kind != model.BACKUP_KIND_INCREMENTAL {
+			break
+		}
+		restored = append(restored, incremental)
+		previous = incremental.CreatedAt
+		if until.IsZero() && incremental.Id == target.Id {
+			break
+		}
+	}
+	return restored, nil
+}
+
+// getRestorer returns the restorer of the backups labelled label and its release function
+func getRestorer(app *application.App, label string) (dumper.Restorer, func(), error) {
+	for _, d := range app.Dumpers {
+		if d.GetLabel() != label {
+			continue
+		}
+		restorer, ok := d.(dumper.Restorer)
+		if !ok {
+			return nil, nil, fmt.Errorf("data source (%s) does not support restore", label)
+		}
+		return restorer, func() {}, nil
+	}
+	for _, d := range app.Dumpers {
+		database, found := strings.CutPrefix(label, d.GetLabel()+"/")
+		if !found {
+			continue
+		}
+		databaseRestorer, ok := d.(dumper.DatabaseRestorer)
+		if !ok {
+			return nil, nil, fmt.Errorf("data source (%s) does not support restore", d.GetLabel())
+		}
+		restorer, err := databaseRestorer.RestorerFor(database)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create restorer of database (%s) of data source (%s) => %s", database, d.GetLabel(), err)
+		}
+		release := func() {
+			closer, ok := restorer.(io.Closer)
+			if !ok {
+				return
+			}
+			err := closer.Close()
+			if err != nil {
+				log.Printf("failed to close restorer of database (%s) => %s", database, err)
+			}
+		}
+		return restorer, release, nil
+	}
+	return nil, nil, fmt.Errorf("data source (%s) not found", label)
+}
+
+// fetchBackupDump returns the dump of a backup, downloaded from a drive when removed locally
+func fetchBackupDump(app *application.App, backup *model.BackupFull, tmpFolder string) (string, error) {
+	if backup.DumpPath != "" {
+		_, err := os.Stat(backup.DumpPath)
+		if err == nil {
+			return backup.DumpPath, nil
+		}
+	}
+
+	errs := make([]error, 0)
+	for _, driveFile := range backup.DriveFiles {
+		if driveFile.Status != model.DRIVE_FILE_STATUS_FINISHED {
+			continue
+		}
+		dstPath := filepath.Join(tmpFolder, backup.Id+filepath.Ext(driveFile.Path))
+		err := downloadDriveFile(context.Background(), app, driveFile, dstPath)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return dstPath, nil
+	}
+	if len(errs) == 0 {
+		return "", fmt.Errorf("backup (%s) has no uploaded dump", backup.Id)
+	}
+	return "", fmt.Errorf("failed to download dump of backup (%s) => %s", backup.Id, errors.Join(errs...))
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/model"
+)
+
+const DEFAULT_RETRY_INITIAL_DELAY = time.Second
+const DEFAULT_RETRY_MAX_DELAY = time.Minute
+
+// uploadWithRetry uploads a dump to a drive, retrying the failed uploads as configured
+func uploadWithRetry(ctx context.Context, app *application.App, d drive.Drive, dumpPath string, driveFile *model.DriveFile) (drive.DriveFile, error) {
+	options := app.DriveOptions[d.GetLabel()]
+	attempts := max(options.Retry.Attempts, 1)
+	for attempt := 1; ; attempt++ {
+		// The upload slot is not held while waiting for the next attempt
+		err := app.Limiter.AcquireUpload(ctx, d.GetLabel())
+		if err != nil {
+			return drive.DriveFile{}, err
+		}
+		driveFile.Attempts++
+		file, err := uploadWithTimeout(ctx, options.UploadTimeout, d, dumpPath)
+		app.Limiter.ReleaseUpload(d.GetLabel())
+		if err == nil {
+			return file, nil
+		}
+		if attempt >= attempts || ctx.Err() != nil {
+			return file, err
+		}
+		delay := retryDelay(options.Retry, attempt)
+		log.Printf("failed to upload dump (%s) to drive (%s), attempt %d/%d, retrying in %s => %s", dumpPath, d.GetLabel(), attempt, attempts, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return file, err
+		}
+	}
+}
+
+// uploadWithTimeout runs an upload attempt aborted after timeout
+func uploadWithTimeout(ctx context.Context, timeout time.Duration, d drive.Drive, dumpPath string) (drive.DriveFile, error) {
+	if timeout <= 0 {
+		return d.Upload(ctx, dumpPath)
+	}
+	uploadCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	file, err := d.Upload(uploadCtx, dumpPath)
+	if err != nil && ctx.Err() == nil && uploadCtx.Err() != nil {
+		return file, fmt.Errorf("upload timed out after %s => %s", timeout, err)
+	}
+	return file, err
+}
+
+// retryDelay returns the delay before the attempt following the given one
+func retryDelay(retry application.RetryConfig, attempt int) time.Duration {
+	delay := retry.InitialDelay
+	if delay <= 0 {
+		delay = DEFAULT_RETRY_INITIAL_DELAY
+	}
+	maxDelay := retry.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DEFAULT_RETRY_MAX_DELAY
+	}
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxDelay)
+	if retry.Jitter > 0 {
+		delay += time.Duration(float64(delay) * retry.Jitter * (2*rand.Float64() - 1))
+	}
+	return delay
+}
+
+// RetryFailedUploads uploads again the failed drive files of the failed
+// backups created within the max age of the retry job, as long as their dump
+// is still present. The drive files having reached the max attempts of the job
+// are left failed. The ids of the retried backups are returned.
+func RetryFailedUploads(ctx context.Context, app *application.App) ([]string, error) {
+	backups, err := app.Db.Backup.ReadByStatus(model.BACKUP_STATUS_FAILED)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read failed backups => %s", err)
+	}
+
+	minCreatedAt := time.Now().Add(-app.Http.RetryJob.MaxAge)
+	retried := make([]string, 0)
+	for i := range backups {
+		backup := &backups[i]
+		if backup.Status != model.BACKUP_STATUS_FAILED || backup.DumpPath == "" || backup.CreatedAt.Before(minCreatedAt) {
+			continue
+		}
+		if !hasRetryableDriveFile(backup, app.Http.RetryJob.MaxAttempts) {
+			continue
+		}
+		_, err := os.Stat(backup.DumpPath)
+		if err != nil {
+			continue
+		}
+
+		retryDriveFiles(ctx, app, backup, app.Http.RetryJob.MaxAttempts)
+		err = AfterBackup(ctx, app, backup.Id)
+		if err != nil {
+			log.Printf("failed to execute after backup tasks for backup (%s) => %s", backup.Id, err)
+		}
+		retried = append(retried, backup.Id)
+	}
+	return retried, nil
+}
+
+func hasRetryableDriveFile(backup *model.BackupFull, maxAttempts int) bool {
+	for _, driveFile := range backup.DriveFiles {
+		if isRetryable(driveFile, maxAttempts) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetryable tells whether a drive file is failed and below maxAttempts
+func isRetryable(driveFile *model.DriveFile, maxAttempts int) bool {
+	if driveFile.Status != model.DRIVE_FILE_STATUS_FAILED {
+		return false
+	}
+	return maxAttempts <= 0 || driveFile.Attempts < maxAttempts
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/model"
+)
+
+// ArchiveWal uploads a WAL segment archived by a PostgreSQL server to the
+// drives of its data source. The segment is recorded as a backup chained to
+// the latest base backup it follows, named by the segment name. An error is
+// returned unless the segment is stored on every drive, so the server keeps
+// the segment and archives it again later. A segment already archived is not
+// uploaded again.
+func ArchiveWal(ctx context.Context, app *application.App, label, walPath, walName string) error {
+	_, err := getBaseBackupDumper(app, label)
+	if err != nil {
+		return err
+	}
+	if len(GetDataSourceDrives(app, label)) == 0 {
+		return fmt.Errorf("data source (%s) has no drive to archive WAL segments", label)
+	}
+
+	segments, err := app.Db.Backup.ReadByPosition(label, model.BACKUP_KIND_WAL, walName, walName)
+	if err != nil {
+		return fmt.Errorf("failed to read backups => %s", err)
+	}
+	for _, backup := range segments {
+		if backup.Status == model.BACKUP_STATUS_FINISHED {
+			log.Printf("WAL segment (%s) of data source (%s) already archived by backup (%s)", walName, label, backup.Id)
+			return nil
+		}
+	}
+
+	bases, err := app.Db.Backup.ReadByPosition(label, model.BACKUP_KIND_FULL, "", walName)
+	if err != nil {
+		return fmt.Errorf("failed to read backups => %s", err)
+	}
+	var parent *model.BackupFull
+	for i, backup := range bases {
+		if backup.Status != model.BACKUP_STATUS_FINISHED || backup.Position == "" {
+			continue
+		}
+		if parent == nil || backup.CreatedAt.After(parent.CreatedAt) {
+			parent = &bases[i]
+		}
+	}
+
+	backup := model.Backup{
+		Label:    label,
+		Status:   model.BACKUP_STATUS_PENDING,
+		Kind:     model.BACKUP_KIND_WAL,
+		Position: walName,
+	}
+	// The segments archived before the first base backup are kept without
+	// chain, they are not needed to restore it
+	if parent != nil {
+		backup.ParentId = parent.Id
+	}
+	// The dump path is left empty, the segment belongs to the server
+	backupId, err := app.Db.Backup.Create(backup)
+	if err != nil {
+		return fmt.Errorf("failed to create backup => %s", err)
+	}
+	created, err := app.Db.Backup.ReadOrError(backupId)
+	if err != nil {
+		return fmt.Errorf("failed to read backup => %s", err)
+	}
+
+	uploadDump(ctx, app, label, created, walPath)
+
+	archived, err := HandleBackupStatus(app, backupId)
+	if err != nil {
+		return fmt.Errorf("failed to handle backup (%s) status => %s", backupId, err)
+	}
+	writeCatalog(ctx, app, backupId)
+	if archived.Status != model.BACKUP_STATUS_FINISHED {
+		return fmt.Errorf("failed to upload WAL segment (%s) of data source (%s), see backup (%s)", walName, label, backupId)
+	}
+	return nil
+}
+
+func getBaseBackupDumper(app *application.App, label string) (dumper.BaseBackupDumper, error) {
+	for _, d := range app.Dumpers {
+		if d.GetLabel() != label {
+			continue
+		}
+		baseBackupDumper, ok := d.(dumper.BaseBackupDumper)
+		if !ok {
+			return nil, fmt.Errorf("data source (%s) does not archive WAL segments", label)
+		}
+		return baseBackupDumper, nil
+	}
+	return nil, fmt.Errorf("data source (%s) not found", label)
+}
@@ -1,11 +1,15 @@
 package http
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/url"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/model"
 	"github.com/herytz/backupman/core/service"
 )
 
@@ -20,17 +24,119 @@ func ListBackup(app *application.App) gin.HandlerFunc {
 	}
 }
 
-func CreateBackup(app *application.App) gin.HandlerFunc {
+type createBackupRequest struct {
+	// Labels of the data sources to back up, every data source when empty
+	DataSources []string `json:"data_sources"`
+}
+
+// CreateBackup starts a backup run cancelled when ctx is done, the request
+// returning once it is started
+func CreateBackup(ctx context.Context, app *application.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		var request createBackupRequest
+		if c.Request.ContentLength != 0 {
+			err := c.ShouldBindJSON(&request)
+			if err != nil {
+				c.JSON(400, gin.H{"Error": err.Error()})
+				return
+			}
+		}
+		err := service.CheckDataSources(app, request.DataSources)
+		if err != nil {
+			c.JSON(400, gin.H{"Error": err.Error()})
+			return
+		}
+		runId, err := service.StartBackupRun(app, model.RUN_TRIGGER_API, c.GetHeader("X-Api-Key"))
+		if err != nil {
+			c.JSON(500, gin.H{"Error": err.Error()})
+			return
+		}
 		go func() {
-			backupIds, err := service.Backup(app)
+			backupIds, err := service.Backup(ctx, app, runId, request.DataSources...)
 			if err != nil {
 				log.Printf("%s", err)
 				return
 			}
 			log.Printf("Backup created with ID: %v", backupIds)
 		}()
-		c.JSON(200, gin.H{"Message": "Backup started"})
+		c.JSON(200, gin.H{"Message": "Backup started", "RunId": runId})
+	}
+}
+
+func GetRun(app *application.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		run, err := service.GetBackupRun(app, c.Param("id"))
+		if err != nil {
+			c.JSON(404, gin.H{"Error": err.Error()})
+			return
+		}
+		c.JSON(200, run)
+	}
+}
+
+type retryBackupsRequest struct {
+	// Duration like 24h, only the backups created within it are retried
+	Since       string `json:"since"`
+	DataSource  string `json:"data_source"`
+	Concurrency int    `json:"concurrency"`
+}
+
+// RetryBackups starts the retry of the failed backups cancelled when ctx is
+// done, the request returning the retried backups once it is started
+func RetryBackups(ctx context.Context, app *application.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request retryBackupsRequest
+		if c.Request.ContentLength != 0 {
+			err := c.ShouldBindJSON(&request)
+			if err != nil {
+				c.JSON(400, gin.H{"Error": err.Error()})
+				return
+			}
+		}
+		input := service.BackupRetryAllInput{
+			DataSource:  request.DataSource,
+			Concurrency: request.Concurrency,
+		}
+		if request.Since != "" {
+			since, err := time.ParseDuration(request.Since)
+			if err != nil {
+				c.JSON(400, gin.H{"Error": "invalid since (" + request.Since + "): " + err.Error()})
+				return
+			}
+			input.Since = since
+		}
+		output, err := service.FailedBackupsToRetry(app, input)
+		if err != nil {
+			c.JSON(500, gin.H{"Error": err.Error()})
+			return
+		}
+		backupIds := make([]string, 0, len(output.Results))
+		for _, result := range output.Results {
+			backupIds = append(backupIds, result.BackupId)
+		}
+		go func() {
+			service.RetryBackups(ctx, app, output, input.Concurrency)
+			for _, result := range output.Results {
+				log.Printf("backup (%s) retried with status %s", result.BackupId, result.Status)
+			}
+		}()
+		c.JSON(202, gin.H{"Message": "Retry started", "BackupIds": backupIds})
+	}
+}
+
+func CancelBackup(app *application.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		backupId := c.Param("id")
+		err := service.CancelBackup(app, backupId)
+		if errors.Is(err, service.ErrBackupNotRunning) {
+			c.JSON(409, gin.H{"Error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(404, gin.H{"Error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"Message": "Backup cancelled"})
 	}
 }
 
@@ -49,7 +155,7 @@ func GenerateDownloadUrl(app *application.App) gin.HandlerFunc {
 func DownloadFile(app *application.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		driveFileId := c.Param("id")
-		output, err := service.Download(app, driveFileId)
+		output, err := service.Download(c.Request.Context(), app, driveFileId)
 		if err != nil {
 			c.JSON(500, gin.H{"Error": err.Error()})
 			return
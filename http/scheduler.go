@@ -1,15 +1,19 @@
 package http
 
 import (
+	"context"
 	"fmt"
 	"log"
 
 	"github.com/go-co-op/gocron/v2"
 	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/model"
 	"github.com/herytz/backupman/core/service"
 )
 
-func SetupScheduler(app *application.App) (gocron.Scheduler, error) {
+// SetupScheduler creates the scheduled jobs of the application, their backups
+// being cancelled when ctx is done
+func SetupScheduler(ctx context.Context, app *application.App) (gocron.Scheduler, error) {
 	scheduler, err := gocron.NewScheduler()
 	if err != nil {
 		log.Fatalf("failed to create scheduler => %s", err)
@@ -21,7 +25,12 @@ func SetupScheduler(app *application.App) (gocron.Scheduler, error) {
 			gocron.NewTask(
 				func(app *application.App) {
 					log.Println("running scheduled backup...")
-					backupIds, err := service.Backup(app)
+					runId, err := service.StartBackupRun(app, model.RUN_TRIGGER_CRON, "")
+					if err != nil {
+						log.Printf("%s", err)
+						return
+					}
+					backupIds, err := service.Backup(ctx, app, runId)
 					if err != nil {
 						log.Printf("%s", err)
 					} else {
@@ -37,5 +46,55 @@ func SetupScheduler(app *application.App) (gocron.Scheduler, error) {
 		log.Printf("scheduler job created, ID=%s\n", job.ID())
 	}
 
+	if app.Http.RetryJob.Enabled {
+		job, err := scheduler.NewJob(
+			gocron.CronJob(app.Http.RetryJob.Cron, true),
+			gocron.NewTask(
+				func(app *application.App) {
+					log.Println("running scheduled upload retry...")
+					backupIds, err := service.RetryFailedUploads(ctx, app)
+					if err != nil {
+						log.Printf("%s", err)
+					} else {
+						log.Printf("scheduled upload retry done, %v backups retried", backupIds)
+					}
+				},
+				app,
+			),
+			gocron.WithSingletonMode(gocron.LimitModeReschedule),
+		)
+		if err != nil {
+			return scheduler, fmt.Errorf("Failed to create retry job => %s", err)
+		}
+		log.Printf("scheduler retry job created, ID=%s\n", job.ID())
+	}
+
+	for label, options := range app.DataSourceOptions {
+		if !options.Incremental.Enabled {
+			continue
+		}
+		job, err := scheduler.NewJob(
+			gocron.CronJob(options.Incremental.Cron, true),
+			gocron.NewTask(
+				func(app *application.App, label string) {
+					log.Printf("running scheduled incremental backup of data source (%s)...", label)
+					backupIds, err := service.BackupIncremental(ctx, app, label)
+					if err != nil {
+						log.Printf("%s", err)
+					} else {
+						log.Printf("scheduled incremental backup done, %v backups created", backupIds)
+					}
+				},
+				app,
+				label,
+			),
+			gocron.WithSingletonMode(gocron.LimitModeReschedule),
+		)
+		if err != nil {
+			return scheduler, fmt.Errorf("Failed to create incremental job for data source (%s) => %s", label, err)
+		}
+		log.Printf("scheduler incremental job created for data source (%s), ID=%s\n", label, job.ID())
+	}
+
 	return scheduler, nil
 }
@@ -1,17 +1,27 @@
 package http
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	nethttp "net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/herytz/backupman/core/application"
 )
 
-func Serve(app *application.App, port int) error {
+// Maximum duration of the requests still running when the server stops
+const SHUTDOWN_TIMEOUT = 30 * time.Second
+
+// Serve runs the HTTP server and the scheduled jobs until ctx is done. The
+// backups started by the server are then cancelled, Serve returning once they
+// are recorded.
+func Serve(ctx context.Context, app *application.App, port int) error {
 	app.Mode = application.APP_MODE_WEB
 
-	scheduler, err := SetupScheduler(app)
+	scheduler, err := SetupScheduler(ctx, app)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -28,10 +38,36 @@ func Serve(app *application.App, port int) error {
 
 	apiRouter := router.Group("/api", Auth(app))
 	apiRouter.GET("/backups", ListBackup(app))
-	apiRouter.POST("/backups", CreateBackup(app))
+	apiRouter.POST("/backups", CreateBackup(ctx, app))
+	apiRouter.POST("/backups/retry", RetryBackups(ctx, app))
+	apiRouter.POST("/backups/:id/cancel", CancelBackup(app))
 	apiRouter.GET("/backups/:id/generate-download-url", GenerateDownloadUrl(app))
 	apiRouter.GET("/backups/:id/download", DownloadFile(app))
+	apiRouter.GET("/runs/:id", GetRun(app))
+
+	server := &nethttp.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: router,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+		defer cancel()
+		err := server.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Printf("failed to shutdown server => %s", err)
+		}
+	}()
 
 	fmt.Printf("Server is running on port %d\n", port)
-	return router.Run(fmt.Sprintf(":%d", port))
+	err = server.ListenAndServe()
+	if !errors.Is(err, nethttp.ErrServerClosed) {
+		return err
+	}
+	err = scheduler.Shutdown()
+	if err != nil {
+		log.Printf("failed to shutdown scheduler => %s", err)
+	}
+	app.Running.Wait()
+	return nil
 }
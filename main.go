@@ -34,6 +34,11 @@ func main() {
 
 	rootCmd.AddCommand(cmd.RunBackup(versionConfig))
 	rootCmd.AddCommand(cmd.RetryBackup(versionConfig))
+	rootCmd.AddCommand(cmd.RestoreBackup(versionConfig))
+	rootCmd.AddCommand(cmd.Replicate(versionConfig))
+	rootCmd.AddCommand(cmd.Reconcile(versionConfig))
+	rootCmd.AddCommand(cmd.Catalog(versionConfig))
+	rootCmd.AddCommand(cmd.WalArchive(versionConfig))
 	rootCmd.AddCommand(cmd.ServeBackup(versionConfig))
 	rootCmd.AddCommand(cmd.Version(versionConfig))
 	rootCmd.AddCommand(cmd.Health(versionConfig))
@@ -0,0 +1,16 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func RunAddBackupIndexes(cnx *sql.DB) error {
+	for _, column := range []string{"run_id", "status", "retry_of_id"} {
+		_, err := cnx.Exec(fmt.Sprintf("CREATE INDEX idx_backups_%s ON backups (%s)", column, column))
+		if err != nil {
+			return fmt.Errorf("failed to add index on %s column of backups table => %w", column, err)
+		}
+	}
+	return nil
+}
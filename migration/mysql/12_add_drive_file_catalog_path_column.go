@@ -0,0 +1,14 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func RunAddDriveFileCatalogPathColumn(cnx *sql.DB) error {
+	_, err := cnx.Exec("ALTER TABLE backup_drive_files ADD COLUMN catalog_path TEXT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to add catalog_path column to backup_drive_files table => %w", err)
+	}
+	return nil
+}
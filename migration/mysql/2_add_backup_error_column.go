@@ -0,0 +1,14 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func RunAddBackupErrorColumn(cnx *sql.DB) error {
+	_, err := cnx.Exec("ALTER TABLE backups ADD COLUMN error TEXT")
+	if err != nil {
+		return fmt.Errorf("failed to add error column to backups table => %w", err)
+	}
+	return nil
+}
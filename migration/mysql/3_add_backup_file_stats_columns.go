@@ -0,0 +1,20 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func RunAddBackupFileStatsColumns(cnx *sql.DB) error {
+	queries := []string{
+		"ALTER TABLE backups ADD COLUMN file_count BIGINT",
+		"ALTER TABLE backups ADD COLUMN total_size BIGINT",
+	}
+	for _, query := range queries {
+		_, err := cnx.Exec(query)
+		if err != nil {
+			return fmt.Errorf("failed to add file stats columns to backups table => %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func RunWidenLabelColumns(cnx *sql.DB) error {
+	for _, table := range []string{"backups", "backup_drive_files"} {
+		_, err := cnx.Exec(fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN label VARCHAR(255) NOT NULL", table))
+		if err != nil {
+			return fmt.Errorf("failed to widen label column of %s table => %w", table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func RunAddBackupPositionIndex(cnx *sql.DB) error {
+	_, err := cnx.Exec("CREATE INDEX idx_backups_label_kind_position ON backups (label, kind, position)")
+	if err != nil {
+		return fmt.Errorf("failed to add position index on backups table => %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func RunAddBackupRetryOfColumn(cnx *sql.DB) error {
+	_, err := cnx.Exec("ALTER TABLE backups ADD COLUMN retry_of_id VARCHAR(36)")
+	if err != nil {
+		return fmt.Errorf("failed to add retry_of_id column to backups table => %w", err)
+	}
+	return nil
+}
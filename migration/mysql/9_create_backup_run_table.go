@@ -0,0 +1,29 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func RunCreateBackupRunTable(cnx *sql.DB) error {
+	backupRunTableQuery := `
+CREATE TABLE backup_runs (
+    id VARCHAR(36) PRIMARY KEY,
+    trigger_source VARCHAR(50) NOT NULL,
+    api_key VARCHAR(64),
+    status VARCHAR(50) NOT NULL,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ended_at TIMESTAMP NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci
+	`
+	_, err := cnx.Exec(backupRunTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create backup_runs table => %w", err)
+	}
+
+	_, err = cnx.Exec("ALTER TABLE backups ADD COLUMN run_id VARCHAR(36)")
+	if err != nil {
+		return fmt.Errorf("failed to add run_id column to backups table => %w", err)
+	}
+	return nil
+}
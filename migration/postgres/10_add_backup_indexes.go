@@ -0,0 +1,18 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func RunAddBackupIndexes(cnx *pgxpool.Pool) error {
+	for _, column := range []string{"run_id", "status", "retry_of_id"} {
+		_, err := cnx.Exec(context.Background(), fmt.Sprintf("CREATE INDEX idx_backups_%s ON backups (%s)", column, column))
+		if err != nil {
+			return fmt.Errorf("failed to add index on %s column of backups table => %w", column, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func RunAddDriveFilePartsColumn(cnx *pgxpool.Pool) error {
+	_, err := cnx.Exec(context.Background(), "ALTER TABLE backup_drive_files ADD COLUMN parts TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return fmt.Errorf("failed to add parts column to backup_drive_files table => %w", err)
+	}
+	return nil
+}
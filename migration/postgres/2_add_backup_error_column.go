@@ -0,0 +1,16 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func RunAddBackupErrorColumn(cnx *pgxpool.Pool) error {
+	_, err := cnx.Exec(context.Background(), "ALTER TABLE backups ADD COLUMN error TEXT")
+	if err != nil {
+		return fmt.Errorf("failed to add error column to backups table => %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func RunAddBackupFileStatsColumns(cnx *pgxpool.Pool) error {
+	queries := []string{
+		"ALTER TABLE backups ADD COLUMN file_count BIGINT",
+		"ALTER TABLE backups ADD COLUMN total_size BIGINT",
+	}
+	for _, query := range queries {
+		_, err := cnx.Exec(context.Background(), query)
+		if err != nil {
+			return fmt.Errorf("failed to add file stats columns to backups table => %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func RunWidenLabelColumns(cnx *pgxpool.Pool) error {
+	for _, table := range []string{"backups", "backup_drive_files"} {
+		_, err := cnx.Exec(context.Background(), fmt.Sprintf("ALTER TABLE %s ALTER COLUMN label TYPE VARCHAR(255)", table))
+		if err != nil {
+			return fmt.Errorf("failed to widen label column of %s table => %w", table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func RunAddBackupIncrementalColumns(cnx *pgxpool.Pool) error {
+	queries := []string{
+		"ALTER TABLE backups ADD COLUMN kind VARCHAR(20)",
+		"ALTER TABLE backups ADD COLUMN parent_id VARCHAR(36)",
+		"ALTER TABLE backups ADD COLUMN position VARCHAR(255)",
+	}
+	for _, query := range queries {
+		_, err := cnx.Exec(context.Background(), query)
+		if err != nil {
+			return fmt.Errorf("failed to add incremental columns to backups table => %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func RunAddBackupPositionIndex(cnx *pgxpool.Pool) error {
+	_, err := cnx.Exec(context.Background(), "CREATE INDEX idx_backups_label_kind_position ON backups (label, kind, position)")
+	if err != nil {
+		return fmt.Errorf("failed to add position index on backups table => %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func RunAddBackupRetryOfColumn(cnx *pgxpool.Pool) error {
+	_, err := cnx.Exec(context.Background(), "ALTER TABLE backups ADD COLUMN retry_of_id VARCHAR(36)")
+	if err != nil {
+		return fmt.Errorf("failed to add retry_of_id column to backups table => %w", err)
+	}
+	return nil
+}
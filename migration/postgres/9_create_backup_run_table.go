@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func RunCreateBackupRunTable(cnx *pgxpool.Pool) error {
+	backupRunTableQuery := `
+CREATE TABLE backup_runs (
+    id VARCHAR(36) PRIMARY KEY,
+    trigger_source VARCHAR(50) NOT NULL,
+    api_key VARCHAR(64),
+    status VARCHAR(50) NOT NULL,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ended_at TIMESTAMP
+)
+	`
+	_, err := cnx.Exec(context.Background(), backupRunTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create backup_runs table => %w", err)
+	}
+
+	_, err = cnx.Exec(context.Background(), "ALTER TABLE backups ADD COLUMN run_id VARCHAR(36)")
+	if err != nil {
+		return fmt.Errorf("failed to add run_id column to backups table => %w", err)
+	}
+	return nil
+}
@@ -26,6 +26,50 @@ func RunPostgres(db application.PostgresDbConfig) error {
 			version: "1",
 			fn:      RunCreateBackupDriveFileTable,
 		},
+		{
+			version: "2",
+			fn:      RunAddBackupErrorColumn,
+		},
+		{
+			version: "3",
+			fn:      RunAddBackupFileStatsColumns,
+		},
+		{
+			version: "4",
+			fn:      RunWidenLabelColumns,
+		},
+		{
+			version: "5",
+			fn:      RunAddBackupIncrementalColumns,
+		},
+		{
+			version: "6",
+			fn:      RunAddBackupPositionIndex,
+		},
+		{
+			version: "7",
+			fn:      RunAddDriveFileAttemptsColumn,
+		},
+		{
+			version: "8",
+			fn:      RunAddBackupRetryOfColumn,
+		},
+		{
+			version: "9",
+			fn:      RunCreateBackupRunTable,
+		},
+		{
+			version: "10",
+			fn:      RunAddBackupIndexes,
+		},
+		{
+			version: "11",
+			fn:      RunAddDriveFilePartsColumn,
+		},
+		{
+			version: "12",
+			fn:      RunAddDriveFileCatalogPathColumn,
+		},
 	}
 
 	for _, migration := range migrations {
@@ -0,0 +1,14 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func RunAddDriveFilePartsColumn(cnx *sql.DB) error {
+	_, err := cnx.Exec("ALTER TABLE backup_drive_files ADD COLUMN parts TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return fmt.Errorf("failed to add parts column to backup_drive_files table => %w", err)
+	}
+	return nil
+}
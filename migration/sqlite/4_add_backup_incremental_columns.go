@@ -0,0 +1,21 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func RunAddBackupIncrementalColumns(cnx *sql.DB) error {
+	queries := []string{
+		"ALTER TABLE backups ADD COLUMN kind VARCHAR(20)",
+		"ALTER TABLE backups ADD COLUMN parent_id VARCHAR(36)",
+		"ALTER TABLE backups ADD COLUMN position VARCHAR(255)",
+	}
+	for _, query := range queries {
+		_, err := cnx.Exec(query)
+		if err != nil {
+			return fmt.Errorf("failed to add incremental columns to backups table => %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func RunAddDriveFileAttemptsColumn(cnx *sql.DB) error {
+	_, err := cnx.Exec("ALTER TABLE backup_drive_files ADD COLUMN attempts INT NOT NULL DEFAULT 0")
+	if err != nil {
+		return fmt.Errorf("failed to add attempts column to backup_drive_files table => %w", err)
+	}
+	return nil
+}
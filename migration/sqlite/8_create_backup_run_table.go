@@ -0,0 +1,29 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func RunCreateBackupRunTable(cnx *sql.DB) error {
+	backupRunTableQuery := `
+CREATE TABLE backup_runs (
+    id TEXT PRIMARY KEY,
+    trigger_source TEXT NOT NULL,
+    api_key TEXT,
+    status TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ended_at TIMESTAMP
+)
+	`
+	_, err := cnx.Exec(backupRunTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create backup_runs table => %w", err)
+	}
+
+	_, err = cnx.Exec("ALTER TABLE backups ADD COLUMN run_id VARCHAR(36)")
+	if err != nil {
+		return fmt.Errorf("failed to add run_id column to backups table => %w", err)
+	}
+	return nil
+}
@@ -25,6 +25,46 @@ func RunSqlite(db application.SqliteDbConfig) error {
 			version: "1",
 			fn:      RunCreateBackupDriveFileTable,
 		},
+		{
+			version: "2",
+			fn:      RunAddBackupErrorColumn,
+		},
+		{
+			version: "3",
+			fn:      RunAddBackupFileStatsColumns,
+		},
+		{
+			version: "4",
+			fn:      RunAddBackupIncrementalColumns,
+		},
+		{
+			version: "5",
+			fn:      RunAddBackupPositionIndex,
+		},
+		{
+			version: "6",
+			fn:      RunAddDriveFileAttemptsColumn,
+		},
+		{
+			version: "7",
+			fn:      RunAddBackupRetryOfColumn,
+		},
+		{
+			version: "8",
+			fn:      RunCreateBackupRunTable,
+		},
+		{
+			version: "9",
+			fn:      RunAddBackupIndexes,
+		},
+		{
+			version: "10",
+			fn:      RunAddDriveFilePartsColumn,
+		},
+		{
+			version: "11",
+			fn:      RunAddDriveFileCatalogPathColumn,
+		},
 	}
 
 	for _, migration := range migrations {
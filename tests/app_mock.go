@@ -32,6 +32,7 @@ func NewAppMock() *application.App {
 		db = dao.Dao{
 			Backup:    memory.NewBackupDaoMemory(memoryDb),
 			DriveFile: memory.NewDriveFileDaoMemory(memoryDb),
+			BackupRun: memory.NewBackupRunDaoMemory(memoryDb),
 			Health:    lib.MockUpHelthChecker{},
 		}
 		notifiers = append(notifiers, &notifier.MockNotifier{})
@@ -50,6 +51,8 @@ func NewAppMock() *application.App {
 			"root",
 			"backupman",
 			"false",
+			dumper.SqlDumpOptions{},
+			dumper.BinlogOptions{},
 		))
 		err := migration.Run(application.MysqlDbConfig{
 			Host:     "localhost",
@@ -69,6 +72,7 @@ func NewAppMock() *application.App {
 		db = dao.Dao{
 			Backup:    mysql.NewBackupDaoMysql(dbConn),
 			DriveFile: mysql.NewDriveFileDaoMysql(dbConn),
+			BackupRun: mysql.NewBackupRunDaoMysql(dbConn),
 			Health:    lib.NewHealthMysql(dbConn),
 		}
 		mailerTransport := mailer.NewStdMailer(
@@ -88,6 +92,8 @@ func NewAppMock() *application.App {
 	app.Dumpers = dumpers
 	app.Db = db
 	app.Notifiers = notifiers
+	app.Limiter = application.NewLimiter(application.ConcurrencyConfig{}, nil)
+	app.Running = application.NewRunningBackups()
 
 	return &app
 }
@@ -0,0 +1,232 @@
+package tests_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/model"
+	"github.com/herytz/backupman/core/notifier"
+	"github.com/herytz/backupman/core/service"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingDumperMock dumps until its context is done
+type blockingDumperMock struct {
+	databaseDumperMock
+	started chan struct{}
+}
+
+func (d *blockingDumperMock) Dump(ctx context.Context) (string, error) {
+	close(d.started)
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+// blockingDriveMock uploads until its context is done
+type blockingDriveMock struct {
+	memoryDriveMock
+	started chan struct{}
+}
+
+func (d *blockingDriveMock) Upload(ctx context.Context, srcPath string) (drive.DriveFile, error) {
+	if d.started != nil {
+		close(d.started)
+		d.started = nil
+	}
+	<-ctx.Done()
+	return drive.DriveFile{}, ctx.Err()
+}
+
+// runningBackup starts Backup and returns the ID of its backup once started is
+// closed, with the channel receiving the result of Backup
+func runningBackup(t *testing.T, app *application.App, started chan struct{}) (string, chan []string) {
+	result := make(chan []string)
+	go func() {
+		backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+		assert.NoError(t, err)
+		result <- backupIds
+	}()
+	<-started
+	backups, err := app.Db.Backup.ReadAllFull()
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+	return backups[0].Id, result
+}
+
+func TestBackupDumpTimeout(t *testing.T) {
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{&blockingDumperMock{databaseDumperMock: databaseDumperMock{label: "shop"}, started: make(chan struct{})}}
+	app.Drives = []drive.Drive{&memoryDriveMock{}}
+	app.DataSourceOptions = map[string]application.DataSourceOptions{
+		"shop": {DumpTimeout: 20 * time.Millisecond},
+	}
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	assert.Len(t, backupIds, 1)
+	backup, err := app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, backup.Status)
+	assert.Contains(t, backup.Error, "dump timed out after 20ms")
+}
+
+func TestBackupUploadTimeout(t *testing.T) {
+	slow := &blockingDriveMock{}
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{&databaseDumperMock{label: "shop"}}
+	app.Drives = []drive.Drive{slow}
+	app.DriveOptions = map[string]application.DriveOptions{
+		"memory": {
+			UploadTimeout: 20 * time.Millisecond,
+			Retry:         application.RetryConfig{Attempts: 2, InitialDelay: time.Millisecond},
+		},
+	}
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	backup, err := app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, backup.Status)
+	assert.Len(t, backup.DriveFiles, 1)
+	assert.Equal(t, model.DRIVE_FILE_STATUS_FAILED, backup.DriveFiles[0].Status)
+	// Every attempt timed out
+	assert.Equal(t, 2, backup.DriveFiles[0].Attempts)
+}
+
+func TestCancelBackupWhileDumping(t *testing.T) {
+	started := make(chan struct{})
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{&blockingDumperMock{databaseDumperMock: databaseDumperMock{label: "shop"}, started: started}}
+	app.Drives = []drive.Drive{&memoryDriveMock{}}
+
+	backupId, result := runningBackup(t, app, started)
+	err := service.CancelBackup(app, backupId)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{backupId}, <-result)
+
+	backup, err := app.Db.Backup.ReadFullById(backupId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_CANCELLED, backup.Status)
+	assert.Equal(t, "backup cancelled", backup.Error)
+	assert.Empty(t, backup.DriveFiles)
+
+	err = service.CancelBackup(app, backupId)
+	assert.ErrorIs(t, err, service.ErrBackupNotRunning)
+	err = service.CancelBackup(app, "unknown")
+	assert.ErrorContains(t, err, "failed to read backup")
+}
+
+func TestCancelBackupWhileUploading(t *testing.T) {
+	started := make(chan struct{})
+	reports := &reportNotifierMock{}
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{&databaseDumperMock{label: "shop"}}
+	app.Drives = []drive.Drive{&blockingDriveMock{started: started}}
+	app.Notifiers = []notifier.Notifier{reports}
+
+	backupId, result := runningBackup(t, app, started)
+	err := service.CancelBackup(app, backupId)
+	assert.NoError(t, err)
+	<-result
+
+	backup, err := app.Db.Backup.ReadFullById(backupId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_CANCELLED, backup.Status)
+	assert.Len(t, backup.DriveFiles, 1)
+	assert.Equal(t, model.DRIVE_FILE_STATUS_FAILED, backup.DriveFiles[0].Status)
+	// The dump of a cancelled backup is removed, the report is still sent
+	assert.Empty(t, backup.DumpPath)
+	assert.Equal(t, 1, reports.reports[backupId])
+
+	// A cancelled backup is not retried
+	_, err = service.BackupRetry(context.Background(), app, backupId)
+	assert.ErrorContains(t, err, "backup status is not failed")
+	output, err := service.BackupRetryAllFailed(context.Background(), app, service.BackupRetryAllInput{})
+	assert.NoError(t, err)
+	assert.Empty(t, output.Results)
+}
+
+func TestBackupCancelledByContext(t *testing.T) {
+	app := tests.NewAppMock()
+	d := &blockingDumperMock{databaseDumperMock: databaseDumperMock{label: "shop"}, started: make(chan struct{})}
+	app.Dumpers = []dumper.Dumper{d}
+	app.Drives = []drive.Drive{&memoryDriveMock{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-d.started
+		cancel()
+	}()
+	backupIds, err := service.Backup(ctx, app, startRun(t, app))
+	assert.NoError(t, err)
+	backup, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_CANCELLED, backup.Status)
+}
+
+func TestCancelBackupRetry(t *testing.T) {
+	app := tests.NewAppMock()
+	app.Mode = application.APP_MODE_CLI
+	app.Dumpers = []dumper.Dumper{&databaseDumperMock{label: "shop"}}
+	app.Drives = []drive.Drive{&memoryDriveMock{unavailable: true}}
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	backupId := backupIds[0]
+
+	// The drive hangs when the failed upload is retried
+	started := make(chan struct{})
+	app.Drives = []drive.Drive{&blockingDriveMock{started: started}}
+	result := make(chan error)
+	go func() {
+		_, err := service.BackupRetry(context.Background(), app, backupId)
+		result <- err
+	}()
+	<-started
+	err = service.CancelBackup(app, backupId)
+	assert.NoError(t, err)
+	assert.NoError(t, <-result)
+	app.Running.Wait()
+
+	// The backup stays failed with its dump, so it can be retried again
+	backup, err := app.Db.Backup.ReadFullById(backupId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, backup.Status)
+	assert.NotEmpty(t, backup.DumpPath)
+	assert.Equal(t, model.DRIVE_FILE_STATUS_FAILED, backup.DriveFiles[0].Status)
+	err = service.CancelBackup(app, backupId)
+	assert.ErrorIs(t, err, service.ErrBackupNotRunning)
+	os.Remove(backup.DumpPath)
+}
+
+func TestRunningBackupsStartedTwice(t *testing.T) {
+	running := application.NewRunningBackups()
+	firstCtx, firstDone := running.Start(context.Background(), "backup-1")
+	secondCtx, secondDone := running.Start(context.Background(), "backup-1")
+
+	// The backup stays running until both runs are over
+	firstDone()
+	assert.NoError(t, secondCtx.Err())
+	assert.True(t, running.Cancel("backup-1"))
+	assert.Error(t, secondCtx.Err())
+	assert.Error(t, firstCtx.Err())
+
+	waited := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("wait returned while a backup is running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	secondDone()
+	<-waited
+	assert.False(t, running.Cancel("backup-1"))
+}
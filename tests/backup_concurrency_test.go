@@ -0,0 +1,169 @@
+package tests_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/model"
+	"github.com/herytz/backupman/core/notifier"
+	"github.com/herytz/backupman/core/service"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+// concurrencyProbe records the most calls running at the same time
+type concurrencyProbe struct {
+	running int
+	max     int
+	mu      sync.Mutex
+}
+
+func (p *concurrencyProbe) enter() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running++
+	p.max = max(p.max, p.running)
+}
+
+func (p *concurrencyProbe) leave() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running--
+}
+
+func (p *concurrencyProbe) maxRunning() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.max
+}
+
+type slowDumperMock struct {
+	databaseDumperMock
+	probe *concurrencyProbe
+}
+
+func (d *slowDumperMock) Dump(ctx context.Context) (string, error) {
+	d.probe.enter()
+	defer d.probe.leave()
+	time.Sleep(50 * time.Millisecond)
+	return d.databaseDumperMock.Dump(ctx)
+}
+
+type slowDriveMock struct {
+	label string
+	// Uploads of the drive and of every drive
+	probe  *concurrencyProbe
+	global *concurrencyProbe
+}
+
+func (d *slowDriveMock) Upload(ctx context.Context, srcPath string) (drive.DriveFile, error) {
+	d.probe.enter()
+	defer d.probe.leave()
+	d.global.enter()
+	defer d.global.leave()
+	time.Sleep(50 * time.Millisecond)
+	return drive.DriveFile{Path: d.label + "/" + filepath.Base(srcPath)}, nil
+}
+
+func (d *slowDriveMock) Delete(ctx context.Context, path string) error {
+	return nil
+}
+
+func (d *slowDriveMock) Health() error {
+	return nil
+}
+
+func (d *slowDriveMock) GetLabel() string {
+	return d.label
+}
+
+func (d *slowDriveMock) GetProvider() string {
+	return "mock"
+}
+
+// reportNotifierMock counts the reports sent for each backup
+type reportNotifierMock struct {
+	notifier.MockNotifier
+	reports map[string]int
+	mu      sync.Mutex
+}
+
+func (n *reportNotifierMock) BackupReport(ctx context.Context, backupId string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.reports == nil {
+		n.reports = make(map[string]int)
+	}
+	n.reports[backupId]++
+	return nil
+}
+
+func TestBackupDumpsConcurrently(t *testing.T) {
+	dumps := &concurrencyProbe{}
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{
+		&slowDumperMock{databaseDumperMock: databaseDumperMock{label: "shop"}, probe: dumps},
+		&slowDumperMock{databaseDumperMock: databaseDumperMock{label: "blog"}, probe: dumps},
+		&slowDumperMock{databaseDumperMock: databaseDumperMock{label: "wiki"}, probe: dumps},
+		&slowDumperMock{databaseDumperMock: databaseDumperMock{label: "crm"}, probe: dumps},
+	}
+	app.Drives = []drive.Drive{&memoryDriveMock{}}
+	app.Limiter = application.NewLimiter(application.ConcurrencyConfig{Dumps: 2}, nil)
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, dumps.maxRunning())
+
+	// The backups are returned in the order of the data sources
+	assert.Len(t, backupIds, 4)
+	for i, label := range []string{"shop", "blog", "wiki", "crm"} {
+		backup, err := app.Db.Backup.ReadFullById(backupIds[i])
+		assert.NoError(t, err)
+		assert.Equal(t, label, backup.Label)
+		assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+	}
+}
+
+func TestBackupUploadsConcurrently(t *testing.T) {
+	uploads := &concurrencyProbe{}
+	fast := &slowDriveMock{label: "fast", probe: &concurrencyProbe{}, global: uploads}
+	slow := &slowDriveMock{label: "slow", probe: &concurrencyProbe{}, global: uploads}
+	reports := &reportNotifierMock{}
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{
+		&databaseDumperMock{label: "shop"},
+		&databaseDumperMock{label: "blog"},
+		&databaseDumperMock{label: "wiki"},
+	}
+	app.Drives = []drive.Drive{fast, slow}
+	app.Notifiers = []notifier.Notifier{reports}
+	app.Limiter = application.NewLimiter(application.ConcurrencyConfig{Dumps: 3, Uploads: 3}, map[string]application.DriveOptions{
+		"slow": {Concurrency: 1},
+	})
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	assert.Len(t, backupIds, 3)
+	assert.LessOrEqual(t, uploads.maxRunning(), 3)
+	assert.Equal(t, 1, slow.probe.maxRunning())
+	assert.Greater(t, fast.probe.maxRunning(), 1)
+
+	for _, backupId := range backupIds {
+		backup, err := app.Db.Backup.ReadFullById(backupId)
+		assert.NoError(t, err)
+		assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+		assert.Len(t, backup.DriveFiles, 2)
+		for _, driveFile := range backup.DriveFiles {
+			assert.Equal(t, model.DRIVE_FILE_STATUS_FINISHED, driveFile.Status)
+			assert.Equal(t, 1, driveFile.Attempts)
+		}
+		assert.Equal(t, 1, reports.reports[backupId])
+	}
+	assert.Len(t, reports.reports, 3)
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/herytz/backupman/core/application"
 	"github.com/herytz/backupman/core/dao/sqlite"
@@ -45,9 +46,13 @@ func TestSqliteReadFullById(t *testing.T) {
 	driveFileDao := sqlite.NewDriveFileDaoSqlite(sqliteDbConn)
 
 	backupInput := model.Backup{
-		Status:   model.BACKUP_STATUS_FINISHED,
-		Label:    "backupLabel",
-		DumpPath: "/tmp/backup.sql",
+		Status:    model.BACKUP_STATUS_FINISHED,
+		Label:     "backupLabel",
+		DumpPath:  "/tmp/backup.sql",
+		FileCount: 3,
+		TotalSize: 1024,
+		RetryOfId: "0f3d2c91-8e4b-4b7a-a1c6-5d9e7f2a3b44",
+		RunId:     "9a2e4f61-7c3d-4e8b-b5a0-1d6f8c2e4b73",
 	}
 	backup, err := backupDao.Create(backupInput)
 	assert.NoError(t, err)
@@ -68,6 +73,8 @@ func TestSqliteReadFullById(t *testing.T) {
 		Path:     "/tmp/drive_file2",
 		Label:    "driveLabel2",
 		Provider: "local",
+		Attempts: 2,
+		Parts:    []string{"/tmp/drive_file2.001", "/tmp/drive_file2.002"},
 	}
 	driveFile2, err := driveFileDao.Create(driveFile2Input)
 	assert.NoError(t, err)
@@ -78,7 +85,11 @@ func TestSqliteReadFullById(t *testing.T) {
 	assert.Equal(t, backup, backupFull.Id)
 	assert.Equal(t, backupInput.Status, backupFull.Status)
 	assert.Equal(t, backupInput.Label, backupFull.Label)
+	assert.Equal(t, backupInput.FileCount, backupFull.FileCount)
+	assert.Equal(t, backupInput.TotalSize, backupFull.TotalSize)
 	assert.Equal(t, backupInput.DumpPath, backupFull.DumpPath)
+	assert.Equal(t, backupInput.RetryOfId, backupFull.RetryOfId)
+	assert.Equal(t, backupInput.RunId, backupFull.RunId)
 
 	for _, driveFile := range backupFull.DriveFiles {
 		assert.Contains(t, []string{driveFile1, driveFile2}, driveFile.Id)
@@ -86,7 +97,22 @@ func TestSqliteReadFullById(t *testing.T) {
 		assert.Contains(t, []string{driveFile1Input.Path, driveFile2Input.Path}, driveFile.Path)
 		assert.Contains(t, []string{driveFile1Input.Label, driveFile2Input.Label}, driveFile.Label)
 		assert.Contains(t, []string{driveFile1Input.Provider, driveFile2Input.Provider}, driveFile.Provider)
+		assert.Contains(t, []int{driveFile1Input.Attempts, driveFile2Input.Attempts}, driveFile.Attempts)
+		assert.Contains(t, [][]string{driveFile1Input.Parts, driveFile2Input.Parts}, driveFile.Parts)
 	}
+
+	readDriveFile, err := driveFileDao.ReadOrError(driveFile2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, readDriveFile.Attempts)
+	assert.Equal(t, driveFile2Input.Parts, readDriveFile.Parts)
+	readDriveFile.Attempts = 3
+	readDriveFile.Parts = nil
+	_, err = driveFileDao.Update(driveFile2, *readDriveFile)
+	assert.NoError(t, err)
+	readDriveFile, err = driveFileDao.ReadOrError(driveFile2)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, readDriveFile.Attempts)
+	assert.Empty(t, readDriveFile.Parts)
 }
 
 func TestSqliteReadAllFull(t *testing.T) {
@@ -174,3 +200,158 @@ func TestSqliteDelete(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, backup)
 }
+
+func TestSqliteImport(t *testing.T) {
+	connectSqliteDb()
+	defer sqliteDbConn.Close()
+
+	backupDao := sqlite.NewBackupDaoSqlite(sqliteDbConn)
+	driveFileDao := sqlite.NewDriveFileDaoSqlite(sqliteDbConn)
+
+	createdAt := time.Now().AddDate(0, 0, -10).Truncate(time.Second)
+	backupInput := model.Backup{
+		Id:        "5b1f0c3e-2d7a-4f6b-9e8c-3a4d5e6f7a8b",
+		Status:    model.BACKUP_STATUS_FINISHED,
+		Label:     "backupLabel",
+		CreatedAt: createdAt,
+	}
+	assert.NoError(t, backupDao.Import(backupInput))
+	assert.Error(t, backupDao.Import(backupInput))
+	driveFileInput := model.DriveFile{
+		Id:          "8c2d4e6f-1a3b-4c5d-8e9f-0a1b2c3d4e5f",
+		BackupId:    backupInput.Id,
+		Status:      model.DRIVE_FILE_STATUS_FINISHED,
+		Path:        "/tmp/drive_file",
+		Label:       "driveLabel",
+		Provider:    "local",
+		CatalogPath: "/tmp/drive_file.backupman.json",
+		CreatedAt:   createdAt,
+	}
+	assert.NoError(t, driveFileDao.Import(driveFileInput))
+
+	// The creation date is kept, for the retention
+	backups, err := backupDao.ReadOlderThan(time.Now().AddDate(0, 0, -5))
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+	assert.Equal(t, backupInput.Id, backups[0].Id)
+	assert.True(t, createdAt.Equal(backups[0].CreatedAt))
+	assert.Len(t, backups[0].DriveFiles, 1)
+	assert.Equal(t, driveFileInput.Id, backups[0].DriveFiles[0].Id)
+	assert.Equal(t, driveFileInput.CatalogPath, backups[0].DriveFiles[0].CatalogPath)
+	driveFile, err := driveFileDao.ReadOrError(driveFileInput.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, driveFileInput.CatalogPath, driveFile.CatalogPath)
+	assert.True(t, createdAt.Equal(driveFile.CreatedAt))
+}
+
+func TestSqliteBackupRun(t *testing.T) {
+	connectSqliteDb()
+	defer sqliteDbConn.Close()
+
+	runDao := sqlite.NewBackupRunDaoSqlite(sqliteDbConn)
+
+	startedAt := time.Now().UTC().Truncate(time.Second)
+	runId, err := runDao.Create(model.BackupRun{
+		Trigger:   model.RUN_TRIGGER_API,
+		ApiKey:    "5e884898",
+		Status:    model.RUN_STATUS_RUNNING,
+		StartedAt: startedAt,
+	})
+	assert.NoError(t, err)
+
+	run, err := runDao.ReadOrError(runId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.RUN_TRIGGER_API, run.Trigger)
+	assert.Equal(t, "5e884898", run.ApiKey)
+	assert.Equal(t, model.RUN_STATUS_RUNNING, run.Status)
+	assert.True(t, startedAt.Equal(run.StartedAt))
+	assert.True(t, run.EndedAt.IsZero())
+
+	run.Status = model.RUN_STATUS_FINISHED
+	run.EndedAt = startedAt.Add(time.Minute)
+	_, err = runDao.Update(runId, *run)
+	assert.NoError(t, err)
+	run, err = runDao.ReadOrError(runId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.RUN_STATUS_FINISHED, run.Status)
+	assert.True(t, startedAt.Add(time.Minute).Equal(run.EndedAt))
+
+	_, err = runDao.ReadOrError("unknown")
+	assert.ErrorContains(t, err, "no backup run found with id unknown")
+}
+
+func TestSqliteReadByRunIdStatusAndRetry(t *testing.T) {
+	connectSqliteDb()
+	defer sqliteDbConn.Close()
+
+	backupDao := sqlite.NewBackupDaoSqlite(sqliteDbConn)
+	driveFileDao := sqlite.NewDriveFileDaoSqlite(sqliteDbConn)
+
+	runId := "9a2e4f61-7c3d-4e8b-b5a0-1d6f8c2e4b73"
+	failed, err := backupDao.Create(model.Backup{Status: model.BACKUP_STATUS_FAILED, Label: "shop", RunId: runId})
+	assert.NoError(t, err)
+	_, err = driveFileDao.Create(model.DriveFile{BackupId: failed, Status: model.DRIVE_FILE_STATUS_FAILED, Label: "driveLabel", Provider: "local"})
+	assert.NoError(t, err)
+	finished, err := backupDao.Create(model.Backup{Status: model.BACKUP_STATUS_FINISHED, Label: "blog", RunId: runId})
+	assert.NoError(t, err)
+	retry, err := backupDao.Create(model.Backup{Status: model.BACKUP_STATUS_FINISHED, Label: "shop", RetryOfId: failed})
+	assert.NoError(t, err)
+
+	backups, err := backupDao.ReadByRunId(runId)
+	assert.NoError(t, err)
+	ids := make([]string, 0)
+	for _, backup := range backups {
+		ids = append(ids, backup.Id)
+	}
+	assert.ElementsMatch(t, []string{failed, finished}, ids)
+
+	backups, err = backupDao.ReadByStatus(model.BACKUP_STATUS_FAILED)
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+	assert.Equal(t, failed, backups[0].Id)
+	assert.Len(t, backups[0].DriveFiles, 1)
+
+	backup, err := backupDao.ReadRetryOf(failed)
+	assert.NoError(t, err)
+	assert.Equal(t, retry, backup.Id)
+	backup, err = backupDao.ReadRetryOf(finished)
+	assert.NoError(t, err)
+	assert.Nil(t, backup)
+}
+
+func TestSqliteReadByPosition(t *testing.T) {
+	connectSqliteDb()
+	defer sqliteDbConn.Close()
+
+	backupDao := sqlite.NewBackupDaoSqlite(sqliteDbConn)
+
+	positions := []string{"000000010000000000000001", "000000010000000000000002", "000000010000000000000003"}
+	ids := make([]string, 0)
+	for _, position := range positions {
+		id, err := backupDao.Create(model.Backup{Status: model.BACKUP_STATUS_FINISHED, Label: "shop", Kind: model.BACKUP_KIND_WAL, Position: position})
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+	_, err := backupDao.Create(model.Backup{Status: model.BACKUP_STATUS_FINISHED, Label: "shop", Kind: model.BACKUP_KIND_FULL, Position: positions[1]})
+	assert.NoError(t, err)
+	_, err = backupDao.Create(model.Backup{Status: model.BACKUP_STATUS_FINISHED, Label: "blog", Kind: model.BACKUP_KIND_WAL, Position: positions[1]})
+	assert.NoError(t, err)
+
+	backups, err := backupDao.ReadByPosition("shop", model.BACKUP_KIND_WAL, "", "")
+	assert.NoError(t, err)
+	assert.Len(t, backups, 3)
+	backups, err = backupDao.ReadByPosition("shop", model.BACKUP_KIND_WAL, positions[1], "")
+	assert.NoError(t, err)
+	found := make([]string, 0)
+	for _, backup := range backups {
+		found = append(found, backup.Id)
+	}
+	assert.ElementsMatch(t, ids[1:], found)
+	backups, err = backupDao.ReadByPosition("shop", model.BACKUP_KIND_WAL, positions[1], positions[1])
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+	assert.Equal(t, ids[1], backups[0].Id)
+	backups, err = backupDao.ReadByPosition("shop", model.BACKUP_KIND_FULL, "", positions[0])
+	assert.NoError(t, err)
+	assert.Empty(t, backups)
+}
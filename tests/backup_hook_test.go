@@ -0,0 +1,124 @@
+package tests_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/model"
+	"github.com/herytz/backupman/core/service"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordHook returns a hook appending its environment to a log file
+func recordHook(logPath string) []string {
+	return []string{"sh", "-c", `echo "$BACKUPMAN_HOOK $BACKUPMAN_STATUS $BACKUPMAN_LABEL $BACKUPMAN_DUMP_PATH" >> ` + logPath}
+}
+
+func newHookAppMock(hooks application.HooksConfig) *application.App {
+	app := tests.NewAppMock()
+	app.DataSourceOptions = map[string]application.DataSourceOptions{
+		"dumper_mock": {Hooks: hooks},
+	}
+	return app
+}
+
+func readHookLog(t *testing.T, logPath string) string {
+	content, err := os.ReadFile(logPath)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestBackupHooks(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "hooks.log")
+	app := newHookAppMock(application.HooksConfig{
+		PreDump:    recordHook(logPath),
+		PostDump:   recordHook(logPath),
+		PostUpload: recordHook(logPath),
+		OnFailure:  recordHook(logPath),
+	})
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	assert.Len(t, backupIds, 1)
+	backup, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+
+	assert.Equal(t, "pre_dump pending dumper_mock \n"+
+		"post_dump pending dumper_mock ./dumper_mock_db\n"+
+		"post_upload finished dumper_mock ./dumper_mock_db\n", readHookLog(t, logPath))
+}
+
+func TestBackupPreDumpHookFailure(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "hooks.log")
+	app := newHookAppMock(application.HooksConfig{
+		PreDump:   []string{"sh", "-c", "echo maintenance mode unavailable; exit 3"},
+		PostDump:  recordHook(logPath),
+		OnFailure: recordHook(logPath),
+	})
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	assert.Len(t, backupIds, 1)
+	backup, err := app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, backup.Status)
+	assert.Contains(t, backup.Error, "hook (pre_dump) failed")
+	assert.Contains(t, backup.Error, "maintenance mode unavailable")
+	assert.Empty(t, backup.DriveFiles)
+
+	assert.Equal(t, "on_failure failed dumper_mock \n", readHookLog(t, logPath))
+}
+
+func TestBackupHookTimeout(t *testing.T) {
+	app := newHookAppMock(application.HooksConfig{
+		PreDump: []string{"sleep", "5"},
+		Timeout: 100 * time.Millisecond,
+	})
+
+	start := time.Now()
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 3*time.Second)
+	backup, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, backup.Status)
+	assert.Contains(t, backup.Error, "hook (pre_dump) timed out after 100ms")
+}
+
+func TestBackupHookCancelled(t *testing.T) {
+	app := newHookAppMock(application.HooksConfig{
+		PreDump: []string{"sleep", "5"},
+	})
+
+	// The hook is killed when the backup is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	backupIds, err := service.Backup(ctx, app, startRun(t, app))
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 3*time.Second)
+	backup, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_CANCELLED, backup.Status)
+}
+
+func TestBackupPostHookFailureKeepsBackup(t *testing.T) {
+	app := newHookAppMock(application.HooksConfig{
+		PostDump:   []string{"false"},
+		PostUpload: []string{"false"},
+	})
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	backup, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+}
@@ -0,0 +1,264 @@
+package tests_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/model"
+	"github.com/herytz/backupman/core/service"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+// incrementalDumperMock holds a log of changes, its position is the number
+// of changes. Restored dumps are recorded in the restored list.
+type incrementalDumperMock struct {
+	changes   []string
+	positions map[string]string
+	restored  []string
+}
+
+func (d *incrementalDumperMock) write(content string) (string, error) {
+	file, err := os.CreateTemp("", "backupman-*.dump")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	_, err = file.WriteString(content)
+	return file.Name(), err
+}
+
+func (d *incrementalDumperMock) Dump(ctx context.Context) (string, error) {
+	dump, err := d.write("full:" + strings.Join(d.changes, ","))
+	if err != nil {
+		return "", err
+	}
+	if d.positions == nil {
+		d.positions = make(map[string]string)
+	}
+	d.positions[dump] = strconv.Itoa(len(d.changes))
+	return dump, nil
+}
+
+func (d *incrementalDumperMock) DumpPosition(dumpPath string) (string, bool) {
+	position, ok := d.positions[dumpPath]
+	return position, ok
+}
+
+func (d *incrementalDumperMock) CurrentPosition() (string, error) {
+	return strconv.Itoa(len(d.changes)), nil
+}
+
+func (d *incrementalDumperMock) DumpIncremental(ctx context.Context, position string) (string, string, error) {
+	start, err := strconv.Atoi(position)
+	if err != nil {
+		return "", "", err
+	}
+	dump, err := d.write("incremental:" + strings.Join(d.changes[start:], ","))
+	return dump, strconv.Itoa(len(d.changes)), err
+}
+
+func (d *incrementalDumperMock) IsIncremental() bool {
+	return true
+}
+
+func (d *incrementalDumperMock) Restore(dumpPath string) error {
+	content, err := os.ReadFile(dumpPath)
+	d.restored = append(d.restored, string(content))
+	return err
+}
+
+func (d *incrementalDumperMock) RestoreIncremental(dumpPath string, until time.Time) error {
+	return d.Restore(dumpPath)
+}
+
+func (d *incrementalDumperMock) GetLabel() string {
+	return "orders"
+}
+
+func (d *incrementalDumperMock) Health() error {
+	return nil
+}
+
+// memoryDriveMock keeps the uploaded files so they can be downloaded back.
+// Uploads fail while unavailable is set, and for the next failures uploads.
+type memoryDriveMock struct {
+	files       map[string][]byte
+	unavailable bool
+	failures    int
+	uploads     int
+	mu          sync.Mutex
+}
+
+func (d *memoryDriveMock) Upload(ctx context.Context, srcPath string) (drive.DriveFile, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.uploads++
+	if d.unavailable {
+		return drive.DriveFile{}, fmt.Errorf("drive unavailable")
+	}
+	if d.failures > 0 {
+		d.failures--
+		return drive.DriveFile{}, fmt.Errorf("upload interrupted")
+	}
+	content, err := os.ReadFile(srcPath)
+	if err != nil {
+		return drive.DriveFile{}, err
+	}
+	if d.files == nil {
+		d.files = make(map[string][]byte)
+	}
+	path := fmt.Sprintf("file-%d", d.uploads)
+	d.files[path] = content
+	return drive.DriveFile{Path: path}, nil
+}
+
+func (d *memoryDriveMock) Download(ctx context.Context, path, dstPath string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	content, ok := d.files[path]
+	if !ok {
+		return fmt.Errorf("file %s not found", path)
+	}
+	return os.WriteFile(dstPath, content, 0644)
+}
+
+func (d *memoryDriveMock) Delete(ctx context.Context, path string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.files, path)
+	return nil
+}
+
+func (d *memoryDriveMock) Health() error {
+	return nil
+}
+
+func (d *memoryDriveMock) GetLabel() string {
+	return "memory"
+}
+
+func (d *memoryDriveMock) GetProvider() string {
+	return "memory"
+}
+
+func newIncrementalAppMock() (*application.App, *incrementalDumperMock) {
+	d := &incrementalDumperMock{}
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{d}
+	app.Drives = []drive.Drive{&memoryDriveMock{}}
+	return app, d
+}
+
+func TestBackupIncrementalChain(t *testing.T) {
+	app, d := newIncrementalAppMock()
+
+	// Nothing to continue before the first full backup
+	backupIds, err := service.BackupIncremental(context.Background(), app)
+	assert.NoError(t, err)
+	assert.Empty(t, backupIds)
+
+	d.changes = []string{"a"}
+	backupIds, err = service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	full, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_KIND_FULL, full.Kind)
+	assert.Equal(t, "1", full.Position)
+
+	// Nothing changed since the full backup
+	backupIds, err = service.BackupIncremental(context.Background(), app)
+	assert.NoError(t, err)
+	assert.Empty(t, backupIds)
+
+	d.changes = append(d.changes, "b", "c")
+	backupIds, err = service.BackupIncremental(context.Background(), app)
+	assert.NoError(t, err)
+	assert.Len(t, backupIds, 1)
+	first, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_KIND_INCREMENTAL, first.Kind)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, first.Status)
+	assert.Equal(t, full.Id, first.ParentId)
+	assert.Equal(t, "3", first.Position)
+
+	d.changes = append(d.changes, "d")
+	backupIds, err = service.BackupIncremental(context.Background(), app)
+	assert.NoError(t, err)
+	second, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, full.Id, second.ParentId)
+	assert.Equal(t, "4", second.Position)
+
+	err = service.Restore(app, second.Id, service.RestoreOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"full:a", "incremental:b,c", "incremental:d"}, d.restored)
+
+	d.restored = nil
+	err = service.Restore(app, first.Id, service.RestoreOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"full:a", "incremental:b,c"}, d.restored)
+
+	d.restored = nil
+	err = service.Restore(app, full.Id, service.RestoreOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"full:a"}, d.restored)
+}
+
+func TestRestoreUntil(t *testing.T) {
+	app, d := newIncrementalAppMock()
+
+	d.changes = []string{"a"}
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	fullId := backupIds[0]
+	d.changes = append(d.changes, "b")
+	backupIds, err = service.BackupIncremental(context.Background(), app)
+	assert.NoError(t, err)
+	firstId := backupIds[0]
+	d.changes = append(d.changes, "c")
+	backupIds, err = service.BackupIncremental(context.Background(), app)
+	assert.NoError(t, err)
+	secondId := backupIds[0]
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{fullId, firstId, secondId} {
+		backup, err := app.Db.Backup.ReadOrError(id)
+		assert.NoError(t, err)
+		backup.CreatedAt = start.Add(time.Duration(i) * time.Hour)
+		_, err = app.Db.Backup.Update(id, *backup)
+		assert.NoError(t, err)
+	}
+
+	// The changes made between the first and the second incremental backups
+	// are held by the second one
+	err = service.Restore(app, fullId, service.RestoreOptions{Until: start.Add(90 * time.Minute)})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"full:a", "incremental:b", "incremental:c"}, d.restored)
+
+	d.restored = nil
+	err = service.Restore(app, fullId, service.RestoreOptions{Until: start.Add(30 * time.Minute)})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"full:a", "incremental:b"}, d.restored)
+
+	err = service.Restore(app, fullId, service.RestoreOptions{Until: start.Add(-time.Hour)})
+	assert.Error(t, err)
+}
+
+func TestRestoreUnsupportedDataSource(t *testing.T) {
+	app := tests.NewAppMock()
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+
+	err = service.Restore(app, backupIds[0], service.RestoreOptions{})
+	assert.ErrorContains(t, err, "does not support restore")
+}
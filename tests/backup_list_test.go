@@ -1,6 +1,7 @@
 package tests_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/herytz/backupman/core/service"
@@ -10,9 +11,9 @@ import (
 
 func TestBackupList(t *testing.T) {
 	app := tests.NewAppMock()
-	backup1Ids, err := service.Backup(app)
+	backup1Ids, err := service.Backup(context.Background(), app, startRun(t, app))
 	assert.NoError(t, err)
-	backup2Ids, err := service.Backup(app)
+	backup2Ids, err := service.Backup(context.Background(), app, startRun(t, app))
 	assert.NoError(t, err)
 	list, err := service.BackupList(app)
 	assert.NoError(t, err)
@@ -1,10 +1,15 @@
 package tests_test
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path"
 	"testing"
+	"time"
 
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
 	"github.com/herytz/backupman/core/model"
 	"github.com/herytz/backupman/core/service"
 	"github.com/herytz/backupman/tests"
@@ -13,7 +18,7 @@ import (
 
 func TestBackupRetry(t *testing.T) {
 	app := tests.NewAppMock()
-	backupIds, err := service.Backup(app)
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
 	assert.NoError(t, err)
 	assert.NotEmpty(t, backupIds)
 	backupId := backupIds[0]
@@ -39,10 +44,167 @@ func TestBackupRetry(t *testing.T) {
 		assert.NoError(t, err)
 	}
 
-	err = service.BackupRetry(app, backupId)
+	retryId, err := service.BackupRetry(context.Background(), app, backupId)
 	assert.NoError(t, err)
+	assert.Equal(t, backupId, retryId)
 	newBackup, err := app.Db.Backup.ReadOrError(backupId)
 	assert.NoError(t, err)
 	assert.Empty(t, newBackup.DumpPath)
 	assert.Equal(t, model.BACKUP_STATUS_FINISHED, newBackup.Status)
 }
+
+func TestBackupRetryAllFailed(t *testing.T) {
+	storage := &memoryDriveMock{unavailable: true}
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{
+		&databaseDumperMock{label: "shop"},
+		&databaseDumperMock{label: "tenants/blog"},
+		&databaseDumperMock{label: "tenants/wiki"},
+		&databaseDumperMock{label: "archive"},
+	}
+	app.Drives = []drive.Drive{storage}
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	assert.Len(t, backupIds, 4)
+	shopId, blogId, wikiId, archiveId := backupIds[0], backupIds[1], backupIds[2], backupIds[3]
+
+	// The dump of the wiki is gone, the archive is too old
+	wiki, err := app.Db.Backup.ReadOrError(wikiId)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Remove(wiki.DumpPath))
+	archive, err := app.Db.Backup.ReadOrError(archiveId)
+	assert.NoError(t, err)
+	archive.CreatedAt = time.Now().Add(-48 * time.Hour)
+	_, err = app.Db.Backup.Update(archiveId, *archive)
+	assert.NoError(t, err)
+
+	storage.unavailable = false
+	output, err := service.BackupRetryAllFailed(context.Background(), app, service.BackupRetryAllInput{
+		Since:      24 * time.Hour,
+		DataSource: "tenants",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []service.BackupRetryResult{
+		{BackupId: blogId, Label: "tenants/blog", Status: model.BACKUP_STATUS_FINISHED},
+	}, output.Results)
+
+	output, err = service.BackupRetryAllFailed(context.Background(), app, service.BackupRetryAllInput{Concurrency: 2})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []service.BackupRetryResult{
+		{BackupId: shopId, Label: "shop", Status: model.BACKUP_STATUS_FINISHED},
+		{BackupId: archiveId, Label: "archive", Status: model.BACKUP_STATUS_FINISHED},
+	}, output.Results)
+
+	wiki, err = app.Db.Backup.ReadOrError(wikiId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, wiki.Status)
+}
+
+func TestBackupRetryAllFailedReportsFailures(t *testing.T) {
+	storage := &memoryDriveMock{unavailable: true}
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{&databaseDumperMock{label: "shop"}}
+	app.Drives = []drive.Drive{storage}
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+
+	output, err := service.BackupRetryAllFailed(context.Background(), app, service.BackupRetryAllInput{})
+	assert.NoError(t, err)
+	assert.Equal(t, []service.BackupRetryResult{
+		{BackupId: backupIds[0], Label: "shop", Status: model.BACKUP_STATUS_FAILED},
+	}, output.Results)
+}
+
+// failingDumperMock fails its first dumps
+type failingDumperMock struct {
+	databaseDumperMock
+	failures int
+}
+
+func (d *failingDumperMock) Dump(ctx context.Context) (string, error) {
+	if d.failures > 0 {
+		d.failures--
+		return "", fmt.Errorf("connection refused")
+	}
+	return d.databaseDumperMock.Dump(ctx)
+}
+
+func TestBackupRetryRedumpsFailedDump(t *testing.T) {
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{&failingDumperMock{databaseDumperMock: databaseDumperMock{label: "shop"}, failures: 1}}
+	app.Drives = []drive.Drive{&memoryDriveMock{}}
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	failedId := backupIds[0]
+	failed, err := app.Db.Backup.ReadFullById(failedId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, failed.Status)
+	assert.Empty(t, failed.DumpPath)
+
+	retryId, err := service.BackupRetry(context.Background(), app, failedId)
+	assert.NoError(t, err)
+	assert.NotEqual(t, failedId, retryId)
+	retried, err := app.Db.Backup.ReadFullById(retryId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, retried.Status)
+	assert.Equal(t, "shop", retried.Label)
+	assert.Equal(t, failedId, retried.RetryOfId)
+	assert.Len(t, retried.DriveFiles, 1)
+
+	// The failed backup is kept as it is and dumped again once
+	failed, err = app.Db.Backup.ReadFullById(failedId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, failed.Status)
+	_, err = service.BackupRetry(context.Background(), app, failedId)
+	assert.ErrorContains(t, err, "already dumped again")
+
+	output, err := service.BackupRetryAllFailed(context.Background(), app, service.BackupRetryAllInput{})
+	assert.NoError(t, err)
+	assert.Empty(t, output.Results)
+}
+
+func TestBackupRetryAllFailedRedumpsDiscoveredDatabase(t *testing.T) {
+	server := &serverDumperMock{databases: []string{"blog", "wiki"}}
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{server}
+	app.Drives = []drive.Drive{&memoryDriveMock{}}
+
+	wikiId, err := app.Db.Backup.Create(model.Backup{
+		Label:  "tenants/wiki",
+		Status: model.BACKUP_STATUS_FAILED,
+		Kind:   model.BACKUP_KIND_FULL,
+		Error:  "connection refused",
+	})
+	assert.NoError(t, err)
+	// A failed discovery is not dumped again, a new backup discovers the databases
+	discoveryId, err := app.Db.Backup.Create(model.Backup{
+		Label:  "tenants",
+		Status: model.BACKUP_STATUS_FAILED,
+		Kind:   model.BACKUP_KIND_FULL,
+		Error:  "access denied",
+	})
+	assert.NoError(t, err)
+
+	output, err := service.BackupRetryAllFailed(context.Background(), app, service.BackupRetryAllInput{})
+	assert.NoError(t, err)
+	assert.Len(t, output.Results, 1)
+	result := output.Results[0]
+	assert.Equal(t, wikiId, result.BackupId)
+	assert.NotEmpty(t, result.NewBackupId)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, result.Status)
+	assert.Empty(t, result.Error)
+
+	retried, err := app.Db.Backup.ReadFullById(result.NewBackupId)
+	assert.NoError(t, err)
+	assert.Equal(t, "tenants/wiki", retried.Label)
+	assert.Equal(t, wikiId, retried.RetryOfId)
+	for _, d := range server.discovered {
+		assert.True(t, d.closed, d.label)
+	}
+
+	_, err = service.BackupRetry(context.Background(), app, discoveryId)
+	assert.ErrorContains(t, err, "failed to discover its databases")
+}
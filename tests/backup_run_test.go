@@ -0,0 +1,105 @@
+package tests_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/model"
+	"github.com/herytz/backupman/core/service"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+// startRun starts a CLI run of the backups of app
+func startRun(t *testing.T, app *application.App) string {
+	runId, err := service.StartBackupRun(app, model.RUN_TRIGGER_CLI, "")
+	assert.NoError(t, err)
+	return runId
+}
+
+func TestBackupRunFinished(t *testing.T) {
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{&databaseDumperMock{label: "shop"}, &databaseDumperMock{label: "blog"}}
+	app.Drives = []drive.Drive{&memoryDriveMock{}}
+
+	runId, err := service.StartBackupRun(app, model.RUN_TRIGGER_API, "secret-key")
+	assert.NoError(t, err)
+	run, err := service.GetBackupRun(app, runId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.RUN_STATUS_RUNNING, run.Status)
+	assert.Equal(t, model.RUN_TRIGGER_API, run.Trigger)
+	assert.True(t, run.EndedAt.IsZero())
+	assert.Empty(t, run.Backups)
+	// Only a fingerprint of the API key is stored
+	assert.Equal(t, service.ApiKeyFingerprint("secret-key"), run.ApiKey)
+	assert.NotContains(t, run.ApiKey, "secret")
+
+	backupIds, err := service.Backup(context.Background(), app, runId)
+	assert.NoError(t, err)
+	run, err = service.GetBackupRun(app, runId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.RUN_STATUS_FINISHED, run.Status)
+	assert.False(t, run.EndedAt.IsZero())
+	assert.Len(t, run.Backups, 2)
+	for _, backup := range run.Backups {
+		assert.Contains(t, backupIds, backup.Id)
+		assert.Equal(t, runId, backup.RunId)
+		assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+	}
+
+	// The backups of another run are not part of it
+	_, err = service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	run, err = service.GetBackupRun(app, runId)
+	assert.NoError(t, err)
+	assert.Len(t, run.Backups, 2)
+}
+
+func TestBackupRunFailed(t *testing.T) {
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{
+		&databaseDumperMock{label: "shop"},
+		&failingDumperMock{databaseDumperMock: databaseDumperMock{label: "blog"}, failures: 1},
+	}
+	app.Drives = []drive.Drive{&memoryDriveMock{}}
+
+	runId := startRun(t, app)
+	_, err := service.Backup(context.Background(), app, runId)
+	assert.NoError(t, err)
+	run, err := service.GetBackupRun(app, runId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.RUN_STATUS_FAILED, run.Status)
+	assert.Equal(t, model.RUN_TRIGGER_CLI, run.Trigger)
+	assert.Empty(t, run.ApiKey)
+	assert.Len(t, run.Backups, 2)
+}
+
+func TestBackupRunCancelled(t *testing.T) {
+	app := tests.NewAppMock()
+	d := &blockingDumperMock{databaseDumperMock: databaseDumperMock{label: "shop"}, started: make(chan struct{})}
+	app.Dumpers = []dumper.Dumper{d}
+	app.Drives = []drive.Drive{&memoryDriveMock{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-d.started
+		cancel()
+	}()
+	runId := startRun(t, app)
+	_, err := service.Backup(ctx, app, runId)
+	assert.NoError(t, err)
+	run, err := service.GetBackupRun(app, runId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.RUN_STATUS_CANCELLED, run.Status)
+}
+
+func TestBackupRunUnknown(t *testing.T) {
+	app := tests.NewAppMock()
+	_, err := service.GetBackupRun(app, "unknown")
+	assert.ErrorContains(t, err, "failed to read backup run")
+	_, err = service.Backup(context.Background(), app, "unknown")
+	assert.ErrorContains(t, err, "failed to read backup run")
+}
@@ -0,0 +1,310 @@
+package tests_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/lib"
+	"github.com/herytz/backupman/core/model"
+	"github.com/herytz/backupman/core/service"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+// streamDumperMock writes its label line by line to the stream, failing after
+// failAfter lines when it is not zero
+type streamDumperMock struct {
+	databaseDumperMock
+	lines     int
+	failAfter int
+	tmpFolder string
+}
+
+func (d *streamDumperMock) NewDumpPath() string {
+	return filepath.Join(d.tmpFolder, fmt.Sprintf("%s.sql", d.label))
+}
+
+func (d *streamDumperMock) DumpTo(ctx context.Context, dumpPath string, w io.Writer) error {
+	for i := 0; i < d.lines; i++ {
+		if d.failAfter > 0 && i == d.failAfter {
+			return fmt.Errorf("connection lost")
+		}
+		_, err := fmt.Fprintf(w, "%s %d\n", d.label, i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *streamDumperMock) content() []byte {
+	var content strings.Builder
+	for i := 0; i < d.lines; i++ {
+		fmt.Fprintf(&content, "%s %d\n", d.label, i)
+	}
+	return []byte(content.String())
+}
+
+// streamDriveMock uploads the streams in memory, its files being complete
+// streams only
+type streamDriveMock struct {
+	memoryDriveMock
+	streams int
+}
+
+func (d *streamDriveMock) UploadStream(ctx context.Context, name string, src io.Reader) (drive.DriveFile, error) {
+	content, err := io.ReadAll(src)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.streams++
+	if err != nil {
+		return drive.DriveFile{}, err
+	}
+	if d.files == nil {
+		d.files = make(map[string][]byte)
+	}
+	path := fmt.Sprintf("stream-%d-%s", d.streams, filepath.Base(name))
+	d.files[path] = content
+	return drive.DriveFile{Path: path}, nil
+}
+
+func streamingApp(t *testing.T, d dumper.Dumper, drives ...drive.Drive) *application.App {
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{d}
+	app.Drives = drives
+	app.DataSourceOptions = map[string]application.DataSourceOptions{
+		d.GetLabel(): {Streaming: true},
+	}
+	return app
+}
+
+func TestBackupStreamingWithoutTmpFile(t *testing.T) {
+	d := &streamDumperMock{databaseDumperMock: databaseDumperMock{label: "shop"}, lines: 1000, tmpFolder: t.TempDir()}
+	streamDrive := &streamDriveMock{}
+	app := streamingApp(t, d, streamDrive)
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	backup, err := app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+	assert.Empty(t, backup.DumpPath)
+	assert.NoFileExists(t, d.NewDumpPath())
+	assert.Len(t, backup.DriveFiles, 1)
+	assert.Equal(t, model.DRIVE_FILE_STATUS_FINISHED, backup.DriveFiles[0].Status)
+	assert.Equal(t, 1, backup.DriveFiles[0].Attempts)
+	assert.Equal(t, d.content(), streamDrive.files[backup.DriveFiles[0].Path])
+	assert.Equal(t, 0, streamDrive.uploads)
+}
+
+func TestBackupStreamingWithTmpFile(t *testing.T) {
+	d := &streamDumperMock{databaseDumperMock: databaseDumperMock{label: "shop"}, lines: 1000, tmpFolder: t.TempDir()}
+	streamDrive := &streamDriveMock{}
+	// The drives unable to stream and the drives retrying their uploads get
+	// the temporary file
+	fileDrive := &memoryDriveMock{}
+	retryDrive := &labeledStreamDriveMock{label: "retry"}
+	app := streamingApp(t, d, streamDrive, fileDrive, retryDrive)
+	app.Mode = application.APP_MODE_CLI
+	app.DriveOptions = map[string]application.DriveOptions{
+		"retry": {Retry: application.RetryConfig{Attempts: 3}},
+	}
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	backup, err := app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+	assert.Len(t, backup.DriveFiles, 3)
+	assert.Equal(t, 1, streamDrive.streams)
+	assert.Equal(t, 1, fileDrive.uploads)
+	assert.Equal(t, 0, retryDrive.streams)
+	assert.Equal(t, 1, retryDrive.uploads)
+	for _, files := range []map[string][]byte{streamDrive.files, fileDrive.files, retryDrive.files} {
+		assert.Len(t, files, 1)
+		for _, content := range files {
+			assert.Equal(t, d.content(), content)
+		}
+	}
+	// The temporary file is removed after the backup
+	assert.NoFileExists(t, d.NewDumpPath())
+}
+
+func TestBackupStreamingDumpFailure(t *testing.T) {
+	d := &streamDumperMock{databaseDumperMock: databaseDumperMock{label: "shop"}, lines: 1000, failAfter: 500, tmpFolder: t.TempDir()}
+	streamDrive := &streamDriveMock{}
+	fileDrive := &memoryDriveMock{}
+	app := streamingApp(t, d, streamDrive, fileDrive)
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	backup, err := app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, backup.Status)
+	assert.Equal(t, "connection lost", backup.Error)
+	// The partial dump is neither stored nor kept
+	assert.Len(t, backup.DriveFiles, 1)
+	assert.Equal(t, model.DRIVE_FILE_STATUS_FAILED, backup.DriveFiles[0].Status)
+	assert.Empty(t, streamDrive.files)
+	assert.Equal(t, 0, fileDrive.uploads)
+	assert.NoFileExists(t, d.NewDumpPath())
+}
+
+func TestBackupStreamingDisabled(t *testing.T) {
+	d := &streamDumperMock{databaseDumperMock: databaseDumperMock{label: "shop"}, lines: 10, tmpFolder: t.TempDir()}
+	streamDrive := &streamDriveMock{}
+	app := streamingApp(t, d, streamDrive)
+	app.DataSourceOptions = nil
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	backup, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+	assert.Equal(t, 0, streamDrive.streams)
+	assert.Equal(t, 1, streamDrive.uploads)
+}
+
+// labeledStreamDriveMock is a streamDriveMock with its own label
+type labeledStreamDriveMock struct {
+	streamDriveMock
+	label string
+}
+
+func (d *labeledStreamDriveMock) GetLabel() string {
+	return d.label
+}
+
+func TestBackupStreamingToSeveralDrives(t *testing.T) {
+	shop := &streamDumperMock{databaseDumperMock: databaseDumperMock{label: "shop"}, lines: 1000, tmpFolder: t.TempDir()}
+	blog := &streamDumperMock{databaseDumperMock: databaseDumperMock{label: "blog"}, lines: 1000, tmpFolder: t.TempDir()}
+	first := &labeledStreamDriveMock{label: "first"}
+	second := &labeledStreamDriveMock{label: "second"}
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{shop, blog}
+	app.Drives = []drive.Drive{first, second}
+	app.DataSourceOptions = map[string]application.DataSourceOptions{
+		"shop": {Streaming: true},
+		"blog": {Streaming: true},
+	}
+	// The dumps run at the same time while a single upload runs at a time
+	// to each drive and to all of them
+	app.Limiter = application.NewLimiter(application.ConcurrencyConfig{Dumps: 2, Uploads: 1}, map[string]application.DriveOptions{
+		"first":  {Concurrency: 1},
+		"second": {Concurrency: 1},
+	})
+
+	result := make(chan []string)
+	go func() {
+		backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+		assert.NoError(t, err)
+		result <- backupIds
+	}()
+	var backupIds []string
+	select {
+	case backupIds = <-result:
+	case <-time.After(10 * time.Second):
+		t.Fatal("streamed backups are blocked")
+	}
+
+	assert.Len(t, backupIds, 2)
+	for _, backupId := range backupIds {
+		backup, err := app.Db.Backup.ReadFullById(backupId)
+		assert.NoError(t, err)
+		assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+		assert.Len(t, backup.DriveFiles, 2)
+		for _, driveFile := range backup.DriveFiles {
+			assert.Equal(t, model.DRIVE_FILE_STATUS_FINISHED, driveFile.Status)
+			assert.Equal(t, 1, driveFile.Attempts)
+		}
+	}
+	assert.Equal(t, 2, first.streams)
+	assert.Equal(t, 2, second.streams)
+}
+
+type failingWriter struct{}
+
+func (w failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestFanOutWriter(t *testing.T) {
+	var first, second strings.Builder
+	w := lib.NewFanOutWriter(&first, failingWriter{}, &second)
+	_, err := io.WriteString(w, "hello ")
+	assert.NoError(t, err)
+	_, err = io.WriteString(w, "world")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", first.String())
+	assert.Equal(t, "hello world", second.String())
+	assert.NoError(t, w.Err(0))
+	assert.EqualError(t, w.Err(1), "disk full")
+
+	w = lib.NewFanOutWriter(failingWriter{})
+	_, err = io.WriteString(w, "hello")
+	assert.EqualError(t, err, "every writer failed => disk full")
+}
+
+func TestLocalDriveUploadStream(t *testing.T) {
+	folder := t.TempDir()
+	localDrive := drive.NewLocalDrive("local", folder)
+	file, err := localDrive.UploadStream(context.Background(), "shop.sql", strings.NewReader("dump"))
+	assert.NoError(t, err)
+	content, err := os.ReadFile(file.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, "dump", string(content))
+
+	// A failing stream leaves nothing on the drive
+	reader, writer := io.Pipe()
+	go func() {
+		writer.Write([]byte("partial"))
+		writer.CloseWithError(errors.New("dump failed"))
+	}()
+	_, err = localDrive.UploadStream(context.Background(), "blog.sql", reader)
+	assert.ErrorContains(t, err, "dump failed")
+	entries, err := os.ReadDir(folder)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestBackupStreamingEmbeddedDatabase(t *testing.T) {
+	dbPath := createExportSqliteDb(t)
+	for _, format := range []string{"", dumper.EXPORT_FORMAT_CSV} {
+		tmpFolder := t.TempDir()
+		d := dumper.NewSqliteDumper("app", tmpFolder, dbPath, format)
+		streamDrive := &streamDriveMock{}
+		app := streamingApp(t, d, streamDrive)
+
+		backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+		assert.NoError(t, err)
+		backup, err := app.Db.Backup.ReadFullById(backupIds[0])
+		assert.NoError(t, err)
+		assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+		assert.Empty(t, backup.DumpPath)
+		written, err := os.ReadDir(tmpFolder)
+		assert.NoError(t, err)
+		assert.Empty(t, written)
+
+		content := streamDrive.files[backup.DriveFiles[0].Path]
+		if format == "" {
+			database, err := os.ReadFile(dbPath)
+			assert.NoError(t, err)
+			assert.Equal(t, database, content)
+			continue
+		}
+		exportPath := filepath.Join(t.TempDir(), "export.tar")
+		assert.NoError(t, os.WriteFile(exportPath, content, 0644))
+		entries, _ := readExportArchive(t, exportPath)
+		assert.Equal(t, "code\n", string(entries["empty_table.csv"]))
+	}
+}
@@ -1,8 +1,11 @@
 package tests_test
 
 import (
+	"context"
 	"testing"
 
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
 	"github.com/herytz/backupman/core/model"
 	"github.com/herytz/backupman/core/service"
 	"github.com/herytz/backupman/tests"
@@ -11,7 +14,7 @@ import (
 
 func TestBackupReport(t *testing.T) {
 	app := tests.NewAppMock()
-	backupIds, err := service.Backup(app)
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
 	assert.NoError(t, err)
 	for _, backupId := range backupIds {
 		assert.NotEqual(t, "", backupId)
@@ -29,3 +32,43 @@ func TestBackupReport(t *testing.T) {
 		assert.Equal(t, len(backupFull.DriveFiles), driveFileFinished)
 	}
 }
+
+func TestBackupDataSources(t *testing.T) {
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{&databaseDumperMock{label: "shop"}, &databaseDumperMock{label: "blog"}, &databaseDumperMock{label: "crm"}}
+	app.Drives = []drive.Drive{&memoryDriveMock{}}
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app), "crm", "shop")
+	assert.NoError(t, err)
+	assert.Len(t, backupIds, 2)
+	labels := make([]string, 0)
+	for _, backupId := range backupIds {
+		backup, err := app.Db.Backup.ReadOrError(backupId)
+		assert.NoError(t, err)
+		assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+		labels = append(labels, backup.Label)
+	}
+	// In the order of the data sources
+	assert.Equal(t, []string{"shop", "crm"}, labels)
+}
+
+func TestBackupUnknownDataSource(t *testing.T) {
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{&databaseDumperMock{label: "shop"}}
+	app.Drives = []drive.Drive{&memoryDriveMock{}}
+
+	err := service.CheckDataSources(app, []string{"shop", "blog"})
+	assert.EqualError(t, err, "unknown data source (blog)")
+	assert.NoError(t, service.CheckDataSources(app, nil))
+
+	runId := startRun(t, app)
+	backupIds, err := service.Backup(context.Background(), app, runId, "blog")
+	assert.EqualError(t, err, "unknown data source (blog)")
+	assert.Empty(t, backupIds)
+	backups, err := app.Db.Backup.ReadAllFull()
+	assert.NoError(t, err)
+	assert.Empty(t, backups)
+	run, err := service.GetBackupRun(app, runId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.RUN_STATUS_FAILED, run.Status)
+}
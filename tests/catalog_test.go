@@ -0,0 +1,165 @@
+package tests_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/model"
+	"github.com/herytz/backupman/core/service"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+// lostCatalogAppMock returns an app with an empty database storing its
+// backups to d, like an app restarted with the memory database
+func lostCatalogAppMock(d drive.Drive) *application.App {
+	app := tests.NewAppMock()
+	app.Mode = application.APP_MODE_CLI
+	app.Dumpers = []dumper.Dumper{&databaseDumperMock{label: "shop"}}
+	app.Drives = []drive.Drive{d}
+	return app
+}
+
+func TestRebuildCatalog(t *testing.T) {
+	folder := t.TempDir()
+	_, backups := reconcileAppMock(t, drive.NewLocalDrive("local", folder), 2)
+	for _, backup := range backups {
+		assert.FileExists(t, backup.DriveFiles[0].CatalogPath)
+	}
+
+	// The drive was renamed when the database was lost
+	app := lostCatalogAppMock(drive.NewLocalDrive("restored", folder))
+	output, err := service.RebuildCatalog(context.Background(), app, "restored")
+	assert.NoError(t, err)
+	assert.Len(t, output.Results, 2)
+	for _, result := range output.Results {
+		assert.Equal(t, service.CATALOG_REBUILD_STATUS_CREATED, result.Status)
+	}
+	for _, backup := range backups {
+		rebuilt, err := app.Db.Backup.ReadFullById(backup.Id)
+		assert.NoError(t, err)
+		assert.Equal(t, backup.Label, rebuilt.Label)
+		assert.Equal(t, model.BACKUP_STATUS_FINISHED, rebuilt.Status)
+		assert.Equal(t, backup.RunId, rebuilt.RunId)
+		assert.True(t, backup.CreatedAt.Equal(rebuilt.CreatedAt))
+		assert.Empty(t, rebuilt.DumpPath)
+		assert.Len(t, rebuilt.DriveFiles, 1)
+		driveFile := rebuilt.DriveFiles[0]
+		assert.Equal(t, backup.DriveFiles[0].Id, driveFile.Id)
+		assert.Equal(t, backup.DriveFiles[0].Path, driveFile.Path)
+		assert.Equal(t, backup.DriveFiles[0].CatalogPath, driveFile.CatalogPath)
+		assert.Equal(t, "restored", driveFile.Label)
+		assert.Equal(t, model.DRIVE_FILE_STATUS_FINISHED, driveFile.Status)
+
+		downloaded, err := service.Download(context.Background(), app, driveFile.Id)
+		assert.NoError(t, err)
+		assert.Equal(t, "shop", string(downloaded.Byte))
+	}
+
+	// The catalog entries are referenced by the rebuilt drive files
+	reconciled, err := service.Reconcile(context.Background(), app, service.ReconcileInput{})
+	assert.NoError(t, err)
+	assert.Empty(t, reconciled.Reports[0].Missing)
+	assert.Empty(t, reconciled.Reports[0].Orphans)
+
+	// Rebuilding again skips the drive files already recorded
+	output, err = service.RebuildCatalog(context.Background(), app, "restored")
+	assert.NoError(t, err)
+	assert.Len(t, output.Results, 2)
+	for _, result := range output.Results {
+		assert.Equal(t, service.CATALOG_REBUILD_STATUS_SKIPPED, result.Status)
+	}
+}
+
+func TestRebuildCatalogRetriedBackup(t *testing.T) {
+	folder := t.TempDir()
+	memoryDrive := &memoryDriveMock{unavailable: true}
+	app := lostCatalogAppMock(drive.NewLocalDrive("local", folder))
+	app.Drives = append(app.Drives, memoryDrive)
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	backup, err := app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, backup.Status)
+
+	// The failed upload is retried after the catalog entry of the finished one
+	// was written
+	memoryDrive.unavailable = false
+	_, err = service.BackupRetry(context.Background(), app, backupIds[0])
+	assert.NoError(t, err)
+	backup, err = app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+
+	app = lostCatalogAppMock(drive.NewLocalDrive("local", folder))
+	output, err := service.RebuildCatalog(context.Background(), app, "local")
+	assert.NoError(t, err)
+	assert.Len(t, output.Results, 1)
+	assert.Equal(t, service.CATALOG_REBUILD_STATUS_CREATED, output.Results[0].Status)
+	rebuilt, err := app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, rebuilt.Status)
+}
+
+func TestRebuildCatalogDedupAndVolumes(t *testing.T) {
+	for name, wrap := range map[string]func(drive.Drive) drive.Drive{
+		"dedup":   func(d drive.Drive) drive.Drive { return drive.NewDedupDrive(d) },
+		"volumes": func(d drive.Drive) drive.Drive { return drive.NewVolumeDrive(d, 3) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			folder := t.TempDir()
+			_, backups := reconcileAppMock(t, wrap(drive.NewLocalDrive("local", folder)), 1)
+
+			app := lostCatalogAppMock(wrap(drive.NewLocalDrive("local", folder)))
+			output, err := service.RebuildCatalog(context.Background(), app, "local")
+			assert.NoError(t, err)
+			assert.Len(t, output.Results, 1)
+			assert.Equal(t, service.CATALOG_REBUILD_STATUS_CREATED, output.Results[0].Status)
+			driveFile, err := app.Db.DriveFile.ReadOrError(backups[0].DriveFiles[0].Id)
+			assert.NoError(t, err)
+			assert.Equal(t, backups[0].DriveFiles[0].Parts, driveFile.Parts)
+			downloaded, err := service.Download(context.Background(), app, driveFile.Id)
+			assert.NoError(t, err)
+			assert.Equal(t, "shop", string(downloaded.Byte))
+		})
+	}
+}
+
+func TestRebuildCatalogInvalidEntry(t *testing.T) {
+	folder := t.TempDir()
+	reconcileAppMock(t, drive.NewLocalDrive("local", folder), 1)
+	invalid := filepath.Join(folder, "invalid"+service.CATALOG_ENTRY_SUFFIX)
+	assert.NoError(t, os.WriteFile(invalid, []byte("{"), 0644))
+
+	// An invalid entry does not stop the others
+	app := lostCatalogAppMock(drive.NewLocalDrive("local", folder))
+	output, err := service.RebuildCatalog(context.Background(), app, "local")
+	assert.NoError(t, err)
+	statuses := make(map[string]string)
+	for _, result := range output.Results {
+		statuses[filepath.Base(result.Path)] = result.Status
+	}
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, service.CATALOG_REBUILD_STATUS_FAILED, statuses[filepath.Base(invalid)])
+	backups, err := app.Db.Backup.ReadAllFull()
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+}
+
+func TestRebuildCatalogUnlistableDrive(t *testing.T) {
+	memoryDrive := &memoryDriveMock{}
+	reconcileAppMock(t, memoryDrive, 1)
+	// No catalog entry is written to a drive which cannot be listed
+	assert.Equal(t, 1, memoryDrive.uploads)
+
+	app := lostCatalogAppMock(memoryDrive)
+	_, err := service.RebuildCatalog(context.Background(), app, "memory")
+	assert.EqualError(t, err, "drive (memory) cannot list its files")
+	_, err = service.RebuildCatalog(context.Background(), app, "s3")
+	assert.EqualError(t, err, "unknown drive (s3)")
+}
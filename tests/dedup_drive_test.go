@@ -0,0 +1,270 @@
+package tests_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/lib"
+	"github.com/herytz/backupman/core/model"
+	"github.com/herytz/backupman/core/service"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+// randomDump returns size bytes of random data, the same for a seed
+func randomDump(seed uint64, size int) []byte {
+	random := rand.New(rand.NewPCG(seed, seed))
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(random.UintN(256))
+	}
+	return data
+}
+
+func chunks(t *testing.T, data []byte) [][]byte {
+	chunker := lib.NewChunker(bytes.NewReader(data), 1024, 4096, 16384)
+	result := make([][]byte, 0)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return result
+		}
+		assert.NoError(t, err)
+		result = append(result, bytes.Clone(chunk))
+	}
+}
+
+func TestChunker(t *testing.T) {
+	data := randomDump(1, 1024*1024)
+	original := chunks(t, data)
+	assert.Equal(t, data, bytes.Join(original, nil))
+	for i, chunk := range original {
+		assert.LessOrEqual(t, len(chunk), 16384)
+		if i < len(original)-1 {
+			assert.GreaterOrEqual(t, len(chunk), 1024)
+		}
+	}
+	// Around 4096 bytes on average
+	assert.InDelta(t, 1024*1024/4096, len(original), 1024*1024/4096/2)
+
+	// Inserting data only changes the chunks around the insertion
+	modified := append(bytes.Clone(data[:500000]), append([]byte("inserted"), data[500000:]...)...)
+	known := make(map[string]bool)
+	for _, chunk := range original {
+		known[string(chunk)] = true
+	}
+	changed := 0
+	for _, chunk := range chunks(t, modified) {
+		if !known[string(chunk)] {
+			changed++
+		}
+	}
+	assert.LessOrEqual(t, changed, 3)
+}
+
+func writeDump(t *testing.T, name string, data []byte) string {
+	dumpPath := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(dumpPath, data, 0644))
+	return dumpPath
+}
+
+func downloadDump(t *testing.T, d drive.Downloader, path string) []byte {
+	dstPath := filepath.Join(t.TempDir(), "downloaded.sql")
+	assert.NoError(t, d.Download(context.Background(), path, dstPath))
+	data, err := os.ReadFile(dstPath)
+	assert.NoError(t, err)
+	return data
+}
+
+func countChunks(t *testing.T, local *drive.LocalDrive) int {
+	objects, err := local.ListObjects(context.Background(), drive.DEDUP_CHUNKS_FOLDER+"/")
+	assert.NoError(t, err)
+	return len(objects)
+}
+
+// ageChunks sets the modification time of the chunks of a drive to age ago
+func ageChunks(t *testing.T, local *drive.LocalDrive, age time.Duration) {
+	objects, err := local.ListObjects(context.Background(), drive.DEDUP_CHUNKS_FOLDER+"/")
+	assert.NoError(t, err)
+	modTime := time.Now().Add(-age)
+	for _, object := range objects {
+		assert.NoError(t, os.Chtimes(object.Path, modTime, modTime))
+	}
+}
+
+func TestDedupDrive(t *testing.T) {
+	ctx := context.Background()
+	local := drive.NewLocalDrive("dedup", t.TempDir())
+	dedup := drive.NewDedupDrive(local)
+
+	first := randomDump(1, 12*1024*1024)
+	firstFile, err := dedup.Upload(ctx, writeDump(t, "first.sql", first))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(firstFile.Path, drive.DEDUP_MANIFESTS_FOLDER+"/"))
+	assert.Equal(t, ".sql", filepath.Ext(firstFile.Path))
+	firstChunks := countChunks(t, local)
+	assert.Greater(t, firstChunks, 3)
+
+	// A nearly identical dump only stores the chunks around the change
+	second := bytes.Clone(first)
+	copy(second[6*1024*1024:], []byte("changed row"))
+	secondFile, err := dedup.Upload(ctx, writeDump(t, "second.sql", second))
+	assert.NoError(t, err)
+	assert.NotEqual(t, firstFile.Path, secondFile.Path)
+	assert.LessOrEqual(t, countChunks(t, local)-firstChunks, 2)
+
+	assert.Equal(t, first, downloadDump(t, dedup, firstFile.Path))
+	assert.Equal(t, second, downloadDump(t, dedup, secondFile.Path))
+
+	// The chunks of a deleted dump are collected once no dump references them
+	deleted, err := dedup.CollectGarbage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+	assert.NoError(t, dedup.Delete(ctx, firstFile.Path))
+	// Within the grace period, the chunks could belong to an upload of another
+	// process whose manifest is not written yet
+	deleted, err = dedup.CollectGarbage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+	ageChunks(t, local, drive.DEDUP_GC_GRACE_PERIOD+time.Hour)
+	deleted, err = dedup.CollectGarbage(ctx)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, deleted, 1)
+	assert.LessOrEqual(t, deleted, 2)
+	assert.Equal(t, second, downloadDump(t, dedup, secondFile.Path))
+
+	assert.NoError(t, dedup.Delete(ctx, secondFile.Path))
+	ageChunks(t, local, drive.DEDUP_GC_GRACE_PERIOD+time.Hour)
+	_, err = dedup.CollectGarbage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, countChunks(t, local))
+}
+
+func TestDedupDriveGarbageGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	folder := t.TempDir()
+	dedup := drive.NewDedupDrive(drive.NewLocalDrive("dedup", folder))
+
+	// A chunk stored by an upload of another process, its manifest not being
+	// written yet
+	other := drive.NewLocalDrive("dedup", folder)
+	chunk := path.Join(drive.DEDUP_CHUNKS_FOLDER, "ab", strings.Repeat("ab", 32))
+	assert.NoError(t, other.PutObject(ctx, chunk, []byte("chunk")))
+
+	deleted, err := dedup.CollectGarbage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+	exists, err := other.ObjectExists(ctx, chunk)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// Past the grace period, the upload is considered failed
+	ageChunks(t, other, drive.DEDUP_GC_GRACE_PERIOD+time.Hour)
+	deleted, err = dedup.CollectGarbage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, 0, countChunks(t, other))
+}
+
+// collectingDriveMock deletes the chunks of the drive before writing a
+// manifest, like a garbage collection of another process
+type collectingDriveMock struct {
+	*drive.LocalDrive
+}
+
+func (d *collectingDriveMock) PutObject(ctx context.Context, name string, data []byte) error {
+	if strings.HasPrefix(name, drive.DEDUP_MANIFESTS_FOLDER+"/") {
+		objects, err := d.ListObjects(ctx, drive.DEDUP_CHUNKS_FOLDER+"/")
+		if err != nil {
+			return err
+		}
+		for _, object := range objects {
+			os.Remove(object.Path)
+		}
+	}
+	return d.LocalDrive.PutObject(ctx, name, data)
+}
+
+func TestDedupDriveReusedChunks(t *testing.T) {
+	ctx := context.Background()
+	local := drive.NewLocalDrive("dedup", t.TempDir())
+	dedup := drive.NewDedupDrive(local)
+	dump := writeDump(t, "dump.sql", randomDump(6, 2*1024*1024))
+
+	// The chunks reused by an upload are touched, the grace period applying
+	// to them again
+	file, err := dedup.Upload(ctx, dump)
+	assert.NoError(t, err)
+	assert.NoError(t, dedup.Delete(ctx, file.Path))
+	ageChunks(t, local, drive.DEDUP_GC_GRACE_PERIOD+time.Hour)
+	file, err = dedup.Upload(ctx, dump)
+	assert.NoError(t, err)
+	assert.NoError(t, dedup.Delete(ctx, file.Path))
+	deleted, err := dedup.CollectGarbage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+
+	// An upload whose chunks were deleted before its manifest was written fails
+	collecting := drive.NewDedupDrive(&collectingDriveMock{LocalDrive: local})
+	_, err = collecting.Upload(ctx, dump)
+	assert.ErrorContains(t, err, "deleted during the upload")
+	manifests, err := local.ListObjects(ctx, drive.DEDUP_MANIFESTS_FOLDER+"/")
+	assert.NoError(t, err)
+	assert.Empty(t, manifests)
+}
+
+func TestDedupDriveCorruptedChunk(t *testing.T) {
+	ctx := context.Background()
+	local := drive.NewLocalDrive("dedup", t.TempDir())
+	dedup := drive.NewDedupDrive(local)
+
+	file, err := dedup.Upload(ctx, writeDump(t, "dump.sql", randomDump(2, 1024*1024)))
+	assert.NoError(t, err)
+	objects, err := local.ListObjects(ctx, drive.DEDUP_CHUNKS_FOLDER+"/")
+	assert.NoError(t, err)
+	assert.NoError(t, local.PutObject(ctx, objects[0].Name, []byte("corrupted")))
+
+	err = dedup.Download(ctx, file.Path, filepath.Join(t.TempDir(), "downloaded.sql"))
+	assert.ErrorContains(t, err, "is corrupted")
+}
+
+func TestBackupDedupDrive(t *testing.T) {
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{&databaseDumperMock{label: "shop"}}
+	app.Drives = []drive.Drive{drive.NewDedupDrive(drive.NewLocalDrive("dedup", t.TempDir()))}
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	backup, err := app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+	assert.Equal(t, "local", backup.DriveFiles[0].Provider)
+
+	// The download route reassembles the dump
+	output, err := service.Download(context.Background(), app, backup.DriveFiles[0].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "shop", string(output.Byte))
+}
+
+func TestDedupDriveFilesStoredBefore(t *testing.T) {
+	ctx := context.Background()
+	local := drive.NewLocalDrive("dedup", t.TempDir())
+	file, err := local.Upload(ctx, writeDump(t, "dump.sql", []byte("plain dump")))
+	assert.NoError(t, err)
+
+	// The dumps stored before enabling dedup are still downloaded and deleted
+	dedup := drive.NewDedupDrive(local)
+	assert.Equal(t, []byte("plain dump"), downloadDump(t, dedup, file.Path))
+	assert.NoError(t, dedup.Delete(ctx, file.Path))
+	assert.NoFileExists(t, file.Path)
+}
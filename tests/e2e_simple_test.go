@@ -62,7 +62,7 @@ func TestS3DriveIntegrityE2E(t *testing.T) {
 	expectedSHA256 := calculateSHA256Hash(testContent)
 
 	// Upload file with integrity verification enabled
-	driveFile, err := s3Drive.Upload(testFile)
+	driveFile, err := s3Drive.Upload(context.Background(), testFile)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, driveFile.Checksum, "Expected checksum to be set in DriveFile")
 
@@ -119,7 +119,7 @@ func TestS3DriveIntegrityDisabledE2E(t *testing.T) {
 	}
 
 	// Upload file without integrity verification
-	driveFile, err := s3Drive.Upload(testFile)
+	driveFile, err := s3Drive.Upload(context.Background(), testFile)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, driveFile.Checksum, "Expected ETag to be set as checksum even with integrity check disabled")
 
@@ -0,0 +1,110 @@
+package tests_test
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/model"
+	"github.com/herytz/backupman/core/service"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func newExecDumper(t *testing.T, command []string, timeout time.Duration) *dumper.ExecDumper {
+	return dumper.NewExecDumper(
+		"exec1",
+		path.Join(t.TempDir(), "exec"),
+		dumper.ExecConnection{
+			Host:     "127.0.0.1",
+			Port:     5432,
+			User:     "root",
+			Password: "s3cret",
+			Database: "backupman",
+		},
+		command,
+		nil,
+		map[string]string{"DB_PASSWORD": "{{ .Password }}"},
+		timeout,
+		"",
+	)
+}
+
+func TestExecDumperDump(t *testing.T) {
+	execDumper := newExecDumper(t, []string{"sh", "-c", "echo {{ .Database }}@{{ .Host }}:{{ .Port }} $DB_PASSWORD $BACKUPMAN_USER"}, 0)
+	dumpPath, err := execDumper.Dump(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, ".sql", path.Ext(dumpPath))
+	content, err := os.ReadFile(dumpPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "backupman@127.0.0.1:5432 s3cret root\n", string(content))
+}
+
+func TestExecDumperPasswordNotAllowedInArgs(t *testing.T) {
+	execDumper := newExecDumper(t, []string{"echo", "{{ .Password }}"}, 0)
+	_, err := execDumper.Dump(context.Background())
+	assert.Error(t, err)
+}
+
+func TestExecDumperTimeout(t *testing.T) {
+	execDumper := newExecDumper(t, []string{"sleep", "5"}, 100*time.Millisecond)
+	_, err := execDumper.Dump(context.Background())
+	assert.ErrorContains(t, err, "timed out")
+	entries, err := os.ReadDir(execDumper.TmpFolder)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestExecDumperHealth(t *testing.T) {
+	execDumper := newExecDumper(t, []string{"sh", "-c", "true"}, 0)
+	assert.NoError(t, execDumper.Health())
+
+	execDumper.HealthCommand = []string{"sh", "-c", "echo unreachable >&2; exit 1"}
+	assert.ErrorContains(t, execDumper.Health(), "unreachable")
+
+	execDumper.HealthCommand = nil
+	execDumper.Command = []string{"backupman-command-not-found"}
+	assert.Error(t, execDumper.Health())
+}
+
+func TestExecDumperErrorRecordedOnBackup(t *testing.T) {
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{
+		newExecDumper(t, []string{"sh", "-c", "echo connection refused >&2; exit 2"}, 0),
+	}
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	assert.Len(t, backupIds, 1)
+
+	backup, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, backup.Status)
+	assert.Contains(t, backup.Error, "connection refused")
+}
+
+func TestBackupRoutedToDataSourceDrives(t *testing.T) {
+	tmpDir := t.TempDir()
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{newExecDumper(t, []string{"echo", "sanitized"}, 0)}
+	app.Drives = []drive.Drive{
+		drive.NewLocalDrive("secure", path.Join(tmpDir, "secure")),
+		drive.NewLocalDrive("dev", path.Join(tmpDir, "dev")),
+	}
+	app.DataSourceOptions = map[string]application.DataSourceOptions{
+		"exec1": {Drives: []string{"dev"}},
+	}
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	backup, err := app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+	assert.Len(t, backup.DriveFiles, 1)
+	assert.Equal(t, "dev", backup.DriveFiles[0].Label)
+	assert.FileExists(t, backup.DriveFiles[0].Path)
+}
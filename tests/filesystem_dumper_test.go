@@ -0,0 +1,109 @@
+package tests_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/model"
+	"github.com/herytz/backupman/core/service"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func createFilesystemSource(t *testing.T) string {
+	root := path.Join(t.TempDir(), "media")
+	tests.CreateTestFile(t, root, "a.jpg", "image a")
+	tests.CreateTestFile(t, path.Join(root, "albums"), "b.jpg", "image bb")
+	tests.CreateTestFile(t, root, "upload.tmp", "partial")
+	tests.CreateTestFile(t, path.Join(root, "cache"), "c.jpg", "cached")
+	assert.NoError(t, os.Chmod(path.Join(root, "a.jpg"), 0600))
+	assert.NoError(t, os.Symlink("a.jpg", path.Join(root, "latest.jpg")))
+	return root
+}
+
+func readTarGzHeaders(t *testing.T, archivePath string) map[string]*tar.Header {
+	file, err := os.Open(archivePath)
+	assert.NoError(t, err)
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	assert.NoError(t, err)
+
+	headers := make(map[string]*tar.Header)
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		headers[header.Name] = header
+	}
+	return headers
+}
+
+func TestFilesystemDumperDump(t *testing.T) {
+	root := createFilesystemSource(t)
+	filesystemDumper := dumper.NewFilesystemDumper("media", t.TempDir(), []string{root}, nil, []string{"*.tmp", "cache"}, dumper.FILESYSTEM_COMPRESSION_GZIP)
+	assert.NoError(t, filesystemDumper.Health())
+
+	dumpPath, err := filesystemDumper.Dump(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(dumpPath, ".tar.gz"))
+
+	prefix := strings.TrimPrefix(root, "/") + "/"
+	headers := readTarGzHeaders(t, dumpPath)
+	assert.Len(t, headers, 5)
+	assert.Contains(t, headers, prefix)
+	assert.Contains(t, headers, prefix+"albums/")
+	assert.Contains(t, headers, prefix+"albums/b.jpg")
+	assert.Equal(t, int64(0600), headers[prefix+"a.jpg"].Mode&0777)
+	assert.Equal(t, byte(tar.TypeSymlink), headers[prefix+"latest.jpg"].Typeflag)
+	assert.Equal(t, "a.jpg", headers[prefix+"latest.jpg"].Linkname)
+
+	stats, ok := filesystemDumper.DumpStats(dumpPath)
+	assert.True(t, ok)
+	assert.Equal(t, dumper.DumpStats{FileCount: 2, TotalSize: 15}, stats)
+}
+
+func TestFilesystemDumperInclude(t *testing.T) {
+	root := createFilesystemSource(t)
+	filesystemDumper := dumper.NewFilesystemDumper("media", t.TempDir(), []string{root}, []string{"b.jpg"}, nil, dumper.FILESYSTEM_COMPRESSION_NONE)
+
+	dumpPath, err := filesystemDumper.Dump(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, ".tar", path.Ext(dumpPath))
+	stats, _ := filesystemDumper.DumpStats(dumpPath)
+	assert.Equal(t, int64(1), stats.FileCount)
+}
+
+func TestFilesystemDumperMissingPath(t *testing.T) {
+	filesystemDumper := dumper.NewFilesystemDumper("media", t.TempDir(), []string{"/backupman/not/found"}, nil, nil, "")
+	assert.Error(t, filesystemDumper.Health())
+	_, err := filesystemDumper.Dump(context.Background())
+	assert.Error(t, err)
+	entries, err := os.ReadDir(filesystemDumper.TmpFolder)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestBackupRecordsFilesystemStats(t *testing.T) {
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{
+		dumper.NewFilesystemDumper("media", t.TempDir(), []string{createFilesystemSource(t)}, nil, nil, ""),
+	}
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+
+	backup, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+	assert.Equal(t, int64(4), backup.FileCount)
+	assert.Equal(t, int64(28), backup.TotalSize)
+}
@@ -3,6 +3,7 @@
 package tests_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/herytz/backupman/core/drive"
@@ -14,15 +15,15 @@ var tokenFile = "../google-token.json"
 
 func TestGoogleDriveUploadFile(t *testing.T) {
 	googleDrive := drive.NewGoogleDrive("Google Drive", "backupman", clientSecretFile, tokenFile)
-	driveFile, err := googleDrive.Upload("./tmp/test.txt")
+	driveFile, err := googleDrive.Upload(context.Background(), "./tmp/test.txt")
 	assert.NoError(t, err)
 	assert.NotEmpty(t, driveFile.Path)
 }
 
 func TestGoogleDriveDeleteFile(t *testing.T) {
 	googleDrive := drive.NewGoogleDrive("Google Drive", "backupman", clientSecretFile, tokenFile)
-	driveFile, err := googleDrive.Upload("./tmp/test.txt")
+	driveFile, err := googleDrive.Upload(context.Background(), "./tmp/test.txt")
 	assert.NoError(t, err)
-	err = googleDrive.Delete(driveFile.Path)
+	err = googleDrive.Delete(context.Background(), driveFile.Path)
 	assert.NoError(t, err)
 }
@@ -3,6 +3,7 @@
 package tests_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/herytz/backupman/core/drive"
@@ -11,16 +12,16 @@ import (
 
 func TestLocalDriveUploadFile(t *testing.T) {
 	localDrive := drive.NewLocalDrive("local_drive", "./tmp/out")
-	file, err := localDrive.Upload("./tmp/test.txt")
+	file, err := localDrive.Upload(context.Background(), "./tmp/test.txt")
 	assert.NoError(t, err)
 	assert.FileExists(t, file.Path)
 }
 
 func TestLocalDriveDeleteFile(t *testing.T) {
 	localDrive := drive.NewLocalDrive("local_drive", "./tmp/out")
-	file, err := localDrive.Upload("./tmp/test.txt")
+	file, err := localDrive.Upload(context.Background(), "./tmp/test.txt")
 	assert.NoError(t, err)
-	err = localDrive.Delete(file.Path)
+	err = localDrive.Delete(context.Background(), file.Path)
 	assert.NoError(t, err)
 	assert.NoFileExists(t, file.Path)
 }
@@ -0,0 +1,54 @@
+package tests_test
+
+import (
+	"testing"
+
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/stretchr/testify/assert"
+)
+
+func mask(t *testing.T, masking dumper.Masking, table, column string, value *string) *string {
+	rule := masking.Rule(table, column)
+	if rule == nil {
+		t.Fatalf("no masking rule for %s.%s", table, column)
+	}
+	return rule.Apply(value)
+}
+
+func ptr(value string) *string {
+	return &value
+}
+
+func TestMaskingStrategies(t *testing.T) {
+	masking := dumper.Masking{
+		{Table: "users", Column: "password", Strategy: dumper.MASKING_STRATEGY_NULL},
+		{Table: "users", Column: "role", Strategy: dumper.MASKING_STRATEGY_FIXED, Value: "guest"},
+		{Table: "users", Column: "token", Strategy: dumper.MASKING_STRATEGY_HASH},
+		{Table: "*", Column: "email", Strategy: dumper.MASKING_STRATEGY_FAKE_EMAIL},
+		{Table: "users", Column: "name", Strategy: dumper.MASKING_STRATEGY_FAKE_NAME},
+		{Table: "users", Column: "phone", Strategy: dumper.MASKING_STRATEGY_REDACT},
+	}
+	assert.NoError(t, masking.Validate())
+
+	assert.Nil(t, mask(t, masking, "users", "password", ptr("secret")))
+	assert.Equal(t, "guest", *mask(t, masking, "users", "role", ptr("admin")))
+	assert.Len(t, *mask(t, masking, "users", "token", ptr("abc")), 64)
+	assert.Equal(t, "+00 (000) 000-Xxx", *mask(t, masking, "users", "phone", ptr("+33 (612) 345-Ext")))
+
+	email := mask(t, masking, "orders", "email", ptr("john@doe.com"))
+	assert.Regexp(t, `^user_[0-9a-f]{10}@example\.com$`, *email)
+	assert.Equal(t, *email, *mask(t, masking, "users", "email", ptr("john@doe.com")))
+	assert.NotEqual(t, *email, *mask(t, masking, "users", "email", ptr("jane@doe.com")))
+
+	name := mask(t, masking, "users", "name", ptr("John Doe"))
+	assert.Regexp(t, `^[A-Z][a-z]+ [A-Z][a-z]+$`, *name)
+	assert.Equal(t, *name, *mask(t, masking, "users", "name", ptr("John Doe")))
+
+	assert.Nil(t, mask(t, masking, "users", "role", nil))
+	assert.Nil(t, masking.Rule("users", "id"))
+}
+
+func TestMaskingValidate(t *testing.T) {
+	assert.Error(t, dumper.Masking{{Table: "users", Column: "email", Strategy: "shuffle"}}.Validate())
+	assert.Error(t, dumper.Masking{{Table: "users", Strategy: dumper.MASKING_STRATEGY_NULL}}.Validate())
+}
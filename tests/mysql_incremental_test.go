@@ -0,0 +1,65 @@
+//go:build test_integration
+
+package tests_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/stretchr/testify/assert"
+)
+
+func countBinlogOrders(t *testing.T) int {
+	var count int
+	err := dbConn.QueryRow("SELECT COUNT(*) FROM binlog_orders").Scan(&count)
+	assert.NoError(t, err)
+	return count
+}
+
+func TestMysqlIncrementalRestore(t *testing.T) {
+	connectDb()
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS binlog_orders",
+		"CREATE TABLE binlog_orders (id INT PRIMARY KEY, label VARCHAR(50))",
+		"INSERT INTO binlog_orders VALUES (1, 'first')",
+	} {
+		_, err := dbConn.Exec(query)
+		assert.NoError(t, err)
+	}
+
+	d := dumper.NewMysqlDumper("mysql1", t.TempDir(), "localhost", 3307, "root", "root", "backupman", "false",
+		dumper.SqlDumpOptions{TableFilter: dumper.TableFilter{IncludeTables: []string{"binlog_orders"}}},
+		dumper.BinlogOptions{Enabled: true, ServerId: 4201})
+	fullPath, err := d.Dump(context.Background())
+	assert.NoError(t, err)
+	position, ok := d.DumpPosition(fullPath)
+	assert.True(t, ok)
+
+	_, err = dbConn.Exec("INSERT INTO binlog_orders VALUES (2, 'second; with a semicolon')")
+	assert.NoError(t, err)
+	firstPath, position, err := d.DumpIncremental(context.Background(), position)
+	assert.NoError(t, err)
+
+	// Binlog timestamps have a one second resolution
+	time.Sleep(1100 * time.Millisecond)
+	until := time.Now()
+	time.Sleep(1100 * time.Millisecond)
+	_, err = dbConn.Exec("INSERT INTO binlog_orders VALUES (3, 'third')")
+	assert.NoError(t, err)
+	secondPath, _, err := d.DumpIncremental(context.Background(), position)
+	assert.NoError(t, err)
+
+	_, err = dbConn.Exec("DELETE FROM binlog_orders")
+	assert.NoError(t, err)
+
+	assert.NoError(t, d.Restore(fullPath))
+	assert.Equal(t, 1, countBinlogOrders(t))
+	assert.NoError(t, d.RestoreIncremental(firstPath, time.Time{}))
+	assert.Equal(t, 2, countBinlogOrders(t))
+	assert.NoError(t, d.RestoreIncremental(secondPath, until))
+	assert.Equal(t, 2, countBinlogOrders(t))
+	assert.NoError(t, d.RestoreIncremental(secondPath, time.Time{}))
+	assert.Equal(t, 3, countBinlogOrders(t))
+}
@@ -0,0 +1,76 @@
+//go:build test_integration
+
+package tests_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path"
+	"regexp"
+	"testing"
+
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/stretchr/testify/assert"
+)
+
+var dumpCompletedLine = regexp.MustCompile(`(?m)^-- Dump completed on .*$`)
+
+func readDumpWithoutDate(t *testing.T, dumpPath string) string {
+	content, err := os.ReadFile(dumpPath)
+	assert.NoError(t, err)
+	return dumpCompletedLine.ReplaceAllString(string(content), "")
+}
+
+func assertParallelDumpIdentical(t *testing.T, newDumper func(parallelism int) dumper.Dumper) {
+	sequentialPath, err := newDumper(1).Dump(context.Background())
+	assert.NoError(t, err)
+	parallelPath, err := newDumper(4).Dump(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, readDumpWithoutDate(t, sequentialPath), readDumpWithoutDate(t, parallelPath))
+
+	entries, err := os.ReadDir(path.Dir(parallelPath))
+	assert.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotRegexp(t, `\.part$`, entry.Name())
+	}
+}
+
+// assertStreamedDumpIdentical compares the dump written to a stream to the
+// dump written to a file
+func assertStreamedDumpIdentical(t *testing.T, d dumper.StreamDumper) {
+	dumpPath, err := d.Dump(context.Background())
+	assert.NoError(t, err)
+	var streamed bytes.Buffer
+	assert.NoError(t, d.DumpTo(context.Background(), d.NewDumpPath(), &streamed))
+	assert.Equal(t, readDumpWithoutDate(t, dumpPath), dumpCompletedLine.ReplaceAllString(streamed.String(), ""))
+}
+
+func TestMysqlParallelDumpIdentical(t *testing.T) {
+	connectDb()
+	tmpFolder := t.TempDir()
+	assertParallelDumpIdentical(t, func(parallelism int) dumper.Dumper {
+		return dumper.NewMysqlDumper("mysql1", tmpFolder, "localhost", 3307, "root", "root", "backupman", "false",
+			dumper.SqlDumpOptions{Parallelism: parallelism}, dumper.BinlogOptions{})
+	})
+}
+
+func TestPostgresParallelDumpIdentical(t *testing.T) {
+	tmpFolder := t.TempDir()
+	assertParallelDumpIdentical(t, func(parallelism int) dumper.Dumper {
+		return dumper.NewPostgresDumper("postgres1", tmpFolder, "localhost", 5433, "postgres", "postgres", "backupman", false,
+			dumper.SqlDumpOptions{Parallelism: parallelism})
+	})
+}
+
+func TestMysqlStreamedDumpIdentical(t *testing.T) {
+	connectDb()
+	assertStreamedDumpIdentical(t, dumper.NewMysqlDumper("mysql1", t.TempDir(), "localhost", 3307, "root", "root", "backupman", "false",
+		dumper.SqlDumpOptions{Parallelism: 4}, dumper.BinlogOptions{}))
+}
+
+func TestPostgresStreamedDumpIdentical(t *testing.T) {
+	assertStreamedDumpIdentical(t, dumper.NewPostgresDumper("postgres1", t.TempDir(), "localhost", 5433, "postgres", "postgres", "backupman", false,
+		dumper.SqlDumpOptions{Parallelism: 4}))
+}
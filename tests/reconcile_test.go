@@ -0,0 +1,202 @@
+package tests_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/model"
+	"github.com/herytz/backupman/core/service"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func reconcileAppMock(t *testing.T, d drive.Drive, backups int) (*application.App, []*model.BackupFull) {
+	app := tests.NewAppMock()
+	app.Mode = application.APP_MODE_CLI
+	app.Dumpers = []dumper.Dumper{&databaseDumperMock{label: "shop"}}
+	app.Drives = []drive.Drive{d}
+	result := make([]*model.BackupFull, 0)
+	for range backups {
+		backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+		assert.NoError(t, err)
+		backup, err := app.Db.Backup.ReadFullById(backupIds[0])
+		assert.NoError(t, err)
+		result = append(result, backup)
+	}
+	return app, result
+}
+
+func writeOrphan(t *testing.T, path string, age time.Duration) {
+	assert.NoError(t, os.WriteFile(path, []byte("orphan"), 0644))
+	modTime := time.Now().Add(-age)
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestReconcile(t *testing.T) {
+	folder := t.TempDir()
+	app, backups := reconcileAppMock(t, drive.NewLocalDrive("local", folder), 2)
+	missingFile := backups[0].DriveFiles[0]
+	assert.NoError(t, os.Remove(missingFile.Path))
+	oldOrphan := filepath.Join(folder, "old.sql")
+	writeOrphan(t, oldOrphan, 10*24*time.Hour)
+	recentOrphan := filepath.Join(folder, "recent.sql")
+	writeOrphan(t, recentOrphan, time.Minute)
+
+	// Only reported by default
+	output, err := service.Reconcile(context.Background(), app, service.ReconcileInput{})
+	assert.NoError(t, err)
+	assert.Len(t, output.Reports, 1)
+	report := output.Reports[0]
+	assert.Equal(t, "local", report.Label)
+	assert.Empty(t, report.Error)
+	assert.Equal(t, []service.ReconcileMissing{{
+		DriveFileId: missingFile.Id,
+		BackupId:    backups[0].Id,
+		Path:        missingFile.Path,
+	}}, report.Missing)
+	assert.Len(t, report.Orphans, 2)
+	driveFile, err := app.Db.DriveFile.ReadOrError(missingFile.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, model.DRIVE_FILE_STATUS_FINISHED, driveFile.Status)
+	assert.FileExists(t, oldOrphan)
+
+	output, err = service.Reconcile(context.Background(), app, service.ReconcileInput{
+		MarkMissing:            true,
+		DeleteOrphansOlderThan: 24 * time.Hour,
+	})
+	assert.NoError(t, err)
+	report = output.Reports[0]
+	assert.True(t, report.Missing[0].Marked)
+	deleted := make(map[string]bool)
+	for _, orphan := range report.Orphans {
+		deleted[orphan.Path] = orphan.Deleted
+	}
+	assert.Equal(t, map[string]bool{oldOrphan: true, recentOrphan: false}, deleted)
+	driveFile, err = app.Db.DriveFile.ReadOrError(missingFile.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, model.DRIVE_FILE_STATUS_MISSING, driveFile.Status)
+	assert.NoFileExists(t, oldOrphan)
+	assert.FileExists(t, recentOrphan)
+	assert.FileExists(t, backups[1].DriveFiles[0].Path)
+
+	// The drive files marked missing are not reported again
+	output, err = service.Reconcile(context.Background(), app, service.ReconcileInput{})
+	assert.NoError(t, err)
+	assert.Empty(t, output.Reports[0].Missing)
+	assert.Len(t, output.Reports[0].Orphans, 1)
+}
+
+func TestReconcileVolumes(t *testing.T) {
+	app, backups := reconcileAppMock(t, drive.NewVolumeDrive(drive.NewLocalDrive("local", t.TempDir()), 3), 1)
+	parts := backups[0].DriveFiles[0].Parts
+	assert.Len(t, parts, 2)
+
+	output, err := service.Reconcile(context.Background(), app, service.ReconcileInput{})
+	assert.NoError(t, err)
+	assert.Empty(t, output.Reports[0].Missing)
+	assert.Empty(t, output.Reports[0].Orphans)
+
+	assert.NoError(t, os.Remove(parts[1]))
+	output, err = service.Reconcile(context.Background(), app, service.ReconcileInput{})
+	assert.NoError(t, err)
+	assert.Len(t, output.Reports[0].Missing, 1)
+	assert.Equal(t, parts[1], output.Reports[0].Missing[0].Path)
+}
+
+func TestReconcileDedup(t *testing.T) {
+	local := drive.NewLocalDrive("local", t.TempDir())
+	dedup := drive.NewDedupDrive(local)
+	app, _ := reconcileAppMock(t, dedup, 1)
+
+	// The chunks are not orphans
+	output, err := service.Reconcile(context.Background(), app, service.ReconcileInput{})
+	assert.NoError(t, err)
+	assert.Empty(t, output.Reports[0].Missing)
+	assert.Empty(t, output.Reports[0].Orphans)
+
+	// The chunks of a deleted orphan manifest are collected
+	file, err := dedup.Upload(context.Background(), writeDump(t, "orphan.sql", []byte("orphan")))
+	assert.NoError(t, err)
+	modTime := time.Now().Add(-48 * time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(local.Folder, file.Path), modTime, modTime))
+	ageChunks(t, local, 48*time.Hour)
+	assert.Equal(t, 2, countChunks(t, local))
+	output, err = service.Reconcile(context.Background(), app, service.ReconcileInput{DeleteOrphansOlderThan: 24 * time.Hour})
+	assert.NoError(t, err)
+	assert.Len(t, output.Reports[0].Orphans, 1)
+	assert.Equal(t, file.Path, output.Reports[0].Orphans[0].Path)
+	assert.True(t, output.Reports[0].Orphans[0].Deleted)
+	assert.Equal(t, 1, countChunks(t, local))
+}
+
+func TestReconcileRenamedDrive(t *testing.T) {
+	folder := t.TempDir()
+	app, _ := reconcileAppMock(t, drive.NewLocalDrive("old", folder), 1)
+	app.Drives = []drive.Drive{drive.NewLocalDrive("local", folder)}
+
+	// The drive files of the former label are not matched to the drive, and
+	// the files they may reference are not deleted
+	output, err := service.Reconcile(context.Background(), app, service.ReconcileInput{DeleteOrphansOlderThan: time.Nanosecond})
+	assert.NoError(t, err)
+	assert.Empty(t, output.Reports[0].Missing)
+	assert.NotEmpty(t, output.Reports[0].Orphans)
+	for _, orphan := range output.Reports[0].Orphans {
+		assert.False(t, orphan.Deleted)
+		assert.FileExists(t, orphan.Path)
+	}
+	assert.Equal(t, "orphan files not deleted, 1 drive files of provider local belong to no configured drive", output.Reports[0].Error)
+}
+
+func TestReconcileSameProviderDrives(t *testing.T) {
+	folder := t.TempDir()
+	app, backups := reconcileAppMock(t, drive.NewLocalDrive("old", folder), 1)
+	app.Drives = []drive.Drive{drive.NewLocalDrive("other", t.TempDir()), drive.NewLocalDrive("local", folder)}
+
+	// The drive files of the former label are not matched to the first drive
+	// of their provider
+	output, err := service.Reconcile(context.Background(), app, service.ReconcileInput{Drives: []string{"other"}, MarkMissing: true})
+	assert.NoError(t, err)
+	assert.Empty(t, output.Reports[0].Missing)
+	assert.Empty(t, output.Reports[0].Error)
+	backup, err := app.Db.Backup.ReadOrError(backups[0].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+}
+
+func TestReconcileUnlistableDrive(t *testing.T) {
+	app, _ := reconcileAppMock(t, &memoryDriveMock{}, 1)
+	app.Drives = append(app.Drives, drive.NewLocalDrive("local", t.TempDir()))
+
+	output, err := service.Reconcile(context.Background(), app, service.ReconcileInput{})
+	assert.NoError(t, err)
+	assert.Len(t, output.Reports, 2)
+	assert.Equal(t, "drive (memory) cannot list its files", output.Reports[0].Error)
+	assert.Empty(t, output.Reports[1].Error)
+
+	output, err = service.Reconcile(context.Background(), app, service.ReconcileInput{Drives: []string{"local"}})
+	assert.NoError(t, err)
+	assert.Len(t, output.Reports, 1)
+	_, err = service.Reconcile(context.Background(), app, service.ReconcileInput{Drives: []string{"s3"}})
+	assert.EqualError(t, err, "unknown drive (s3)")
+}
+
+func TestReconcileMissingBackupStatus(t *testing.T) {
+	app, backups := reconcileAppMock(t, drive.NewLocalDrive("local", t.TempDir()), 1)
+	assert.NoError(t, os.Remove(backups[0].DriveFiles[0].Path))
+	_, err := service.Reconcile(context.Background(), app, service.ReconcileInput{MarkMissing: true})
+	assert.NoError(t, err)
+
+	// The finished backup cannot be restored from its missing drive file
+	stored, err := app.Db.Backup.ReadOrError(backups[0].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, stored.Status)
+	backup, err := service.HandleBackupStatus(app, backups[0].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, backup.Status)
+}
@@ -0,0 +1,274 @@
+package tests_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/stretchr/testify/assert"
+)
+
+const fakeRdb = "REDIS0011\xfa\tredis-ver\x057.2.4\xff\x00\x01\x02\x03\x04\x05\x06\x07"
+
+// startFakeRedis serves a single client per connection, requiring the given
+// credentials and answering SYNC with the reply built by sync.
+func startFakeRedis(t *testing.T, user, password string, sync func(w io.Writer)) (string, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	return acceptFakeRedis(t, listener, user, password, sync)
+}
+
+func acceptFakeRedis(t *testing.T, listener net.Listener, user, password string, sync func(w io.Writer)) (string, int) {
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeRedis(conn, user, password, sync)
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func serveFakeRedis(conn net.Conn, user, password string, sync func(w io.Writer)) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := password == ""
+	for {
+		args, err := readFakeRedisCommand(reader)
+		if err != nil {
+			return
+		}
+		switch strings.ToUpper(args[0]) {
+		case "AUTH":
+			expected := []string{"AUTH", password}
+			if user != "" {
+				expected = []string{"AUTH", user, password}
+			}
+			if strings.Join(args, " ") != strings.Join(expected, " ") {
+				io.WriteString(conn, "-WRONGPASS invalid username-password pair\r\n")
+				continue
+			}
+			authenticated = true
+			io.WriteString(conn, "+OK\r\n")
+		case "PING", "SYNC":
+			if !authenticated {
+				io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+				continue
+			}
+			if args[0] == "PING" {
+				io.WriteString(conn, "+PONG\r\n")
+				continue
+			}
+			sync(conn)
+			return
+		}
+	}
+}
+
+func readFakeRedisCommand(reader *bufio.Reader) ([]string, error) {
+	var count int
+	_, err := fmt.Fscanf(reader, "*%d\r\n", &count)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		var size int
+		_, err = fmt.Fscanf(reader, "$%d\r\n", &size)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		_, err = io.ReadFull(reader, buf)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestRedisDumperDump(t *testing.T) {
+	host, port := startFakeRedis(t, "backup", "s3cret", func(w io.Writer) {
+		fmt.Fprintf(w, "\n\n$%d\r\n%s", len(fakeRdb), fakeRdb)
+	})
+	redisDumper := dumper.NewRedisDumper("redis1", t.TempDir(), host, port, "backup", "s3cret", dumper.RedisTlsConfig{})
+	assert.NoError(t, redisDumper.Health())
+
+	dumpPath, err := redisDumper.Dump(context.Background())
+	assert.NoError(t, err)
+	content, err := os.ReadFile(dumpPath)
+	assert.NoError(t, err)
+	assert.Equal(t, fakeRdb, string(content))
+}
+
+func TestRedisDumperDisklessDump(t *testing.T) {
+	mark := strings.Repeat("a", 40)
+	host, port := startFakeRedis(t, "", "s3cret", func(w io.Writer) {
+		fmt.Fprintf(w, "$EOF:%s\r\n%s%s", mark, fakeRdb, mark)
+	})
+	redisDumper := dumper.NewRedisDumper("redis1", t.TempDir(), host, port, "", "s3cret", dumper.RedisTlsConfig{})
+
+	dumpPath, err := redisDumper.Dump(context.Background())
+	assert.NoError(t, err)
+	content, err := os.ReadFile(dumpPath)
+	assert.NoError(t, err)
+	assert.Equal(t, fakeRdb, string(content))
+}
+
+func TestRedisDumperWrongPassword(t *testing.T) {
+	host, port := startFakeRedis(t, "", "s3cret", func(w io.Writer) {})
+	redisDumper := dumper.NewRedisDumper("redis1", t.TempDir(), host, port, "", "wrong", dumper.RedisTlsConfig{})
+	assert.ErrorContains(t, redisDumper.Health(), "WRONGPASS")
+
+	_, err := redisDumper.Dump(context.Background())
+	assert.ErrorContains(t, err, "WRONGPASS")
+	entries, err := os.ReadDir(redisDumper.TmpFolder)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRedisDumperStalledServer(t *testing.T) {
+	host, port := startFakeRedis(t, "", "", func(w io.Writer) {
+		fmt.Fprintf(w, "$%d\r\n%s", len(fakeRdb)+10, fakeRdb)
+		time.Sleep(time.Second)
+	})
+	redisDumper := dumper.NewRedisDumper("redis1", t.TempDir(), host, port, "", "", dumper.RedisTlsConfig{})
+	redisDumper.ReadTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	_, err := redisDumper.Dump(context.Background())
+	assert.ErrorContains(t, err, "i/o timeout")
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestRedisDumperKeepalive(t *testing.T) {
+	// The newlines sent during the background save extend the read deadline
+	host, port := startFakeRedis(t, "", "", func(w io.Writer) {
+		for range 6 {
+			io.WriteString(w, "\n")
+			time.Sleep(50 * time.Millisecond)
+		}
+		fmt.Fprintf(w, "$%d\r\n%s", len(fakeRdb), fakeRdb)
+	})
+	redisDumper := dumper.NewRedisDumper("redis1", t.TempDir(), host, port, "", "", dumper.RedisTlsConfig{})
+	redisDumper.ReadTimeout = 150 * time.Millisecond
+
+	dumpPath, err := redisDumper.Dump(context.Background())
+	assert.NoError(t, err)
+	content, err := os.ReadFile(dumpPath)
+	assert.NoError(t, err)
+	assert.Equal(t, fakeRdb, string(content))
+}
+
+// writeTestCertificate writes the PEM files of a certificate for 127.0.0.1
+// signed by parent, self signed when nil
+func writeTestCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	folder := t.TempDir()
+	certFile := filepath.Join(folder, name+".crt")
+	keyFile := filepath.Join(folder, name+".key")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certificate, key, certFile, keyFile
+}
+
+func TestRedisDumperTls(t *testing.T) {
+	ca, caKey, caFile, _ := writeTestCertificate(t, "ca", nil, nil)
+	_, _, serverCert, serverKey := writeTestCertificate(t, "server", ca, caKey)
+	_, _, clientCert, clientKey := writeTestCertificate(t, "client", ca, caKey)
+	serverPair, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	assert.NoError(t, err)
+	clientCas := x509.NewCertPool()
+	clientCas.AddCert(ca)
+
+	// The server requires a client certificate signed by the CA
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverPair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCas,
+	})
+	assert.NoError(t, err)
+	host, port := acceptFakeRedis(t, listener, "", "s3cret", func(w io.Writer) {
+		fmt.Fprintf(w, "$%d\r\n%s", len(fakeRdb), fakeRdb)
+	})
+
+	redisDumper := dumper.NewRedisDumper("redis1", t.TempDir(), host, port, "", "s3cret", dumper.RedisTlsConfig{
+		Enabled:  true,
+		CaFile:   caFile,
+		CertFile: clientCert,
+		KeyFile:  clientKey,
+	})
+	assert.NoError(t, redisDumper.Health())
+	dumpPath, err := redisDumper.Dump(context.Background())
+	assert.NoError(t, err)
+	content, err := os.ReadFile(dumpPath)
+	assert.NoError(t, err)
+	assert.Equal(t, fakeRdb, string(content))
+
+	// The server is not trusted without the CA, unless verification is skipped
+	redisDumper = dumper.NewRedisDumper("redis1", t.TempDir(), host, port, "", "s3cret", dumper.RedisTlsConfig{
+		Enabled:  true,
+		CertFile: clientCert,
+		KeyFile:  clientKey,
+	})
+	assert.ErrorContains(t, redisDumper.Health(), "certificate")
+	redisDumper = dumper.NewRedisDumper("redis1", t.TempDir(), host, port, "", "s3cret", dumper.RedisTlsConfig{
+		Enabled:    true,
+		CertFile:   clientCert,
+		KeyFile:    clientKey,
+		SkipVerify: true,
+	})
+	assert.NoError(t, redisDumper.Health())
+
+	// The client certificate is required by the server
+	redisDumper = dumper.NewRedisDumper("redis1", t.TempDir(), host, port, "", "s3cret", dumper.RedisTlsConfig{
+		Enabled: true,
+		CaFile:  caFile,
+	})
+	assert.Error(t, redisDumper.Health())
+}
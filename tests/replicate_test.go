@@ -0,0 +1,196 @@
+package tests_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/model"
+	"github.com/herytz/backupman/core/service"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+// replicateAppMock returns an app whose backups were uploaded to a memory
+// drive before adding a local drive
+func replicateAppMock(t *testing.T, backups int) (*application.App, *memoryDriveMock, []string) {
+	app := tests.NewAppMock()
+	app.Mode = application.APP_MODE_CLI
+	app.Dumpers = []dumper.Dumper{&databaseDumperMock{label: "shop"}}
+	memoryDrive := &memoryDriveMock{}
+	app.Drives = []drive.Drive{memoryDrive}
+	backupIds := make([]string, 0)
+	for range backups {
+		ids, err := service.Backup(context.Background(), app, startRun(t, app))
+		assert.NoError(t, err)
+		backupIds = append(backupIds, ids...)
+	}
+	app.Drives = append(app.Drives, drive.NewLocalDrive("local", t.TempDir()))
+	return app, memoryDrive, backupIds
+}
+
+func replicateStatuses(output service.ReplicateOutput) map[string]string {
+	statuses := make(map[string]string)
+	for _, result := range output.Results {
+		statuses[result.BackupId] = result.Status
+	}
+	return statuses
+}
+
+func TestReplicate(t *testing.T) {
+	app, _, backupIds := replicateAppMock(t, 2)
+	input := service.ReplicateInput{From: "memory", To: "local"}
+
+	output, err := service.Replicate(context.Background(), app, input)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		backupIds[0]: service.REPLICATE_STATUS_REPLICATED,
+		backupIds[1]: service.REPLICATE_STATUS_REPLICATED,
+	}, replicateStatuses(output))
+	for _, backupId := range backupIds {
+		backup, err := app.Db.Backup.ReadFullById(backupId)
+		assert.NoError(t, err)
+		assert.Len(t, backup.DriveFiles, 2)
+		for _, driveFile := range backup.DriveFiles {
+			assert.Equal(t, model.DRIVE_FILE_STATUS_FINISHED, driveFile.Status)
+			if driveFile.Label == "local" {
+				content, err := os.ReadFile(driveFile.Path)
+				assert.NoError(t, err)
+				assert.Equal(t, "shop", string(content))
+			}
+		}
+	}
+
+	// The backups already replicated are skipped
+	output, err = service.Replicate(context.Background(), app, input)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		backupIds[0]: service.REPLICATE_STATUS_SKIPPED,
+		backupIds[1]: service.REPLICATE_STATUS_SKIPPED,
+	}, replicateStatuses(output))
+	backup, err := app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	assert.Len(t, backup.DriveFiles, 2)
+}
+
+func TestReplicateMissing(t *testing.T) {
+	app, _, backupIds := replicateAppMock(t, 1)
+	_, err := service.Replicate(context.Background(), app, service.ReplicateInput{From: "memory", To: "local"})
+	assert.NoError(t, err)
+	backup, err := app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	for _, driveFile := range backup.DriveFiles {
+		if driveFile.Label == "local" {
+			assert.NoError(t, os.Remove(driveFile.Path))
+		}
+	}
+	_, err = service.Reconcile(context.Background(), app, service.ReconcileInput{Drives: []string{"local"}, MarkMissing: true})
+	assert.NoError(t, err)
+	failed, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, failed.Status)
+
+	// The missing file is copied again, finishing its backup
+	output, err := service.Replicate(context.Background(), app, service.ReplicateInput{From: "memory", To: "local"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		backupIds[0]: service.REPLICATE_STATUS_REPLICATED,
+	}, replicateStatuses(output))
+	finished, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, finished.Status)
+}
+
+func TestReplicateSince(t *testing.T) {
+	app, _, backupIds := replicateAppMock(t, 2)
+	old, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	old.CreatedAt = time.Now().AddDate(0, 0, -10)
+	_, err = app.Db.Backup.Update(old.Id, *old)
+	assert.NoError(t, err)
+
+	output, err := service.Replicate(context.Background(), app, service.ReplicateInput{From: "memory", To: "local", Since: 24 * time.Hour})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		backupIds[1]: service.REPLICATE_STATUS_REPLICATED,
+	}, replicateStatuses(output))
+}
+
+func TestReplicateResume(t *testing.T) {
+	app, memoryDrive, backupIds := replicateAppMock(t, 1)
+	_, err := service.Replicate(context.Background(), app, service.ReplicateInput{From: "memory", To: "local"})
+	assert.NoError(t, err)
+	backup, err := app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	for _, driveFile := range backup.DriveFiles {
+		if driveFile.Label == "memory" {
+			assert.NoError(t, app.Db.DriveFile.Delete(driveFile.Id))
+		}
+	}
+	// Replicated back from the local drive to the memory drive, failing once
+	memoryDrive.failures = 1
+
+	output, err := service.Replicate(context.Background(), app, service.ReplicateInput{From: "local", To: "memory"})
+	assert.NoError(t, err)
+	assert.Equal(t, service.REPLICATE_STATUS_FAILED, output.Results[0].Status)
+	assert.Equal(t, "upload interrupted", output.Results[0].Error)
+
+	// The failed drive file is uploaded again
+	output, err = service.Replicate(context.Background(), app, service.ReplicateInput{From: "local", To: "memory"})
+	assert.NoError(t, err)
+	assert.Equal(t, service.REPLICATE_STATUS_REPLICATED, output.Results[0].Status)
+	backup, err = app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	assert.Len(t, backup.DriveFiles, 2)
+	for _, driveFile := range backup.DriveFiles {
+		assert.Equal(t, model.DRIVE_FILE_STATUS_FINISHED, driveFile.Status)
+		if driveFile.Label == "memory" {
+			assert.Equal(t, 2, driveFile.Attempts)
+		}
+	}
+}
+
+// corruptingDriveMock stores the uploads in memory but downloads them altered
+type corruptingDriveMock struct {
+	memoryDriveMock
+}
+
+func (d *corruptingDriveMock) Download(ctx context.Context, path, dstPath string) error {
+	return os.WriteFile(dstPath, []byte("corrupted"), 0644)
+}
+
+func (d *corruptingDriveMock) GetLabel() string {
+	return "corrupting"
+}
+
+func TestReplicateChecksumMismatch(t *testing.T) {
+	app, _, _ := replicateAppMock(t, 1)
+	corruptingDrive := &corruptingDriveMock{}
+	app.Drives = append(app.Drives, corruptingDrive)
+
+	output, err := service.Replicate(context.Background(), app, service.ReplicateInput{From: "memory", To: "corrupting"})
+	assert.NoError(t, err)
+	assert.Equal(t, service.REPLICATE_STATUS_FAILED, output.Results[0].Status)
+	assert.Contains(t, output.Results[0].Error, "does not match the source")
+	// The unverified replica is deleted
+	assert.Empty(t, corruptingDrive.files)
+	backup, err := app.Db.Backup.ReadFullById(output.Results[0].BackupId)
+	assert.NoError(t, err)
+	for _, driveFile := range backup.DriveFiles {
+		if driveFile.Label == "corrupting" {
+			assert.Equal(t, model.DRIVE_FILE_STATUS_FAILED, driveFile.Status)
+		}
+	}
+}
+
+func TestReplicateInvalidDrives(t *testing.T) {
+	app, _, _ := replicateAppMock(t, 0)
+	_, err := service.Replicate(context.Background(), app, service.ReplicateInput{From: "memory", To: "s3"})
+	assert.EqualError(t, err, "unknown drive (s3)")
+	_, err = service.Replicate(context.Background(), app, service.ReplicateInput{From: "local", To: "local"})
+	assert.EqualError(t, err, "cannot replicate drive (local) to itself")
+}
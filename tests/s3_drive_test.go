@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -68,6 +69,22 @@ func TestS3DriveUploadWithInvalidCredentials(t *testing.T) {
 	s3Drive := drive.NewS3Drive("test", "invalid-bucket", "us-east-1", "invalid-key", "invalid-secret", "", "", false)
 
 	// This should fail due to invalid credentials
-	_, err = s3Drive.Upload(tmpFile)
+	_, err = s3Drive.Upload(context.Background(), tmpFile)
 	assert.Error(t, err)
 }
+
+func TestS3StreamPartSize(t *testing.T) {
+	const mib = 1024 * 1024
+	assert.Equal(t, 8*mib, drive.S3StreamPartSize(1))
+	assert.Equal(t, 8*mib, drive.S3StreamPartSize(1000))
+	assert.Equal(t, 16*mib, drive.S3StreamPartSize(1001))
+	assert.Equal(t, 4096*mib, drive.S3StreamPartSize(9001))
+	assert.Equal(t, 4096*mib, drive.S3StreamPartSize(drive.S3_MAX_PARTS))
+
+	// The parts can hold more than the 5 TiB of the largest S3 object
+	var total int64
+	for partNumber := int32(1); partNumber <= drive.S3_MAX_PARTS; partNumber++ {
+		total += int64(drive.S3StreamPartSize(partNumber))
+	}
+	assert.Greater(t, total, int64(5*1024*1024*mib))
+}
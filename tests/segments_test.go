@@ -0,0 +1,113 @@
+package tests_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/core/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// segmentJob writes its index, the jobs of lower indexes finishing last
+func segmentJob(count int) func(worker, index int, w io.Writer) error {
+	return func(worker, index int, w io.Writer) error {
+		time.Sleep(time.Duration(count-index) * time.Millisecond)
+		_, err := fmt.Fprintf(w, "%d;", index)
+		return err
+	}
+}
+
+func assertNoSegments(t *testing.T, folder string) {
+	segments, err := filepath.Glob(filepath.Join(folder, "*.part"))
+	assert.NoError(t, err)
+	assert.Empty(t, segments)
+}
+
+func TestWriteSegmentsOrder(t *testing.T) {
+	expected := ""
+	for i := range 20 {
+		expected += fmt.Sprintf("%d;", i)
+	}
+	for _, parallelism := range []int{1, 4, 20} {
+		folder := t.TempDir()
+		var dst bytes.Buffer
+		err := lib.WriteSegments(&dst, filepath.Join(folder, "dump.sql"), 20, parallelism, segmentJob(20))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, dst.String(), "parallelism %d", parallelism)
+		assertNoSegments(t, folder)
+	}
+}
+
+func TestWriteSegmentsWorkers(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	workers := make(map[int]bool)
+	var mu sync.Mutex
+	err := lib.WriteSegments(io.Discard, filepath.Join(t.TempDir(), "dump.sql"), 12, 3, func(worker, index int, w io.Writer) error {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			previous := maxRunning.Load()
+			if current <= previous || maxRunning.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		mu.Lock()
+		workers[worker] = true
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, maxRunning.Load(), int32(3))
+	for worker := range workers {
+		assert.Less(t, worker, 3)
+	}
+}
+
+func TestWriteSegmentsFailure(t *testing.T) {
+	folder := t.TempDir()
+	failure := fmt.Errorf("table locked")
+	var dst bytes.Buffer
+	err := lib.WriteSegments(&dst, filepath.Join(folder, "dump.sql"), 10, 4, func(worker, index int, w io.Writer) error {
+		fmt.Fprintf(w, "%d;", index)
+		if index == 3 {
+			return failure
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, failure)
+	// Nothing is written and the segments of the failed dump are removed
+	assert.Empty(t, dst.String())
+	assertNoSegments(t, folder)
+}
+
+func TestRunJobsFirstError(t *testing.T) {
+	var ran []int
+	err := lib.RunJobs(10, 1, func(worker, index int) error {
+		ran = append(ran, index)
+		if index >= 2 {
+			return fmt.Errorf("job %d failed", index)
+		}
+		return nil
+	})
+	// The first error is returned and the remaining jobs are skipped
+	assert.EqualError(t, err, "job 2 failed")
+	assert.Equal(t, []int{0, 1, 2}, ran)
+
+	var count atomic.Int32
+	err = lib.RunJobs(10, 4, func(worker, index int) error {
+		count.Add(1)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(10), count.Load())
+	assert.NoError(t, lib.RunJobs(0, 4, func(worker, index int) error {
+		return fmt.Errorf("not run")
+	}))
+}
@@ -0,0 +1,76 @@
+//go:build test_integration
+
+package tests_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMysqlExportCsv(t *testing.T) {
+	connectDb()
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS export_users",
+		"CREATE TABLE export_users (id INT PRIMARY KEY, email VARCHAR(100), balance DECIMAL(10,2), ratio DOUBLE)",
+		"INSERT INTO export_users VALUES (1, 'alice@mail.com', 12.50, 0.5), (2, NULL, 3.00, NULL)",
+	} {
+		_, err := dbConn.Exec(query)
+		assert.NoError(t, err)
+	}
+
+	d := dumper.NewMysqlDumper("mysql1", t.TempDir(), "localhost", 3307, "root", "root", "backupman", "false",
+		dumper.SqlDumpOptions{
+			TableFilter: dumper.TableFilter{IncludeTables: []string{"export_users"}},
+			Masking:     dumper.Masking{{Table: "export_users", Column: "email", Strategy: dumper.MASKING_STRATEGY_FIXED, Value: "hidden"}},
+			Format:      dumper.EXPORT_FORMAT_CSV,
+		}, dumper.BinlogOptions{})
+	dumpPath, err := d.Dump(context.Background())
+	assert.NoError(t, err)
+
+	entries, manifest := readExportArchive(t, dumpPath)
+	assert.Len(t, manifest.Tables, 1)
+	assert.Equal(t, int64(2), manifest.Tables[0].RowCount)
+	assert.Equal(t, []dumper.TableColumn{
+		{Name: "id", DatabaseType: "INT", Type: dumper.EXPORT_TYPE_INTEGER},
+		{Name: "email", DatabaseType: "VARCHAR", Type: dumper.EXPORT_TYPE_STRING},
+		{Name: "balance", DatabaseType: "DECIMAL", Type: dumper.EXPORT_TYPE_STRING},
+		{Name: "ratio", DatabaseType: "DOUBLE", Type: dumper.EXPORT_TYPE_FLOAT},
+	}, manifest.Tables[0].Columns)
+	assert.Equal(t, "id,email,balance,ratio\n1,hidden,12.50,0.5\n2,,3.00,\n", string(entries["export_users.csv"]))
+
+	err = d.Restore(dumpPath)
+	assert.ErrorContains(t, err, "cannot be restored")
+}
+
+func TestPostgresExportJsonl(t *testing.T) {
+	connectDbPostgres()
+	ctx := context.Background()
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS export_users",
+		"CREATE TABLE export_users (id BIGINT PRIMARY KEY, email TEXT, active BOOLEAN, created_at TIMESTAMPTZ)",
+		"INSERT INTO export_users VALUES (1, 'alice@mail.com', true, '2025-01-02 03:04:05+00'), (2, NULL, false, NULL)",
+	} {
+		_, err := dbConnPg.Exec(ctx, query)
+		assert.NoError(t, err)
+	}
+
+	d := dumper.NewPostgresDumper("postgres1", t.TempDir(), "localhost", 5433, "postgres", "postgres", "backupman", false,
+		dumper.SqlDumpOptions{
+			TableFilter: dumper.TableFilter{IncludeTables: []string{"export_users"}},
+			Format:      dumper.EXPORT_FORMAT_JSONL,
+		})
+	dumpPath, err := d.Dump(context.Background())
+	assert.NoError(t, err)
+
+	entries, manifest := readExportArchive(t, dumpPath)
+	assert.Equal(t, []dumper.TableColumn{
+		{Name: "id", DatabaseType: "int8", Type: dumper.EXPORT_TYPE_INTEGER},
+		{Name: "email", DatabaseType: "text", Type: dumper.EXPORT_TYPE_STRING},
+		{Name: "active", DatabaseType: "bool", Type: dumper.EXPORT_TYPE_BOOLEAN},
+		{Name: "created_at", DatabaseType: "timestamptz", Type: dumper.EXPORT_TYPE_STRING},
+	}, manifest.Tables[0].Columns)
+	assert.Contains(t, string(entries["export_users.jsonl"]), `{"id":2,"email":null,"active":false,"created_at":null}`)
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
 	"database/sql"
 	"os"
 	"path"
@@ -47,7 +48,7 @@ func TestSqliteDumper(t *testing.T) {
 	db.Close()
 
 	// Create the dumper
-	sqliteDumper := dumper.NewSqliteDumper("Test SQLite", dumpFolder, sourceDbPath)
+	sqliteDumper := dumper.NewSqliteDumper("Test SQLite", dumpFolder, sourceDbPath, "")
 
 	// Test Health check
 	err = sqliteDumper.Health()
@@ -61,7 +62,7 @@ func TestSqliteDumper(t *testing.T) {
 	}
 
 	// Test Dump
-	dumpPath, err := sqliteDumper.Dump()
+	dumpPath, err := sqliteDumper.Dump(context.Background())
 	if err != nil {
 		t.Fatalf("Dump failed: %v", err)
 	}
@@ -0,0 +1,161 @@
+package tests_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// readExportArchive returns the entries of a table export with its manifest
+func readExportArchive(t *testing.T, dumpPath string) (map[string][]byte, dumper.ExportManifest) {
+	file, err := os.Open(dumpPath)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	entries := make(map[string][]byte)
+	archive := tar.NewReader(file)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		content, err := io.ReadAll(archive)
+		assert.NoError(t, err)
+		entries[header.Name] = content
+	}
+
+	var manifest dumper.ExportManifest
+	err = json.Unmarshal(entries[dumper.ExportManifestName], &manifest)
+	assert.NoError(t, err)
+	return entries, manifest
+}
+
+func createExportSqliteDb(t *testing.T) string {
+	dbPath := path.Join(t.TempDir(), "source.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, score REAL, active BOOLEAN, avatar BLOB);
+		INSERT INTO users VALUES (1, 'Alice', 9.5, 1, x'0102'), (2, 'Bob, "the builder"', NULL, 0, NULL);
+		CREATE TABLE empty_table (code VARCHAR(10));
+	`)
+	assert.NoError(t, err)
+	return dbPath
+}
+
+func TestSqliteExportCsv(t *testing.T) {
+	d := dumper.NewSqliteDumper("export", t.TempDir(), createExportSqliteDb(t), dumper.EXPORT_FORMAT_CSV)
+	dumpPath, err := d.Dump(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, ".tar", path.Ext(dumpPath))
+
+	entries, manifest := readExportArchive(t, dumpPath)
+	assert.Equal(t, dumper.EXPORT_FORMAT_CSV, manifest.Format)
+	assert.Equal(t, []dumper.ExportTable{
+		{
+			Name:     "empty_table",
+			File:     "empty_table.csv",
+			RowCount: 0,
+			Columns: []dumper.TableColumn{
+				{Name: "code", DatabaseType: "VARCHAR(10)", Type: dumper.EXPORT_TYPE_STRING},
+			},
+		},
+		{
+			Name:     "users",
+			File:     "users.csv",
+			RowCount: 2,
+			Columns: []dumper.TableColumn{
+				{Name: "id", DatabaseType: "INTEGER", Type: dumper.EXPORT_TYPE_INTEGER},
+				{Name: "name", DatabaseType: "TEXT", Type: dumper.EXPORT_TYPE_STRING},
+				{Name: "score", DatabaseType: "REAL", Type: dumper.EXPORT_TYPE_FLOAT},
+				{Name: "active", DatabaseType: "BOOLEAN", Type: dumper.EXPORT_TYPE_BOOLEAN},
+				{Name: "avatar", DatabaseType: "BLOB", Type: dumper.EXPORT_TYPE_BYTES},
+			},
+		},
+	}, manifest.Tables)
+
+	assert.Equal(t, "code\n", string(entries["empty_table.csv"]))
+	assert.Equal(t, "id,name,score,active,avatar\n1,Alice,9.5,true,AQI=\n2,\"Bob, \"\"the builder\"\"\",,false,\n", string(entries["users.csv"]))
+}
+
+func TestSqliteExportJsonl(t *testing.T) {
+	d := dumper.NewSqliteDumper("export", t.TempDir(), createExportSqliteDb(t), dumper.EXPORT_FORMAT_JSONL)
+	dumpPath, err := d.Dump(context.Background())
+	assert.NoError(t, err)
+
+	entries, manifest := readExportArchive(t, dumpPath)
+	assert.Equal(t, "users.jsonl", manifest.Tables[1].File)
+	lines := strings.Split(strings.TrimSpace(string(entries["users.jsonl"])), "\n")
+	assert.Equal(t, []string{
+		`{"id":1,"name":"Alice","score":9.5,"active":true,"avatar":"AQI="}`,
+		`{"id":2,"name":"Bob, \"the builder\"","score":null,"active":false,"avatar":null}`,
+	}, lines)
+}
+
+func TestSqliteExportParquet(t *testing.T) {
+	d := dumper.NewSqliteDumper("export", t.TempDir(), createExportSqliteDb(t), dumper.EXPORT_FORMAT_PARQUET)
+	dumpPath, err := d.Dump(context.Background())
+	assert.NoError(t, err)
+
+	entries, manifest := readExportArchive(t, dumpPath)
+	assert.Equal(t, int64(2), manifest.Tables[1].RowCount)
+	content := entries["users.parquet"]
+
+	type user struct {
+		Id     *int64   `parquet:"id,optional"`
+		Name   *string  `parquet:"name,optional"`
+		Score  *float64 `parquet:"score,optional"`
+		Active *bool    `parquet:"active,optional"`
+		Avatar []byte   `parquet:"avatar,optional"`
+	}
+	users, err := parquet.Read[user](bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.Equal(t, int64(1), *users[0].Id)
+	assert.Equal(t, "Alice", *users[0].Name)
+	assert.Equal(t, 9.5, *users[0].Score)
+	assert.True(t, *users[0].Active)
+	assert.Equal(t, []byte{1, 2}, users[0].Avatar)
+	assert.Equal(t, `Bob, "the builder"`, *users[1].Name)
+	assert.Nil(t, users[1].Score)
+	assert.False(t, *users[1].Active)
+}
+
+func TestSqliteExportInvalidValue(t *testing.T) {
+	dbPath := path.Join(t.TempDir(), "source.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE counters (total INTEGER); INSERT INTO counters VALUES ('many');`)
+	assert.NoError(t, err)
+	db.Close()
+
+	tmpFolder := t.TempDir()
+	d := dumper.NewSqliteDumper("export", tmpFolder, dbPath, dumper.EXPORT_FORMAT_CSV)
+	_, err = d.Dump(context.Background())
+	assert.ErrorContains(t, err, "column total: value (many) is not of type integer")
+
+	// Nothing is left in the temporary folder
+	entries, err := os.ReadDir(tmpFolder)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestValidateExportFormat(t *testing.T) {
+	for _, format := range []string{"", "sql", "csv", "jsonl", "parquet"} {
+		assert.NoError(t, dumper.ValidateExportFormat(format))
+	}
+	assert.ErrorContains(t, dumper.ValidateExportFormat("xml"), "unsupported format")
+}
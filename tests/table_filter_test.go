@@ -0,0 +1,41 @@
+package tests_test
+
+import (
+	"testing"
+
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableFilterApply(t *testing.T) {
+	tables := []string{"users", "orders", "audit_logs", "audit_events", "sessions"}
+
+	assert.Equal(t, tables, dumper.TableFilter{}.Apply(tables))
+
+	filter := dumper.TableFilter{
+		ExcludeTables: []string{"audit_*", "sessions"},
+	}
+	assert.Equal(t, []string{"users", "orders"}, filter.Apply(tables))
+
+	filter = dumper.TableFilter{
+		IncludeTables: []string{"audit_*", "users"},
+		ExcludeTables: []string{"audit_events"},
+	}
+	assert.Equal(t, []string{"users", "audit_logs"}, filter.Apply(tables))
+}
+
+func TestTableFilterSchemaOnlyAndWhere(t *testing.T) {
+	filter := dumper.TableFilter{
+		SchemaOnlyTables: []string{"audit_*"},
+		Where:            map[string]string{"orders": "created_at > '2024-01-01'"},
+	}
+	assert.True(t, filter.IsSchemaOnly("audit_logs"))
+	assert.False(t, filter.IsSchemaOnly("orders"))
+	assert.Equal(t, "created_at > '2024-01-01'", filter.WhereClause("orders"))
+	assert.Equal(t, "", filter.WhereClause("users"))
+}
+
+func TestTableFilterValidate(t *testing.T) {
+	assert.NoError(t, dumper.TableFilter{ExcludeTables: []string{"audit_*"}}.Validate())
+	assert.Error(t, dumper.TableFilter{ExcludeTables: []string{"audit_[*"}}.Validate())
+}
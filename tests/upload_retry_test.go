@@ -0,0 +1,122 @@
+package tests_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/model"
+	"github.com/herytz/backupman/core/service"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func newUploadRetryAppMock(retry application.RetryConfig) (*application.App, *memoryDriveMock) {
+	d := &memoryDriveMock{}
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{&databaseDumperMock{label: "shop"}}
+	app.Drives = []drive.Drive{d}
+	app.DriveOptions = map[string]application.DriveOptions{
+		"memory": {Retry: retry},
+	}
+	app.Http.RetryJob = application.RetryJobConfig{
+		Enabled:     true,
+		MaxAge:      time.Hour,
+		MaxAttempts: 3,
+	}
+	return app, d
+}
+
+func readSingleDriveFile(t *testing.T, app *application.App, backupId string) (*model.BackupFull, *model.DriveFile) {
+	backup, err := app.Db.Backup.ReadFullById(backupId)
+	assert.NoError(t, err)
+	assert.Len(t, backup.DriveFiles, 1)
+	return backup, backup.DriveFiles[0]
+}
+
+func TestUploadRetryBackoff(t *testing.T) {
+	app, d := newUploadRetryAppMock(application.RetryConfig{
+		Attempts:     3,
+		InitialDelay: time.Millisecond,
+		MaxDelay:     2 * time.Millisecond,
+		Jitter:       0.5,
+	})
+	d.failures = 2
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	backup, driveFile := readSingleDriveFile(t, app, backupIds[0])
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+	assert.Equal(t, model.DRIVE_FILE_STATUS_FINISHED, driveFile.Status)
+	assert.Equal(t, 3, driveFile.Attempts)
+	assert.Equal(t, 3, d.uploads)
+}
+
+func TestUploadRetryExhausted(t *testing.T) {
+	app, d := newUploadRetryAppMock(application.RetryConfig{
+		Attempts:     2,
+		InitialDelay: time.Millisecond,
+	})
+	d.unavailable = true
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	backup, driveFile := readSingleDriveFile(t, app, backupIds[0])
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, backup.Status)
+	assert.Equal(t, model.DRIVE_FILE_STATUS_FAILED, driveFile.Status)
+	assert.Equal(t, 2, driveFile.Attempts)
+}
+
+func TestRetryFailedUploads(t *testing.T) {
+	app, d := newUploadRetryAppMock(application.RetryConfig{})
+	d.unavailable = true
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	backupId := backupIds[0]
+
+	// Still unavailable, the drive file is retried until the max attempts
+	for range 2 {
+		retried, err := service.RetryFailedUploads(context.Background(), app)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{backupId}, retried)
+	}
+	retried, err := service.RetryFailedUploads(context.Background(), app)
+	assert.NoError(t, err)
+	assert.Empty(t, retried)
+	_, driveFile := readSingleDriveFile(t, app, backupId)
+	assert.Equal(t, 3, driveFile.Attempts)
+	assert.Equal(t, model.DRIVE_FILE_STATUS_FAILED, driveFile.Status)
+
+	// A new backup is retried once the drive is back
+	d.unavailable = false
+	d.failures = 1
+	backupIds, err = service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	retried, err = service.RetryFailedUploads(context.Background(), app)
+	assert.NoError(t, err)
+	assert.Equal(t, backupIds, retried)
+	backup, driveFile := readSingleDriveFile(t, app, backupIds[0])
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+	assert.Equal(t, 2, driveFile.Attempts)
+	// The dump is removed once uploaded
+	assert.Empty(t, backup.DumpPath)
+}
+
+func TestRetryFailedUploadsSkipsOldBackups(t *testing.T) {
+	app, d := newUploadRetryAppMock(application.RetryConfig{})
+	d.unavailable = true
+
+	_, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+
+	app.Http.RetryJob.MaxAge = -time.Minute
+	d.unavailable = false
+	retried, err := service.RetryFailedUploads(context.Background(), app)
+	assert.NoError(t, err)
+	assert.Empty(t, retried)
+	assert.Equal(t, 1, d.uploads)
+}
@@ -0,0 +1,163 @@
+package tests_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/model"
+	"github.com/herytz/backupman/core/service"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumeDrive(t *testing.T) {
+	ctx := context.Background()
+	folder := t.TempDir()
+	volumeDrive := drive.NewVolumeDrive(drive.NewLocalDrive("local", folder), 1000)
+	dump := randomDump(3, 3500)
+
+	file, err := volumeDrive.Upload(ctx, writeDump(t, "shop.sql", dump))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(file.Path, drive.VOLUME_MANIFEST_PREFIX+"shop.sql"))
+	assert.Len(t, file.Parts, 4)
+	for i, part := range file.Parts {
+		assert.True(t, strings.HasSuffix(part, fmt.Sprintf("shop.sql.%03d", i+1)))
+		info, err := os.Stat(part)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, info.Size(), int64(1000))
+	}
+
+	dstPath := filepath.Join(t.TempDir(), "shop.sql")
+	assert.NoError(t, drive.DownloadVolumes(ctx, volumeDrive, file.Path, dstPath))
+	downloaded, err := os.ReadFile(dstPath)
+	assert.NoError(t, err)
+	assert.Equal(t, dump, downloaded)
+}
+
+func TestVolumeDriveWithoutStream(t *testing.T) {
+	ctx := context.Background()
+	// The volumes are uploaded from temporary files to the drives unable to
+	// upload a stream
+	memoryDrive := &memoryDriveMock{}
+	volumeDrive := drive.NewVolumeDrive(memoryDrive, 1000)
+	dump := randomDump(4, 2000)
+
+	file, err := volumeDrive.Upload(ctx, writeDump(t, "shop.sql", dump))
+	assert.NoError(t, err)
+	assert.Len(t, file.Parts, 2)
+	assert.Equal(t, 3, memoryDrive.uploads)
+	assert.Equal(t, dump[:1000], memoryDrive.files[file.Parts[0]])
+	assert.Equal(t, dump[1000:], memoryDrive.files[file.Parts[1]])
+
+	dstPath := filepath.Join(t.TempDir(), "shop.sql")
+	assert.NoError(t, drive.DownloadVolumes(ctx, volumeDrive, file.Path, dstPath))
+	downloaded, err := os.ReadFile(dstPath)
+	assert.NoError(t, err)
+	assert.Equal(t, dump, downloaded)
+
+	// A corrupted volume is detected
+	memoryDrive.files[file.Parts[1]] = []byte("corrupted")
+	err = drive.DownloadVolumes(ctx, volumeDrive, file.Path, dstPath)
+	assert.ErrorContains(t, err, "volume 2 of file-3 is corrupted")
+}
+
+// failAtDriveMock fails its upload number failAt
+type failAtDriveMock struct {
+	memoryDriveMock
+	failAt int
+}
+
+func (d *failAtDriveMock) Upload(ctx context.Context, srcPath string) (drive.DriveFile, error) {
+	d.mu.Lock()
+	if d.uploads+1 == d.failAt {
+		d.uploads++
+		d.mu.Unlock()
+		return drive.DriveFile{}, fmt.Errorf("upload interrupted")
+	}
+	d.mu.Unlock()
+	return d.memoryDriveMock.Upload(ctx, srcPath)
+}
+
+func TestVolumeDriveFailedUpload(t *testing.T) {
+	failingDrive := &failAtDriveMock{failAt: 3}
+	volumeDrive := drive.NewVolumeDrive(failingDrive, 1000)
+
+	_, err := volumeDrive.Upload(context.Background(), writeDump(t, "shop.sql", randomDump(5, 3500)))
+	assert.ErrorContains(t, err, "failed to upload volume 3 of")
+	// The volumes already uploaded are deleted
+	assert.Empty(t, failingDrive.files)
+}
+
+func TestBackupRetryVolumeDrive(t *testing.T) {
+	folder := t.TempDir()
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{&databaseDumperMock{label: "shop"}}
+	app.Drives = []drive.Drive{drive.NewVolumeDrive(drive.NewLocalDrive("local", folder), 3)}
+	// The volumes cannot be stored until the folder of the drive is back
+	assert.NoError(t, os.Remove(folder))
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	backup, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FAILED, backup.Status)
+
+	assert.NoError(t, os.Mkdir(folder, 0755))
+	_, err = service.BackupRetry(context.Background(), app, backupIds[0])
+	assert.NoError(t, err)
+	retried, err := app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, retried.Status)
+	driveFile := retried.DriveFiles[0]
+	assert.Len(t, driveFile.Parts, 2)
+	for _, part := range driveFile.Parts {
+		assert.FileExists(t, part)
+	}
+
+	output, err := service.Download(context.Background(), app, driveFile.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("shop"), output.Byte)
+}
+
+func TestBackupVolumeDrive(t *testing.T) {
+	folder := t.TempDir()
+	app := tests.NewAppMock()
+	app.Retention.Days = 7
+	app.Dumpers = []dumper.Dumper{&databaseDumperMock{label: "shop"}}
+	app.Drives = []drive.Drive{drive.NewVolumeDrive(drive.NewLocalDrive("local", folder), 3)}
+
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	backup, err := app.Db.Backup.ReadFullById(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, backup.Status)
+	assert.Len(t, backup.DriveFiles[0].Parts, 2)
+
+	output, err := service.Download(context.Background(), app, backup.DriveFiles[0].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "shop", string(output.Byte))
+
+	// The retention deletes the manifest, every volume and the catalog entry,
+	// which is not split
+	stored, err := os.ReadDir(folder)
+	assert.NoError(t, err)
+	assert.Len(t, stored, 4)
+	assert.True(t, strings.HasSuffix(backup.DriveFiles[0].CatalogPath, service.CATALOG_ENTRY_SUFFIX))
+	assert.FileExists(t, backup.DriveFiles[0].CatalogPath)
+	old, err := app.Db.Backup.ReadOrError(backup.Id)
+	assert.NoError(t, err)
+	old.CreatedAt = time.Now().AddDate(0, 0, -10)
+	_, err = app.Db.Backup.Update(old.Id, *old)
+	assert.NoError(t, err)
+	assert.NoError(t, service.RemoveOldBackup(context.Background(), app))
+	stored, err = os.ReadDir(folder)
+	assert.NoError(t, err)
+	assert.Empty(t, stored)
+}
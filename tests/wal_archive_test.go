@@ -0,0 +1,291 @@
+package tests_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/core/drive"
+	"github.com/herytz/backupman/core/dumper"
+	"github.com/herytz/backupman/core/model"
+	"github.com/herytz/backupman/core/service"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	walSegment1 = "000000010000000000000001"
+	walSegment2 = "000000010000000000000002"
+	walSegment3 = "000000010000000000000003"
+	walSegment4 = "000000010000000000000004"
+)
+
+// baseBackupDumperMock starts its base backups at position. Restored base
+// backups are recorded with the content of their segments.
+type baseBackupDumperMock struct {
+	position  string
+	positions map[string]string
+	restored  string
+	segments  map[string]string
+	until     time.Time
+}
+
+func (d *baseBackupDumperMock) Dump(ctx context.Context) (string, error) {
+	file, err := os.CreateTemp("", "backupman-*.tar")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	_, err = file.WriteString("base:" + d.position)
+	if err != nil {
+		return "", err
+	}
+	if d.positions == nil {
+		d.positions = make(map[string]string)
+	}
+	d.positions[file.Name()] = d.position
+	return file.Name(), nil
+}
+
+func (d *baseBackupDumperMock) DumpPosition(dumpPath string) (string, bool) {
+	position, ok := d.positions[dumpPath]
+	return position, ok
+}
+
+func (d *baseBackupDumperMock) RestoreBaseBackup(dumpPath string, segments map[string]string, targetDir string, until time.Time) error {
+	content, err := os.ReadFile(dumpPath)
+	if err != nil {
+		return err
+	}
+	d.restored = string(content)
+	d.until = until
+	d.segments = make(map[string]string)
+	for name, path := range segments {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		d.segments[name] = string(content)
+	}
+	return nil
+}
+
+func (d *baseBackupDumperMock) GetLabel() string {
+	return "cluster"
+}
+
+func (d *baseBackupDumperMock) Health() error {
+	return nil
+}
+
+func newBaseBackupAppMock() (*application.App, *baseBackupDumperMock, *memoryDriveMock) {
+	d := &baseBackupDumperMock{}
+	storage := &memoryDriveMock{}
+	app := tests.NewAppMock()
+	app.Dumpers = []dumper.Dumper{d}
+	app.Drives = []drive.Drive{storage}
+	return app, d, storage
+}
+
+func archiveWal(t *testing.T, app *application.App, name string) {
+	path := tests.CreateTestFile(t, t.TempDir(), name, "wal:"+name)
+	err := service.ArchiveWal(context.Background(), app, "cluster", path, name)
+	assert.NoError(t, err)
+}
+
+func readWalBackup(t *testing.T, app *application.App, name string) model.BackupFull {
+	backups, err := app.Db.Backup.ReadAllFull()
+	assert.NoError(t, err)
+	for _, backup := range backups {
+		if backup.Kind == model.BACKUP_KIND_WAL && backup.Position == name {
+			return backup
+		}
+	}
+	t.Fatalf("WAL segment %s not archived", name)
+	return model.BackupFull{}
+}
+
+func TestArchiveWal(t *testing.T) {
+	app, d, storage := newBaseBackupAppMock()
+
+	// Segments archived before the first base backup have no chain
+	archiveWal(t, app, walSegment1)
+	assert.Equal(t, "", readWalBackup(t, app, walSegment1).ParentId)
+
+	d.position = walSegment2
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	base, err := app.Db.Backup.ReadOrError(backupIds[0])
+	assert.NoError(t, err)
+	assert.Equal(t, walSegment2, base.Position)
+
+	archiveWal(t, app, walSegment2)
+	archiveWal(t, app, "00000002.history")
+	wal := readWalBackup(t, app, walSegment2)
+	assert.Equal(t, model.BACKUP_STATUS_FINISHED, wal.Status)
+	assert.Equal(t, base.Id, wal.ParentId)
+	assert.Equal(t, "", wal.DumpPath)
+	assert.Equal(t, base.Id, readWalBackup(t, app, "00000002.history").ParentId)
+
+	// A segment archived again is not uploaded twice
+	uploads := storage.uploads
+	archiveWal(t, app, walSegment2)
+	assert.Equal(t, uploads, storage.uploads)
+
+	// The server keeps the segment until it is stored
+	storage.unavailable = true
+	path := tests.CreateTestFile(t, t.TempDir(), walSegment3, "wal:"+walSegment3)
+	err = service.ArchiveWal(context.Background(), app, "cluster", path, walSegment3)
+	assert.ErrorContains(t, err, "failed to upload WAL segment")
+	storage.unavailable = false
+	err = service.ArchiveWal(context.Background(), app, "cluster", path, walSegment3)
+	assert.NoError(t, err)
+
+	err = service.ArchiveWal(context.Background(), app, "unknown", path, walSegment3)
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestRestoreBaseBackupWithWal(t *testing.T) {
+	app, d, _ := newBaseBackupAppMock()
+
+	archiveWal(t, app, walSegment1)
+	d.position = walSegment2
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	baseId := backupIds[0]
+	archiveWal(t, app, walSegment2)
+	archiveWal(t, app, walSegment3)
+	archiveWal(t, app, walSegment4)
+
+	err = service.Restore(app, baseId, service.RestoreOptions{})
+	assert.ErrorContains(t, err, "target directory is required")
+
+	until := time.Now()
+	err = service.Restore(app, baseId, service.RestoreOptions{TargetDir: t.TempDir(), Until: until})
+	assert.NoError(t, err)
+	assert.Equal(t, "base:"+walSegment2, d.restored)
+	assert.Equal(t, until, d.until)
+	assert.Equal(t, map[string]string{
+		walSegment2: "wal:" + walSegment2,
+		walSegment3: "wal:" + walSegment3,
+		walSegment4: "wal:" + walSegment4,
+	}, d.segments)
+
+	// A segment is restored by replaying the segments up to it
+	err = service.Restore(app, readWalBackup(t, app, walSegment3).Id, service.RestoreOptions{TargetDir: t.TempDir()})
+	assert.NoError(t, err)
+	assert.Equal(t, "base:"+walSegment2, d.restored)
+	assert.Equal(t, map[string]string{
+		walSegment2: "wal:" + walSegment2,
+		walSegment3: "wal:" + walSegment3,
+	}, d.segments)
+
+	err = service.Restore(app, readWalBackup(t, app, walSegment1).Id, service.RestoreOptions{TargetDir: t.TempDir()})
+	assert.ErrorContains(t, err, "does not follow a base backup")
+}
+
+func TestRemoveOldBackupChain(t *testing.T) {
+	app, d, storage := newBaseBackupAppMock()
+	app.Retention.Days = 7
+
+	d.position = walSegment1
+	backupIds, err := service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	oldBaseId := backupIds[0]
+	archiveWal(t, app, walSegment1)
+	// Archived while the next base backup runs
+	archiveWal(t, app, walSegment2)
+	d.position = walSegment2
+	backupIds, err = service.Backup(context.Background(), app, startRun(t, app))
+	assert.NoError(t, err)
+	baseId := backupIds[0]
+	archiveWal(t, app, walSegment3)
+
+	setCreatedAt := func(id string, createdAt time.Time) {
+		backup, err := app.Db.Backup.ReadOrError(id)
+		assert.NoError(t, err)
+		backup.CreatedAt = createdAt
+		_, err = app.Db.Backup.Update(id, *backup)
+		assert.NoError(t, err)
+	}
+	old := time.Now().AddDate(0, 0, -10)
+	setCreatedAt(oldBaseId, old)
+	setCreatedAt(readWalBackup(t, app, walSegment1).Id, old)
+
+	// The chain is kept while one of its backups is recent
+	err = service.RemoveOldBackup(context.Background(), app)
+	assert.NoError(t, err)
+	_, err = app.Db.Backup.ReadOrError(oldBaseId)
+	assert.NoError(t, err)
+
+	setCreatedAt(readWalBackup(t, app, walSegment2).Id, old)
+	err = service.RemoveOldBackup(context.Background(), app)
+	assert.NoError(t, err)
+
+	backups, err := app.Db.Backup.ReadAllFull()
+	assert.NoError(t, err)
+	remaining := make(map[string]string)
+	for _, backup := range backups {
+		if backup.Kind == model.BACKUP_KIND_WAL {
+			remaining[backup.Position] = backup.ParentId
+		}
+	}
+	// The second segment is needed by the recent base backup
+	assert.Equal(t, map[string]string{
+		walSegment2: baseId,
+		walSegment3: baseId,
+	}, remaining)
+	assert.Len(t, backups, 3)
+	assert.Len(t, storage.files, 3)
+}
+
+func TestPostgresRestoreBaseBackup(t *testing.T) {
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	files := map[string]string{
+		"backup_label":         "START WAL LOCATION: 0/2000028 (file 000000010000000000000002)\n",
+		"base/1/1259":          "relation",
+		"postgresql.auto.conf": "work_mem = '8MB'\n",
+	}
+	assert.NoError(t, writer.WriteHeader(&tar.Header{Name: "base/1/", Typeflag: tar.TypeDir, Mode: 0700}))
+	for name, content := range files {
+		assert.NoError(t, writer.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(content))}))
+		_, err := writer.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, writer.Close())
+	dir := t.TempDir()
+	dumpPath := tests.CreateTestFile(t, dir, "base.tar", archive.String())
+	segmentPath := tests.CreateTestFile(t, dir, walSegment2, "wal")
+
+	targetDir := filepath.Join(dir, "data")
+	until := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	d := &dumper.PostgresBaseBackupDumper{}
+	err := d.RestoreBaseBackup(dumpPath, map[string]string{walSegment2: segmentPath}, targetDir, until)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "relation", tests.GetFileContent(t, filepath.Join(targetDir, "base/1/1259")))
+	assert.Equal(t, "wal", tests.GetFileContent(t, filepath.Join(targetDir, dumper.PostgresRestoreWalFolder, walSegment2)))
+	tests.AssertFileExists(t, filepath.Join(targetDir, "recovery.signal"))
+	autoConf := tests.GetFileContent(t, filepath.Join(targetDir, "postgresql.auto.conf"))
+	assert.Contains(t, autoConf, "work_mem = '8MB'")
+	assert.Contains(t, autoConf, "restore_command = 'cp \""+filepath.Join(targetDir, dumper.PostgresRestoreWalFolder)+"/%f\" \"%p\"'")
+	assert.Contains(t, autoConf, "recovery_target_time = '2025-01-02 03:04:05Z'")
+
+	// The data directory of a running server is never overwritten
+	err = d.RestoreBaseBackup(dumpPath, nil, targetDir, time.Time{})
+	assert.ErrorContains(t, err, "not empty")
+
+	var evil bytes.Buffer
+	writer = tar.NewWriter(&evil)
+	assert.NoError(t, writer.WriteHeader(&tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0600}))
+	assert.NoError(t, writer.Close())
+	evilPath := tests.CreateTestFile(t, dir, "evil.tar", evil.String())
+	err = d.RestoreBaseBackup(evilPath, nil, filepath.Join(dir, "evil"), time.Time{})
+	assert.ErrorContains(t, err, "outside of the target directory")
+}
@@ -0,0 +1,511 @@
+package tests_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/herytz/backupman/cmd/config"
+	"github.com/herytz/backupman/core/application"
+	"github.com/herytz/backupman/tests"
+	"github.com/stretchr/testify/assert"
+)
+
+const ymlLoaderBase = `
+database:
+  provider: memory
+drives:
+  - provider: local
+    label: Secure
+    folder: ./tmp/secure
+  - provider: local
+    label: Dev
+    folder: ./tmp/dev
+`
+
+func loadYml(t *testing.T, content string) (application.AppConfig, error) {
+	file := tests.CreateTestFile(t, t.TempDir(), "config.yml", content)
+	return config.LoadYml(file)
+}
+
+func TestLoadYmlMaskingAndDrives(t *testing.T) {
+	c, err := loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: postgres
+    label: Sanitized
+    drives: [Dev]
+    exclude_tables: ["sessions"]
+    masking:
+      - column: users.email
+        strategy: fake_email
+      - column: users.role
+        strategy: fixed
+        value: guest
+`)
+	assert.NoError(t, err)
+	assert.Len(t, c.DataSources, 1)
+	ds := c.DataSources[0].(application.PostgresDataSourceConfig)
+	assert.Equal(t, []string{"Dev"}, ds.Options.Drives)
+	assert.Equal(t, []string{"sessions"}, ds.TableFilter.ExcludeTables)
+	assert.Equal(t, []application.MaskingRuleConfig{
+		{Table: "users", Column: "email", Strategy: "fake_email"},
+		{Table: "users", Column: "role", Strategy: "fixed", Value: "guest"},
+	}, ds.Masking)
+}
+
+func TestLoadYmlInvalidDataSource(t *testing.T) {
+	_, err := loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: postgres
+    label: Sanitized
+    drives: [Unknown]
+`)
+	assert.ErrorContains(t, err, "unknown drive label")
+
+	_, err = loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: postgres
+    label: Sanitized
+    masking:
+      - column: email
+        strategy: fake_email
+`)
+	assert.ErrorContains(t, err, "table.column")
+
+	_, err = loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: mysql
+    label: Parallel
+    parallelism: -1
+`)
+	assert.ErrorContains(t, err, "parallelism")
+
+	_, err = loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: sqlite
+    label: Same
+  - provider: sqlite
+    label: Same
+`)
+	assert.ErrorContains(t, err, "duplicate data source label")
+}
+
+func TestLoadYmlMongodb(t *testing.T) {
+	c, err := loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: mongodb
+    label: Mongo
+    uri: mongodb://localhost:27017
+    db_name: app
+    exclude_collections: ["sessions"]
+`)
+	assert.NoError(t, err)
+	ds := c.DataSources[0].(application.MongodbDataSourceConfig)
+	assert.Equal(t, "mongodb://localhost:27017", ds.Uri)
+	assert.Equal(t, "app", ds.Database)
+	assert.Equal(t, []string{"sessions"}, ds.ExcludeCollections)
+
+	_, err = loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: mongodb
+    label: Mongo
+`)
+	assert.ErrorContains(t, err, "uri is required")
+}
+
+func TestLoadYmlDatabases(t *testing.T) {
+	c, err := loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: mysql
+    label: Tenants
+    databases: all
+  - provider: postgres
+    label: Shops
+    databases: ["shop_*", "billing"]
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*"}, c.DataSources[0].(application.MysqlDataSourceConfig).Databases)
+	assert.Equal(t, []string{"shop_*", "billing"}, c.DataSources[1].(application.PostgresDataSourceConfig).Databases)
+
+	_, err = loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: mysql
+    label: Tenants
+    db_name: app
+    databases: all
+`)
+	assert.ErrorContains(t, err, "cannot be used together")
+}
+
+func TestLoadYmlIncremental(t *testing.T) {
+	c, err := loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: mysql
+    label: Orders
+    db_name: orders
+    incremental:
+      enabled: true
+      cron: "*/15 * * * *"
+      server_id: 4201
+`)
+	assert.NoError(t, err)
+	config := c.DataSources[0].(application.MysqlDataSourceConfig)
+	assert.Equal(t, application.IncrementalConfig{Enabled: true, Cron: "*/15 * * * *"}, config.Options.Incremental)
+	assert.Equal(t, uint32(4201), config.ServerId)
+
+	_, err = loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: mysql
+    label: Orders
+    db_name: orders
+    incremental:
+      enabled: true
+      cron: "*/15 * * * *"
+`)
+	assert.ErrorContains(t, err, "server_id is required")
+
+	_, err = loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: sqlite
+    label: Local
+    db_path: ./app.db
+    incremental:
+      enabled: true
+      cron: "*/15 * * * *"
+      server_id: 4201
+`)
+	assert.ErrorContains(t, err, "not supported")
+}
+
+func TestLoadYmlPitr(t *testing.T) {
+	c, err := loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: postgres
+    label: Cluster
+    pitr:
+      enabled: true
+      pg_basebackup: /usr/lib/postgresql/17/bin/pg_basebackup
+`)
+	assert.NoError(t, err)
+	config := c.DataSources[0].(application.PostgresDataSourceConfig)
+	assert.Equal(t, application.PitrConfig{Enabled: true, PgBasebackup: "/usr/lib/postgresql/17/bin/pg_basebackup"}, config.Pitr)
+
+	_, err = loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: postgres
+    label: Cluster
+    include_tables: [users]
+    pitr:
+      enabled: true
+`)
+	assert.ErrorContains(t, err, "pitr cannot be used")
+
+	_, err = loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: mysql
+    label: Orders
+    db_name: orders
+    pitr:
+      enabled: true
+`)
+	assert.ErrorContains(t, err, "not supported")
+}
+
+func TestLoadYmlHooks(t *testing.T) {
+	c, err := loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: sqlite
+    label: App
+    db_path: app.db
+    hooks:
+      timeout: 30s
+      pre_dump: ["php", "artisan", "down"]
+      post_dump: ["php", "artisan", "up"]
+      on_failure: ["./alert.sh"]
+`)
+	assert.NoError(t, err)
+	config := c.DataSources[0].(application.SqliteDataSourceConfig)
+	assert.Equal(t, application.HooksConfig{
+		PreDump:   []string{"php", "artisan", "down"},
+		PostDump:  []string{"php", "artisan", "up"},
+		OnFailure: []string{"./alert.sh"},
+		Timeout:   30 * time.Second,
+	}, config.Options.Hooks)
+
+	_, err = loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: sqlite
+    label: App
+    db_path: app.db
+    hooks:
+      timeout: soon
+`)
+	assert.ErrorContains(t, err, "invalid hooks timeout")
+}
+
+const ymlLoaderSqlite = `
+data_sources:
+  - provider: sqlite
+    label: App
+    db_path: app.db
+`
+
+func TestLoadYmlUploadRetry(t *testing.T) {
+	c, err := loadYml(t, `
+http:
+  retry_job:
+    enabled: true
+    cron: "*/10 * * * *"
+    max_age: 12h
+database:
+  provider: memory
+drives:
+  - provider: s3
+    label: Offsite
+    bucket: backups
+    retry:
+      attempts: 5
+      initial_delay: 2s
+      max_delay: 1m
+      jitter: 0.2
+`+ymlLoaderSqlite)
+	assert.NoError(t, err)
+	assert.Equal(t, application.RetryJobConfig{
+		Enabled:     true,
+		Cron:        "*/10 * * * *",
+		MaxAge:      12 * time.Hour,
+		MaxAttempts: 10,
+	}, c.Http.RetryJob)
+	assert.Equal(t, application.RetryConfig{
+		Attempts:     5,
+		InitialDelay: 2 * time.Second,
+		MaxDelay:     time.Minute,
+		Jitter:       0.2,
+	}, c.Drives[0].(application.S3DriveConfig).Options.Retry)
+
+	_, err = loadYml(t, `
+database:
+  provider: memory
+drives:
+  - provider: local
+    label: Secure
+    folder: ./tmp/secure
+    retry:
+      jitter: 2
+`+ymlLoaderSqlite)
+	assert.ErrorContains(t, err, "jitter must be between 0 and 1")
+
+	_, err = loadYml(t, `
+http:
+  retry_job:
+    enabled: true
+`+ymlLoaderBase+ymlLoaderSqlite)
+	assert.ErrorContains(t, err, "retry_job cron is required")
+}
+
+func TestLoadYmlConcurrency(t *testing.T) {
+	c, err := loadYml(t, `
+concurrency:
+  dumps: 2
+  uploads: 4
+database:
+  provider: memory
+drives:
+  - provider: google_drive
+    label: Google
+    folder: backups
+    concurrency: 1
+  - provider: local
+    label: Secure
+    folder: ./tmp/secure
+`+ymlLoaderSqlite)
+	assert.NoError(t, err)
+	assert.Equal(t, application.ConcurrencyConfig{Dumps: 2, Uploads: 4}, c.Concurrency)
+	assert.Equal(t, 1, c.Drives[0].(application.GoogleDriveConfig).Options.Concurrency)
+	assert.Equal(t, 0, c.Drives[1].(application.LocalDriveConfig).Options.Concurrency)
+
+	_, err = loadYml(t, `
+concurrency:
+  uploads: -1
+`+ymlLoaderBase+ymlLoaderSqlite)
+	assert.ErrorContains(t, err, "concurrency dumps and uploads cannot be negative")
+}
+
+func TestLoadYmlTimeouts(t *testing.T) {
+	c, err := loadYml(t, `
+database:
+  provider: memory
+drives:
+  - provider: local
+    label: Secure
+    folder: ./tmp/secure
+    upload_timeout: 15m
+data_sources:
+  - provider: sqlite
+    label: App
+    db_path: app.db
+    dump_timeout: 1h
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, c.Drives[0].(application.LocalDriveConfig).Options.UploadTimeout)
+	assert.Equal(t, time.Hour, c.DataSources[0].(application.SqliteDataSourceConfig).Options.DumpTimeout)
+
+	_, err = loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: sqlite
+    label: App
+    db_path: app.db
+    dump_timeout: 1 hour
+`)
+	assert.ErrorContains(t, err, "data source (App): invalid dump_timeout (1 hour)")
+
+	_, err = loadYml(t, `
+database:
+  provider: memory
+drives:
+  - provider: local
+    label: Secure
+    folder: ./tmp/secure
+    upload_timeout: -1m
+`+ymlLoaderSqlite)
+	assert.ErrorContains(t, err, "drive (Secure): upload_timeout cannot be negative")
+}
+
+func TestLoadYmlStreaming(t *testing.T) {
+	c, err := loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: filesystem
+    label: Uploads
+    paths: [./uploads]
+    compression: gzip
+    streaming: true
+`)
+	assert.NoError(t, err)
+	assert.True(t, c.DataSources[0].(application.FilesystemDataSourceConfig).Options.Streaming)
+
+	c, err = loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: sqlite
+    label: App
+    db_path: app.db
+    streaming: true
+`)
+	assert.NoError(t, err)
+	assert.True(t, c.DataSources[0].(application.SqliteDataSourceConfig).Options.Streaming)
+
+	_, err = loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: mongodb
+    label: Mongo
+    uri: mongodb://localhost:27017
+    streaming: true
+`)
+	assert.ErrorContains(t, err, "data source (Mongo): streaming is not supported by mongodb provider")
+}
+
+func TestLoadYmlDedup(t *testing.T) {
+	c, err := loadYml(t, `
+database:
+  provider: memory
+drives:
+  - provider: local
+    label: Secure
+    folder: ./tmp/secure
+    dedup: true
+`+ymlLoaderSqlite)
+	assert.NoError(t, err)
+	assert.True(t, c.Drives[0].(application.LocalDriveConfig).Options.Dedup)
+
+	_, err = loadYml(t, `
+database:
+  provider: memory
+drives:
+  - provider: google_drive
+    label: Google
+    folder: demo
+    dedup: true
+`+ymlLoaderSqlite)
+	assert.ErrorContains(t, err, "drive (Google): dedup is not supported by google_drive provider")
+}
+
+func TestLoadYmlMaxFileSize(t *testing.T) {
+	c, err := loadYml(t, `
+database:
+  provider: memory
+drives:
+  - provider: google_drive
+    label: Google
+    folder: demo
+    max_file_size: 2GiB
+`+ymlLoaderSqlite)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2*1024*1024*1024), c.Drives[0].(application.GoogleDriveConfig).Options.MaxFileSize)
+
+	for value, expected := range map[string]string{
+		"big":   "drive (Google): invalid max_file_size (big)",
+		"0MB":   "drive (Google): invalid max_file_size (0MB): size must be positive",
+		"-10KB": "drive (Google): invalid max_file_size (-10KB): size must be positive",
+	} {
+		_, err = loadYml(t, `
+database:
+  provider: memory
+drives:
+  - provider: google_drive
+    label: Google
+    folder: demo
+    max_file_size: `+value+`
+`+ymlLoaderSqlite)
+		assert.ErrorContains(t, err, expected)
+	}
+
+	_, err = loadYml(t, `
+database:
+  provider: memory
+drives:
+  - provider: local
+    label: Secure
+    folder: ./tmp/secure
+    dedup: true
+    max_file_size: 500MB
+`+ymlLoaderSqlite)
+	assert.ErrorContains(t, err, "drive (Secure): max_file_size cannot be used with dedup")
+}
+
+func TestLoadYmlRedisTls(t *testing.T) {
+	c, err := loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: redis
+    label: Cache
+    host: redis.internal
+    tls: true
+    tls_ca_file: ./ca.crt
+    tls_cert_file: ./client.crt
+    tls_key_file: ./client.key
+    tls_skip_verify: true
+`)
+	assert.NoError(t, err)
+	config := c.DataSources[0].(application.RedisDataSourceConfig)
+	assert.True(t, config.Tls)
+	assert.Equal(t, "./ca.crt", config.TlsCaFile)
+	assert.Equal(t, "./client.crt", config.TlsCertFile)
+	assert.Equal(t, "./client.key", config.TlsKeyFile)
+	assert.True(t, config.TlsSkipVerify)
+
+	_, err = loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: redis
+    label: Cache
+    host: redis.internal
+    tls_ca_file: ./ca.crt
+`)
+	assert.ErrorContains(t, err, "data source (Cache): tls options require tls")
+
+	_, err = loadYml(t, ymlLoaderBase+`
+data_sources:
+  - provider: redis
+    label: Cache
+    host: redis.internal
+    tls: true
+    tls_cert_file: ./client.crt
+`)
+	assert.ErrorContains(t, err, "data source (Cache): tls_cert_file and tls_key_file must be set together")
+}